@@ -0,0 +1,187 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+
+	replPrompt = "pulsar> "
+)
+
+// localOptions are the flags of the commands running bot commands in the terminal.
+type localOptions struct {
+	userID  string
+	roles   []string
+	output  string
+	timeout time.Duration
+	yes     bool
+}
+
+func (o *localOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.userID, "user", "ULOCAL", "Slack user ID the commands are run as.")
+	cmd.Flags().StringSliceVar(&o.roles, "role", nil, "Roles of the user in addition to Base, e.g. KubernetesUser or KubernetesAdmin.")
+	cmd.Flags().StringVarP(&o.output, "output", "o", outputText, "Output format of the responses: text or json.")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", 2*time.Minute, "Time after which a command is cancelled.")
+	cmd.Flags().BoolVarP(&o.yes, "yes", "y", false, "Confirm destructive commands without asking.")
+}
+
+// newLocal returns the adapter running the commands. Logs are written to stderr to keep the output parsable.
+func (o *localOptions) newLocal(cmd *cobra.Command) (*bot.Local, error) {
+	util.SetLogOutput(cmd.ErrOrStderr())
+
+	if o.output != outputText && o.output != outputJSON {
+		return nil, fmt.Errorf("unknown output format '%s'", o.output)
+	}
+
+	roles := make([]auth.UserRole, 0, len(o.roles))
+	for _, name := range o.roles {
+		role, err := auth.ParseUserRole(name)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return bot.NewLocal(o.userID, roles, o.timeout, util.NewLogger()), nil
+}
+
+// confirmFunc returns a function asking for confirmation by reading a line from in unless --yes was given.
+func (o *localOptions) confirmFunc(in *bufio.Scanner, out io.Writer) bot.ConfirmFunc {
+	return func(description string) bool {
+		if o.yes {
+			return true
+		}
+		fmt.Fprintf(out, "%s\nContinue? [y/N] ", description)
+		if !in.Scan() {
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(in.Text()))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+func (o *localOptions) print(out io.Writer, response *slack.Msg) error {
+	if response == nil {
+		_, err := fmt.Fprintln(out, "The command responded by itself.")
+		return err
+	}
+
+	if o.output == outputJSON {
+		data, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+
+	_, err := fmt.Fprintln(out, bot.RenderText(response))
+	return err
+}
+
+func newExecCmd() *cobra.Command {
+	o := &localOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "exec <command text>",
+		Short:   "Run a single bot command without Slack",
+		Long:    "Dispatches the command text like a message to the bot and prints the response. Commands responding by themselves still require Slack.",
+		Example: `  pulsar exec "list nodes eu-de-1" --role KubernetesUser --output json`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			local, err := o.newLocal(cmd)
+			if err != nil {
+				return err
+			}
+
+			response, err := local.Exec(strings.Join(args, " "), o.confirmFunc(bufio.NewScanner(cmd.InOrStdin()), cmd.ErrOrStderr()))
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), response)
+		},
+	}
+
+	o.addFlags(cmd)
+	return cmd
+}
+
+func newReplCmd() *cobra.Command {
+	o := &localOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "repl",
+		Short: "Run bot commands interactively without Slack",
+		Long:  "Reads bot commands line by line, dispatches them like messages to the bot and prints the responses. Enter exit or quit to leave.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			local, err := o.newLocal(cmd)
+			if err != nil {
+				return err
+			}
+
+			in, out := bufio.NewScanner(cmd.InOrStdin()), cmd.OutOrStdout()
+			confirm := o.confirmFunc(in, out)
+			for {
+				fmt.Fprint(out, replPrompt)
+				if !in.Scan() {
+					fmt.Fprintln(out)
+					return in.Err()
+				}
+
+				text := strings.TrimSpace(in.Text())
+				switch text {
+				case "":
+					continue
+				case "exit", "quit":
+					return nil
+				}
+
+				response, err := local.Exec(text, confirm)
+				if err != nil {
+					fmt.Fprintf(out, "Error: %s\n", err.Error())
+					continue
+				}
+				if err := o.print(out, response); err != nil {
+					return err
+				}
+			}
+		},
+	}
+
+	o.addFlags(cmd)
+	return cmd
+}
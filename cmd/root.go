@@ -37,6 +37,7 @@ const rootCmdLongUsage = "Pulsar bot mode"
 
 func New() *cobra.Command {
 	stop := make(chan struct{})
+	var configFile string
 
 	cmd := &cobra.Command{
 		Use:          "pulsar",
@@ -44,6 +45,11 @@ func New() *cobra.Command {
 		Long:         rootCmdLongUsage,
 		SilenceUsage: true,
 		Version:      version.Print(),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if configFile != "" {
+				config.SetFile(configFile)
+			}
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			logger := util.NewLogger()
 
@@ -69,9 +75,12 @@ func New() *cobra.Command {
 				return errors.Wrap(err, "error initializing api")
 			}
 
+			go config.Watch(stop, logger)
 			go authorizer.Run(stop)
 			go a.Serve(stop)
             go a.ServeIncidentSync(stop)
+			go a.ServeHandoverAnnouncements(stop)
+			go a.ServeApprovalExpiry(stop)
 			go b.ListenAndRespond(stop)
 
 			<-stop
@@ -81,5 +90,8 @@ func New() *cobra.Command {
 		},
 	}
 
+	cmd.AddCommand(newConfigCmd(), newDoctorCmd(), newExecCmd(), newReplCmd(), newSyncCmd())
+	cmd.PersistentFlags().StringVar(&configFile, "config", "", "Path to the YAML configuration file. Defaults to $PULSAR_CONFIG_FILE.")
+
 	return cmd
 }
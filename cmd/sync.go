@@ -0,0 +1,92 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/api"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+func newSyncCmd() *cobra.Command {
+	var once, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync PagerDuty incidents with the alerts in Slack",
+		Long: "Links open PagerDuty incidents to the matching alerts in the sync channels, marks acknowledged ones and syncs thread replies and incident notes. " +
+			"Runs continuously unless --once or --dry-run is given.",
+		Example: "  pulsar sync --dry-run\n  pulsar sync --once",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dryRun {
+				// Keep the output parsable.
+				util.SetLogOutput(cmd.ErrOrStderr())
+			}
+			logger := util.NewLogger()
+
+			cfg, err := config.NewSlackConfigFromEnv()
+			if err != nil {
+				return err
+			}
+
+			authorizer, err := auth.New(cfg, logger)
+			if err != nil {
+				return errors.Wrap(err, "error initializing authorizer")
+			}
+
+			a, err := api.New(authorizer, cfg, logger)
+			if err != nil {
+				return errors.Wrap(err, "error initializing api")
+			}
+
+			if !once && !dryRun {
+				stop := make(chan struct{})
+				go config.Watch(stop, logger)
+				a.ServeIncidentSync(stop)
+				return nil
+			}
+
+			plan, err := a.PlanIncidentSync()
+			if err != nil {
+				return errors.Wrap(err, "error planning incident sync")
+			}
+			if err := plan.Report(cmd.OutOrStdout()); err != nil {
+				return err
+			}
+
+			if dryRun {
+				_, err := fmt.Fprintln(cmd.OutOrStdout(), "Dry run. Nothing was changed.")
+				return err
+			}
+			return a.ApplyIncidentSync(plan)
+		},
+	}
+
+	cmd.Flags().BoolVar(&once, "once", false, "Sync once and exit.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the planned actions and ambiguous matches without performing them. Implies --once.")
+
+	return cmd
+}
@@ -20,9 +20,11 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
+	"github.com/PagerDuty/go-pagerduty"
 	"github.com/go-kit/log/level"
 	"github.com/nlopes/slack"
 	"github.com/sapcc/pulsar/pkg/clients"
@@ -31,43 +33,31 @@ import (
 // acknowledge will:
 // 1. open a slack thread noting the acknowledger (slack user) and time
 // 2. add an emoji to the original slack message with the alert to indicate it's being worked on
-// 3. search and acknowledge the corresponding incident in pagerduty to avoid further escalation (call, etc.)
+// 3. post the runbook of the alert in the thread unless it was posted already
+// 4. search and acknowledge the corresponding incident in pagerduty to avoid further escalation (call, etc.)
 func (a *API) acknowledge(message slack.InteractionCallback) error {
-	// Post the message.
-	if _, _, err := a.slackBotClient.PostMessage(
-		message.Channel.ID,
-		slack.MsgOptionText(fmt.Sprintf(acknowledgeString, message.User.ID), false),
-		slack.MsgOptionTS(message.OriginalMessage.Timestamp),
-	); err != nil {
+	if err := a.markAcknowledged(message.Channel.ID, message.OriginalMessage.Timestamp, message.User.ID); err != nil {
 		return err
 	}
 
-	// Add reaction emoji to original message.
-	if err := a.slackBotClient.AddReactionToMessage(
-		message.Channel.ID,
-		message.OriginalMessage.Timestamp,
-		emojiFirefighter,
-	); err != nil {
-		return err
+	summary := ""
+	if len(message.OriginalMessage.Attachments) > 0 {
+		summary = message.OriginalMessage.Attachments[0].Text
 	}
-
-	slackUser, err := a.slackBotClient.GetUserByID(message.User.ID)
-	if err != nil {
-		level.Error(a.logger).Log("msg", "cannot find slack user", "err", err.Error())
-		return err
+	if err := a.postRunbook(message.Channel.ID, &message.OriginalMessage, summary); err != nil {
+		level.Error(a.logger).Log("msg", "failed to post runbook", "channel", message.Channel.ID, "err", err.Error())
 	}
 
-	// Find the corresponding pagerduty user.
-	user, err := a.pdClient.GetUserByEmail(slackUser.Profile.Email)
+	slackUser, user, err := a.acknowledger(message.User.ID)
 	if err != nil {
-		level.Info(a.logger).Log("msg", "failed to find pagerduty user. falling back to default user", "err", err.Error())
-		user = a.pdClient.GetDefaultUser()
+		return err
 	}
 
 	if len(message.OriginalMessage.Attachments) == 0 || message.OriginalMessage.Attachments[0].Text == "" {
 		return errors.New("slack message structure doesn't fit")
 	}
 
+	ctx := context.Background()
 	f := &clients.Filter{}
 	for _, msgAttachment := range message.OriginalMessage.Attachments {
 		if f.ClusterFilterFromText(msgAttachment.Text) != nil ||
@@ -75,22 +65,80 @@ func (a *API) acknowledge(message slack.InteractionCallback) error {
 			return errors.New("slack message parsing for alertname and cluster failed")
 		}
 
-		incident, err := a.pdClient.GetIncident(f)
+		incident, err := a.pdClient.GetIncident(ctx, f)
 		if err != nil {
 			return err
 		}
 
-		if incident.Status == clients.IncidentStatusTriggered {
-			_, err = a.pdClient.AcknowledgeIncident(incident.ID, user)
-			if err != nil {
-				return err
-			}
+		if err := a.acknowledgeIncident(ctx, incident, slackUser, user); err != nil {
+			return err
 		}
 
-		if user.ID == a.pdClient.GetDefaultUser().ID {
-			_, err = a.pdClient.AddActualAcknowledgerAsNoteToIncident(incident.ID, slackUser.Name)
+		isDefaultUser, err := a.isDefaultUser(ctx, user)
+		if err != nil || isDefaultUser {
 			return err
 		}
 	}
 	return nil
 }
+
+// markAcknowledged posts the acknowledging user in the thread of the message and adds the firefighter emoji to it.
+func (a *API) markAcknowledged(channelID, timestamp, userID string) error {
+	// Post the message.
+	if _, _, err := a.slackBotClient.PostMessage(
+		channelID,
+		slack.MsgOptionText(fmt.Sprintf(acknowledgeString, userID), false),
+		slack.MsgOptionTS(timestamp),
+	); err != nil {
+		return err
+	}
+
+	// Add reaction emoji to original message.
+	return a.slackBotClient.AddReactionToMessage(channelID, timestamp, emojiFirefighter)
+}
+
+// acknowledger returns the Slack user and the PagerDuty user with the same email, falling back to the default user.
+func (a *API) acknowledger(userID string) (*slack.User, *pagerduty.User, error) {
+	slackUser, err := a.slackBotClient.GetUserByID(userID)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "cannot find slack user", "err", err.Error())
+		return nil, nil, err
+	}
+
+	// Find the corresponding pagerduty user.
+	user, err := a.pdClient.GetUserByEmail(context.Background(), slackUser.Profile.Email)
+	if err != nil {
+		level.Info(a.logger).Log("msg", "failed to find pagerduty user. falling back to default user", "err", err.Error())
+		if user, err = a.pdClient.GetDefaultUser(context.Background()); err != nil {
+			return nil, nil, err
+		}
+	}
+	return slackUser, user, nil
+}
+
+// isDefaultUser returns whether the user is the pagerduty default user.
+func (a *API) isDefaultUser(ctx context.Context, user *pagerduty.User) (bool, error) {
+	defaultUser, err := a.pdClient.GetDefaultUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	return user.ID == defaultUser.ID, nil
+}
+
+// acknowledgeIncident acknowledges the incident on behalf of the user unless it was acknowledged already.
+// If the default user is used, the actual acknowledger is added as note.
+func (a *API) acknowledgeIncident(ctx context.Context, incident *pagerduty.Incident, slackUser *slack.User, user *pagerduty.User) error {
+	if incident.Status == clients.IncidentStatusTriggered {
+		if _, err := a.pdClient.AcknowledgeIncident(ctx, incident.ID, user); err != nil {
+			return err
+		}
+	}
+
+	isDefaultUser, err := a.isDefaultUser(ctx, user)
+	if err != nil || !isDefaultUser {
+		return err
+	}
+
+	_, err = a.pdClient.AddActualAcknowledgerAsNoteToIncident(ctx, incident.ID, slackUser.Name)
+	return err
+}
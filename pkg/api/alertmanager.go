@@ -0,0 +1,238 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+)
+
+// alertMessageTTL is the time after which the message of an alert group without notifications is forgotten.
+// The Alertmanager repeats notifications of firing groups within its repeat interval, which defaults to 4h.
+// Forgotten messages are looked up in the channel history.
+const alertMessageTTL = 24 * time.Hour
+
+// alertMessage is the message posted for an alert group.
+type alertMessage struct {
+	channelID,
+	timestamp string
+	resolved bool
+	updated  time.Time
+
+	// busy is closed once the notification posting or updating the message is done.
+	busy chan struct{}
+}
+
+// handleAlertmanagerWebhook posts the notifications of the Alertmanager in the channel of their receiver.
+// Notifications of the same group update the message of the group unless it was resolved before.
+func (a *API) handleAlertmanagerWebhook(w http.ResponseWriter, r *http.Request) {
+	// The token is required if receiver channels are configured. Without either, there is nothing to post.
+	token := a.amCfg.WebhookToken
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		level.Info(a.logger).Log("msg", "rejecting alertmanager notification with invalid token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var group models.AlertGroup
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		level.Error(a.logger).Log("msg", "error decoding alertmanager notification", "err", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	channelID, ok := a.amCfg.ChannelForReceiver(group.Receiver)
+	if !ok {
+		level.Error(a.logger).Log("msg", "no channel configured for alertmanager receiver", "receiver", group.Receiver)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The Alertmanager retries on server errors.
+	if err := a.notifyAlertGroup(channelID, &group); err != nil {
+		level.Error(a.logger).Log("msg", "error posting alert group", "receiver", group.Receiver, "channel", channelID, "err", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// notifyAlertGroup posts the alert group or updates its message.
+// The messages of groups are remembered until the group resolves or the alertMessageTTL passed.
+func (a *API) notifyAlertGroup(channelID string, group *models.AlertGroup) error {
+	key := group.Key()
+	msg := group.ToSlackMessage()
+	options := []slack.MsgOption{slack.MsgOptionText(msg.Text, false), slack.MsgOptionBlocks(msg.Blocks.BlockSet...)}
+
+	existing, ok := a.reserveAlertMessage(key)
+	// What was remembered is kept unless the message is posted or updated below.
+	remembered, keep := existing, ok
+	defer func() { a.releaseAlertMessage(key, remembered, keep) }()
+
+	if !ok {
+		existing, ok = a.findAlertMessage(channelID, key)
+	}
+	isSameChannel := ok && existing.channelID == channelID
+
+	// Repeated notifications of resolved groups are ignored.
+	if isSameChannel && existing.resolved && group.IsResolved() {
+		level.Debug(a.logger).Log("msg", "alert group already resolved", "channel", channelID, "timestamp", existing.timestamp)
+		return nil
+	}
+
+	// Alerts firing again after the group was resolved get a new message.
+	if isSameChannel && !existing.resolved {
+		if _, _, _, err := a.slackBotClient.UpdateMessage(channelID, existing.timestamp, options...); err != nil {
+			return errors.Wrap(err, "failed to update alert message")
+		}
+		remembered, keep = newAlertMessage(channelID, existing.timestamp, group)
+		level.Debug(a.logger).Log("msg", "updated alert message", "channel", channelID, "timestamp", existing.timestamp, "status", group.Status)
+		return nil
+	}
+
+	_, timestamp, err := a.slackBotClient.PostMessage(channelID, options...)
+	if err != nil {
+		return errors.Wrap(err, "failed to post alert message")
+	}
+	remembered, keep = newAlertMessage(channelID, timestamp, group)
+	level.Debug(a.logger).Log("msg", "posted alert message", "channel", channelID, "timestamp", timestamp, "status", group.Status)
+	return nil
+}
+
+// newAlertMessage returns the message to remember for the alert group and false once the group resolved, so it is forgotten.
+func newAlertMessage(channelID, timestamp string, group *models.AlertGroup) (alertMessage, bool) {
+	return alertMessage{channelID: channelID, timestamp: timestamp, updated: time.Now()}, !group.IsResolved()
+}
+
+// reserveAlertMessage returns the remembered message of the alert group, if any, and reserves it until
+// releaseAlertMessage is called. Notifications of the same group wait for each other while Slack is called
+// without holding the alertMessagesMtx.
+func (a *API) reserveAlertMessage(key string) (alertMessage, bool) {
+	for {
+		a.alertMessagesMtx.Lock()
+		a.removeExpiredAlertMessages()
+		existing, ok := a.alertMessages[key]
+		if ok && existing.busy != nil {
+			busy := existing.busy
+			a.alertMessagesMtx.Unlock()
+			<-busy
+			continue
+		}
+
+		reserved := existing
+		reserved.busy = make(chan struct{})
+		a.alertMessages[key] = reserved
+		a.alertMessagesMtx.Unlock()
+		return existing, ok
+	}
+}
+
+// releaseAlertMessage remembers the message of the alert group reserved by reserveAlertMessage or forgets it
+// unless keep is true and lets waiting notifications of the group continue.
+func (a *API) releaseAlertMessage(key string, msg alertMessage, keep bool) {
+	a.alertMessagesMtx.Lock()
+	defer a.alertMessagesMtx.Unlock()
+
+	busy := a.alertMessages[key].busy
+	if keep {
+		msg.busy = nil
+		a.alertMessages[key] = msg
+	} else {
+		delete(a.alertMessages, key)
+	}
+	if busy != nil {
+		close(busy)
+	}
+}
+
+// removeExpiredAlertMessages forgets the messages of groups without notifications within the alertMessageTTL.
+// Reserved messages are kept. The caller must hold the alertMessagesMtx.
+func (a *API) removeExpiredAlertMessages() {
+	for key, msg := range a.alertMessages {
+		if msg.busy == nil && time.Since(msg.updated) > alertMessageTTL {
+			delete(a.alertMessages, key)
+		}
+	}
+}
+
+// findAlertMessage looks up the latest message of the alert group in the channel history, e.g. after a restart.
+func (a *API) findAlertMessage(channelID, key string) (alertMessage, bool) {
+	h, err := a.slackClient.GetConversationHistory(channelID)
+	if err != nil {
+		level.Info(a.logger).Log("msg", "failed to get channel history. posting a new alert message", "channel", channelID, "err", err.Error())
+		return alertMessage{}, false
+	}
+
+	// The history is sorted newest first.
+	for i := range h.Messages {
+		if k, ok := models.AlertGroupKey(&h.Messages[i]); ok && k == key {
+			return alertMessage{channelID: channelID, timestamp: h.Messages[i].Timestamp, resolved: models.IsResolvedAlertGroup(&h.Messages[i])}, true
+		}
+	}
+	return alertMessage{}, false
+}
+
+// acknowledgeAlert acknowledges the incident of the alert group given by the value of the button on behalf of the user
+// and posts the runbook of the group in its thread.
+// The interaction is acknowledged right away while PagerDuty and Slack are called in the background.
+func (a *API) acknowledgeAlert(message slack.InteractionCallback, act *slack.BlockAction) error {
+	channelID, timestamp := message.Channel.ID, message.Message.Timestamp
+	go func() {
+		if err := a.acknowledgeAlertIncident(context.Background(), message.User.ID, act.Value); err != nil {
+			level.Error(a.logger).Log("msg", "failed to acknowledge alert", "incidentKey", act.Value, "userID", message.User.ID, "err", err.Error())
+			a.postInThread(channelID, timestamp, &slack.Msg{Text: fmt.Sprintf("Failed to acknowledge the incident :x:\n```\n%s\n```", err.Error())})
+			return
+		}
+
+		if err := a.markAcknowledged(channelID, timestamp, message.User.ID); err != nil {
+			level.Error(a.logger).Log("msg", "failed to mark alert as acknowledged", "channel", channelID, "err", err.Error())
+		}
+		if err := a.postRunbook(channelID, &message.Message, message.Message.Text); err != nil {
+			level.Error(a.logger).Log("msg", "failed to post runbook", "channel", channelID, "err", err.Error())
+		}
+	}()
+	return nil
+}
+
+// acknowledgeAlertIncident acknowledges the incident with the given key on behalf of the Slack user.
+func (a *API) acknowledgeAlertIncident(ctx context.Context, userID, incidentKey string) error {
+	incident, err := a.pdClient.GetIncidentByKey(ctx, incidentKey)
+	if err != nil {
+		return err
+	}
+
+	slackUser, user, err := a.acknowledger(userID)
+	if err != nil {
+		return err
+	}
+	return a.acknowledgeIncident(ctx, incident, slackUser, user)
+}
@@ -0,0 +1,176 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAlertGroup(status string, alertStatuses ...string) models.AlertGroup {
+	g := models.AlertGroup{
+		Version:           "4",
+		GroupKey:          `{}:{alertname="OpenstackLbaasApiFlapping"}`,
+		Status:            status,
+		Receiver:          "slack-alerts",
+		GroupLabels:       map[string]string{"alertname": "OpenstackLbaasApiFlapping"},
+		CommonLabels:      map[string]string{"alertname": "OpenstackLbaasApiFlapping", "region": "eu-de-1"},
+		CommonAnnotations: map[string]string{"summary": "lbaas API flapping", "runbook_url": "https://runbooks.example.com/lbaas"},
+	}
+	for i, s := range alertStatuses {
+		g.Alerts = append(g.Alerts, models.Alert{
+			Status:      s,
+			Labels:      map[string]string{"alertname": "OpenstackLbaasApiFlapping", "region": "eu-de-1"},
+			Annotations: map[string]string{"summary": "lbaas API flapping"},
+			Fingerprint: string(rune('a'+i)) + "0c1f",
+		})
+	}
+	return g
+}
+
+func (s *scenario) notify(t *testing.T, token string, group models.AlertGroup) int {
+	body, err := json.Marshal(group)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/alertmanager", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	s.api.handleAlertmanagerWebhook(rec, req)
+	return rec.Code
+}
+
+func TestScenarioAlertmanagerWebhook(t *testing.T) {
+	s := newScenario(t)
+	firing := newAlertGroup(models.AlertStatusFiring, models.AlertStatusFiring, models.AlertStatusFiring)
+	incident := s.pagerduty.TriggerIncidentWithKey(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping", firing.Key())
+
+	assert.Equal(t, http.StatusUnauthorized, s.notify(t, "wrong", firing), "notifications with an invalid token should be rejected")
+	assert.Empty(t, s.slack.Messages(scenarioChannelID), "nothing should be posted for rejected notifications")
+
+	// The first notification is posted with the key of the group.
+	assert.Equal(t, http.StatusOK, s.notify(t, scenarioWebhookToken, firing))
+	messages := s.slack.Messages(scenarioChannelID)
+	require.Len(t, messages, 1, "the alert group should be posted")
+	alertTS := messages[0].Timestamp
+	assert.Equal(t, "[FIRING:2] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping", messages[0].Text)
+	key, ok := models.AlertGroupKey(&messages[0])
+	assert.True(t, ok, "the message should carry the key of the group")
+	assert.Equal(t, firing.Key(), key)
+
+	// The user acknowledges the incident of the group.
+	err := s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, alertTS, scenarioUserID, models.ActionIDAlertAcknowledge, firing.Key())
+	require.NoError(t, err, "there should be no error clicking the acknowledge button")
+	require.Eventually(t, func() bool { return len(s.slack.Reactions(scenarioChannelID, alertTS)) == 2 }, time.Second, 10*time.Millisecond,
+		"the acknowledgement should be handled in the background")
+	incident, _ = s.pagerduty.Incident(incident.ID)
+	assert.Equal(t, "acknowledged", incident.Status, "the incident of the group should be acknowledged")
+	assert.Equal(t, []string{emojiFirefighter, emojiRunbook}, s.slack.Reactions(scenarioChannelID, alertTS), "the alert should be marked as acknowledged")
+	replies := s.slack.Replies(scenarioChannelID, alertTS)
+	if assert.Len(t, replies, 2, "the acknowledgement and the runbook should be posted in the thread") {
+		assert.Equal(t, ":book: Runbook for *OpenstackLbaasApiFlapping*: https://runbooks.example.com/lbaas", replies[1].Text, "the runbook annotation should be linked")
+	}
+
+	// The sync matches the message by the key of the group.
+	plan, err := s.api.PlanIncidentSync()
+	require.NoError(t, err)
+	if assert.NotEmpty(t, plan.Actions, "the message of the group should be linked to its incident") {
+		assert.Equal(t, SyncActionPostLink, plan.Actions[0].Type)
+		assert.Equal(t, alertTS, plan.Actions[0].Timestamp)
+	}
+	for _, action := range plan.Actions {
+		assert.NotEqual(t, SyncActionPostRunbook, action.Type, "the runbook should not be posted twice")
+	}
+
+	// Later notifications update the message, also after a restart.
+	s.api.alertMessages = make(map[string]alertMessage)
+	assert.Equal(t, http.StatusOK, s.notify(t, scenarioWebhookToken, newAlertGroup(models.AlertStatusFiring, models.AlertStatusFiring, models.AlertStatusResolved)))
+	assert.Equal(t, http.StatusOK, s.notify(t, scenarioWebhookToken, newAlertGroup(models.AlertStatusResolved, models.AlertStatusResolved, models.AlertStatusResolved)))
+	messages = s.slack.Messages(scenarioChannelID)
+	require.Len(t, messages, 1, "the message of the group should be updated")
+	assert.Equal(t, "[RESOLVED] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping", messages[0].Text)
+	assert.Empty(t, s.api.alertMessages, "the message of the resolved group should be forgotten")
+
+	// Repeated notifications of the resolved group are ignored.
+	assert.Equal(t, http.StatusOK, s.notify(t, scenarioWebhookToken, newAlertGroup(models.AlertStatusResolved, models.AlertStatusResolved, models.AlertStatusResolved)))
+	assert.Len(t, s.slack.Messages(scenarioChannelID), 1, "nothing should be posted for the resolved group")
+
+	// Alerts firing again get a new message.
+	assert.Equal(t, http.StatusOK, s.notify(t, scenarioWebhookToken, firing))
+	assert.Len(t, s.slack.Messages(scenarioChannelID), 2, "a new message should be posted after the group was resolved")
+}
+
+func TestScenarioAlertmanagerWebhookConcurrent(t *testing.T) {
+	s := newScenario(t)
+	firing := newAlertGroup(models.AlertStatusFiring, models.AlertStatusFiring)
+
+	// Concurrent notifications of the same group wait for each other, so the group is posted once.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		group := firing
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.api.notifyAlertGroup(scenarioChannelID, &group), "there should be no error posting the alert group")
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, s.slack.Messages(scenarioChannelID), 1, "the alert group should be posted once")
+	if assert.Contains(t, s.api.alertMessages, firing.Key(), "the message of the firing group should be remembered") {
+		assert.Nil(t, s.api.alertMessages[firing.Key()].busy, "the message should not stay reserved")
+	}
+}
+
+func TestScenarioAlertmanagerWebhookExpiredMessages(t *testing.T) {
+	s := newScenario(t)
+	firing := newAlertGroup(models.AlertStatusFiring, models.AlertStatusFiring)
+	s.api.alertMessages["expired"] = alertMessage{channelID: scenarioChannelID, timestamp: "1", updated: time.Now().Add(-alertMessageTTL - time.Minute)}
+
+	assert.Equal(t, http.StatusOK, s.notify(t, scenarioWebhookToken, firing))
+	require.Len(t, s.api.alertMessages, 1, "messages without notifications within the TTL should be forgotten")
+	assert.Contains(t, s.api.alertMessages, firing.Key(), "the message of the firing group should be remembered")
+}
+
+func TestScenarioAlertmanagerWebhookWithoutToken(t *testing.T) {
+	s := newScenario(t)
+	s.api.amCfg = &config.AlertmanagerConfig{ReceiverChannels: map[string]string{"slack-alerts": scenarioChannelID}}
+
+	assert.Equal(t, http.StatusUnauthorized, s.notify(t, "", newAlertGroup(models.AlertStatusFiring, models.AlertStatusFiring)), "notifications should be rejected without a token")
+	assert.Empty(t, s.slack.Messages(scenarioChannelID))
+}
+
+func TestScenarioAlertmanagerWebhookUnknownReceiver(t *testing.T) {
+	s := newScenario(t)
+	group := newAlertGroup(models.AlertStatusFiring, models.AlertStatusFiring)
+	group.Receiver = "unknown"
+
+	assert.Equal(t, http.StatusBadRequest, s.notify(t, scenarioWebhookToken, group), "notifications of unknown receivers should be rejected")
+	assert.Empty(t, s.slack.Messages(scenarioChannelID))
+}
@@ -0,0 +1,130 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/robfig/cron"
+	"github.com/sapcc/pulsar/pkg/bot"
+)
+
+// resolveConfirmation handles a click on the buttons of a pending action and records the decision.
+// Slack expects the interaction to be acknowledged within 3 seconds, so the decision is posted in the thread,
+// the prompt is updated and the action runs once it was confirmed and, if required, approved after the acknowledgement.
+// The action is no longer pending once it is ready, so further clicks are rejected.
+func (a *API) resolveConfirmation(message slack.InteractionCallback, act *slack.BlockAction) error {
+	pending, ready, err := bot.Decide(act.Value, act.ActionID, message.User.ID, a.authorizer.IsUserAuthorized)
+	if err != nil {
+		threadTimestamp := message.Message.ThreadTimestamp
+		if threadTimestamp == "" {
+			threadTimestamp = message.Message.Timestamp
+		}
+		go a.postInThread(message.Channel.ID, threadTimestamp, &slack.Msg{Text: err.Error()})
+		return nil
+	}
+
+	level.Info(a.logger).Log("msg", "audit", "decision", pending.LastDecision().Decision, "actionID", pending.ID, "userID", message.User.ID, "requesterID", pending.UserID, "action", pending.Description)
+	go a.runPendingAction(pending, ready)
+	return nil
+}
+
+// runPendingAction posts the last decision about the action in its thread, updates the prompt and,
+// if the action is ready, runs it and reports the outcome in the thread.
+func (a *API) runPendingAction(pending *bot.PendingAction, ready bool) {
+	a.postInThread(pending.ChannelID, pending.ThreadTimestamp, &slack.Msg{Text: fmt.Sprintf("%s %s", pending.Description, pending.LastDecision().String())})
+	if err := a.replaceMessage(pending.ChannelID, pending.Timestamp, pending.ToSlackMessage()); err != nil {
+		level.Error(a.logger).Log("msg", "failed to update prompt", "actionID", pending.ID, "err", err.Error())
+	}
+
+	if !ready {
+		return
+	}
+
+	response, err := pending.Run()
+	pending.Finish(err)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "audit", "decision", bot.DecisionFailed, "actionID", pending.ID, "requesterID", pending.UserID, "action", pending.Description, "err", err.Error())
+		response = &slack.Msg{Text: fmt.Sprintf("%s failed :x:\n```\n%s\n```", pending.Description, err.Error())}
+	} else {
+		level.Info(a.logger).Log("msg", "audit", "decision", bot.DecisionExecuted, "actionID", pending.ID, "requesterID", pending.UserID, "action", pending.Description)
+	}
+
+	if err := a.replaceMessage(pending.ChannelID, pending.Timestamp, pending.ToSlackMessage()); err != nil {
+		level.Error(a.logger).Log("msg", "failed to update prompt", "actionID", pending.ID, "err", err.Error())
+	}
+
+	// The action already responded by itself.
+	if response == nil {
+		return
+	}
+	a.postInThread(pending.ChannelID, pending.ThreadTimestamp, response)
+}
+
+// ServeApprovalExpiry periodically expires pending actions and updates their prompts.
+func (a *API) ServeApprovalExpiry(stop <-chan struct{}) {
+	c := cron.New()
+	c.AddFunc("@every 1m", a.expireApprovals)
+	go c.Start()
+	<-stop
+	c.Stop()
+}
+
+func (a *API) expireApprovals() {
+	for _, pending := range bot.ExpireActions() {
+		level.Info(a.logger).Log("msg", "audit", "decision", bot.DecisionExpired, "actionID", pending.ID, "requesterID", pending.UserID, "action", pending.Description)
+		if err := a.replaceMessage(pending.ChannelID, pending.Timestamp, pending.ToSlackMessage()); err != nil {
+			level.Error(a.logger).Log("msg", "failed to update expired action", "actionID", pending.ID, "err", err.Error())
+		}
+	}
+}
+
+// postInThread posts the message in the thread and logs failures.
+func (a *API) postInThread(channelID, threadTimestamp string, msg *slack.Msg) {
+	options := []slack.MsgOption{slack.MsgOptionText(msg.Text, false), slack.MsgOptionTS(threadTimestamp)}
+	if len(msg.Blocks.BlockSet) > 0 {
+		options = append(options, slack.MsgOptionBlocks(msg.Blocks.BlockSet...))
+	}
+	if len(msg.Attachments) > 0 {
+		options = append(options, slack.MsgOptionAttachments(msg.Attachments...))
+	}
+
+	if _, _, err := a.slackBotClient.PostMessage(channelID, options...); err != nil {
+		level.Error(a.logger).Log("msg", "failed to post in thread", "channelID", channelID, "err", err.Error())
+	}
+}
+
+// replaceMessage replaces text and blocks of an existing message.
+func (a *API) replaceMessage(channelID, timestamp string, msg *slack.Msg) error {
+	blocks := msg.Blocks.BlockSet
+	if len(blocks) == 0 {
+		blocks = []slack.Block{slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, msg.Text, false, false), nil, nil)}
+	}
+
+	_, _, _, err := a.slackBotClient.UpdateMessage(
+		channelID,
+		timestamp,
+		slack.MsgOptionText(msg.Text, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	return err
+}
@@ -0,0 +1,76 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hasReply reports whether a reply in the thread contains the text.
+func hasReply(s *scenario, threadTimestamp, text string) bool {
+	for _, reply := range s.slack.Replies(scenarioChannelID, threadTimestamp) {
+		if strings.Contains(reply.Text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestScenarioConfirmAction(t *testing.T) {
+	s := newScenario(t)
+
+	threadTS := s.slack.SendMessage(scenarioChannelID, "", scenarioUserID, "scale deployment kube-system/coredns 3")
+	promptTS := s.slack.SendMessage(scenarioChannelID, threadTS, fake.SlackBotID, "Working on it")
+
+	var runs int32
+	prompt, err := bot.RequestApproval(scenarioUserID, "scale deployment kube-system/coredns", "", scenarioChannelID, promptTS, threadTS, func() (*slack.Msg, error) {
+		atomic.AddInt32(&runs, 1)
+		return &slack.Msg{Text: "scaled deployment kube-system/coredns"}, nil
+	})
+	require.NoError(t, err, "there should be no error requesting the approval")
+	actionID := buttonValue(t, slack.Message{Msg: *prompt}, bot.ActionIDConfirm)
+
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, promptTS, scenarioGuestID, bot.ActionIDConfirm, actionID))
+	assert.Eventually(t, func() bool { return hasReply(s, threadTS, "only <@UALICE> can confirm") }, time.Second, 10*time.Millisecond,
+		"others should not be able to confirm the action")
+
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, promptTS, scenarioUserID, bot.ActionIDConfirm, actionID))
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, promptTS, scenarioUserID, bot.ActionIDConfirm, actionID))
+	assert.Eventually(t, func() bool { return hasReply(s, threadTS, "scaled deployment kube-system/coredns") }, time.Second, 10*time.Millisecond,
+		"the result of the action should be posted in the thread")
+	assert.True(t, hasReply(s, threadTS, "scale deployment kube-system/coredns confirmed by <@UALICE> at"), "the decision should be posted in the thread")
+	assert.Eventually(t, func() bool { return hasReply(s, threadTS, "the action expired or was already handled") }, time.Second, 10*time.Millisecond,
+		"the second click should be rejected")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs), "the action should run once")
+
+	assert.Eventually(t, func() bool {
+		msg, _ := s.slack.Message(scenarioChannelID, promptTS)
+		return msg.Text == "scale deployment kube-system/coredns executed :white_check_mark:"
+	}, time.Second, 10*time.Millisecond, "the prompt should show the outcome")
+}
@@ -20,21 +20,29 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/PagerDuty/go-pagerduty"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/gorilla/mux"
 	"github.com/nlopes/slack"
 	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
 	"github.com/sapcc/pulsar/pkg/clients"
 	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+	"github.com/sapcc/pulsar/pkg/util"
 
     "github.com/robfig/cron"
 )
@@ -46,17 +54,47 @@ const (
 	actionValueAcknowledge = "acknowledge"
 	acknowledgeString      = "Acknowledged by <@%s>"
 	emojiFirefighter       = "male-firefighter"
-    emojiPagerDuty         = "pagerduty"
+	emojiPagerDuty         = "pagerduty"
+	emojiRunbook           = "book"
 )
 
 // API ...
 type API struct {
-	authorizer  *auth.Authorizer
+	authorizer     *auth.Authorizer
 	slackBotClient *clients.SlackClient
-    slackClient *clients.SlackClient
-	pdClient    *clients.PagerdutyClient
-	cfg         *config.SlackConfig
-	logger      log.Logger
+	slackClient    *clients.SlackClient
+	pdClient       *clients.PagerdutyClient
+	cfg            *config.SlackConfig
+	pdCfg          *config.PagerdutyConfig
+	amCfg          *config.AlertmanagerConfig
+	amClient       *clients.AlertmanagerClient
+	runbooks       *config.RunbookCatalog
+	logger         log.Logger
+
+	// silenceAdminRole is the role of the users who may expire silences created by others.
+	silenceAdminRole auth.UserRole
+
+	// alertMessages are the messages posted for alert groups by the hash of their group key.
+	alertMessages    map[string]alertMessage
+	alertMessagesMtx sync.Mutex
+
+	// onCallUsers remembers the on-call users per handover channel and schedule to detect handovers.
+	onCallUsers    map[string][]pagerduty.User
+	onCallUsersMtx sync.Mutex
+
+	// pagedMessages are the pages sent by the channel and timestamp of the message, so repeated clicks are ignored.
+	pagedMessages    map[string]pagedMessage
+	pagedMessagesMtx sync.Mutex
+
+	// watchCtx is cancelled once the API stops serving, which ends the watchers of paged incidents.
+	watchCtx    context.Context
+	stopWatches context.CancelFunc
+
+	// noteReplyCounts are the reply counts of the alert threads by incident and lastNoteSync the start of the last
+	// incident sync applied successfully. The notes of threads and incidents without activity since are not synced again.
+	noteReplyCounts map[string]int
+	lastNoteSync    time.Time
+	noteSyncMtx     sync.Mutex
 }
 
 // New returns a new API or an error.
@@ -71,26 +109,63 @@ func New(authorizer *auth.Authorizer, cfg *config.SlackConfig, logger log.Logger
 		return nil, err
 	}
 
-	pdClient, err := clients.NewPagerdutyClientFromEnv()
+	pdCfg, err := config.NewPagerdutyConfigFromEnv()
 	if err != nil {
 		return nil, err
 	}
 
+	pdClient, err := clients.NewPagerdutyClient(pdCfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	amCfg, err := config.NewAlertmanagerConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var silenceAdminRole auth.UserRole
+	if amCfg.SilenceAdminRole != "" {
+		if silenceAdminRole, err = auth.ParseUserRole(amCfg.SilenceAdminRole); err != nil {
+			return nil, err
+		}
+	}
+
+	runbooks, err := config.NewRunbookCatalogFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	watchCtx, stopWatches := context.WithCancel(context.Background())
+
 	return &API{
-		logger:      log.With(logger, "component", "api"),
-		authorizer:  authorizer,
-		cfg:         cfg,
-		slackBotClient: slackBotClient,
-        slackClient: slackClient,
-		pdClient:    pdClient,
+		logger:           log.With(logger, "component", "api"),
+		authorizer:       authorizer,
+		cfg:              cfg,
+		pdCfg:            pdCfg,
+		amCfg:            amCfg,
+		amClient:         clients.NewAlertmanagerClient(amCfg, logger),
+		runbooks:         runbooks,
+		slackBotClient:   slackBotClient,
+		slackClient:      slackClient,
+		pdClient:         pdClient,
+		onCallUsers:      make(map[string][]pagerduty.User),
+		alertMessages:    make(map[string]alertMessage),
+		silenceAdminRole: silenceAdminRole,
+		pagedMessages:    make(map[string]pagedMessage),
+		watchCtx:         watchCtx,
+		stopWatches:      stopWatches,
 	}, nil
 }
 
 // Serve ...
 func (a *API) Serve(stop <-chan struct{}) {
+	defer a.stopWatches()
+
 	router := mux.NewRouter().StrictSlash(true)
 	router.HandleFunc("/", a.home)
 	router.HandleFunc("/interaction", a.handleInteraction).Methods(http.MethodPost)
+	router.HandleFunc("/alertmanager", a.handleAlertmanagerWebhook).Methods(http.MethodPost)
 
 	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", a.cfg.APIHost, a.cfg.APIPort))
 	if err != nil {
@@ -101,6 +176,21 @@ func (a *API) Serve(stop <-chan struct{}) {
 
 	level.Info(a.logger).Log("msg", "serving API", "host", a.cfg.APIHost, "port", a.cfg.APIPort)
 	go http.Serve(ln, router)
+
+	// The counters, memory statistics and command line are only served on the internal debug listener.
+	if a.cfg.DebugAddress != "" {
+		debugRouter := mux.NewRouter()
+		debugRouter.Handle("/debug/vars", expvar.Handler())
+
+		// The debug listener is optional, so failing to create it must not take down the API.
+		if debugLn, err := net.Listen("tcp", a.cfg.DebugAddress); err != nil {
+			level.Error(a.logger).Log("msg", "error creating debug listener. not serving debug variables", "address", a.cfg.DebugAddress, "err", err.Error())
+		} else {
+			defer debugLn.Close()
+			level.Info(a.logger).Log("msg", "serving debug variables", "address", a.cfg.DebugAddress)
+			go http.Serve(debugLn, debugRouter)
+		}
+	}
 	<-stop
 }
 
@@ -167,6 +257,12 @@ func (a *API) handleInteraction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Slack expects validation errors of dialogs in the response.
+	if message.Type == slack.InteractionTypeDialogSubmission {
+		a.handleDialogSubmission(w, message)
+		return
+	}
+
 	if err := a.handleInteractionCallback(message); err != nil {
 		level.Error(a.logger).Log("msg", "error handling message", "err", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -190,5 +286,22 @@ func (a *API) handleInteractionCallback(message slack.InteractionCallback) error
 		}
 	}
 
+	for _, act := range actionCallbacks.BlockActions {
+		switch act.ActionID {
+		case bot.ActionIDConfirm, bot.ActionIDCancel, bot.ActionIDApprove, bot.ActionIDReject:
+			return a.resolveConfirmation(message, act)
+		case models.ActionIDPage:
+			return a.page(message)
+		case models.ActionIDAlertAcknowledge:
+			return a.acknowledgeAlert(message, act)
+		case models.ActionIDAlertSilence:
+			return a.openSilenceDialog(message, act)
+		case models.ActionIDSilenceExpire:
+			return a.expireSilence(message, act)
+		case util.ActionIDTablePage:
+			return a.paginateTable(message, act)
+		}
+	}
+
 	return nil
 }
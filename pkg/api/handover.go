@@ -0,0 +1,194 @@
+/*******************************************************************************
+*
+* Copyright 2023 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/robfig/cron"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+// maxHandoverIncidents is the maximal number of open incidents listed in a handover announcement.
+const maxHandoverIncidents = 20
+
+// ServeHandoverAnnouncements periodically checks the configured schedules and
+// announces shift handovers in the corresponding channels.
+func (a *API) ServeHandoverAnnouncements(stop <-chan struct{}) {
+	if len(a.pdCfg.Handovers()) == 0 {
+		level.Info(a.logger).Log("msg", "no handover channels configured yet. announcing on-call handovers once configured")
+	}
+
+	a.announceHandovers()
+	c := cron.New()
+	c.AddFunc("@every 1m", a.announceHandovers)
+	go c.Start()
+	<-stop
+	c.Stop()
+}
+
+// announceHandovers posts the handover announcement for every schedule whose on-call changed since the last run.
+// The first run only records the current on-call.
+func (a *API) announceHandovers() {
+	a.onCallUsersMtx.Lock()
+	defer a.onCallUsersMtx.Unlock()
+
+	for channelID, scheduleNames := range a.pdCfg.Handovers() {
+		for _, scheduleName := range scheduleNames {
+			schedule, err := a.pdClient.GetSchedule(context.Background(), scheduleName)
+			if err != nil {
+				level.Error(a.logger).Log("msg", "failed to get schedule", "schedule", scheduleName, "err", err.Error())
+				continue
+			}
+
+			incoming, err := a.listScheduleOnCallUsers(schedule.ID)
+			if err != nil {
+				level.Error(a.logger).Log("msg", "failed to list on-call users", "schedule", scheduleName, "err", err.Error())
+				continue
+			}
+
+			key := fmt.Sprintf("%s/%s", channelID, schedule.ID)
+			outgoing, known := a.onCallUsers[key]
+			a.onCallUsers[key] = incoming
+			if !known || isSameUsers(outgoing, incoming) {
+				continue
+			}
+
+			level.Info(a.logger).Log("msg", "announcing on-call handover", "schedule", scheduleName, "channel", channelID)
+			if _, _, err := a.slackBotClient.PostMessage(
+				channelID,
+				slack.MsgOptionText(a.handoverText(schedule, outgoing, incoming), false),
+			); err != nil {
+				level.Error(a.logger).Log("msg", "failed to post on-call handover", "channel", channelID, "err", err.Error())
+			}
+		}
+	}
+}
+
+// listScheduleOnCallUsers returns the users currently on-call for the schedule sorted by id.
+func (a *API) listScheduleOnCallUsers(scheduleID string) ([]pagerduty.User, error) {
+	onCalls, err := a.pdClient.ListCurrentOnCalls(context.Background(), []string{scheduleID}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]pagerduty.User, 0)
+	for _, onCall := range onCalls {
+		if onCall.Schedule.ID != scheduleID || containsUserID(res, onCall.User.ID) {
+			continue
+		}
+		res = append(res, onCall.User)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+// handoverText announces the handover and lists the open incidents of the escalation policies the schedule is part of.
+func (a *API) handoverText(schedule *pagerduty.Schedule, outgoing, incoming []pagerduty.User) string {
+	text := fmt.Sprintf(
+		"*On-call handover* for %s\nOutgoing: %s\nIncoming: %s\n",
+		schedule.Name, a.userMentions(outgoing), a.userMentions(incoming),
+	)
+
+	incidents, err := a.listScheduleIncidents(schedule)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to list incidents for handover", "schedule", schedule.Name, "err", err.Error())
+		return text + "\nFailed to list open incidents :x:"
+	}
+
+	if len(incidents) == 0 {
+		return text + "\nNo open incidents :green_heart:"
+	}
+
+	text += fmt.Sprintf("\n*Open incidents (%d):*\n", len(incidents))
+	for idx, inc := range incidents {
+		if idx == maxHandoverIncidents {
+			text += fmt.Sprintf("… and %d more\n", len(incidents)-maxHandoverIncidents)
+			break
+		}
+		text += fmt.Sprintf("• <%s|[#%d] %s> (%s)\n", inc.HTMLURL, inc.IncidentNumber, strings.TrimSpace(inc.Title), inc.Status)
+	}
+	return text
+}
+
+// listScheduleIncidents returns the open incidents escalated to the schedule via one of its escalation policies.
+func (a *API) listScheduleIncidents(schedule *pagerduty.Schedule) ([]pagerduty.Incident, error) {
+	policyIDs := make([]string, 0, len(schedule.EscalationPolicies))
+	for _, policy := range schedule.EscalationPolicies {
+		policyIDs = append(policyIDs, policy.ID)
+	}
+	if len(policyIDs) == 0 {
+		return nil, nil
+	}
+
+	incidents, err := a.pdClient.ListIncidents(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]pagerduty.Incident, 0)
+	for _, inc := range incidents {
+		if util.Contains(policyIDs, inc.EscalationPolicy.ID) {
+			res = append(res, inc)
+		}
+	}
+	return res, nil
+}
+
+func (a *API) userMentions(users []pagerduty.User) string {
+	if len(users) == 0 {
+		return "nobody"
+	}
+
+	res := make([]string, 0)
+	for _, u := range users {
+		res = append(res, a.slackBotClient.UserMentionByEmail(u.Email, clients.UserName(u)))
+	}
+	return strings.Join(res, ", ")
+}
+
+func isSameUsers(users1, users2 []pagerduty.User) bool {
+	if len(users1) != len(users2) {
+		return false
+	}
+	for idx := range users1 {
+		if users1[idx].ID != users2[idx].ID {
+			return false
+		}
+	}
+	return true
+}
+
+func containsUserID(users []pagerduty.User, userID string) bool {
+	for _, u := range users {
+		if u.ID == userID {
+			return true
+		}
+	}
+	return false
+}
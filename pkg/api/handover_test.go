@@ -0,0 +1,60 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenarioHandover(t *testing.T) {
+	s := newScenarioWithEnv(t, map[string]string{
+		"PAGERDUTY_SERVICES_ID_LIST":  scenarioServiceID + ",PSVC2",
+		"PAGERDUTY_HANDOVER_CHANNELS": scenarioChannelID + "=compute",
+	})
+	alice := s.pagerduty.AddUser("Alice Doe", "alice.doe@example.com")
+	bob := s.pagerduty.AddUser("Bob", "bob@example.com")
+	s.pagerduty.AddService("PSVC2", "Storage", "")
+
+	scheduleID := s.pagerduty.AddSchedule("compute", alice)
+	s.pagerduty.AddEscalationPolicy("Compute", scheduleID, scenarioServiceID)
+	s.pagerduty.AddEscalationPolicy("Storage", s.pagerduty.AddSchedule("storage", bob), "PSVC2")
+	s.pagerduty.TriggerIncident(scenarioServiceID, "[EU-DE-1] NovaApiDown")
+	s.pagerduty.TriggerIncident("PSVC2", "[EU-DE-1] CinderApiDown")
+
+	// The first run only records the current on-call.
+	s.api.announceHandovers()
+	assert.Empty(t, s.slack.Messages(scenarioChannelID), "nothing should be announced without a handover")
+
+	s.pagerduty.SetOnCall(scheduleID, bob)
+	s.api.announceHandovers()
+	messages := s.slack.Messages(scenarioChannelID)
+	require.Len(t, messages, 1, "the handover should be announced")
+	assert.Contains(t, messages[0].Text, "*On-call handover* for compute")
+	assert.Contains(t, messages[0].Text, "Outgoing: Alice Doe\nIncoming: Bob\n")
+	assert.Contains(t, messages[0].Text, "*Open incidents (1):*", "only the incidents of the schedule should be listed")
+	assert.Contains(t, messages[0].Text, "NovaApiDown")
+	assert.NotContains(t, messages[0].Text, "CinderApiDown", "incidents of other escalation policies should not be listed")
+
+	s.api.announceHandovers()
+	assert.Len(t, s.slack.Messages(scenarioChannelID), 1, "the handover should be announced once")
+}
@@ -0,0 +1,185 @@
+/*******************************************************************************
+*
+* Copyright 2023 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/clients"
+)
+
+// The markers are added to synced notes and messages to track what was already synced.
+const (
+	slackMarkerFormat  = "(slack message %s)"
+	noteMarkerFormat   = "_(pd note %s)_"
+	slackMarkerPattern = `\(slack message (\d+\.\d+)\)`
+	noteMarkerPattern  = `_\(pd note (\w+)\)_`
+
+	subTypeBotMessage = "bot_message"
+)
+
+var (
+	slackMarkerRegex = regexp.MustCompile(slackMarkerPattern)
+	noteMarkerRegex  = regexp.MustCompile(noteMarkerPattern)
+)
+
+// noteSyncActivity tells which alert threads and incidents had activity since their notes were last synced.
+type noteSyncActivity struct {
+	// all is true if the notes of all threads are synced, e.g. on the first run.
+	all bool
+	// replyCounts are the reply counts of the threads by incident when their notes were last synced.
+	replyCounts map[string]int
+	// annotatedIncidents are the ids of the incidents notes were added to since.
+	annotatedIncidents map[string]bool
+}
+
+// noteActivity returns the activity since the last applied incident sync.
+// The notes of all threads are synced if it is unknown.
+func (a *API) noteActivity() noteSyncActivity {
+	a.noteSyncMtx.Lock()
+	since, replyCounts := a.lastNoteSync, a.noteReplyCounts
+	a.noteSyncMtx.Unlock()
+
+	if since.IsZero() {
+		return noteSyncActivity{all: true}
+	}
+
+	annotated, err := a.pdClient.ListAnnotatedIncidentIDs(context.Background(), since)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to list incidents with new notes. syncing the notes of all incidents", "err", err.Error())
+		return noteSyncActivity{all: true}
+	}
+	return noteSyncActivity{replyCounts: replyCounts, annotatedIncidents: annotated}
+}
+
+// has returns whether the thread of the message got replies or notes were added to the incident since the last sync.
+func (n noteSyncActivity) has(message *slack.Message, incident *pagerduty.Incident) bool {
+	if n.all || n.annotatedIncidents[incident.ID] {
+		return true
+	}
+	count, ok := n.replyCounts[noteActivityKey(message, incident)]
+	return !ok || count != message.ReplyCount
+}
+
+// rememberNoteSync remembers the reply counts of the threads of the applied plan and when it started.
+// The counts of threads no longer matching an open incident are forgotten.
+func (a *API) rememberNoteSync(plan *SyncPlan) {
+	a.noteSyncMtx.Lock()
+	defer a.noteSyncMtx.Unlock()
+	a.noteReplyCounts = plan.noteReplyCounts
+	a.lastNoteSync = plan.startedAt
+}
+
+func noteActivityKey(message *slack.Message, incident *pagerduty.Incident) string {
+	return fmt.Sprintf("%s/%s/%s", message.Channel, message.Timestamp, incident.ID)
+}
+
+// planIncidentNotes returns the actions mirroring replies in the thread of the alert message as notes of the incident
+// and posting notes of the incident, which were added in PagerDuty, in the thread.
+func (a *API) planIncidentNotes(message *slack.Message, incident *pagerduty.Incident) []SyncAction {
+	actions := make([]SyncAction, 0)
+
+	replies, err := a.slackClient.GetConversationReplies(message.Channel, message.Timestamp)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to get thread replies", "channel", message.Channel, "err", err.Error())
+		return actions
+	}
+
+	notes, err := a.pdClient.ListIncidentNotes(context.Background(), incident.ID)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to list incident notes", "incidentID", incident.ID, "err", err.Error())
+		return actions
+	}
+
+	syncedMessages := findMarkers(slackMarkerRegex, noteContents(notes)...)
+	syncedNotes := findMarkers(noteMarkerRegex, messageTexts(replies)...)
+
+	authors := make(map[string]string)
+	for _, reply := range replies {
+		// Skip the alert itself, messages posted by bots including Pulsar and already synced messages.
+		if reply.Timestamp == message.Timestamp || reply.BotID != "" || reply.SubType == subTypeBotMessage || syncedMessages[reply.Timestamp] {
+			continue
+		}
+
+		if _, ok := authors[reply.User]; !ok {
+			authors[reply.User] = a.slackUserName(reply.User)
+		}
+
+		content := fmt.Sprintf("%s wrote in Slack: %s\n"+slackMarkerFormat, authors[reply.User], reply.Text, reply.Timestamp)
+		actions = append(actions, newSyncAction(SyncActionAddNote, message, incident, content))
+	}
+
+	for _, note := range notes {
+		// Skip notes created from slack replies, notes Pulsar added on its own and already posted notes.
+		if slackMarkerRegex.MatchString(note.Content) || strings.Contains(note.Content, clients.PulsarNoteMarker) || syncedNotes[note.ID] {
+			continue
+		}
+
+		text := fmt.Sprintf("Note by %s in PagerDuty: %s\n"+noteMarkerFormat, note.User.Summary, note.Content, note.ID)
+		actions = append(actions, newSyncAction(SyncActionPostNote, message, incident, text))
+	}
+
+	return actions
+}
+
+func (a *API) slackUserName(userID string) string {
+	usr, err := a.slackBotClient.GetUserByID(userID)
+	if err != nil {
+		return userID
+	}
+
+	if usr.RealName != "" {
+		return usr.RealName
+	}
+	return usr.Name
+}
+
+// findMarkers returns the set of values captured by the marker regex in the given texts.
+func findMarkers(markerRegex *regexp.Regexp, texts ...string) map[string]bool {
+	res := make(map[string]bool)
+	for _, txt := range texts {
+		for _, match := range markerRegex.FindAllStringSubmatch(txt, -1) {
+			res[match[1]] = true
+		}
+	}
+	return res
+}
+
+func noteContents(notes []pagerduty.IncidentNote) []string {
+	res := make([]string, 0, len(notes))
+	for _, n := range notes {
+		res = append(res, n.Content)
+	}
+	return res
+}
+
+func messageTexts(messages []slack.Message) []string {
+	res := make([]string, 0, len(messages))
+	for _, m := range messages {
+		res = append(res, m.Text)
+	}
+	return res
+}
@@ -20,174 +20,302 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"time"
+
 	"github.com/PagerDuty/go-pagerduty"
 	"github.com/go-kit/log/level"
+	"github.com/gosuri/uitable"
 	"github.com/nlopes/slack"
 	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/slack/models"
 )
 
+// SyncActionType is the type of a change made by the incident sync.
+type SyncActionType string
+
+const (
+	// SyncActionPostLink posts the link to the incident in the thread of the alert.
+	SyncActionPostLink SyncActionType = "post link"
+	// SyncActionAddReaction adds a reaction to the alert.
+	SyncActionAddReaction SyncActionType = "add reaction"
+	// SyncActionPostAcknowledgement posts who acknowledged the incident in the thread of the alert.
+	SyncActionPostAcknowledgement SyncActionType = "post acknowledgement"
+	// SyncActionPostNote posts a note of the incident in the thread of the alert.
+	SyncActionPostNote SyncActionType = "post note"
+	// SyncActionPostRunbook posts the runbook of the alert in its thread.
+	SyncActionPostRunbook SyncActionType = "post runbook"
+	// SyncActionAddNote adds a reply in the thread of the alert as note to the incident.
+	SyncActionAddNote SyncActionType = "add note"
+)
+
+// SyncAction is a single change planned by the incident sync.
+type SyncAction struct {
+	Type SyncActionType
+
+	// ChannelID and Timestamp identify the alert message.
+	ChannelID string
+	Timestamp string
+
+	// IncidentID and IncidentNumber identify the matched incident.
+	IncidentID     string
+	IncidentNumber uint
+
+	// Text is the posted message, the reaction or the content of the note.
+	Text string
+}
+
+// SyncPlan are the changes the incident sync would make.
+type SyncPlan struct {
+	Actions []SyncAction
+
+	// Ambiguities describe messages matching several incidents and incidents matching several messages.
+	Ambiguities []string
+
+	// noteReplyCounts and startedAt are remembered once the plan was applied, so the notes of threads and incidents
+	// without activity since are skipped by the next plan.
+	noteReplyCounts map[string]int
+	startedAt       time.Time
+}
+
+// Report writes the actions and ambiguities of the plan as a table.
+func (p *SyncPlan) Report(w io.Writer) error {
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("ACTION", "CHANNEL", "MESSAGE", "INCIDENT", "DETAIL")
+	for _, action := range p.Actions {
+		table.AddRow(string(action.Type), action.ChannelID, action.Timestamp, fmt.Sprintf("#%d", action.IncidentNumber), action.Text)
+	}
+
+	if _, err := fmt.Fprintf(w, "%s\n\n%d actions\n", table.String(), len(p.Actions)); err != nil {
+		return err
+	}
+	for _, ambiguity := range p.Ambiguities {
+		if _, err := fmt.Fprintf(w, "AMBIGUOUS: %s\n", ambiguity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // incident sync will do:
 // run frequently as cron job
 // try to match open incidents from pagerduty of defined services to defined slack channels
 // filter on service from environmental values: PD_SERVICES_ID_LIST
 // filter on slack channels from environmental values: SLACK_CHANNELS_ID_LIST
+// sync replies in the thread of matched messages and incident notes in both directions
 func (a *API) pd_slack_incidents_sync() error {
-
-	// 1. get all PD incidents from our defined services
-	f := &clients.Filter{}
-	f.SetLimit(100)
-	iL, err := a.pdClient.ListIncidents(f)
+	plan, err := a.PlanIncidentSync()
 	if err != nil {
 		return err
 	}
-	for _, i := range iL {
-		a.enrich_slack_channel_with_incident(&i)
-	}
 
-	return nil
+	for _, ambiguity := range plan.Ambiguities {
+		level.Info(a.logger).Log("msg", "ambiguous incident match", "match", ambiguity)
+	}
+	return a.ApplyIncidentSync(plan)
 }
 
-func (a *API) enrich_slack_channel_with_incident(incident *pagerduty.Incident) {
-	level.Info(a.logger).Log("write into Channel")
+// PlanIncidentSync matches the open incidents to the alerts in the sync channels and returns the changes needed to
+// sync them without making any. Incidents and messages are only read.
+func (a *API) PlanIncidentSync() (*SyncPlan, error) {
+	startedAt := time.Now()
+	activity := a.noteActivity()
 
-	for _, channelId := range a.cfg.ChannelIdsListForPdSync {
+	f := &clients.Filter{}
+	f.SetLimit(100)
+	incidents, err := a.pdClient.ListIncidents(context.Background(), f)
+	if err != nil {
+		return nil, err
+	}
 
-		h, err := a.slackClient.GetConversationHistory(channelId)
+	channelIDs := a.cfg.SyncChannels()
+	messages := make(map[string][]slack.Message, len(channelIDs))
+	for _, channelID := range channelIDs {
+		h, err := a.slackClient.GetConversationHistory(channelID)
 		if err != nil {
-			level.Error(a.logger).Log("trouble to get slack channel messages - ", channelId, ": ", err)
+			level.Error(a.logger).Log("msg", "failed to get channel history", "channel", channelID, "err", err.Error())
 			continue
 		}
-		for _, message := range h.Messages {
-
-            // skip if message isn't in the same time range (other alert)
-            if !a.checkIfIncidentMessageTimeIsMoreOrLessSame(&message, incident){
-                level.Debug(a.logger).Log(fmt.Printf("skip message in channel %s because of timestamp.", message.Channel))
-                continue
-            }
-
-            level.Debug(a.logger).Log("Incident Match in Channel ", channelId, " for incident ", incident.APIObject.HTMLURL)
-
-            // AlertManager makes Attachment Messages
-			if len(message.Attachments) > 0 {
-
-                s := strings.ToLower(message.Attachments[0].Text)
-				level.Info(a.logger).Log(s)
-				region, alertname, err := clients.ParseRegionAndAlertnameFromText(incident.Summary)
-
-                // skip resolved
-                if err == nil && strings.Contains(s, "resolved") {
-                    level.Debug(a.logger).Log(fmt.Printf("skip message in channel %s because it's resolved", message.Channel))
-                    continue
-                }
-
-                // get state (acknowledged / already add PD link)
-                bIconFireFighter, bIconPagerduty := a.checkReactions(&message)
-                if bIconFireFighter && bIconPagerduty {
-                    level.Debug(a.logger).Log(fmt.Printf("skip message in channel %s because it's already handled", message.Channel))
-                    continue
-                }
-
-                // handle - both states (acknowledged / pd link added) are possible
-				if err == nil && strings.Contains(strings.ToLower(s), region) && strings.Contains(strings.ToLower(s), alertname) {
-
-                    message.Channel = channelId
-
-                    // add pd incident link add
-                    if !bIconPagerduty {
-                        level.Debug(a.logger).Log(fmt.Printf("add pd link to slack message - channel %s for alertname: %s", channelId, alertname))
-                        a.addPdLink(&message, incident)
-                        a.addReactionHandled(&message)
-                    }
-
-                    // if not marked as acknowledged - we mark it
-					if incident.Status == "acknowledged" && !bIconFireFighter {
-                            level.Debug(a.logger).Log(fmt.Printf("add ack Icon to slack message - channel %s for alertname: %s", channelId, alertname))
-                            a.addReactionAcknowledged(&message, incident)
-                    }
+		for i := range h.Messages {
+			h.Messages[i].Channel = channelID
+		}
+		messages[channelID] = h.Messages
+	}
+
+	plan := &SyncPlan{Actions: make([]SyncAction, 0), Ambiguities: make([]string, 0), noteReplyCounts: make(map[string]int), startedAt: startedAt}
+	matchedIncidents := make(map[string][]string)
+	messageOrder := make([]string, 0)
+
+	for i := range incidents {
+		incident := &incidents[i]
+		matchedMessages := make([]string, 0)
+
+		for _, channelID := range channelIDs {
+			for j := range messages[channelID] {
+				// The message is changed by planning to account for reactions added for previous incidents.
+				message := &messages[channelID][j]
+				if !a.matchesIncident(message, incident) {
+					continue
+				}
 
+				level.Debug(a.logger).Log("msg", "incident matches message", "incidentID", incident.ID, "channel", channelID, "timestamp", message.Timestamp)
+				plan.Actions = append(plan.Actions, a.planMessageSync(message, incident)...)
+				if activity.has(message, incident) {
+					plan.Actions = append(plan.Actions, a.planIncidentNotes(message, incident)...)
 				}
+				plan.noteReplyCounts[noteActivityKey(message, incident)] = message.ReplyCount
+
+				ref := fmt.Sprintf("%s in channel %s", message.Timestamp, channelID)
+				matchedMessages = append(matchedMessages, ref)
+				if _, ok := matchedIncidents[ref]; !ok {
+					messageOrder = append(messageOrder, ref)
+				}
+				matchedIncidents[ref] = append(matchedIncidents[ref], fmt.Sprintf("#%d", incident.IncidentNumber))
 			}
 		}
-    }
+
+		if len(matchedMessages) > 1 {
+			plan.Ambiguities = append(plan.Ambiguities, fmt.Sprintf("incident #%d matches messages %s", incident.IncidentNumber, strings.Join(matchedMessages, ", ")))
+		}
+	}
+
+	for _, ref := range messageOrder {
+		if len(matchedIncidents[ref]) > 1 {
+			plan.Ambiguities = append(plan.Ambiguities, fmt.Sprintf("message %s matches incidents %s", ref, strings.Join(matchedIncidents[ref], ", ")))
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplyIncidentSync makes the changes of the plan. Failed actions are logged and skipped.
+// Returns an error if any action failed.
+func (a *API) ApplyIncidentSync(plan *SyncPlan) error {
+	failed := 0
+	for _, action := range plan.Actions {
+		if err := a.applySyncAction(action); err != nil {
+			level.Error(a.logger).Log("msg", "failed to sync incident", "action", action.Type, "incidentID", action.IncidentID, "channel", action.ChannelID, "timestamp", action.Timestamp, "err", err.Error())
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sync actions failed", failed, len(plan.Actions))
+	}
+	a.rememberNoteSync(plan)
+	return nil
+}
+
+func (a *API) applySyncAction(action SyncAction) error {
+	switch action.Type {
+	case SyncActionPostLink, SyncActionPostAcknowledgement, SyncActionPostNote, SyncActionPostRunbook:
+		_, _, err := a.slackBotClient.PostMessage(
+			action.ChannelID,
+			slack.MsgOptionText(action.Text, false),
+			slack.MsgOptionTS(action.Timestamp),
+		)
+		return err
+	case SyncActionAddReaction:
+		return a.slackBotClient.AddReactionToMessage(action.ChannelID, action.Timestamp, action.Text)
+	case SyncActionAddNote:
+		_, err := a.pdClient.AddNoteToIncident(context.Background(), action.IncidentID, action.Text)
+		return err
+	}
+	return fmt.Errorf("unknown sync action '%s'", action.Type)
 }
 
-func (a *API)checkIfIncidentMessageTimeIsMoreOrLessSame(message *slack.Message, incident *pagerduty.Incident) bool {
-    tp, _ := time.Parse(time.RFC3339, incident.CreatedAt)
-    tmm, err := strconv.ParseInt(strings.Split(message.Timestamp, ".")[0], 10, 64)
-    if err != nil {
-        level.Error(a.logger).Log(err)
-    }
-    return tp.Sub(time.Unix(tmm,0)).Abs().Minutes() <= 1
+// matchesIncident returns whether the message is the alert of the incident.
+// Alert groups posted by Pulsar belong to the incident whose key is the hash of their group key.
+// AlertManager posts attachments containing the region and alertname within a minute of the incident.
+// Resolved alerts are skipped.
+func (a *API) matchesIncident(message *slack.Message, incident *pagerduty.Incident) bool {
+	if key, ok := models.AlertGroupKey(message); ok {
+		return key == incident.IncidentKey && !models.IsResolvedAlertGroup(message)
+	}
+
+	if !a.checkIfIncidentMessageTimeIsMoreOrLessSame(message, incident) || len(message.Attachments) == 0 {
+		return false
+	}
+
+	region, alertname, err := clients.ParseRegionAndAlertnameFromText(incident.Summary)
+	if err != nil {
+		return false
+	}
+
+	s := strings.ToLower(message.Attachments[0].Text)
+	return !strings.Contains(s, "resolved") && strings.Contains(s, region) && strings.Contains(s, alertname)
 }
 
-func (a *API)checkReactions(message *slack.Message) (bool, bool) {
+// planMessageSync returns the actions linking the message to the incident, posting the runbook and marking it as
+// acknowledged. Nothing is returned for already handled messages.
+func (a *API) planMessageSync(message *slack.Message, incident *pagerduty.Incident) []SyncAction {
+	actions := make([]SyncAction, 0)
 
-    bIconFireFighter :=false
-    bIconPagerduty := false
+	if !hasReaction(message, emojiPagerDuty) {
+		actions = append(actions,
+			newSyncAction(SyncActionPostLink, message, incident, fmt.Sprintf("PD Incident (%d): %s", incident.IncidentNumber, incident.HTMLURL)),
+			newSyncAction(SyncActionAddReaction, message, incident, emojiPagerDuty),
+		)
+		message.Reactions = append(message.Reactions, slack.ItemReaction{Name: emojiPagerDuty})
+	}
 
-    for _, r := range message.Reactions{
-        if r.Name == emojiPagerDuty {
-            level.Debug(a.logger).Log(fmt.Printf("there is a reaction icon :%s:  - we handled it already - channel: %s.", emojiPagerDuty, message.Channel))
-            bIconPagerduty = true
-        }
+	if !hasReaction(message, emojiRunbook) {
+		if alertname, runbook, ok := a.runbookFor(message, incident.Summary); ok {
+			actions = append(actions,
+				newSyncAction(SyncActionPostRunbook, message, incident, models.NewRunbookMessage(alertname, runbook).Text),
+				newSyncAction(SyncActionAddReaction, message, incident, emojiRunbook),
+			)
+			message.Reactions = append(message.Reactions, slack.ItemReaction{Name: emojiRunbook})
+		}
+	}
 
-        if r.Name == emojiFirefighter {
-            level.Debug(a.logger).Log(fmt.Printf("there is a reaction icon :%s:  - we handled it already - channel: %s.", emojiFirefighter, message.Channel))
-            bIconFireFighter = true
-        }
-    }
+	if incident.Status == clients.IncidentStatusAcknowledged && !hasReaction(message, emojiFirefighter) {
+		acknowledger := "unknown"
+		if len(incident.Acknowledgements) > 0 {
+			acknowledger = incident.Acknowledgements[0].Acknowledger.Summary
+		}
+		actions = append(actions,
+			newSyncAction(SyncActionAddReaction, message, incident, emojiFirefighter),
+			newSyncAction(SyncActionPostAcknowledgement, message, incident, fmt.Sprintf(acknowledgeString, acknowledger)),
+		)
+		message.Reactions = append(message.Reactions, slack.ItemReaction{Name: emojiFirefighter})
+	}
 
-    return bIconFireFighter, bIconPagerduty
+	return actions
 }
 
-// Post incident link
-func (a *API)addPdLink(message *slack.Message, incident *pagerduty.Incident) error {
-    if _, _, err := a.slackBotClient.PostMessage(
-        message.Channel,// channelId,
-        slack.MsgOptionText(fmt.Sprintf("PD Incident (%d): %s", incident.IncidentNumber, incident.HTMLURL), false),
-        slack.MsgOptionTS(message.Timestamp),
-    ); err != nil {
-        level.Error(a.logger).Log(err)
-        return err
-    }
-    return nil
+func (a *API) checkIfIncidentMessageTimeIsMoreOrLessSame(message *slack.Message, incident *pagerduty.Incident) bool {
+	tp, _ := time.Parse(time.RFC3339, incident.CreatedAt)
+	tmm, err := strconv.ParseInt(strings.Split(message.Timestamp, ".")[0], 10, 64)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to parse message timestamp", "timestamp", message.Timestamp, "err", err.Error())
+	}
+	return tp.Sub(time.Unix(tmm, 0)).Abs().Minutes() <= 1
 }
 
-// Add reaction emoji to original message.
-func (a *API)addReactionHandled(message *slack.Message) error {
-    if err := a.slackBotClient.AddReactionToMessage(
-        message.Channel,
-        message.Timestamp,
-        emojiPagerDuty,
-    ); err != nil {
-        level.Error(a.logger).Log(err)
-        return err
-    }
-    return nil
+func newSyncAction(t SyncActionType, message *slack.Message, incident *pagerduty.Incident, text string) SyncAction {
+	return SyncAction{
+		Type:           t,
+		ChannelID:      message.Channel,
+		Timestamp:      message.Timestamp,
+		IncidentID:     incident.ID,
+		IncidentNumber: incident.IncidentNumber,
+		Text:           text,
+	}
 }
 
-func (a *API)addReactionAcknowledged(message *slack.Message, incident *pagerduty.Incident) error {
-    // Add reaction emoji to original message.
-    if err := a.slackBotClient.AddReactionToMessage(
-        message.Channel,
-        message.Timestamp,
-        emojiFirefighter,
-    ); err != nil {
-        level.Error(a.logger).Log(err)
-        return err
-    }
-    // Post the message.
-    if _, _, err := a.slackBotClient.PostMessage(
-        message.Channel,
-        slack.MsgOptionText(fmt.Sprintf(acknowledgeString, incident.Acknowledgements[0].Acknowledger.Summary), false),
-        slack.MsgOptionTS(message.Timestamp),
-    ); err != nil {
-        level.Error(a.logger).Log(err)
-        return err
-    }
-    return nil
+// hasReaction returns whether the message has the reaction, which indicates it was handled already.
+func hasReaction(message *slack.Message, name string) bool {
+	for _, r := range message.Reactions {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,135 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanIncidentSync(t *testing.T) {
+	s := newScenario(t)
+	alertTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping*"})
+	s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-2] KubernetesNodeNotReady - node not ready*"})
+	incident := s.pagerduty.TriggerIncident(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+
+	plan, err := s.api.PlanIncidentSync()
+	require.NoError(t, err, "there should be no error planning the sync")
+	assert.Equal(t, []SyncAction{
+		{Type: SyncActionPostLink, ChannelID: scenarioChannelID, Timestamp: alertTS, IncidentID: incident.ID, IncidentNumber: 1, Text: "PD Incident (1): " + incident.HTMLURL},
+		{Type: SyncActionAddReaction, ChannelID: scenarioChannelID, Timestamp: alertTS, IncidentID: incident.ID, IncidentNumber: 1, Text: emojiPagerDuty},
+	}, plan.Actions, "only the matching alert should be linked")
+	assert.Empty(t, plan.Ambiguities, "there should be no ambiguous matches")
+
+	var buf bytes.Buffer
+	assert.NoError(t, plan.Report(&buf), "there should be no error writing the report")
+	assert.Contains(t, buf.String(), "post link")
+	assert.Contains(t, buf.String(), "2 actions")
+
+	assert.Empty(t, s.slack.Reactions(scenarioChannelID, alertTS), "planning should not change the alert")
+	assert.Empty(t, s.slack.Replies(scenarioChannelID, alertTS), "planning should not post in the thread")
+
+	assert.NoError(t, s.api.ApplyIncidentSync(plan), "there should be no error applying the plan")
+	assert.Equal(t, []string{emojiPagerDuty}, s.slack.Reactions(scenarioChannelID, alertTS), "the alert should be marked as synced")
+	assert.Len(t, s.slack.Replies(scenarioChannelID, alertTS), 1, "the link should be posted in the thread")
+}
+
+func TestPlanIncidentSyncRunbook(t *testing.T) {
+	t.Setenv("RUNBOOK_URLS", "OpenstackLbaasApiFlapping=https://runbooks.example.com/lbaas")
+	s := newScenario(t)
+	alertTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping*"})
+	incident := s.pagerduty.TriggerIncident(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+
+	plan, err := s.api.PlanIncidentSync()
+	require.NoError(t, err, "there should be no error planning the sync")
+	assert.Equal(t, []SyncAction{
+		{Type: SyncActionPostLink, ChannelID: scenarioChannelID, Timestamp: alertTS, IncidentID: incident.ID, IncidentNumber: 1, Text: "PD Incident (1): " + incident.HTMLURL},
+		{Type: SyncActionAddReaction, ChannelID: scenarioChannelID, Timestamp: alertTS, IncidentID: incident.ID, IncidentNumber: 1, Text: emojiPagerDuty},
+		{Type: SyncActionPostRunbook, ChannelID: scenarioChannelID, Timestamp: alertTS, IncidentID: incident.ID, IncidentNumber: 1, Text: ":book: Runbook for *openstacklbaasapiflapping*: https://runbooks.example.com/lbaas"},
+		{Type: SyncActionAddReaction, ChannelID: scenarioChannelID, Timestamp: alertTS, IncidentID: incident.ID, IncidentNumber: 1, Text: emojiRunbook},
+	}, plan.Actions, "the runbook of the alertname should be posted with the link")
+
+	assert.NoError(t, s.api.ApplyIncidentSync(plan), "there should be no error applying the plan")
+	assert.Len(t, s.slack.Replies(scenarioChannelID, alertTS), 2, "the link and the runbook should be posted in the thread")
+
+	plan, err = s.api.PlanIncidentSync()
+	require.NoError(t, err, "there should be no error planning the sync")
+	assert.Empty(t, plan.Actions, "the runbook should only be posted once")
+}
+
+func TestPlanIncidentSyncAmbiguous(t *testing.T) {
+	s := newScenario(t)
+	firstTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping*"})
+	secondTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping again*"})
+	s.pagerduty.TriggerIncident(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+	s.pagerduty.TriggerIncident(scenarioServiceID, "[#2] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+
+	plan, err := s.api.PlanIncidentSync()
+	require.NoError(t, err, "there should be no error planning the sync")
+	assert.Equal(t, []string{
+		"incident #2 matches messages " + secondTS + " in channel CALERTS, " + firstTS + " in channel CALERTS",
+		"incident #1 matches messages " + secondTS + " in channel CALERTS, " + firstTS + " in channel CALERTS",
+		"message " + secondTS + " in channel CALERTS matches incidents #2, #1",
+		"message " + firstTS + " in channel CALERTS matches incidents #2, #1",
+	}, plan.Ambiguities, "ambiguous matches should be flagged")
+
+	links := 0
+	for _, action := range plan.Actions {
+		if action.Type == SyncActionPostLink {
+			links++
+		}
+	}
+	assert.Equal(t, 2, links, "each alert should only be linked once")
+}
+
+func TestIncidentSyncNotesActivity(t *testing.T) {
+	s := newScenario(t)
+	alertTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping*"})
+	incident := s.pagerduty.TriggerIncident(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+	notesPath := "/incidents/" + incident.ID + "/notes"
+
+	// The first sync posts the link, which is a new reply the second sync checks.
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+	listed := s.pagerduty.Requests("GET", notesPath)
+	assert.Equal(t, 2, listed, "the notes should be listed by the first sync and after the link was posted")
+
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+	assert.Equal(t, listed, s.pagerduty.Requests("GET", notesPath), "the notes should not be listed without new activity")
+
+	// A note added in PagerDuty is posted in the thread.
+	_, err := s.api.pdClient.AddNoteToIncident(context.Background(), incident.ID, "restarted the lbaas agents")
+	require.NoError(t, err, "there should be no error adding a note")
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+	assert.True(t, hasReply(s, alertTS, "restarted the lbaas agents"), "the new note should be posted in the thread")
+
+	// A reply in the thread is added as note.
+	s.slack.SendMessage(scenarioChannelID, alertTS, scenarioUserID, "looks good again")
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+	notes := s.pagerduty.Notes(incident.ID)
+	if assert.Len(t, notes, 2, "the new reply should be added as note") {
+		assert.Contains(t, notes[1].Content, "looks good again")
+	}
+}
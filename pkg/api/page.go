@@ -0,0 +1,105 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/clients"
+)
+
+// pagedMessageTTL is how long repeated clicks on the page button of a message are ignored.
+const pagedMessageTTL = 24 * time.Hour
+
+// pagedMessage is a page sent for a message.
+type pagedMessage struct {
+	userID string
+	sentAt time.Time
+}
+
+// page triggers a PagerDuty incident for the default page target using the text of the message as summary
+// and posts the incident link and its status changes in the thread.
+// The interaction is acknowledged right away while the incident is triggered and watched in the background.
+func (a *API) page(message slack.InteractionCallback) error {
+	target := a.pdCfg.PageTarget()
+	routingKey, ok := a.pdCfg.RoutingKey(target)
+	if !ok {
+		return errors.New("no default page target configured")
+	}
+
+	channelID, timestamp := message.Channel.ID, message.Message.Timestamp
+	if pagedBy, ok := a.reservePage(channelID, timestamp, message.User.ID); !ok {
+		go a.postInThread(channelID, timestamp, &slack.Msg{Text: fmt.Sprintf("<@%s> already paged *%s* for this message", pagedBy, target)})
+		return nil
+	}
+
+	go func() {
+		summary := fmt.Sprintf("%s (paged by %s via Slack)", message.Message.Text, message.User.Name)
+		dedupKey, err := a.pdClient.TriggerEvent(a.watchCtx, routingKey, "critical", summary, "slack")
+		if err != nil {
+			// Let the user try again.
+			a.releasePage(channelID, timestamp)
+			level.Error(a.logger).Log("msg", "failed to page", "target", target, "userID", message.User.ID, "err", err.Error())
+			a.postInThread(channelID, timestamp, &slack.Msg{Text: fmt.Sprintf("Failed to page *%s* :x:\n```\n%s\n```", target, err.Error())})
+			return
+		}
+		level.Info(a.logger).Log("msg", "paged", "target", target, "userID", message.User.ID, "dedupKey", dedupKey)
+		a.postInThread(channelID, timestamp, &slack.Msg{Text: fmt.Sprintf("<@%s> is paging *%s* :rotating_light:", message.User.ID, target)})
+
+		onChange := clients.PostIncidentUpdates(a.slackBotClient, channelID, timestamp)
+		if err := a.pdClient.WatchIncident(a.watchCtx, dedupKey, onChange); err != nil {
+			level.Info(a.logger).Log("msg", "stopped watching paged incident", "err", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// reservePage remembers that the user pages for the message.
+// Returns the user who already paged for it and false if the message was paged before.
+func (a *API) reservePage(channelID, timestamp, userID string) (string, bool) {
+	a.pagedMessagesMtx.Lock()
+	defer a.pagedMessagesMtx.Unlock()
+
+	now := time.Now()
+	for key, p := range a.pagedMessages {
+		if now.Sub(p.sentAt) > pagedMessageTTL {
+			delete(a.pagedMessages, key)
+		}
+	}
+
+	key := channelID + "/" + timestamp
+	if p, ok := a.pagedMessages[key]; ok {
+		return p.userID, false
+	}
+	a.pagedMessages[key] = pagedMessage{userID: userID, sentAt: now}
+	return userID, true
+}
+
+// releasePage forgets the page for the message, e.g. because it failed.
+func (a *API) releasePage(channelID, timestamp string) {
+	a.pagedMessagesMtx.Lock()
+	defer a.pagedMessagesMtx.Unlock()
+	delete(a.pagedMessages, channelID+"/"+timestamp)
+}
@@ -0,0 +1,63 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sapcc/pulsar/pkg/slack/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenarioPage(t *testing.T) {
+	t.Setenv("PAGERDUTY_ROUTING_KEYS", "compute=compute-key")
+	t.Setenv("PAGERDUTY_DEFAULT_PAGE_TARGET", "compute")
+	s := newScenario(t)
+	t.Cleanup(s.api.stopWatches)
+
+	msgTS := s.slack.SendMessage(scenarioChannelID, "", scenarioUserID, "nova api is down")
+
+	// PagerDuty rejects the unknown routing key, which is reported in the thread.
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, msgTS, scenarioUserID, models.ActionIDPage, "page"))
+	assert.Eventually(t, func() bool { return hasReply(s, msgTS, "Failed to page *compute*") }, time.Second, 10*time.Millisecond,
+		"the failure should be posted in the thread")
+	assert.Empty(t, s.pagerduty.Incidents(), "no incident should be triggered")
+
+	// Once the routing key exists, clicking again pages the on-call and posts the incident.
+	s.pagerduty.AddService("PCOMPUTE", "Compute", "compute-key")
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, msgTS, scenarioUserID, models.ActionIDPage, "page"))
+	assert.Eventually(t, func() bool { return hasReply(s, msgTS, "<@UALICE> is paging *compute*") }, time.Second, 10*time.Millisecond,
+		"the page should be posted in the thread")
+	assert.Eventually(t, func() bool { return hasReply(s, msgTS, "PD Incident (1): ") }, time.Second, 10*time.Millisecond,
+		"the watcher should post the incident in the thread")
+	incidents := s.pagerduty.Incidents()
+	if assert.Len(t, incidents, 1, "an incident should be triggered") {
+		assert.Contains(t, incidents[0].Title, "nova api is down (paged by")
+		assert.Equal(t, "PCOMPUTE", incidents[0].Service.ID, "the incident should be triggered for the default page target")
+	}
+
+	// Repeated clicks do not page again.
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, msgTS, scenarioGuestID, models.ActionIDPage, "page"))
+	assert.Eventually(t, func() bool { return hasReply(s, msgTS, "<@UALICE> already paged *compute* for this message") }, time.Second, 10*time.Millisecond,
+		"the user should be told that the message was paged")
+	assert.Len(t, s.pagerduty.Incidents(), 1, "no further incident should be triggered")
+}
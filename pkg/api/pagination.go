@@ -0,0 +1,34 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+// paginateTable replaces a table with the page requested by the clicked button.
+func (a *API) paginateTable(message slack.InteractionCallback, act *slack.BlockAction) error {
+	msg, err := util.TablePageFromValue(act.Value)
+	if err != nil {
+		return err
+	}
+	return a.replaceMessage(message.Channel.ID, message.Message.Timestamp, msg)
+}
@@ -0,0 +1,68 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"github.com/go-kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+)
+
+// runbookFor returns the alertname and the runbook of the alerts of the message and whether there is one.
+// Alert groups posted by Pulsar carry their labels and runbook URL. For other alerts the region and alertname
+// are parsed from the summary, e.g. of the incident.
+func (a *API) runbookFor(message *slack.Message, summary string) (string, config.Runbook, bool) {
+	labels, runbookURL := models.AlertGroupRunbook(message)
+	if labels["alertname"] == "" {
+		region, alertname, err := clients.ParseRegionAndAlertnameFromText(summary)
+		if err != nil && runbookURL == "" {
+			return "", config.Runbook{}, false
+		}
+		labels["alertname"], labels["region"] = alertname, region
+	}
+
+	runbook, ok := a.runbooks.Find(labels, runbookURL)
+	return labels["alertname"], runbook, ok
+}
+
+// postRunbook posts the runbook of the alerts in the thread of the message and adds the book emoji to it
+// unless it was posted already.
+func (a *API) postRunbook(channelID string, message *slack.Message, summary string) error {
+	if hasReaction(message, emojiRunbook) {
+		return nil
+	}
+
+	alertname, runbook, ok := a.runbookFor(message, summary)
+	if !ok {
+		level.Debug(a.logger).Log("msg", "no runbook found", "channel", channelID, "timestamp", message.Timestamp)
+		return nil
+	}
+
+	if _, _, err := a.slackBotClient.PostMessage(
+		channelID,
+		slack.MsgOptionText(models.NewRunbookMessage(alertname, runbook).Text, false),
+		slack.MsgOptionTS(message.Timestamp),
+	); err != nil {
+		return err
+	}
+	return a.slackBotClient.AddReactionToMessage(channelID, message.Timestamp, emojiRunbook)
+}
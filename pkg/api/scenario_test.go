@@ -0,0 +1,199 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/fake"
+	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	scenarioChannelID = "CALERTS"
+	scenarioServiceID = "PSVC1"
+	scenarioUserID    = "UALICE"
+	// scenarioGuestID is an authorized user without a PagerDuty account.
+	scenarioGuestID = "UCAROL"
+
+	scenarioWebhookToken = "alertmanager-token"
+)
+
+// scenario runs the API against the fake Slack and PagerDuty.
+type scenario struct {
+	slack        *fake.Slack
+	pagerduty    *fake.Pagerduty
+	alertmanager *fake.Alertmanager
+	api          *API
+	interaction  *httptest.Server
+}
+
+func newScenario(t *testing.T) *scenario {
+	return newScenarioWithEnv(t, nil)
+}
+
+// newScenarioWithEnv is like newScenario but sets the given environment variables in addition to or instead of the
+// ones of the scenario.
+func newScenarioWithEnv(t *testing.T, env map[string]string) *scenario {
+	s := &scenario{slack: fake.NewSlack(), pagerduty: fake.NewPagerduty(), alertmanager: fake.NewAlertmanager()}
+	t.Cleanup(s.slack.Close)
+	t.Cleanup(s.pagerduty.Close)
+	t.Cleanup(s.alertmanager.Close)
+
+	s.slack.AddUser(slack.User{ID: scenarioUserID, Name: "alice", Profile: slack.UserProfile{Email: "alice@example.com"}})
+	s.slack.AddUser(slack.User{ID: scenarioGuestID, Name: "carol", Profile: slack.UserProfile{Email: "carol@example.com"}})
+	s.slack.AddUserGroup("pulsar-users", scenarioUserID, scenarioGuestID)
+	s.slack.AddChannel(scenarioChannelID, "alerts")
+
+	s.pagerduty.AddUser("Pulsar", "pulsar@example.com")
+	s.pagerduty.AddUser("Alice", "alice@example.com")
+	s.pagerduty.AddService(scenarioServiceID, "Alerts", "")
+
+	for k, v := range map[string]string{
+		"SLACK_API_URL":                     s.slack.URL(),
+		"SLACK_BOT_TOKEN":                   fake.SlackBotToken,
+		"SLACK_BOT_ID":                      fake.SlackBotID,
+		"SLACK_ACCESS_TOKEN":                fake.SlackAccessToken,
+		"SLACK_VERIFICATION_TOKEN":          fake.SlackVerificationToken,
+		"SLACK_AUTHORIZED_USER_GROUP_NAMES": "pulsar-users",
+		"SLACK_CHANNELS_ID_LIST":            scenarioChannelID,
+		"PAGERDUTY_API_URL":                 s.pagerduty.URL(),
+		"PAGERDUTY_EVENTS_API_URL":          s.pagerduty.URL(),
+		"PAGERDUTY_AUTH_TOKEN":              fake.PagerdutyToken,
+		"PAGERDUTY_DEFAULT_EMAIL":           "pulsar@example.com",
+		"PAGERDUTY_SERVICES_ID_LIST":        scenarioServiceID,
+		"ALERTMANAGER_WEBHOOK_TOKEN":        scenarioWebhookToken,
+		"ALERTMANAGER_RECEIVER_CHANNELS":    "slack-alerts=" + scenarioChannelID,
+		"ALERTMANAGER_API_URL":              s.alertmanager.URL() + "/{region}",
+	} {
+		t.Setenv(k, v)
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	config.SetFile("")
+	t.Cleanup(func() { config.SetFile("") })
+
+	cfg, err := config.NewSlackConfigFromEnv()
+	require.NoError(t, err, "there should be no error loading the configuration")
+
+	authorizer, err := auth.New(cfg, util.NewLogger())
+	require.NoError(t, err, "there should be no error creating the authorizer")
+
+	s.api, err = New(authorizer, cfg, util.NewLogger())
+	require.NoError(t, err, "there should be no error creating the api")
+
+	s.interaction = httptest.NewServer(http.HandlerFunc(s.api.handleInteraction))
+	t.Cleanup(s.interaction.Close)
+	return s
+}
+
+func TestScenarioAcknowledgeAlert(t *testing.T) {
+	s := newScenario(t)
+
+	// Alertmanager posts the alert with an acknowledge button. PagerDuty opens an incident for it.
+	alertTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{
+		Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping*",
+		Actions: []slack.AttachmentAction{
+			{Name: actionName, Type: actionType, Text: "Acknowledge", Value: actionValueAcknowledge},
+		},
+	})
+	incident := s.pagerduty.TriggerIncident(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+
+	// The user clicks the button.
+	err := s.slack.ClickAttachmentButton(s.interaction.URL, scenarioChannelID, alertTS, scenarioUserID, actionName, actionValueAcknowledge)
+	require.NoError(t, err, "there should be no error clicking the acknowledge button")
+
+	incident, _ = s.pagerduty.Incident(incident.ID)
+	assert.Equal(t, "acknowledged", incident.Status, "the incident should be acknowledged")
+	if assert.Len(t, incident.Acknowledgements, 1, "the incident should be acknowledged once") {
+		assert.Equal(t, "Alice", incident.Acknowledgements[0].Acknowledger.Summary, "the incident should be acknowledged by the user who clicked")
+	}
+	assert.Empty(t, s.pagerduty.Notes(incident.ID), "no note should be added if the user exists in pagerduty")
+
+	assert.Equal(t, []string{emojiFirefighter}, s.slack.Reactions(scenarioChannelID, alertTS), "the alert should be marked as acknowledged")
+	replies := s.slack.Replies(scenarioChannelID, alertTS)
+	if assert.Len(t, replies, 1, "the acknowledgement should be posted in the thread") {
+		assert.Equal(t, "Acknowledged by <@UALICE>", replies[0].Text)
+	}
+
+	// The user replies in the thread, which the next sync mirrors as note next to the link to the incident.
+	s.slack.SendMessage(scenarioChannelID, alertTS, scenarioUserID, "looking into it")
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+
+	assert.ElementsMatch(t, []string{emojiFirefighter, emojiPagerDuty}, s.slack.Reactions(scenarioChannelID, alertTS), "the alert should be marked as synced")
+	replies = s.slack.Replies(scenarioChannelID, alertTS)
+	if assert.Len(t, replies, 3, "the link to the incident should be posted in the thread") {
+		assert.Contains(t, replies[2].Text, "PD Incident (1): ")
+	}
+	notes := s.pagerduty.Notes(incident.ID)
+	if assert.Len(t, notes, 1, "the reply should be added as note") {
+		assert.Contains(t, notes[0].Content, "alice wrote in Slack: looking into it")
+	}
+
+	// Syncing again changes nothing.
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+	assert.Len(t, s.slack.Replies(scenarioChannelID, alertTS), 3, "nothing should be posted twice")
+	assert.Len(t, s.pagerduty.Notes(incident.ID), 1, "no note should be added twice")
+}
+
+func TestScenarioAcknowledgeAlertDefaultUser(t *testing.T) {
+	s := newScenario(t)
+
+	alertTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping*"})
+	incident := s.pagerduty.TriggerIncident(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+
+	// Carol has no PagerDuty user, so the incident is acknowledged by the default user and she is noted.
+	err := s.slack.ClickAttachmentButton(s.interaction.URL, scenarioChannelID, alertTS, scenarioGuestID, actionName, actionValueAcknowledge)
+	require.NoError(t, err, "there should be no error clicking the acknowledge button")
+	notes := s.pagerduty.Notes(incident.ID)
+	if assert.Len(t, notes, 1, "the actual acknowledger should be added as note") {
+		assert.Contains(t, notes[0].Content, "Incident was acknowledged on behalf of carol")
+	}
+
+	// The sync does not post the note of Pulsar back in the thread.
+	require.NoError(t, s.api.pd_slack_incidents_sync(), "there should be no error syncing incidents")
+	for _, reply := range s.slack.Replies(scenarioChannelID, alertTS) {
+		assert.NotContains(t, reply.Text, "Note by", "the note added by Pulsar should not be posted")
+	}
+}
+
+func TestScenarioAcknowledgeAlertUnknownUser(t *testing.T) {
+	s := newScenario(t)
+	s.slack.AddUser(slack.User{ID: "UBOB", Name: "bob", Profile: slack.UserProfile{Email: "bob@example.com"}})
+	s.slack.AddUserGroup("others", "UBOB")
+
+	alertTS := s.slack.PostAlert(scenarioChannelID, slack.Attachment{Text: "*[EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping*"})
+	incident := s.pagerduty.TriggerIncident(scenarioServiceID, "[#1] [EU-DE-1] OpenstackLbaasApiFlapping - lbaas API flapping")
+
+	err := s.slack.ClickAttachmentButton(s.interaction.URL, scenarioChannelID, alertTS, "UBOB", actionName, actionValueAcknowledge)
+	assert.Error(t, err, "users who are not authorized should be rejected")
+
+	incident, _ = s.pagerduty.Incident(incident.ID)
+	assert.Equal(t, "triggered", incident.Status, "the incident should not be acknowledged")
+	assert.Empty(t, s.slack.Reactions(scenarioChannelID, alertTS), "the alert should not be marked")
+}
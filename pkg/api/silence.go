@@ -0,0 +1,189 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+)
+
+const dialogStateSeparator = "|"
+
+// openSilenceDialog opens the silence dialog prefilled with the matchers given by the value of the button.
+// The channel and thread of the message are passed as state, so the silence is posted there.
+func (a *API) openSilenceDialog(message slack.InteractionCallback, act *slack.BlockAction) error {
+	threadTimestamp := message.Message.ThreadTimestamp
+	if threadTimestamp == "" {
+		threadTimestamp = message.Message.Timestamp
+	}
+
+	dialog := models.NewSilenceDialog(act.Value, message.Channel.ID+dialogStateSeparator+threadTimestamp)
+	return errors.Wrap(a.slackBotClient.OpenDialog(message.TriggerID, dialog), "failed to open silence dialog")
+}
+
+// handleDialogSubmission handles the submission of a dialog and responds with the validation errors, if any.
+// Slack expects the response within 3 seconds, so valid submissions are processed after responding.
+func (a *API) handleDialogSubmission(w http.ResponseWriter, message slack.InteractionCallback) {
+	var validationErrors []slack.DialogInputValidationError
+	switch message.CallbackID {
+	case models.CallbackIDSilence:
+		var (
+			region  string
+			silence *clients.Silence
+		)
+		region, silence, validationErrors = a.validateSilence(message)
+		if len(validationErrors) == 0 {
+			go a.silence(message, region, silence)
+		}
+	default:
+		level.Info(a.logger).Log("msg", "ignoring submission of unknown dialog", "callbackID", message.CallbackID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if len(validationErrors) > 0 {
+		json.NewEncoder(w).Encode(slack.DialogInputValidationErrors{Errors: validationErrors})
+	}
+}
+
+// validateSilence returns the region and the silence submitted with the dialog or the validation errors.
+func (a *API) validateSilence(message slack.InteractionCallback) (string, *clients.Silence, []slack.DialogInputValidationError) {
+	submission := message.Submission
+	matchers, err := clients.ParseMatchers(submission[models.SilenceMatchers])
+	if err != nil {
+		return "", nil, dialogError(models.SilenceMatchers, err)
+	}
+
+	region := clients.MatchersRegion(matchers)
+	if _, err := a.amCfg.URLForRegion(region); err != nil {
+		return "", nil, dialogError(models.SilenceMatchers, err)
+	}
+
+	duration, err := time.ParseDuration(strings.TrimSpace(submission[models.SilenceDuration]))
+	if err != nil || duration <= 0 {
+		return "", nil, dialogError(models.SilenceDuration, errors.New("use a positive duration like 30m or 2h"))
+	}
+
+	comment := strings.TrimSpace(submission[models.SilenceComment])
+	if comment == "" {
+		return "", nil, dialogError(models.SilenceComment, errors.New("a comment is required"))
+	}
+
+	createdBy := message.User.Name
+	if createdBy == "" {
+		createdBy = message.User.ID
+	}
+
+	startsAt := time.Now().UTC()
+	return region, &clients.Silence{
+		Matchers:  matchers,
+		StartsAt:  startsAt,
+		EndsAt:    startsAt.Add(duration),
+		CreatedBy: createdBy,
+		Comment:   comment,
+	}, nil
+}
+
+// silence creates the silence in the Alertmanager of the region and posts it with a button to expire it
+// or the error in the thread of the message the dialog was opened from.
+func (a *API) silence(message slack.InteractionCallback, region string, silence *clients.Silence) {
+	channelID, threadTimestamp := message.Channel.ID, ""
+	if state := strings.SplitN(message.State, dialogStateSeparator, 2); len(state) == 2 {
+		channelID, threadTimestamp = state[0], state[1]
+	}
+
+	silenceID, err := a.amClient.CreateSilence(region, *silence)
+	if err != nil {
+		level.Error(a.logger).Log("msg", "failed to create silence", "region", region, "userID", message.User.ID, "err", err.Error())
+		a.postInThread(channelID, threadTimestamp, &slack.Msg{Text: fmt.Sprintf("Failed to silence the alerts in %s :x:\n```\n%s\n```", region, err.Error())})
+		return
+	}
+	level.Info(a.logger).Log("msg", "audit", "decision", "silenced", "region", region, "silenceID", silenceID, "userID", message.User.ID, "matchers", clients.FormatMatchers(silence.Matchers))
+
+	a.postInThread(channelID, threadTimestamp, models.NewSilenceMessage(message.User.ID, region, silenceID, silence.EndsAt))
+}
+
+// expireSilence expires the silence given by the value of the button and replaces the message announcing it.
+// Only the creator of the silence and users with the silence admin role may expire it.
+// The Alertmanager is called after the interaction was acknowledged and errors are posted in the thread.
+func (a *API) expireSilence(message slack.InteractionCallback, act *slack.BlockAction) error {
+	region, silenceID, creatorID, err := models.ParseSilenceExpireValue(act.Value)
+	if err != nil {
+		return err
+	}
+
+	threadTimestamp := message.Message.ThreadTimestamp
+	if threadTimestamp == "" {
+		threadTimestamp = message.Message.Timestamp
+	}
+
+	if !a.mayExpireSilence(message.User.ID, creatorID) {
+		level.Info(a.logger).Log("msg", "rejecting expiry of silence", "region", region, "silenceID", silenceID, "userID", message.User.ID, "creatorID", creatorID)
+		go a.postInThread(message.Channel.ID, threadTimestamp, &slack.Msg{Text: a.expireSilenceDeniedText(creatorID)})
+		return nil
+	}
+
+	go func() {
+		if err := a.amClient.ExpireSilence(region, silenceID); err != nil {
+			level.Error(a.logger).Log("msg", "failed to expire silence", "region", region, "silenceID", silenceID, "err", err.Error())
+			a.postInThread(message.Channel.ID, threadTimestamp, &slack.Msg{Text: fmt.Sprintf("Failed to expire the silence `%s` :x:\n```\n%s\n```", silenceID, err.Error())})
+			return
+		}
+		level.Info(a.logger).Log("msg", "audit", "decision", "expired silence", "region", region, "silenceID", silenceID, "userID", message.User.ID)
+
+		if err := a.replaceMessage(message.Channel.ID, message.Message.Timestamp, models.NewSilenceExpiredMessage(message.User.ID, region, silenceID)); err != nil {
+			level.Error(a.logger).Log("msg", "failed to update silence message", "silenceID", silenceID, "err", err.Error())
+		}
+	}()
+	return nil
+}
+
+// mayExpireSilence returns whether the user created the silence or has the silence admin role.
+func (a *API) mayExpireSilence(userID, creatorID string) bool {
+	if creatorID != "" && userID == creatorID {
+		return true
+	}
+	return a.silenceAdminRole != "" && a.authorizer.IsUserAuthorized(userID, a.silenceAdminRole)
+}
+
+func (a *API) expireSilenceDeniedText(creatorID string) string {
+	switch {
+	case creatorID == "" && a.silenceAdminRole == "":
+		return "This silence can only be expired in the Alertmanager"
+	case creatorID == "":
+		return fmt.Sprintf("Only users with role %s can expire this silence", a.silenceAdminRole)
+	case a.silenceAdminRole == "":
+		return fmt.Sprintf("Only <@%s> can expire this silence", creatorID)
+	default:
+		return fmt.Sprintf("Only <@%s> or users with role %s can expire this silence", creatorID, a.silenceAdminRole)
+	}
+}
+
+func dialogError(name string, err error) []slack.DialogInputValidationError {
+	return []slack.DialogInputValidationError{{Name: name, Error: err.Error()}}
+}
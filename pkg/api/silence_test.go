@@ -0,0 +1,129 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buttonValue returns the value of the button with the given action ID of the message.
+func buttonValue(t *testing.T, msg slack.Message, actionID string) string {
+	for _, block := range msg.Blocks.BlockSet {
+		actionBlock, ok := block.(*slack.ActionBlock)
+		if !ok {
+			continue
+		}
+		for _, element := range actionBlock.Elements.ElementSet {
+			if button, ok := element.(*slack.ButtonBlockElement); ok && button.ActionID == actionID {
+				return button.Value
+			}
+		}
+	}
+	require.Failf(t, "button not found", "the message should have a button with action ID %s", actionID)
+	return ""
+}
+
+func TestScenarioSilenceAlert(t *testing.T) {
+	s := newScenario(t)
+	require.Equal(t, http.StatusOK, s.notify(t, scenarioWebhookToken, newAlertGroup(models.AlertStatusFiring, models.AlertStatusFiring)))
+	alert := s.slack.Messages(scenarioChannelID)[0]
+
+	// The user clicks the silence button, which opens the dialog prefilled with the labels of the alerts.
+	matchers := buttonValue(t, alert, models.ActionIDAlertSilence)
+	assert.Equal(t, "alertname=OpenstackLbaasApiFlapping\nregion=eu-de-1", matchers)
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, alert.Timestamp, scenarioUserID, models.ActionIDAlertSilence, matchers))
+	dialogs := s.slack.Dialogs()
+	require.Len(t, dialogs, 1, "the silence dialog should be opened")
+	assert.Equal(t, models.CallbackIDSilence, dialogs[0].CallbackID)
+
+	submission := map[string]string{
+		models.SilenceMatchers: matchers,
+		models.SilenceDuration: "soon",
+		models.SilenceComment:  "flapping during the lbaas upgrade",
+	}
+	assert.Error(t, s.slack.SubmitDialog(s.interaction.URL, scenarioChannelID, scenarioUserID, dialogs[0], submission), "an invalid duration should be rejected")
+	assert.Empty(t, s.alertmanager.Silences(), "no silence should be created for invalid input")
+
+	// The user submits the dialog, which creates the silence in the region of the alerts and posts it in the thread.
+	submission[models.SilenceDuration] = "2h"
+	require.NoError(t, s.slack.SubmitDialog(s.interaction.URL, scenarioChannelID, scenarioUserID, dialogs[0], submission))
+	require.Eventually(t, func() bool { return len(s.slack.Replies(scenarioChannelID, alert.Timestamp)) == 1 }, time.Second, 10*time.Millisecond,
+		"the silence should be posted in the thread of the alert")
+	silences := s.alertmanager.Silences()
+	require.Len(t, silences, 1, "the silence should be created")
+	assert.Equal(t, "eu-de-1", silences[0].Region)
+	assert.Equal(t, "alice", silences[0].CreatedBy)
+	assert.Len(t, silences[0].Matchers, 2)
+
+	replies := s.slack.Replies(scenarioChannelID, alert.Timestamp)
+	assert.Contains(t, replies[0].Text, silences[0].ID)
+
+	// Others may not expire the silence.
+	expire := buttonValue(t, replies[0], models.ActionIDSilenceExpire)
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, replies[0].Timestamp, scenarioGuestID, models.ActionIDSilenceExpire, expire))
+	assert.Eventually(t, func() bool { return hasReply(s, alert.Timestamp, "Only <@UALICE> can expire this silence") }, time.Second, 10*time.Millisecond,
+		"the expiry by others should be rejected")
+	assert.Equal(t, "active", s.alertmanager.Silences()[0].Status.State, "the silence should not be expired by others")
+
+	// The user expires the silence.
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, replies[0].Timestamp, scenarioUserID, models.ActionIDSilenceExpire, expire))
+	assert.Eventually(t, func() bool {
+		reply, _ := s.slack.Message(scenarioChannelID, replies[0].Timestamp)
+		return strings.Contains(reply.Text, "expired the silence")
+	}, time.Second, 10*time.Millisecond, "the message should be replaced")
+	assert.Equal(t, "expired", s.alertmanager.Silences()[0].Status.State, "the silence should be expired")
+}
+
+func TestScenarioExpireSilenceAdmin(t *testing.T) {
+	t.Setenv("ALERTMANAGER_SILENCE_ADMIN_ROLE", "base")
+	s := newScenario(t)
+
+	msg := models.NewSilenceMessage(scenarioUserID, "eu-de-1", "silence-1", time.Now().Add(time.Hour))
+	threadTS := s.slack.SendMessage(scenarioChannelID, "", scenarioUserID, "silence alertname=Foo")
+	silenceTS := s.slack.SendMessage(scenarioChannelID, threadTS, scenarioUserID, msg.Text)
+
+	// Users with the silence admin role may expire silences of others.
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, silenceTS, scenarioGuestID, models.ActionIDSilenceExpire,
+		buttonValue(t, slack.Message{Msg: *msg}, models.ActionIDSilenceExpire)))
+	assert.Eventually(t, func() bool { return hasReply(s, threadTS, "Failed to expire the silence `silence-1`") }, time.Second, 10*time.Millisecond,
+		"the expiry should be attempted and the failure of unknown silences posted in the thread")
+}
+
+func TestScenarioSilenceWithoutRegion(t *testing.T) {
+	s := newScenario(t)
+	alertTS := s.slack.SendMessage(scenarioChannelID, "", scenarioUserID, "silence alertname=Foo")
+	require.NoError(t, s.slack.ClickBlockButton(s.interaction.URL, scenarioChannelID, alertTS, scenarioUserID, models.ActionIDAlertSilence, "alertname=Foo"))
+
+	err := s.slack.SubmitDialog(s.interaction.URL, scenarioChannelID, scenarioUserID, s.slack.Dialogs()[0], map[string]string{
+		models.SilenceMatchers: "alertname=Foo",
+		models.SilenceDuration: "1h",
+		models.SilenceComment:  "testing",
+	})
+	assert.Error(t, err, "silences without region should be rejected")
+	assert.Empty(t, s.alertmanager.Silences())
+}
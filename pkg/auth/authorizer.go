@@ -20,6 +20,7 @@
 package auth
 
 import (
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -37,6 +38,8 @@ type Authorizer struct {
 	client         *slack.Client
 	tickerInterval time.Duration
 
+	// mtx guards the user IDs which are replaced on every refresh.
+	mtx sync.RWMutex
 	authorizedUserIDs,
 	kubernetesAdminsUserIDs,
 	kubernetesUsersUserIDs []string
@@ -44,7 +47,7 @@ type Authorizer struct {
 
 // New returns a new Authorizer or an error.
 func New(cfg *config.SlackConfig, logger log.Logger) (*Authorizer, error) {
-	c := slack.New(cfg.AccessToken)
+	c := slack.New(cfg.AccessToken, slack.OptionAPIURL(cfg.APIEndpoint()))
 	if c == nil {
 		return nil, errors.New("cannot create slack client")
 	}
@@ -60,11 +63,21 @@ func New(cfg *config.SlackConfig, logger log.Logger) (*Authorizer, error) {
 		return nil, err
 	}
 
+	// Apply changed user group names immediately.
+	config.OnReload(func() {
+		if err := a.getAuthorizedUserIDs(); err != nil {
+			level.Error(a.logger).Log("msg", "failed to refresh authorized users after configuration reload", "err", err.Error())
+		}
+	})
+
 	return a, nil
 }
 
 // IsUserAuthorized checks whether the given user is authorized to run the bot command.
 func (a *Authorizer) IsUserAuthorized(userID string, requiredUserRole UserRole) bool {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
 	switch requiredUserRole {
 	case UserRoles.Base:
 		return util.Contains(a.authorizedUserIDs, userID)
@@ -104,24 +117,33 @@ func (a *Authorizer) getAuthorizedUserIDs() error {
 		return errors.Wrap(err, "failed to list user groups")
 	}
 
+	authorizedGroupNames, kubernetesUserGroupNames, kubernetesAdminGroupNames := a.cfg.UserGroupNames()
+
+	var authorizedUserIDs, kubernetesUsersUserIDs, kubernetesAdminsUserIDs []string
 	for _, ug := range ugList {
-		if util.Contains(a.cfg.AuthorizedUserGroupNames, ug.Name) {
-			a.authorizedUserIDs = append(a.authorizedUserIDs, ug.Users...)
+		if util.Contains(authorizedGroupNames, ug.Name) {
+			authorizedUserIDs = append(authorizedUserIDs, ug.Users...)
 		}
 
-		if util.Contains(a.cfg.KubernetesUserGroupNames, ug.Name) {
-			a.kubernetesUsersUserIDs = append(a.kubernetesUsersUserIDs, ug.Users...)
+		if util.Contains(kubernetesUserGroupNames, ug.Name) {
+			kubernetesUsersUserIDs = append(kubernetesUsersUserIDs, ug.Users...)
 		}
 
-		if util.Contains(a.cfg.KubernetesAdminGroupNames, ug.Name) {
-			a.kubernetesAdminsUserIDs = append(a.kubernetesAdminsUserIDs, ug.Users...)
+		if util.Contains(kubernetesAdminGroupNames, ug.Name) {
+			kubernetesAdminsUserIDs = append(kubernetesAdminsUserIDs, ug.Users...)
 		}
 	}
 
-	if a.authorizedUserIDs == nil || len(a.authorizedUserIDs) == 0 {
+	if len(authorizedUserIDs) == 0 {
 		return errors.New("not a single user is authorized to respond to slack messages. check configured authorized user groups")
 	}
 
+	a.mtx.Lock()
+	a.authorizedUserIDs = authorizedUserIDs
+	a.kubernetesUsersUserIDs = kubernetesUsersUserIDs
+	a.kubernetesAdminsUserIDs = kubernetesAdminsUserIDs
+	a.mtx.Unlock()
+
 	level.Debug(a.logger).Log("msg", "syncing authorized users from slack groups")
 	return nil
 }
@@ -19,6 +19,11 @@
 
 package auth
 
+import (
+	"fmt"
+	"strings"
+)
+
 // UserRole ...
 type UserRole string
 
@@ -38,3 +43,13 @@ var UserRoles = struct {
 	"KubernetesAdmin",
 	"KubernetesUser",
 }
+
+// ParseUserRole returns the UserRole with the given name ignoring the case or an error.
+func ParseUserRole(name string) (UserRole, error) {
+	for _, role := range []UserRole{UserRoles.Base, UserRoles.KubernetesAdmin, UserRoles.KubernetesUser} {
+		if strings.EqualFold(string(role), name) {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("unknown user role '%s'", name)
+}
@@ -0,0 +1,335 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/auth"
+)
+
+const (
+	// ActionIDConfirm is the action id of the button confirming a pending action.
+	ActionIDConfirm = "confirm"
+
+	// ActionIDCancel is the action id of the button cancelling a pending action.
+	ActionIDCancel = "cancel"
+
+	// ActionIDApprove is the action id of the button approving a confirmed action.
+	ActionIDApprove = "approve"
+
+	// ActionIDReject is the action id of the button rejecting a confirmed action.
+	ActionIDReject = "reject"
+
+	confirmationTimeout = 5 * time.Minute
+	approvalTimeout     = 30 * time.Minute
+)
+
+// Decisions about pending actions.
+const (
+	DecisionConfirmed = "confirmed"
+	DecisionCancelled = "cancelled"
+	DecisionApproved  = "approved"
+	DecisionRejected  = "rejected"
+	DecisionExpired   = "expired"
+	DecisionExecuted  = "executed"
+	DecisionFailed    = "failed"
+)
+
+var pendingActions = struct {
+	sync.Mutex
+	actions map[string]*PendingAction
+}{
+	actions: make(map[string]*PendingAction),
+}
+
+// Decision is a recorded decision about a pending action.
+type Decision struct {
+	UserID   string
+	Decision string
+	Time     time.Time
+}
+
+// PendingAction is an action of a destructive command awaiting the confirmation of the user who requested it
+// and, if an approver role is set, the approval of a second user with that role.
+type PendingAction struct {
+	// ID identifies the action in the buttons.
+	ID string
+
+	// UserID is the id of the slack user who requested the action.
+	UserID string
+
+	// Description is shown in the prompt.
+	Description string
+
+	// ApproverRole is the role of the second user who must approve the action. Empty if no approval is required.
+	ApproverRole auth.UserRole
+
+	// ChannelID and Timestamp identify the message prompting for the decisions.
+	ChannelID,
+	Timestamp string
+
+	// ThreadTimestamp identifies the thread the decisions and the outcome are posted in.
+	ThreadTimestamp string
+
+	// Expires is the time after which the action can no longer be confirmed or approved.
+	Expires time.Time
+
+	// Decisions made so far.
+	Decisions []Decision
+
+	// Run executes the action and returns the response or an error.
+	Run func() (*slack.Msg, error)
+}
+
+// RequestApproval registers the action and returns the message prompting the user to confirm or cancel it.
+// The prompt is expected to be posted as the message identified by channelID and timestamp in the thread given by threadTimestamp.
+func RequestApproval(userID, description string, approverRole auth.UserRole, channelID, timestamp, threadTimestamp string, run func() (*slack.Msg, error)) (*slack.Msg, error) {
+	id, err := newActionID()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate action id")
+	}
+
+	act := &PendingAction{
+		ID:              id,
+		UserID:          userID,
+		Description:     description,
+		ApproverRole:    approverRole,
+		ChannelID:       channelID,
+		Timestamp:       timestamp,
+		ThreadTimestamp: threadTimestamp,
+		Expires:         time.Now().Add(confirmationTimeout),
+		Run:             run,
+	}
+
+	pendingActions.Lock()
+	defer pendingActions.Unlock()
+	pendingActions.actions[id] = act
+
+	return act.ToSlackMessage(), nil
+}
+
+// Decide records the decision of the user clicking the button with the given action id and returns a snapshot of the action.
+// The action is ready to run if it was confirmed and, if required, approved.
+// isAuthorized is used to check whether the approver has the approver role.
+func Decide(id, actionID, userID string, isAuthorized func(userID string, role auth.UserRole) bool) (act *PendingAction, ready bool, err error) {
+	pendingActions.Lock()
+	defer pendingActions.Unlock()
+
+	pending, ok := pendingActions.actions[id]
+	if !ok || time.Now().After(pending.Expires) {
+		return nil, false, errors.New("the action expired or was already handled")
+	}
+
+	var decision string
+	switch actionID {
+	case ActionIDConfirm, ActionIDCancel:
+		if pending.isConfirmed() {
+			return nil, false, errors.New("the action was already confirmed")
+		}
+		if pending.UserID != userID {
+			return nil, false, fmt.Errorf("only <@%s> can confirm or cancel this action", pending.UserID)
+		}
+
+		decision = DecisionCancelled
+		if actionID == ActionIDConfirm {
+			decision = DecisionConfirmed
+		}
+
+	case ActionIDApprove, ActionIDReject:
+		if !pending.isConfirmed() {
+			return nil, false, errors.New("the action needs to be confirmed first")
+		}
+
+		// The requester may withdraw the action but not approve it.
+		if actionID == ActionIDReject && userID == pending.UserID {
+			decision = DecisionRejected
+			break
+		}
+		if userID == pending.UserID {
+			return nil, false, errors.New("the action must be approved by someone else")
+		}
+		if !isAuthorized(userID, pending.ApproverRole) {
+			return nil, false, fmt.Errorf("only users with role %s can approve or reject this action", pending.ApproverRole)
+		}
+
+		decision = DecisionRejected
+		if actionID == ActionIDApprove {
+			decision = DecisionApproved
+		}
+
+	default:
+		return nil, false, fmt.Errorf("unknown action '%s'", actionID)
+	}
+
+	pending.Decisions = append(pending.Decisions, Decision{UserID: userID, Decision: decision, Time: time.Now().UTC()})
+
+	switch {
+	case decision == DecisionCancelled || decision == DecisionRejected:
+		delete(pendingActions.actions, id)
+	case decision == DecisionApproved || pending.ApproverRole == "":
+		ready = true
+		delete(pendingActions.actions, id)
+	default:
+		// Give the approvers more time.
+		pending.Expires = time.Now().Add(approvalTimeout)
+	}
+
+	return pending.snapshot(), ready, nil
+}
+
+// ExpireActions removes all expired actions and returns them.
+func ExpireActions() []*PendingAction {
+	pendingActions.Lock()
+	defer pendingActions.Unlock()
+
+	now := time.Now()
+	res := make([]*PendingAction, 0)
+	for id, act := range pendingActions.actions {
+		if now.After(act.Expires) {
+			act.Decisions = append(act.Decisions, Decision{Decision: DecisionExpired, Time: now.UTC()})
+			res = append(res, act.snapshot())
+			delete(pendingActions.actions, id)
+		}
+	}
+	return res
+}
+
+// Finish records the outcome of running the action, which must have been ready.
+func (p *PendingAction) Finish(err error) {
+	decision := DecisionExecuted
+	if err != nil {
+		decision = DecisionFailed
+	}
+	p.Decisions = append(p.Decisions, Decision{Decision: decision, Time: time.Now().UTC()})
+}
+
+// LastDecision returns the latest decision or nil.
+func (p *PendingAction) LastDecision() *Decision {
+	if len(p.Decisions) == 0 {
+		return nil
+	}
+	return &p.Decisions[len(p.Decisions)-1]
+}
+
+// ToSlackMessage renders the prompt according to the decisions made so far.
+func (p *PendingAction) ToSlackMessage() *slack.Msg {
+	blocks := make([]slack.Block, 0)
+
+	var text string
+	switch last := p.LastDecision(); {
+	case last == nil:
+		text = fmt.Sprintf("<@%s> please confirm: %s", p.UserID, p.Description)
+		blocks = append(blocks, newTextSection(text), slack.NewActionBlock("",
+			newButton(ActionIDConfirm, "Confirm", p.ID, slack.StyleDanger),
+			newButton(ActionIDCancel, "Cancel", p.ID, slack.StyleDefault),
+		))
+
+	case last.Decision == DecisionConfirmed && p.ApproverRole != "":
+		text = fmt.Sprintf("%s is waiting for the approval of a %s", p.Description, p.ApproverRole)
+		blocks = append(blocks, newTextSection(text), slack.NewActionBlock("",
+			newButton(ActionIDApprove, "Approve", p.ID, slack.StyleDanger),
+			newButton(ActionIDReject, "Reject", p.ID, slack.StyleDefault),
+		))
+
+	case last.Decision == DecisionConfirmed || last.Decision == DecisionApproved:
+		text = fmt.Sprintf("%s %s :hourglass:", p.Description, last.Decision)
+		blocks = append(blocks, newTextSection(text))
+
+	case last.Decision == DecisionExecuted:
+		text = fmt.Sprintf("%s executed :white_check_mark:", p.Description)
+		blocks = append(blocks, newTextSection(text))
+
+	case last.Decision == DecisionFailed:
+		text = fmt.Sprintf("%s failed :x:", p.Description)
+		blocks = append(blocks, newTextSection(text))
+
+	default:
+		text = fmt.Sprintf("~%s~ %s", p.Description, last.Decision)
+		blocks = append(blocks, newTextSection(text))
+	}
+
+	if len(p.Decisions) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, p.decisionsToString(), false, false)))
+	}
+
+	blockMsg := slack.NewBlockMessage(blocks...)
+	blockMsg.Msg.Text = text
+	return &blockMsg.Msg
+}
+
+func (p *PendingAction) decisionsToString() string {
+	res := make([]string, 0, len(p.Decisions))
+	for _, d := range p.Decisions {
+		res = append(res, d.String())
+	}
+	return strings.Join(res, ", ")
+}
+
+// String returns the decision with the user who made it and its time.
+func (d Decision) String() string {
+	if d.UserID == "" {
+		return fmt.Sprintf("%s at %s", d.Decision, d.Time.Format("15:04 MST"))
+	}
+	return fmt.Sprintf("%s by <@%s> at %s", d.Decision, d.UserID, d.Time.Format("15:04 MST"))
+}
+
+func (p *PendingAction) isConfirmed() bool {
+	for _, d := range p.Decisions {
+		if d.Decision == DecisionConfirmed {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot must be called while holding the lock.
+func (p *PendingAction) snapshot() *PendingAction {
+	res := *p
+	res.Decisions = append([]Decision(nil), p.Decisions...)
+	return &res
+}
+
+func newTextSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+func newButton(actionID, text, value string, style slack.Style) *slack.ButtonBlockElement {
+	btn := slack.NewButtonBlockElement(actionID, value, slack.NewTextBlockObject(slack.PlainTextType, text, false, false))
+	if style != slack.StyleDefault {
+		btn.WithStyle(style)
+	}
+	return btn
+}
+
+func newActionID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
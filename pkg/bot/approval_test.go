@@ -0,0 +1,98 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func isAdmin(userID string, role auth.UserRole) bool {
+	return userID == "UADMIN" && role == auth.UserRoles.KubernetesAdmin
+}
+
+func requestTestApproval(t *testing.T, approverRole auth.UserRole) string {
+	msg, err := RequestApproval("UREQUESTER", "scale deployment kube-system/coredns", approverRole, "C1", "1.1", "1.0", func() (*slack.Msg, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err, "there should be no error requesting the approval")
+	return msg.Blocks.BlockSet[1].(*slack.ActionBlock).Elements.ElementSet[0].(*slack.ButtonBlockElement).Value
+}
+
+func TestTwoPersonApproval(t *testing.T) {
+	id := requestTestApproval(t, auth.UserRoles.KubernetesAdmin)
+
+	_, _, err := Decide(id, ActionIDConfirm, "UOTHER", isAdmin)
+	assert.Error(t, err, "only the requester may confirm")
+
+	_, _, err = Decide(id, ActionIDApprove, "UADMIN", isAdmin)
+	assert.Error(t, err, "the action must be confirmed before it can be approved")
+
+	act, ready, err := Decide(id, ActionIDConfirm, "UREQUESTER", isAdmin)
+	assert.NoError(t, err)
+	assert.False(t, ready, "the action should wait for the approval")
+	assert.Equal(t, DecisionConfirmed, act.LastDecision().Decision)
+
+	_, _, err = Decide(id, ActionIDApprove, "UREQUESTER", isAdmin)
+	assert.Error(t, err, "the requester must not approve the own action")
+
+	_, _, err = Decide(id, ActionIDApprove, "UOTHER", isAdmin)
+	assert.Error(t, err, "only users with the approver role may approve")
+
+	act, ready, err = Decide(id, ActionIDApprove, "UADMIN", isAdmin)
+	assert.NoError(t, err)
+	assert.True(t, ready, "the action should be ready after the approval")
+	assert.Len(t, act.Decisions, 2, "both decisions should be recorded")
+
+	_, _, err = Decide(id, ActionIDApprove, "UADMIN", isAdmin)
+	assert.Error(t, err, "the action should be handled only once")
+}
+
+func TestConfirmationOnly(t *testing.T) {
+	id := requestTestApproval(t, "")
+
+	act, ready, err := Decide(id, ActionIDConfirm, "UREQUESTER", isAdmin)
+	assert.NoError(t, err)
+	assert.True(t, ready, "the action should be ready after the confirmation")
+
+	act.Finish(nil)
+	assert.Equal(t, DecisionExecuted, act.LastDecision().Decision)
+	assert.Equal(t, "scale deployment kube-system/coredns executed :white_check_mark:", act.ToSlackMessage().Text)
+}
+
+func TestExpireActions(t *testing.T) {
+	id := requestTestApproval(t, "")
+
+	pendingActions.Lock()
+	pendingActions.actions[id].Expires = time.Now().Add(-time.Second)
+	pendingActions.Unlock()
+
+	_, _, err := Decide(id, ActionIDConfirm, "UREQUESTER", isAdmin)
+	assert.Error(t, err, "expired actions cannot be confirmed")
+
+	expired := ExpireActions()
+	assert.Len(t, expired, 1)
+	assert.Equal(t, DecisionExpired, expired[0].LastDecision().Decision)
+	assert.Equal(t, "C1", expired[0].ChannelID)
+}
@@ -0,0 +1,357 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+// ArgumentType determines how the value of an argument is parsed.
+type ArgumentType int
+
+const (
+	// ArgString is a string. Positional strings may contain spaces if they are the last positional argument
+	// or are followed by a positional argument of another type.
+	ArgString ArgumentType = iota
+	// ArgInt is an integer.
+	ArgInt
+	// ArgDuration is a duration like 8h, 2d or 1w.
+	ArgDuration
+	// ArgUser is a Slack user mention.
+	ArgUser
+	// ArgCluster is the name or an alias of a region of the region catalog. Its value is the name of the region.
+	ArgCluster
+	// ArgEnum is one of the values of the argument.
+	ArgEnum
+	// ArgFlag is a boolean flag given as --name.
+	ArgFlag
+)
+
+var argumentTypeNames = map[ArgumentType]string{
+	ArgString:   "text",
+	ArgInt:      "number",
+	ArgDuration: "duration",
+	ArgUser:     "@user",
+	ArgCluster:  "cluster",
+	ArgEnum:     "one of",
+	ArgFlag:     "flag",
+}
+
+func (t ArgumentType) String() string {
+	return argumentTypeNames[t]
+}
+
+// Argument declares an argument of a command.
+// Positional arguments are given in order. All others are given as name=value, --name value or, if set, $prefix value.
+type Argument struct {
+	Name        string
+	Type        ArgumentType
+	Positional  bool
+	Required    bool
+	Description string
+
+	// Default is used if the argument is not given.
+	Default string
+	// Values are the allowed values of an ArgEnum.
+	Values []string
+	// Prefix is an optional word preceding the value of a non-positional argument, like `in $cluster`.
+	Prefix string
+}
+
+// ArgumentsCommand is a Command declaring its arguments.
+type ArgumentsCommand interface {
+	Command
+
+	// Arguments returns the arguments of the command.
+	Arguments() []Argument
+}
+
+// UsageError is returned if the arguments of a command are invalid.
+// The bot responds with the error and the usage of the command.
+type UsageError struct {
+	Err   error
+	Usage string
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("%s. usage: %s", e.Err.Error(), e.Usage)
+}
+
+// Args are the parsed arguments of a command.
+type Args struct {
+	values map[string]interface{}
+}
+
+// IsSet returns true if the argument was given or has a default.
+func (a *Args) IsSet(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// String returns the value of an ArgString, ArgEnum, ArgUser or ArgCluster argument.
+func (a *Args) String(name string) string {
+	s, _ := a.values[name].(string)
+	return s
+}
+
+// Int returns the value of an ArgInt argument.
+func (a *Args) Int(name string) int {
+	i, _ := a.values[name].(int)
+	return i
+}
+
+// Duration returns the value of an ArgDuration argument.
+func (a *Args) Duration(name string) time.Duration {
+	d, _ := a.values[name].(time.Duration)
+	return d
+}
+
+// Bool returns true if the ArgFlag argument was given.
+func (a *Args) Bool(name string) bool {
+	b, _ := a.values[name].(bool)
+	return b
+}
+
+// Usage returns the usage of the command like `cover $user $schedule $duration`.
+func Usage(cmd ArgumentsCommand) string {
+	parts := make([]string, 0)
+	if keywords := cmd.Keywords(); len(keywords) > 0 {
+		parts = append(parts, keywords[0])
+	}
+
+	for _, arg := range cmd.Arguments() {
+		var part string
+		switch {
+		case arg.Type == ArgFlag:
+			part = "--" + arg.Name
+		case arg.Type == ArgEnum && arg.Positional:
+			part = strings.Join(arg.Values, "|")
+		case arg.Positional:
+			part = "$" + arg.Name
+		case arg.Prefix != "":
+			part = fmt.Sprintf("%s $%s", arg.Prefix, arg.Name)
+		default:
+			part = fmt.Sprintf("%s=$%s", arg.Name, arg.Name)
+		}
+
+		if !arg.Required {
+			part = fmt.Sprintf("[%s]", part)
+		}
+		parts = append(parts, part)
+	}
+
+	return fmt.Sprintf("`%s`", strings.Join(parts, " "))
+}
+
+// ParseArguments parses the arguments of the command from the text following its keyword.
+// A *UsageError is returned if the arguments are invalid.
+func ParseArguments(cmd ArgumentsCommand, text string) (*Args, error) {
+	args, err := parseArguments(cmd.Arguments(), strings.Fields(trimLongestKeyword(cmd.Keywords(), text)))
+	if err != nil {
+		return nil, &UsageError{Err: err, Usage: Usage(cmd)}
+	}
+	return args, nil
+}
+
+func parseArguments(spec []Argument, words []string) (*Args, error) {
+	args := &Args{values: make(map[string]interface{})}
+
+	// Slack replaces -- with an em dash.
+	for idx, w := range words {
+		if strings.HasPrefix(w, "—") {
+			words[idx] = "--" + strings.TrimPrefix(w, "—")
+		}
+	}
+
+	positionals := make([]Argument, 0)
+	named := make(map[string]Argument)
+	prefixed := make(map[string]Argument)
+	for _, arg := range spec {
+		if arg.Positional {
+			positionals = append(positionals, arg)
+			continue
+		}
+		named[arg.Name] = arg
+		if arg.Prefix != "" {
+			prefixed[arg.Prefix] = arg
+		}
+	}
+
+	// Extract the named arguments first. All remaining words are positional.
+	rest := make([]string, 0, len(words))
+	for idx := 0; idx < len(words); idx++ {
+		w := words[idx]
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(w, "--"), "=")
+
+		arg, isNamed := named[name]
+		switch {
+		case isNamed && arg.Type == ArgFlag && w == "--"+name:
+			args.values[name] = true
+			continue
+		case isNamed && hasValue:
+		case isNamed && strings.HasPrefix(w, "--") && idx+1 < len(words):
+			idx++
+			value = words[idx]
+		default:
+			if arg, ok := prefixed[w]; ok && idx+1 < len(words) {
+				if _, err := parseValue(arg, words[idx+1]); err == nil {
+					idx++
+					if err := args.set(arg, words[idx]); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+			rest = append(rest, w)
+			continue
+		}
+
+		if err := args.set(arg, value); err != nil {
+			return nil, err
+		}
+	}
+
+	for idx, arg := range positionals {
+		if len(rest) == 0 {
+			break
+		}
+
+		n := 1
+		if arg.Type == ArgString {
+			n = positionalStringLength(rest, positionals[idx+1:])
+		}
+
+		if err := args.set(arg, strings.Join(rest[:n], " ")); err != nil {
+			return nil, err
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected argument '%s'", strings.Join(rest, " "))
+	}
+
+	for _, arg := range spec {
+		if args.IsSet(arg.Name) {
+			continue
+		}
+		if arg.Default != "" {
+			if err := args.set(arg, arg.Default); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if arg.Required {
+			return nil, fmt.Errorf("missing %s", arg.Name)
+		}
+	}
+
+	return args, nil
+}
+
+// positionalStringLength returns the number of words taken by a positional string followed by the given positionals.
+// The last positional string takes all words. Otherwise it takes all words up to the first one valid for the next positional.
+func positionalStringLength(words []string, following []Argument) int {
+	if len(following) == 0 {
+		return len(words)
+	}
+
+	next := following[0]
+	if next.Type == ArgString {
+		return 1
+	}
+
+	for idx := 1; idx < len(words); idx++ {
+		if _, err := parseValue(next, words[idx]); err == nil {
+			return idx
+		}
+	}
+	return len(words)
+}
+
+func (a *Args) set(arg Argument, value string) error {
+	v, err := parseValue(arg, value)
+	if err != nil {
+		return err
+	}
+	a.values[arg.Name] = v
+	return nil
+}
+
+func parseValue(arg Argument, value string) (interface{}, error) {
+	switch arg.Type {
+	case ArgInt:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", arg.Name)
+		}
+		return i, nil
+
+	case ArgDuration:
+		d, err := util.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a duration like 8h, 2d or 1w", arg.Name)
+		}
+		return d, nil
+
+	case ArgUser:
+		users := util.ParseUserMentionsFromString(value)
+		if len(users) != 1 {
+			return nil, fmt.Errorf("%s must mention a user", arg.Name)
+		}
+		return users[0], nil
+
+	case ArgCluster:
+		region, err := config.Regions().Resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a region: %s", arg.Name, err.Error())
+		}
+		return region, nil
+
+	case ArgEnum:
+		if !util.Contains(arg.Values, strings.ToLower(value)) {
+			return nil, fmt.Errorf("%s must be one of %s", arg.Name, strings.Join(arg.Values, ", "))
+		}
+		return strings.ToLower(value), nil
+
+	case ArgFlag:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", arg.Name)
+		}
+		return b, nil
+	}
+
+	if value == "" {
+		return nil, fmt.Errorf("%s must not be empty", arg.Name)
+	}
+	return value, nil
+}
+
+// trimLongestKeyword removes the longest keyword the text starts with.
+func trimLongestKeyword(keywords []string, text string) string {
+	return strings.TrimSpace(strings.TrimPrefix(text, matchingKeyword(keywords, text)))
+}
@@ -0,0 +1,86 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeArgumentsCommand struct {
+	arguments []Argument
+}
+
+func (f *fakeArgumentsCommand) Init() error                     { return nil }
+func (f *fakeArgumentsCommand) Describe() string                { return "fake" }
+func (f *fakeArgumentsCommand) Keywords() []string              { return []string{"cover", "cover on-call"} }
+func (f *fakeArgumentsCommand) IsDisabled() bool                { return false }
+func (f *fakeArgumentsCommand) RequiredUserRole() auth.UserRole { return auth.UserRoles.Base }
+func (f *fakeArgumentsCommand) Arguments() []Argument           { return f.arguments }
+func (f *fakeArgumentsCommand) Run(context.Context, *slack.Msg) (*slack.Msg, error) {
+	return nil, nil
+}
+
+func TestParseArguments(t *testing.T) {
+	cmd := &fakeArgumentsCommand{arguments: []Argument{
+		{Name: "user", Type: ArgUser, Positional: true, Required: true},
+		{Name: "schedule", Type: ArgString, Positional: true, Required: true},
+		{Name: "duration", Type: ArgDuration, Positional: true, Required: true},
+		{Name: "cluster", Type: ArgCluster, Prefix: "in"},
+		{Name: "replicas", Type: ArgInt},
+		{Name: "force", Type: ArgFlag},
+		{Name: "urgency", Type: ArgEnum, Values: []string{"high", "low"}, Default: "low"},
+	}}
+
+	args, err := ParseArguments(cmd, "cover on-call <@u123> my two day shift 2d in eu-de-1 —replicas 3 --force")
+	assert.NoError(t, err, "there should be no error parsing the arguments")
+	assert.Equal(t, "U123", args.String("user"))
+	assert.Equal(t, "my two day shift", args.String("schedule"))
+	assert.Equal(t, 48*time.Hour, args.Duration("duration"))
+	assert.Equal(t, "eu-de-1", args.String("cluster"))
+	assert.Equal(t, 3, args.Int("replicas"))
+	assert.True(t, args.Bool("force"))
+	assert.Equal(t, "low", args.String("urgency"))
+
+	args, err = ParseArguments(cmd, "cover <@u123> schedule 8h urgency=high")
+	assert.NoError(t, err, "there should be no error parsing the arguments")
+	assert.Equal(t, "high", args.String("urgency"))
+	assert.False(t, args.IsSet("cluster"))
+
+	stimuli := []string{
+		"cover <@u123> schedule",
+		"cover someone schedule 8h",
+		"cover <@u123> schedule 8h urgency=medium",
+		"cover <@u123> schedule 8h replicas=many",
+	}
+	for _, text := range stimuli {
+		_, err := ParseArguments(cmd, text)
+		var usageErr *UsageError
+		assert.True(t, errors.As(err, &usageErr), "a usage error is expected for '%s'", text)
+	}
+
+	assert.Equal(t, "`cover $user $schedule $duration [in $cluster] [replicas=$replicas] [--force] [urgency=$urgency]`", Usage(cmd))
+}
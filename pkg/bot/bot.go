@@ -20,8 +20,12 @@
 package bot
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -42,8 +46,35 @@ type Bot struct {
 	channelID   string
 	helpCommand Command
 	commands    []Command
+
+	// jobs are the commands waiting for a worker.
+	jobs           chan job
+	workers        int
+	commandTimeout time.Duration
+
+	userLimiter     *util.RateLimiter
+	commandLimiters map[Command]*util.RateLimiter
+}
+
+// job is a command to be run for a message.
+type job struct {
+	command Command
+	msg     slack.Msg
 }
 
+const (
+	// jobsPerWorker is the number of commands which may wait for each worker.
+	jobsPerWorker = 10
+
+	placeholderText = "Working on it :hourglass_flowing_sand:"
+
+	// directMessageChannelPrefix is the prefix of the ids of direct message channels.
+	directMessageChannelPrefix = "D"
+)
+
+// rateLimitedCommands counts the commands rejected by the per user or per command rate limits.
+var rateLimitedCommands = expvar.NewMap("pulsar_rate_limited_commands_total")
+
 // New returns a new Bot or an error.
 func New(authorizer *auth.Authorizer, cfg *config.SlackConfig, logger log.Logger) (*Bot, error) {
 	slackBotClient, err := clients.NewSlackBotClient(cfg, logger)
@@ -57,29 +88,55 @@ func New(authorizer *auth.Authorizer, cfg *config.SlackConfig, logger log.Logger
 		client:     slackBotClient,
 		rtmClient:  slackBotClient.NewRTM(),
 		botID:      cfg.BotID,
+
+		jobs:           make(chan job, cfg.CommandWorkers*jobsPerWorker),
+		workers:        cfg.CommandWorkers,
+		commandTimeout: cfg.CommandTimeout,
+
+		userLimiter:     util.NewRateLimiter(cfg.UserRateLimit, time.Minute),
+		commandLimiters: make(map[Command]*util.RateLimiter),
 	}
 
-	for _, c := range availableCommands {
-		cmd := c()
-		if err := cmd.Init(); err != nil {
-			level.Error(b.logger).Log("msg", "failed to initialize command", "keywords", strings.Join(cmd.Keywords(), ", "), "description", cmd.Describe(), "err", err.Error())
-			continue
-		}
-		level.Info(b.logger).Log("msg", "registering command", "keywords", strings.Join(cmd.Keywords(), ", "), "description", cmd.Describe())
+	for _, cmd := range initCommands(b.logger) {
 		b.commands = append(b.commands, cmd)
+
+		limit := cfg.CommandRateLimit
+		if rc, ok := cmd.(RateLimitedCommand); ok {
+			limit = rc.RateLimit()
+		}
+		b.commandLimiters[cmd] = util.NewRateLimiter(limit, time.Minute)
 	}
 
-	b.helpCommand = b.newHelpCommand(b.commands)
+	b.helpCommand = newHelpCommand(b.commands)
 	b.commands = append(b.commands, b.helpCommand)
 
 	return b, nil
 }
 
+// initCommands initializes all registered commands and returns those which were initialized successfully.
+func initCommands(logger log.Logger) []Command {
+	res := make([]Command, 0, len(availableCommands))
+	for _, c := range availableCommands {
+		cmd := c()
+		if err := cmd.Init(); err != nil {
+			level.Error(logger).Log("msg", "failed to initialize command", "keywords", strings.Join(cmd.Keywords(), ", "), "description", cmd.Describe(), "err", err.Error())
+			continue
+		}
+		level.Info(logger).Log("msg", "registering command", "keywords", strings.Join(cmd.Keywords(), ", "), "description", cmd.Describe())
+		res = append(res, cmd)
+	}
+	return res
+}
+
 // ListenAndRespond will make the bot listen to events and respond o them.
 func (b *Bot) ListenAndRespond(stop <-chan struct{}) {
 	// Listen to slack events.
 	go b.rtmClient.ManageConnection()
 
+	for i := 0; i < b.workers; i++ {
+		go b.work()
+	}
+
 	for {
 		select {
 		case msg := <-b.rtmClient.IncomingEvents:
@@ -109,59 +166,218 @@ func (b *Bot) handleMessageEvent(e *slack.MessageEvent) error {
 	info := b.rtmClient.GetInfo()
 	prefix := fmt.Sprintf("<@%s>", info.User.ID)
 
-	if !strings.HasPrefix(e.Text, prefix) {
+	// Never respond to bots including itself.
+	if e.BotID != "" || e.User == info.User.ID {
+		return nil
+	}
+
+	// Only respond if the bot is mentioned or in direct messages.
+	isDirectMessage := strings.HasPrefix(e.Channel, directMessageChannelPrefix) && e.SubType == ""
+	if !strings.HasPrefix(e.Text, prefix) && !isDirectMessage {
 		return nil
 	}
 
-	// Only respond if the bot is mentioned.
-	text := e.Msg.Text
-	text = strings.TrimPrefix(text, prefix)
-	text = strings.TrimSpace(text)
-	text = strings.ToLower(text)
+	original := e.Msg.Text
+	original = strings.TrimPrefix(original, prefix)
+	original = strings.TrimSpace(original)
+	text := strings.ToLower(original)
 
 	// Update original message text with normalized one.
 	e.Msg.Text = text
 
-	atLeastOneCommand := false
-	for _, c := range b.commands {
-		if util.HasAnyPrefix(c.Keywords(), text) {
+	c := findCommand(b.commands, text)
+	if c == nil {
+		return b.respond(b.unknownCommandResponse(text), &e.Msg)
+	}
+	e.Msg.Text = commandText(c, original)
 
-			if !b.authorizer.IsUserAuthorized(e.Msg.User, c.RequiredUserRole()) {
-				level.Debug(b.logger).Log("msg", "user is not authorized", "userID", e.Msg.User, "requiredRole", c.RequiredUserRole())
-				b.respond(&slack.Msg{Text: "You are not authorized :x:"}, &e.Msg)
-				return nil
-			}
+	if !b.authorizer.IsUserAuthorized(e.Msg.User, c.RequiredUserRole()) {
+		level.Debug(b.logger).Log("msg", "user is not authorized", "userID", e.Msg.User, "requiredRole", c.RequiredUserRole())
+		return b.respond(&slack.Msg{Text: "You are not authorized :x:"}, &e.Msg)
+	}
 
-			level.Debug(b.logger).Log("msg", "running command", "description", c.Describe())
-			atLeastOneCommand = true
-			response, err := c.Run(&e.Msg)
-			if err != nil {
-				return err
-			}
+	if !b.userLimiter.Allow(e.Msg.User) {
+		rateLimitedCommands.Add("user", 1)
+		return b.respond(&slack.Msg{Text: "You are running too many commands. Please slow down :snail:"}, &e.Msg)
+	}
+
+	if limiter, ok := b.commandLimiters[c]; ok && !limiter.Allow("") {
+		rateLimitedCommands.Add("command", 1)
+		return b.respond(&slack.Msg{Text: "This command ran too often recently. Please try again in a minute :snail:"}, &e.Msg)
+	}
+
+	// Commands are run by the workers so a slow command doesn't block others.
+	select {
+	case b.jobs <- job{command: c, msg: e.Msg}:
+		return nil
+	default:
+		level.Error(b.logger).Log("msg", "too many commands waiting", "description", c.Describe())
+		return b.respond(&slack.Msg{Text: "I'm too busy right now. Please try again later :x:"}, &e.Msg)
+	}
+}
+
+func (b *Bot) work() {
+	for j := range b.jobs {
+		b.runCommand(j.command, &j.msg)
+	}
+}
+
+// runCommand posts a placeholder where the command replies, runs the command and replaces the placeholder with the response.
+// Ephemeral messages cannot be updated so ephemeral replies are posted once the command finished.
+func (b *Bot) runCommand(c Command, msg *slack.Msg) {
+	mode := ReplyInThread
+	if rc, ok := c.(ReplyModeCommand); ok {
+		mode = rc.ReplyMode()
+	}
 
-			if err := b.respond(response, &e.Msg); err != nil {
-				return err
+	// Prompts of destructive commands are updated with each decision which is impossible for ephemeral messages.
+	dc, isDestructive := c.(DestructiveCommand)
+	if isDestructive && mode == ReplyEphemeral {
+		mode = ReplyInThread
+	}
+
+	if mode == ReplyEphemeral {
+		if response := b.run(c, msg); response != nil {
+			opts := append(messageOptions(response), slack.MsgOptionTS(ThreadTimestamp(msg)))
+			if _, err := b.client.PostEphemeral(msg.Channel, msg.User, opts...); err != nil {
+				level.Error(b.logger).Log("msg", "failed to respond", "description", c.Describe(), "err", err.Error())
 			}
 		}
+		return
 	}
 
-	// Show the help if no command could be found.
-	if atLeastOneCommand {
-		return nil
+	channelID, threadTimestamp := msg.Channel, ThreadTimestamp(msg)
+	opts := []slack.MsgOption{slack.MsgOptionTS(threadTimestamp)}
+	if mode == ReplyDirect {
+		imID, err := b.client.OpenDirectMessage(msg.User)
+		if err != nil {
+			level.Error(b.logger).Log("msg", "failed to open direct message", "userID", msg.User, "err", err.Error())
+			return
+		}
+		channelID, threadTimestamp, opts = imID, "", nil
+	}
+
+	_, timestamp, err := b.client.PostMessage(channelID, append(opts, slack.MsgOptionText(placeholderText, false))...)
+	if err != nil {
+		level.Error(b.logger).Log("msg", "failed to post placeholder", "err", err.Error())
+		return
+	}
+
+	var response *slack.Msg
+	if isDestructive {
+		// Direct replies start a thread of their own.
+		if threadTimestamp == "" {
+			threadTimestamp = timestamp
+		}
+		response = b.requestApproval(dc, msg, channelID, timestamp, threadTimestamp)
+	} else {
+		response = b.run(c, msg)
+	}
+
+	// The command already responded by itself.
+	if response == nil {
+		if err := b.client.DeleteMessage(channelID, timestamp); err != nil {
+			level.Error(b.logger).Log("msg", "failed to delete placeholder", "err", err.Error())
+		}
+		return
+	}
+
+	if _, _, _, err := b.client.UpdateMessage(channelID, timestamp, messageOptions(response)...); err != nil {
+		level.Error(b.logger).Log("msg", "failed to respond", "description", c.Describe(), "err", err.Error())
+	}
+}
+
+// run runs the command with a deadline and returns the response or the error to show to the user.
+func (b *Bot) run(c Command, msg *slack.Msg) *slack.Msg {
+	ctx, cancel := context.WithTimeout(context.Background(), b.commandTimeout)
+	defer cancel()
+
+	type result struct {
+		response *slack.Msg
+		err      error
+	}
+	done := make(chan result, 1)
+
+	level.Debug(b.logger).Log("msg", "running command", "description", c.Describe())
+	go func() {
+		response, err := c.Run(ctx, msg)
+		done <- result{response: response, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		level.Error(b.logger).Log("msg", "command timed out", "description", c.Describe(), "timeout", b.commandTimeout.String())
+		return &slack.Msg{Text: fmt.Sprintf("Timed out after %s :x:", b.commandTimeout.String())}
+
+	case res := <-done:
+		return b.responseOrError(c, res.response, res.err)
 	}
+}
 
-	response, err := b.helpCommand.Run(&e.Msg)
+// requestApproval returns the prompt to confirm and approve the destructive command.
+// The command runs once the decisions were made via the API.
+func (b *Bot) requestApproval(c DestructiveCommand, msg *slack.Msg, channelID, timestamp, threadTimestamp string) *slack.Msg {
+	description, err := c.DescribeAction(msg)
 	if err != nil {
-		return err
+		return b.responseOrError(c, nil, err)
 	}
 
-	return b.respond(response, &e.Msg)
+	level.Info(b.logger).Log("msg", "audit", "decision", "requested", "userID", msg.User, "action", description, "approverRole", c.ApproverRole())
+	response, err := RequestApproval(msg.User, description, c.ApproverRole(), channelID, timestamp, threadTimestamp, func() (*slack.Msg, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), b.commandTimeout)
+		defer cancel()
+		return c.Run(ctx, msg)
+	})
+	return b.responseOrError(c, response, err)
+}
+
+// responseOrError returns the response or, if the command failed, the error to show to the user.
+func (b *Bot) responseOrError(c Command, response *slack.Msg, err error) *slack.Msg {
+	if err == nil {
+		return response
+	}
+
+	// Let the user know how to use the command.
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		return &slack.Msg{Text: fmt.Sprintf(":x: %s", usageErr.Error())}
+	}
+
+	level.Error(b.logger).Log("msg", "error running command", "description", c.Describe(), "err", err.Error())
+	return &slack.Msg{Text: "Failed to respond"}
+}
+
+// unknownCommandResponse suggests similar commands or shows the help if there are none.
+func (b *Bot) unknownCommandResponse(text string) *slack.Msg {
+	return unknownCommandResponse(b.commands, b.helpCommand, text)
+}
+
+func unknownCommandResponse(commands []Command, helpCommand Command, text string) *slack.Msg {
+	if suggestions := suggestKeywords(commands, text); len(suggestions) > 0 {
+		return &slack.Msg{Text: fmt.Sprintf("I don't know that command. Did you mean `%s`?", strings.Join(suggestions, "`, `"))}
+	}
+
+	response, err := helpCommand.Run(context.Background(), &slack.Msg{})
+	if err != nil {
+		return &slack.Msg{Text: "I don't know that command. Try `help`."}
+	}
+	return response
 }
 
 func (b *Bot) respond(msg, originalMsg *slack.Msg) error {
-	opts := []slack.MsgOption{
+	opts := append([]slack.MsgOption{
 		slack.MsgOptionUsername(b.botID),
 		slack.MsgOptionAsUser(true),
+		slack.MsgOptionTS(ThreadTimestamp(originalMsg)),
+	}, messageOptions(msg)...)
+
+	_, _, err := b.client.PostMessage(originalMsg.Channel, opts...)
+	return err
+}
+
+// messageOptions returns the options to post or update a message with the text, blocks and attachments of msg.
+func messageOptions(msg *slack.Msg) []slack.MsgOption {
+	opts := []slack.MsgOption{
 		slack.MsgOptionText(msg.Text, false),
 	}
 
@@ -173,6 +389,5 @@ func (b *Bot) respond(msg, originalMsg *slack.Msg) error {
 		opts = append(opts, slack.MsgOptionAttachments(msg.Attachments...))
 	}
 
-	_, _, err := b.client.PostMessage(originalMsg.Channel, opts...)
-	return err
+	return opts
 }
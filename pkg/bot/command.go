@@ -20,6 +20,11 @@
 package bot
 
 import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+
 	"github.com/nlopes/slack"
 	"github.com/sapcc/pulsar/pkg/auth"
 	"github.com/sapcc/pulsar/pkg/util"
@@ -47,7 +52,65 @@ type Command interface {
 	RequiredUserRole() auth.UserRole
 
 	// Run executes the command and returns the response or an error.
-	Run(originalMsg *slack.Msg) (*slack.Msg, error)
+	// A nil response indicates the command already responded by itself.
+	Run(ctx context.Context, originalMsg *slack.Msg) (*slack.Msg, error)
+}
+
+// ReplyMode determines where the bot replies to a command.
+type ReplyMode int
+
+const (
+	// ReplyInThread replies in the thread of the triggering message. This is the default.
+	ReplyInThread ReplyMode = iota
+	// ReplyEphemeral replies with a message only visible to the user who ran the command.
+	ReplyEphemeral
+	// ReplyDirect replies in a direct message to the user who ran the command.
+	ReplyDirect
+)
+
+// ReplyModeCommand is a Command which doesn't reply in the thread of the triggering message.
+type ReplyModeCommand interface {
+	Command
+
+	// ReplyMode returns where to reply to the command.
+	ReplyMode() ReplyMode
+}
+
+// DestructiveCommand is a Command which only runs after the requesting user confirmed it
+// and, if an approver role is given, a second user with that role approved it.
+type DestructiveCommand interface {
+	Command
+
+	// DescribeAction validates the message and returns what the command is going to do. It is shown in the prompt.
+	DescribeAction(originalMsg *slack.Msg) (string, error)
+
+	// ApproverRole returns the role of the second user who must approve the command or an empty role.
+	ApproverRole() auth.UserRole
+}
+
+// RateLimitedCommand is a Command with its own rate limit, e.g. because it is expensive.
+type RateLimitedCommand interface {
+	Command
+
+	// RateLimit returns the number of times the command may run per minute.
+	RateLimit() int
+}
+
+// ExamplesCommand is a Command providing examples shown by `help <command>`.
+type ExamplesCommand interface {
+	Command
+
+	// Examples returns example invocations of the command.
+	Examples() []string
+}
+
+// CaseSensitiveCommand is a Command receiving the text of the message in its original case, e.g. to parse label values.
+// The text of all other commands is lower cased. Keywords are matched case-insensitively either way.
+type CaseSensitiveCommand interface {
+	Command
+
+	// IsCaseSensitive returns true if the command needs the original case of the text.
+	IsCaseSensitive() bool
 }
 
 type CommandFactory func() Command
@@ -69,3 +132,102 @@ func RegisterCommand(factory CommandFactory) {
 
 	availableCommands = append(availableCommands, factory)
 }
+
+// ThreadTimestamp returns the timestamp of the thread the message belongs to or the timestamp of the message itself
+// to start a new thread.
+func ThreadTimestamp(msg *slack.Msg) string {
+	if msg.ThreadTimestamp != "" {
+		return msg.ThreadTimestamp
+	}
+	return msg.Timestamp
+}
+
+// commandText returns the text passed to the command. It is lower cased unless the command is case sensitive,
+// in which case only the keyword is.
+// Slack escapes &, < and > in messages. They are unescaped for case sensitive commands, e.g. for comparisons in
+// PromQL or regular expressions of matchers. Mentions and links keep their brackets as they are not escaped.
+func commandText(c Command, text string) string {
+	lower := strings.ToLower(text)
+	if cc, ok := c.(CaseSensitiveCommand); !ok || !cc.IsCaseSensitive() {
+		return lower
+	}
+	if len(lower) != len(text) {
+		return html.UnescapeString(lower)
+	}
+
+	keyword := matchingKeyword(c.Keywords(), lower)
+	return keyword + html.UnescapeString(text[len(keyword):])
+}
+
+// findCommand returns the command with the longest keyword matching the text or nil.
+// Commands registered first win if several have an equally long keyword.
+func findCommand(commands []Command, text string) Command {
+	var (
+		res     Command
+		longest string
+	)
+	for _, c := range commands {
+		if keyword := matchingKeyword(c.Keywords(), text); len(keyword) > len(longest) {
+			res, longest = c, keyword
+		}
+	}
+	return res
+}
+
+// matchingKeyword returns the longest keyword the text starts with as whole words or an empty string.
+func matchingKeyword(keywords []string, text string) string {
+	var res string
+	for _, k := range keywords {
+		if k == "" || !strings.HasPrefix(text, k) {
+			continue
+		}
+		// "page" must not match "pagerduty".
+		if len(text) > len(k) && text[len(k)] != ' ' {
+			continue
+		}
+		if len(k) > len(res) {
+			res = k
+		}
+	}
+	return res
+}
+
+// suggestKeywords returns up to 3 keywords similar to the beginning of the text, closest first.
+func suggestKeywords(commands []Command, text string) []string {
+	type suggestion struct {
+		keyword  string
+		distance int
+	}
+
+	words := strings.Fields(text)
+	suggestions := make([]suggestion, 0)
+	for _, c := range commands {
+		for _, k := range c.Keywords() {
+			n := len(strings.Fields(k))
+			if n > len(words) {
+				n = len(words)
+			}
+
+			// Allow one typo per 4 characters.
+			distance := util.EditDistance(strings.Join(words[:n], " "), k)
+			if distance <= len(k)/4+1 {
+				suggestions = append(suggestions, suggestion{keyword: k, distance: distance})
+			}
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+
+	res := make([]string, 0)
+	for _, s := range suggestions {
+		if len(res) == 3 {
+			break
+		}
+		if !util.Contains(res, s.keyword) {
+			res = append(res, s.keyword)
+		}
+	}
+	return res
+}
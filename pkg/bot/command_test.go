@@ -0,0 +1,91 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCommand struct {
+	keywords []string
+}
+
+func (f *fakeCommand) Init() error                     { return nil }
+func (f *fakeCommand) Describe() string                { return f.keywords[0] }
+func (f *fakeCommand) Keywords() []string              { return f.keywords }
+func (f *fakeCommand) IsDisabled() bool                { return false }
+func (f *fakeCommand) RequiredUserRole() auth.UserRole { return auth.UserRoles.Base }
+func (f *fakeCommand) Run(context.Context, *slack.Msg) (*slack.Msg, error) {
+	return nil, nil
+}
+
+func TestFindCommand(t *testing.T) {
+	list := &fakeCommand{keywords: []string{"list incidents"}}
+	listAcknowledged := &fakeCommand{keywords: []string{"list incidents acknowledged"}}
+	page := &fakeCommand{keywords: []string{"page"}}
+	commands := []Command{list, listAcknowledged, page}
+
+	stimuli := map[string]Command{
+		"list incidents":                      list,
+		"list incidents eu-de-1":              list,
+		"list incidents acknowledged eu-de-1": listAcknowledged,
+		"page compute high db down":           page,
+		"pagerduty":                           nil,
+		"unknown":                             nil,
+	}
+
+	for text, expected := range stimuli {
+		assert.Equal(t, expected, findCommand(commands, text), "unexpected command for '%s'", text)
+	}
+}
+
+func TestSuggestKeywords(t *testing.T) {
+	commands := []Command{
+		&fakeCommand{keywords: []string{"list incidents"}},
+		&fakeCommand{keywords: []string{"list nodes", "show nodes"}},
+	}
+
+	assert.Equal(t, []string{"list incidents"}, suggestKeywords(commands, "lsit incidents eu-de-1"))
+	assert.Equal(t, []string{"list nodes"}, suggestKeywords(commands, "list node eu-de-1"))
+	assert.Empty(t, suggestKeywords(commands, "hello"))
+}
+
+type fakeCaseSensitiveCommand struct {
+	fakeCommand
+}
+
+func (f *fakeCaseSensitiveCommand) IsCaseSensitive() bool { return true }
+
+func TestCommandText(t *testing.T) {
+	query := &fakeCaseSensitiveCommand{fakeCommand{keywords: []string{"query"}}}
+	list := &fakeCommand{keywords: []string{"list incidents"}}
+
+	assert.Equal(t, `query up{job="Nova"} in eu-de-1`, commandText(query, `Query up{job="Nova"} in eu-de-1`), "only the keyword should be lower cased")
+	assert.Equal(t, "list incidents eu-de-1", commandText(list, "List Incidents EU-DE-1"), "the text should be lower cased")
+
+	assert.Equal(t, `query up > 0 and rate(x[5m]) <= 1 in eu-de-1`, commandText(query, `query up &gt; 0 and rate(x[5m]) &lt;= 1 in eu-de-1`), "comparisons should be unescaped")
+	silence := &fakeCaseSensitiveCommand{fakeCommand{keywords: []string{"silence"}}}
+	assert.Equal(t, `silence alertname=~"A|B" service!="<none>&" for <@U1>`, commandText(silence, `silence alertname=~"A|B" service!="&lt;none&gt;&amp;" for <@U1>`), "matchers should be unescaped")
+}
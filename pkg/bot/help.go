@@ -20,6 +20,7 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -34,7 +35,7 @@ type helpCommand struct {
 	availableCommands []Command
 }
 
-func (b *Bot) newHelpCommand(availableCommands []Command) Command {
+func newHelpCommand(availableCommands []Command) Command {
 	return &helpCommand{
 		availableCommands: availableCommands,
 	}
@@ -53,14 +54,22 @@ func (h *helpCommand) Keywords() []string {
 }
 
 func (h *helpCommand) Describe() string {
-	return "Help for all commands"
+	return "Help for all commands or a single one: help [$command]."
 }
 
 func (h *helpCommand) RequiredUserRole() auth.UserRole {
 	return auth.UserRoles.Base
 }
 
-func (h *helpCommand) Run(msg *slack.Msg) (*slack.Msg, error) {
+func (h *helpCommand) ReplyMode() ReplyMode {
+	return ReplyEphemeral
+}
+
+func (h *helpCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	if name := trimLongestKeyword(h.Keywords(), msg.Text); name != "" {
+		return h.commandHelp(name), nil
+	}
+
 	table := uitable.New()
 	table.MaxColWidth = 200
 
@@ -73,6 +82,63 @@ func (h *helpCommand) Run(msg *slack.Msg) (*slack.Msg, error) {
 
 	return &slack.Msg{
 		Type: slack.MarkdownType,
-		Text: fmt.Sprintf("```\n%s\n```", table.String()),
+		Text: fmt.Sprintf("```\n%s\n```\nUse `help $command` for details.", table.String()),
 	}, nil
 }
+
+// commandHelp shows the usage, arguments, examples and required role of a single command.
+func (h *helpCommand) commandHelp(name string) *slack.Msg {
+	c := findCommand(h.availableCommands, name)
+	if c == nil {
+		text := fmt.Sprintf("There is no command `%s`.", name)
+		if suggestions := suggestKeywords(h.availableCommands, name); len(suggestions) > 0 {
+			text += fmt.Sprintf(" Did you mean `%s`?", strings.Join(suggestions, "`, `"))
+		}
+		return &slack.Msg{Text: text}
+	}
+
+	lines := []string{
+		fmt.Sprintf("*%s*", c.Describe()),
+		fmt.Sprintf("Keywords: `%s`", strings.Join(c.Keywords(), "`, `")),
+	}
+
+	if ac, ok := c.(ArgumentsCommand); ok {
+		lines = append(lines, "Usage: "+Usage(ac))
+		if args := ac.Arguments(); len(args) > 0 {
+			lines = append(lines, "Arguments:")
+			for _, arg := range args {
+				lines = append(lines, "• "+describeArgument(arg))
+			}
+		}
+	}
+
+	if ec, ok := c.(ExamplesCommand); ok && len(ec.Examples()) > 0 {
+		lines = append(lines, "Examples:")
+		for _, example := range ec.Examples() {
+			lines = append(lines, fmt.Sprintf("• `%s`", example))
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("Required role: %s", c.RequiredUserRole()))
+
+	return &slack.Msg{Text: strings.Join(lines, "\n")}
+}
+
+func describeArgument(arg Argument) string {
+	details := []string{arg.Type.String()}
+	if arg.Type == ArgEnum {
+		details[0] += " " + strings.Join(arg.Values, ", ")
+	}
+	if arg.Required {
+		details = append(details, "required")
+	}
+	if arg.Default != "" {
+		details = append(details, "default "+arg.Default)
+	}
+
+	res := fmt.Sprintf("`%s` (%s)", arg.Name, strings.Join(details, ", "))
+	if arg.Description != "" {
+		res += ": " + arg.Description
+	}
+	return res
+}
@@ -0,0 +1,133 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+)
+
+// LocalChannelID is the channel of messages run via the Local adapter.
+const LocalChannelID = "local"
+
+// ConfirmFunc asks the user to confirm the described action of a destructive command.
+type ConfirmFunc func(description string) bool
+
+// Local dispatches commands given in a terminal instead of Slack through the same registry as the Bot.
+// Commands are run as the given user who has the given roles.
+type Local struct {
+	logger         log.Logger
+	helpCommand    Command
+	commands       []Command
+	userID         string
+	roles          []auth.UserRole
+	commandTimeout time.Duration
+}
+
+// NewLocal initializes all registered commands and returns a new Local adapter.
+// Every user has the base role.
+func NewLocal(userID string, roles []auth.UserRole, commandTimeout time.Duration, logger log.Logger) *Local {
+	l := &Local{
+		logger:         log.With(logger, "component", "local"),
+		userID:         userID,
+		roles:          append([]auth.UserRole{auth.UserRoles.Base}, roles...),
+		commandTimeout: commandTimeout,
+	}
+
+	l.commands = initCommands(l.logger)
+	l.helpCommand = newHelpCommand(l.commands)
+	l.commands = append(l.commands, l.helpCommand)
+	return l
+}
+
+// Exec runs the command given by the text and returns its response or an error.
+// Destructive commands only run if confirm returns true. Commands requiring the approval of a second user are refused.
+// A nil response indicates the command responded by itself, which usually fails without Slack.
+func (l *Local) Exec(text string, confirm ConfirmFunc) (*slack.Msg, error) {
+	original := strings.TrimSpace(text)
+	text = strings.ToLower(original)
+	msg := &slack.Msg{
+		Channel:   LocalChannelID,
+		User:      l.userID,
+		Text:      text,
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+
+	c := findCommand(l.commands, text)
+	if c == nil {
+		return unknownCommandResponse(l.commands, l.helpCommand, text), nil
+	}
+	msg.Text = commandText(c, original)
+
+	if !l.hasRole(c.RequiredUserRole()) {
+		return nil, fmt.Errorf("command requires role %s", c.RequiredUserRole())
+	}
+
+	if dc, ok := c.(DestructiveCommand); ok {
+		description, err := dc.DescribeAction(msg)
+		if err != nil {
+			return usageErrorResponse(err)
+		}
+		if dc.ApproverRole() != "" {
+			return nil, fmt.Errorf("command requires the approval of a second user with role %s. run it in Slack", dc.ApproverRole())
+		}
+		if confirm == nil || !confirm(description) {
+			return &slack.Msg{Text: "Cancelled"}, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.commandTimeout)
+	defer cancel()
+
+	response, err := c.Run(ctx, msg)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", l.commandTimeout.String())
+	}
+	if err != nil {
+		return usageErrorResponse(err)
+	}
+	return response, nil
+}
+
+func (l *Local) hasRole(role auth.UserRole) bool {
+	for _, r := range l.roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// usageErrorResponse returns the usage errors as response like the Bot does and other errors as they are.
+func usageErrorResponse(err error) (*slack.Msg, error) {
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		return &slack.Msg{Text: fmt.Sprintf(":x: %s", usageErr.Error())}, nil
+	}
+	return nil, err
+}
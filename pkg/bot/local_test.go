@@ -0,0 +1,97 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeScaleCommand struct {
+	fakeCommand
+	approverRole auth.UserRole
+}
+
+func (f *fakeScaleCommand) RequiredUserRole() auth.UserRole { return auth.UserRoles.KubernetesAdmin }
+func (f *fakeScaleCommand) ApproverRole() auth.UserRole     { return f.approverRole }
+func (f *fakeScaleCommand) DescribeAction(msg *slack.Msg) (string, error) {
+	return "scale " + trimLongestKeyword(f.keywords, msg.Text), nil
+}
+func (f *fakeScaleCommand) Run(_ context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	return &slack.Msg{Text: "scaled by " + msg.User}, nil
+}
+
+func newTestLocal(roles ...auth.UserRole) *Local {
+	commands := []Command{
+		&fakeScaleCommand{fakeCommand: fakeCommand{keywords: []string{"scale"}}},
+		&fakeScaleCommand{fakeCommand: fakeCommand{keywords: []string{"delete"}}, approverRole: auth.UserRoles.KubernetesAdmin},
+	}
+	l := &Local{userID: "ULOCAL", roles: append(roles, auth.UserRoles.Base), commandTimeout: time.Second}
+	l.helpCommand = newHelpCommand(commands)
+	l.commands = append(commands, l.helpCommand)
+	return l
+}
+
+func TestLocalExec(t *testing.T) {
+	_, err := newTestLocal().Exec("scale deployment a/b", nil)
+	assert.Error(t, err, "the user should lack the role")
+
+	l := newTestLocal(auth.UserRoles.KubernetesAdmin)
+	var description string
+	response, err := l.Exec(" Scale deployment a/b ", func(d string) bool {
+		description = d
+		return false
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "scale deployment a/b", description, "the action should be described before asking")
+	assert.Equal(t, "Cancelled", response.Text)
+
+	response, err = l.Exec("scale deployment a/b", func(string) bool { return true })
+	assert.NoError(t, err)
+	assert.Equal(t, "scaled by ULOCAL", response.Text)
+
+	_, err = l.Exec("delete deployment a/b", func(string) bool { return true })
+	assert.Error(t, err, "commands requiring a second user should be refused")
+
+	response, err = l.Exec("scael", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, response.Text, "Did you mean `scale`?")
+}
+
+func TestRenderText(t *testing.T) {
+	msg := &slack.Msg{
+		Text: "Incidents",
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*Summary*", false, false), []*slack.TextBlockObject{
+				slack.NewTextBlockObject(slack.MarkdownType, "field", false, false),
+			}, nil),
+			slack.NewDividerBlock(),
+			slack.NewActionBlock("", slack.NewButtonBlockElement("next", "2", slack.NewTextBlockObject(slack.PlainTextType, "Next", false, false))),
+		}},
+		Attachments: []slack.Attachment{{Title: "Alert", Fields: []slack.AttachmentField{{Title: "Region", Value: "eu-de-1"}}}},
+	}
+
+	assert.Equal(t, "Incidents\n*Summary*\nfield\n---\n[Next]\nAlert\nRegion: eu-de-1", RenderText(msg))
+}
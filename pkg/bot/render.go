@@ -0,0 +1,108 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// RenderText renders the text, Block Kit blocks and attachments of the message as plain text for a terminal.
+// Buttons are shown in brackets. Markdown is kept as it is.
+func RenderText(msg *slack.Msg) string {
+	lines := make([]string, 0)
+	if msg.Text != "" {
+		lines = append(lines, msg.Text)
+	}
+
+	lines = append(lines, renderBlocks(msg.Blocks.BlockSet)...)
+
+	for _, a := range msg.Attachments {
+		for _, s := range []string{a.Pretext, a.Title, a.Text} {
+			if s != "" {
+				lines = append(lines, s)
+			}
+		}
+		for _, f := range a.Fields {
+			lines = append(lines, fmt.Sprintf("%s: %s", f.Title, f.Value))
+		}
+		lines = append(lines, renderBlocks(a.Blocks)...)
+		for _, action := range a.Actions {
+			lines = append(lines, fmt.Sprintf("[%s]", action.Text))
+		}
+		if a.Footer != "" {
+			lines = append(lines, a.Footer)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderBlocks(blocks []slack.Block) []string {
+	lines := make([]string, 0)
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *slack.SectionBlock:
+			if b.Text != nil {
+				lines = append(lines, b.Text.Text)
+			}
+			for _, f := range b.Fields {
+				lines = append(lines, f.Text)
+			}
+			if b.Accessory != nil && b.Accessory.ButtonElement != nil {
+				lines = append(lines, renderButton(b.Accessory.ButtonElement))
+			}
+
+		case *slack.ContextBlock:
+			texts := make([]string, 0)
+			for _, e := range b.ContextElements.Elements {
+				if t, ok := e.(*slack.TextBlockObject); ok {
+					texts = append(texts, t.Text)
+				}
+			}
+			lines = append(lines, strings.Join(texts, " "))
+
+		case *slack.ActionBlock:
+			buttons := make([]string, 0)
+			for _, e := range b.Elements.ElementSet {
+				if button, ok := e.(*slack.ButtonBlockElement); ok {
+					buttons = append(buttons, renderButton(button))
+				}
+			}
+			lines = append(lines, strings.Join(buttons, " "))
+
+		case *slack.ImageBlock:
+			lines = append(lines, fmt.Sprintf("<%s>", b.ImageURL))
+
+		case *slack.DividerBlock:
+			lines = append(lines, "---")
+		}
+	}
+	return lines
+}
+
+func renderButton(b *slack.ButtonBlockElement) string {
+	if b.Text == nil {
+		return "[]"
+	}
+	return fmt.Sprintf("[%s]", b.Text.Text)
+}
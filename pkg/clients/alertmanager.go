@@ -0,0 +1,204 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package clients
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+// AlertmanagerClient silences alerts via the Alertmanager API v2 of a region.
+type AlertmanagerClient struct {
+	cfg        *config.AlertmanagerConfig
+	httpClient httpDoer
+	logger     log.Logger
+}
+
+// Matcher matches the label of alerts. Only equality matchers are supported.
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// Silence mutes all alerts matching its matchers until it ends.
+type Silence struct {
+	ID        string    `json:"id,omitempty"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+}
+
+// NewAlertmanagerClient returns a new AlertmanagerClient.
+func NewAlertmanagerClient(cfg *config.AlertmanagerConfig, logger log.Logger) *AlertmanagerClient {
+	return &AlertmanagerClient{
+		cfg:        cfg,
+		httpClient: newRetryClient("alertmanager", logger),
+		logger:     log.With(logger, "component", "alertmanager"),
+	}
+}
+
+// NewAlertmanagerClientFromEnv get's the configuration from the environment and returns a new AlertmanagerClient or an error.
+func NewAlertmanagerClientFromEnv() (*AlertmanagerClient, error) {
+	cfg, err := config.NewAlertmanagerConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAlertmanagerClient(cfg, util.NewLogger()), nil
+}
+
+// CreateSilence creates the silence in the Alertmanager of the region and returns its ID or an error.
+func (c *AlertmanagerClient) CreateSilence(region string, silence Silence) (string, error) {
+	body, err := json.Marshal(silence)
+	if err != nil {
+		return "", err
+	}
+
+	var res struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := c.do(region, http.MethodPost, "/api/v2/silences", body, &res); err != nil {
+		return "", errors.Wrap(err, "failed to create silence")
+	}
+
+	level.Info(c.logger).Log("msg", "created silence", "region", region, "silenceID", res.SilenceID, "createdBy", silence.CreatedBy)
+	return res.SilenceID, nil
+}
+
+// ExpireSilence expires the silence with the given ID in the Alertmanager of the region.
+func (c *AlertmanagerClient) ExpireSilence(region, silenceID string) error {
+	if err := c.do(region, http.MethodDelete, "/api/v2/silence/"+url.PathEscape(silenceID), nil, nil); err != nil {
+		return errors.Wrap(err, "failed to expire silence")
+	}
+
+	level.Info(c.logger).Log("msg", "expired silence", "region", region, "silenceID", silenceID)
+	return nil
+}
+
+// do sends the request to the Alertmanager of the region and decodes the response into res unless it is nil.
+func (c *AlertmanagerClient) do(region, method, path string, body []byte, res interface{}) error {
+	baseURL, err := c.cfg.URLForRegion(region)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("alertmanager in region %s responded with %d: %s", region, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// ParseMatchers parses matchers of the form `name=value` separated by commas or new lines.
+// Values may be quoted, e.g. `alertname="Foo"`.
+func ParseMatchers(text string) ([]Matcher, error) {
+	res := make([]Matcher, 0)
+	for _, entry := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		nameAndValue := strings.SplitN(entry, "=", 2)
+		name := strings.TrimSpace(nameAndValue[0])
+		if len(nameAndValue) != 2 || name == "" || strings.HasSuffix(name, "!") {
+			return nil, fmt.Errorf("invalid matcher '%s'. use name=value", entry)
+		}
+		value := strings.TrimSpace(nameAndValue[1])
+		if strings.HasPrefix(value, "~") {
+			return nil, fmt.Errorf("invalid matcher '%s'. only equality matchers are supported", entry)
+		}
+		res = append(res, Matcher{Name: name, Value: strings.Trim(value, `"`), IsEqual: true})
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New("at least one matcher is required")
+	}
+	return res, nil
+}
+
+// MatchersFromLabels returns the sorted matchers of the labels.
+func MatchersFromLabels(labels map[string]string) []Matcher {
+	res := make([]Matcher, 0, len(labels))
+	for name, value := range labels {
+		res = append(res, Matcher{Name: name, Value: value, IsEqual: true})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// FormatMatchers returns the matchers one per line in the format accepted by ParseMatchers.
+func FormatMatchers(matchers []Matcher) string {
+	lines := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		lines = append(lines, fmt.Sprintf("%s=%s", m.Name, m.Value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MatchersRegion returns the value of the region or, if there is none, the cluster matcher.
+func MatchersRegion(matchers []Matcher) string {
+	var cluster string
+	for _, m := range matchers {
+		switch m.Name {
+		case "region":
+			return m.Value
+		case "cluster":
+			cluster = m.Value
+		}
+	}
+	return cluster
+}
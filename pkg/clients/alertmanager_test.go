@@ -0,0 +1,46 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package clients
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMatchers(t *testing.T) {
+	matchers, err := ParseMatchers("alertname=OpenstackLbaasApiFlapping, region=\"eu-de-1\"\n\nservice = lbaas")
+	assert.NoError(t, err, "there should be no error parsing the matchers")
+	assert.Equal(t, []Matcher{
+		{Name: "alertname", Value: "OpenstackLbaasApiFlapping", IsEqual: true},
+		{Name: "region", Value: "eu-de-1", IsEqual: true},
+		{Name: "service", Value: "lbaas", IsEqual: true},
+	}, matchers)
+	assert.Equal(t, "eu-de-1", MatchersRegion(matchers))
+
+	reparsed, err := ParseMatchers(FormatMatchers(matchers))
+	assert.NoError(t, err)
+	assert.Equal(t, matchers, reparsed, "formatted matchers should be parsed again")
+
+	for _, invalid := range []string{"", "alertname", "alertname!=Foo", "alertname=~Foo.*", "=Foo"} {
+		_, err := ParseMatchers(invalid)
+		assert.Error(t, err, "'%s' should be rejected", invalid)
+	}
+}
@@ -3,8 +3,11 @@ package clients
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/PagerDuty/go-pagerduty"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/config"
 	"github.com/sapcc/pulsar/pkg/util"
 )
 
@@ -20,16 +23,30 @@ type Filter struct {
 	// Fingerprint of the alert(s) to filter for.
 	Fingerprint string
 
-	// Clusters to filter for
+	// Clusters to filter for. An incident matches if its summary names one of them or its service belongs to one of them.
 	Clusters []string
 
+	// Statuses of the incidents to filter for. Defaults to triggered and acknowledged.
+	Statuses []string
+
+	// Urgencies of the incidents to filter for.
+	Urgencies []string
+
+	// Services to filter for. An incident matches if the name of its service contains one of them.
+	Services []string
+
+	// Since and Until limit the time range in which the incidents were created.
+	// If both are zero incidents are not filtered by time.
+	Since,
+	Until time.Time
+
 	// limit is the number of items per response.
 	limit *uint
 }
 
 // ClusterFilterFromText takes a string potentially containing cluster names and creates the filter accordingly.
 func (f *Filter) ClusterFilterFromText(theString string) error {
-	clusters, err := util.ParseClusterFromString(theString)
+	clusters, err := config.Regions().Parse(theString)
 	if err != nil {
 		return err
 	}
@@ -53,17 +70,22 @@ func (f *Filter) FilterIncidents(incidents []pagerduty.Incident) []pagerduty.Inc
 	res := make([]pagerduty.Incident, 0)
 
 	for _, inc := range incidents {
-		region, alertname, err := ParseRegionAndAlertnameFromText(inc.Summary)
-		if err != nil {
-			continue
-		}
-
 		keep := true
-		if f.Clusters != nil && !util.Contains(f.Clusters, region) {
-			keep = false
+		// Region and alertname are only parsed from the summary if they are filtered for.
+		if f.Clusters != nil || f.Alertname != "" {
+			region, alertname, err := ParseRegionAndAlertnameFromText(inc.Summary)
+
+			if f.Clusters != nil && (err != nil || !util.Contains(f.Clusters, region)) &&
+				!config.Regions().HasPagerdutyService(f.Clusters, inc.Service.ID) {
+				keep = false
+			}
+
+			if f.Alertname != "" && (err != nil || util.NormalizeString(f.Alertname) != alertname) {
+				keep = false
+			}
 		}
 
-		if f.Alertname != "" && util.NormalizeString(f.Alertname) != alertname {
+		if f.Services != nil && !containsAnyFold(inc.Service.Summary, f.Services) {
 			keep = false
 		}
 
@@ -75,6 +97,14 @@ func (f *Filter) FilterIncidents(incidents []pagerduty.Incident) []pagerduty.Inc
 	return res
 }
 
+// GetStatuses returns the statuses to filter for.
+func (f *Filter) GetStatuses() []string {
+	if f == nil || len(f.Statuses) == 0 {
+		return []string{IncidentStatusTriggered, IncidentStatusAcknowledged}
+	}
+	return f.Statuses
+}
+
 // SetLimit sets the limit of items per response.
 func (f *Filter) SetLimit(limit uint) {
 	f.limit = &limit
@@ -88,6 +118,23 @@ func (f *Filter) GetLimit() uint {
 	return 100
 }
 
+// TimeRange returns the time range to filter for. ok is false if the incidents should not be filtered by time.
+// A missing end defaults to now and a missing start to one month before the end.
+func (f *Filter) TimeRange() (since, until time.Time, ok bool) {
+	if f == nil || (f.Since.IsZero() && f.Until.IsZero()) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	since, until = f.Since, f.Until
+	if until.IsZero() {
+		until = time.Now().UTC()
+	}
+	if since.IsZero() {
+		since = until.AddDate(0, -1, 0)
+	}
+	return since, until, true
+}
+
 // ToString returns the string representation of the filter.
 func (f *Filter) ToString() string {
 	var res string
@@ -107,5 +154,117 @@ func (f *Filter) ToString() string {
 		res += fmt.Sprintf(", clusters=%s", strings.Join(f.Clusters, ","))
 	}
 
+	if f.Statuses != nil {
+		res += fmt.Sprintf(", statuses=%s", strings.Join(f.Statuses, ","))
+	}
+
+	if f.Urgencies != nil {
+		res += fmt.Sprintf(", urgencies=%s", strings.Join(f.Urgencies, ","))
+	}
+
+	if f.Services != nil {
+		res += fmt.Sprintf(", services=%s", strings.Join(f.Services, ","))
+	}
+
+	if since, until, ok := f.TimeRange(); ok {
+		res += fmt.Sprintf(", since=%s, until=%s", util.TimestampToString(since), util.TimestampToString(until))
+	}
+
+	res += fmt.Sprintf(", limit=%d", f.GetLimit())
+
 	return res
 }
+
+// NewFilterFromText creates a filter from a text like `list incidents acknowledged urgency=high service=compute eu-de-1`.
+// since and until are durations before now, so `since=2d until=1d` lists the incidents created the day before yesterday.
+// Incident statuses and regions are recognized by their name. Further filters are given as key=value pairs.
+// Words which are neither are ignored, unknown regions are reported.
+func NewFilterFromText(theString string) (*Filter, error) {
+	f := &Filter{}
+	for _, field := range strings.Fields(theString) {
+		key, value, isPair := strings.Cut(field, "=")
+		if !isPair {
+			word := strings.ToLower(field)
+			if util.Contains(incidentStatuses, word) {
+				f.Statuses = append(f.Statuses, word)
+				continue
+			}
+
+			clusters, err := config.Regions().Parse(field)
+			if err == nil {
+				f.Clusters = append(f.Clusters, clusters...)
+			} else if err != config.ErrNoRegion {
+				return nil, err
+			}
+			continue
+		}
+
+		if value == "" {
+			return nil, fmt.Errorf("missing value for filter '%s'", key)
+		}
+
+		switch strings.ToLower(key) {
+		case "status":
+			for _, status := range strings.Split(strings.ToLower(value), ",") {
+				if !util.Contains(incidentStatuses, status) {
+					return nil, fmt.Errorf("invalid status '%s'. use triggered, acknowledged or resolved", status)
+				}
+				f.Statuses = append(f.Statuses, status)
+			}
+
+		case "urgency":
+			for _, urgency := range strings.Split(strings.ToLower(value), ",") {
+				if urgency != incidentUrgencyHigh && urgency != incidentUrgencyLow {
+					return nil, fmt.Errorf("invalid urgency '%s'. use high or low", urgency)
+				}
+				f.Urgencies = append(f.Urgencies, urgency)
+			}
+
+		case "service":
+			f.Services = append(f.Services, strings.Split(value, ",")...)
+
+		case "alertname":
+			f.Alertname = value
+
+		case "since":
+			d, err := util.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration '%s'", value)
+			}
+			f.Since = time.Now().UTC().Add(-d)
+
+		case "until":
+			d, err := util.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration '%s'", value)
+			}
+			f.Until = time.Now().UTC().Add(-d)
+
+		default:
+			return nil, fmt.Errorf("unknown filter '%s'. use status, urgency, service, alertname, since or until", key)
+		}
+	}
+
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Until.After(f.Since) {
+		return nil, errors.New("since must be longer ago than until")
+	}
+
+	// Keep nil slices as nil since they disable the respective filter.
+	if f.Statuses != nil {
+		f.Statuses = util.RemoveDuplicates(f.Statuses)
+	}
+	if f.Clusters != nil {
+		f.Clusters = util.RemoveDuplicates(f.Clusters)
+	}
+	return f, nil
+}
+
+func containsAnyFold(theString string, substrings []string) bool {
+	theString = strings.ToLower(theString)
+	for _, s := range substrings {
+		if strings.Contains(theString, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
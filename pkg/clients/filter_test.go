@@ -1,10 +1,15 @@
 package clients
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/PagerDuty/go-pagerduty"
+	"github.com/sapcc/pulsar/pkg/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFilterIncidents(t *testing.T) {
@@ -27,3 +32,74 @@ func TestFilterIncidents(t *testing.T) {
 	res := f.FilterIncidents(stimuli)
 	assert.EqualValues(t, expected, res, "the slices should have equal content")
 }
+
+func TestNewFilterFromText(t *testing.T) {
+	f, err := NewFilterFromText("list incidents acknowledged urgency=high service=Compute,network eu-de-1")
+	assert.NoError(t, err, "there should be no error parsing the filter")
+	assert.Equal(t, []string{"acknowledged"}, f.Statuses)
+	assert.Equal(t, []string{"high"}, f.Urgencies)
+	assert.Equal(t, []string{"Compute", "network"}, f.Services)
+	assert.Equal(t, []string{"eu-de-1"}, f.Clusters)
+
+	f, err = NewFilterFromText("list incidents")
+	assert.NoError(t, err, "there should be no error parsing the filter")
+	assert.Nil(t, f.Clusters, "no cluster filter expected")
+	assert.Equal(t, []string{IncidentStatusTriggered, IncidentStatusAcknowledged}, f.GetStatuses())
+
+	_, err = NewFilterFromText("list incidents urgency=medium")
+	assert.Error(t, err, "invalid urgency should be rejected")
+
+	_, err = NewFilterFromText("list incidents foo=bar")
+	assert.Error(t, err, "unknown filter should be rejected")
+
+	f, err = NewFilterFromText("list incidents since=2d until=1d")
+	assert.NoError(t, err, "there should be no error parsing the time range")
+	since, until, ok := f.TimeRange()
+	assert.True(t, ok, "the incidents should be filtered by time")
+	assert.InDelta(t, 24*time.Hour, until.Sub(since), float64(time.Second), "the time range should be one day")
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), until, time.Minute, "the time range should end one day ago")
+
+	_, err = NewFilterFromText("list incidents since=1d until=2d")
+	assert.Error(t, err, "time ranges ending before their start should be rejected")
+}
+
+func TestFilterIncidentsByService(t *testing.T) {
+	stimuli := []pagerduty.Incident{
+		{Service: pagerduty.APIObject{Summary: "Compute Alerts"}},
+		{Service: pagerduty.APIObject{Summary: "Network Alerts"}},
+	}
+
+	f := &Filter{Services: []string{"compute"}}
+	assert.EqualValues(t, stimuli[:1], f.FilterIncidents(stimuli), "only the compute incident should be kept")
+}
+
+func TestFilterIncidentsWithRegionCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pulsar.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+regions:
+- name: eu-de-1
+  aliases: [frankfurt]
+  pagerdutyServices: [PSTORAGE]
+- name: eu-de-2
+`), 0600))
+	config.SetFile(path)
+	defer config.SetFile("")
+
+	stimuli := []pagerduty.Incident{
+		{APIObject: pagerduty.APIObject{Summary: summaryText}},
+		{APIObject: pagerduty.APIObject{Summary: summaryTextMultiple}},
+		{APIObject: pagerduty.APIObject{Summary: "[#2200] storage backend degraded"}, Service: pagerduty.APIObject{ID: "PSTORAGE"}},
+		{APIObject: pagerduty.APIObject{Summary: summaryTextMultipleNoDescription}},
+	}
+
+	f, err := NewFilterFromText("list incidents frankfurt")
+	require.NoError(t, err, "there should be no error parsing the filter")
+	assert.Equal(t, []string{"eu-de-1"}, f.Clusters, "the alias should be resolved")
+	assert.EqualValues(t, []pagerduty.Incident{stimuli[0], stimuli[2]}, f.FilterIncidents(stimuli), "incidents of the services of the region should be kept")
+
+	_, err = NewFilterFromText("list incidents eu-nl-1")
+	assert.EqualError(t, err, "unknown region(s) eu-nl-1. known regions are eu-de-1, eu-de-2", "unknown regions should be reported")
+
+	_, _, err = ParseRegionAndAlertnameFromText(summaryTextMultipleNoDescription)
+	assert.Error(t, err, "incidents of unknown regions should not be parsed")
+}
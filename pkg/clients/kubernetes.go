@@ -20,7 +20,13 @@
 package clients
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
 	"github.com/sapcc/pulsar/pkg/config"
 	"github.com/sapcc/pulsar/pkg/util"
 )
@@ -56,12 +62,61 @@ func NewK8sClientFromEnv() (*K8sClient, error) {
 	return NewK8sClient(cfg, util.NewLogger())
 }
 
-func (k *K8sClient) SetContext(context string) error {
-	_, err := k.cmd.Run("config", "use-context", context)
+func (k *K8sClient) SetContext(kubeContext string) error {
+	_, err := k.cmd.Run("config", "use-context", kubeContext)
 	return err
 }
 
-// ListNodes is self-explanatory.
-func (k *K8sClient) ListNodes() (string, error) {
-	return k.cmd.Run("get", "nodes", "-o", "wide")
+// ListContexts returns the names of the contexts in the kubeconfig.
+func (k *K8sClient) ListContexts(ctx context.Context) ([]string, error) {
+	res, err := k.cmd.RunWithContext(ctx, "config", "get-contexts", "--output", "name")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(res), nil
+}
+
+// ServerVersion returns the version of the API server of the cluster identified by kubeContext.
+// It is used to verify the cluster is reachable with the credentials of the context.
+func (k *K8sClient) ServerVersion(ctx context.Context, kubeContext string) (string, error) {
+	res, err := k.cmd.RunWithContext(ctx, "--context", kubeContext, "--request-timeout", "10s", "get", "--raw", "/version")
+	if err != nil {
+		return "", err
+	}
+
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err := json.Unmarshal([]byte(res), &version); err != nil {
+		return "", errors.Wrap(err, "failed to decode version")
+	}
+	return version.GitVersion, nil
+}
+
+// ListNodes lists the nodes of the cluster identified by kubeContext.
+// The context is passed explicitly as concurrent commands must not switch the current context.
+func (k *K8sClient) ListNodes(ctx context.Context, kubeContext string) (string, error) {
+	return k.cmd.RunWithContext(ctx, "--context", kubeContext, "get", "nodes", "-o", "wide")
+}
+
+// RolloutRestart triggers a rolling restart of the given workload in the cluster identified by kubeContext.
+func (k *K8sClient) RolloutRestart(ctx context.Context, kubeContext, kind, namespace, name string) (string, error) {
+	return k.cmd.RunWithContext(ctx, "--context", kubeContext, "--namespace", namespace, "rollout", "restart", fmt.Sprintf("%s/%s", kind, name))
+}
+
+// Scale sets the number of replicas of the given workload in the cluster identified by kubeContext.
+func (k *K8sClient) Scale(ctx context.Context, kubeContext, kind, namespace, name string, replicas int) (string, error) {
+	return k.cmd.RunWithContext(ctx, "--context", kubeContext, "--namespace", namespace, "scale", fmt.Sprintf("%s/%s", kind, name), fmt.Sprintf("--replicas=%d", replicas))
+}
+
+// RolloutStatus returns the current rollout status of the given workload without waiting for it to finish.
+// The boolean indicates whether the rollout is complete.
+func (k *K8sClient) RolloutStatus(ctx context.Context, kubeContext, kind, namespace, name string) (string, bool, error) {
+	res, err := k.cmd.RunWithContext(ctx, "--context", kubeContext, "--namespace", namespace, "rollout", "status", fmt.Sprintf("%s/%s", kind, name), "--watch=false")
+	if err != nil {
+		return "", false, err
+	}
+
+	res = strings.TrimSpace(res)
+	return res, strings.Contains(res, "successfully rolled out") || strings.Contains(res, "roll out complete"), nil
 }
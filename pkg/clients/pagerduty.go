@@ -20,7 +20,10 @@
 package clients
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/PagerDuty/go-pagerduty"
@@ -34,38 +37,61 @@ import (
 const (
 	IncidentStatusAcknowledged = "acknowledged"
 	IncidentStatusTriggered    = "triggered"
+	incidentUrgencyHigh        = "high"
+	incidentUrgencyLow         = "low"
 	typeUserReference          = "user_reference"
 	typeIncident               = "incident"
+	logEntryTypeAnnotate       = "annotate_log_entry"
+
+	// incidentsPageLimit is the maximal number of incidents per page supported by the PagerDuty API.
+	incidentsPageLimit = 100
+
+	// dateRangeAll makes the PagerDuty API ignore the since and until parameters.
+	dateRangeAll = "all"
+
+	// PulsarNoteMarker tags the notes Pulsar adds on its own, so the note sync does not post them in Slack.
+	PulsarNoteMarker = "(added by Pulsar)"
 )
 
+// incidentStatuses are all statuses of a PagerDuty incident.
+var incidentStatuses = []string{IncidentStatusTriggered, IncidentStatusAcknowledged, IncidentStatusResolved}
+
+// ErrNotFound is returned if no schedule, escalation policy or team with the given name exists.
+var ErrNotFound = errors.New("not found")
+
 // PagerdutyClient wraps the pagerduty client.
 type PagerdutyClient struct {
 	logger          log.Logger
 	cfg             *config.PagerdutyConfig
 	pagerdutyClient *pagerduty.Client
-	defaultUser     *pagerduty.User
+
+	// defaultUser is looked up on first use, so creating the client does not require PagerDuty to be reachable.
+	defaultUser    *pagerduty.User
+	defaultUserMtx sync.Mutex
+
+	// watchInterval is the polling interval of WatchIncident. Defaults to incidentWatchInterval.
+	watchInterval time.Duration
 }
 
 // NewPagerdutyClient returns a new PagerdutyClient or an error.
+// No request is sent to PagerDuty until the client is used.
 func NewPagerdutyClient(cfg *config.PagerdutyConfig, logger log.Logger) (*PagerdutyClient, error) {
-	pagerdutyClient := pagerduty.NewClient(cfg.AuthToken)
+	pagerdutyClient := pagerduty.NewClient(cfg.AuthToken,
+		pagerduty.WithAPIEndpoint(strings.TrimSuffix(cfg.APIURL, "/")),
+		pagerduty.WithV2EventsAPIEndpoint(strings.TrimSuffix(cfg.EventsAPIURL, "/")),
+	)
 	if pagerdutyClient == nil {
 		return nil, errors.New("failed to initialize pagerduty client")
 	}
 
-	c := &PagerdutyClient{
+	logger = log.With(logger, "component", "pagerduty")
+	pagerdutyClient.HTTPClient = newRetryClient("pagerduty", logger)
+
+	return &PagerdutyClient{
 		cfg:             cfg,
-		logger:          log.With(logger, "component", "pagerduty"),
+		logger:          logger,
 		pagerdutyClient: pagerdutyClient,
-	}
-
-	defaultUser, err := c.GetUserByEmail(cfg.DefaultEmail)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error getting default pagerduty user with email %s", cfg.DefaultEmail)
-	}
-	c.defaultUser = defaultUser
-
-	return c, nil
+	}, nil
 }
 
 func NewPagerdutyClientFromEnv() (*PagerdutyClient, error) {
@@ -77,14 +103,27 @@ func NewPagerdutyClientFromEnv() (*PagerdutyClient, error) {
 	return NewPagerdutyClient(cfg, util.NewLogger())
 }
 
-// GetDefaultUser returns the pagerduty default user.
-func (c *PagerdutyClient) GetDefaultUser() *pagerduty.User {
-	return c.defaultUser
+// GetDefaultUser returns the pagerduty default user or an error.
+// The user is looked up on the first call and cached once found.
+func (c *PagerdutyClient) GetDefaultUser(ctx context.Context) (*pagerduty.User, error) {
+	c.defaultUserMtx.Lock()
+	defer c.defaultUserMtx.Unlock()
+
+	if c.defaultUser != nil {
+		return c.defaultUser, nil
+	}
+
+	defaultUser, err := c.GetUserByEmail(ctx, c.cfg.DefaultEmail)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting default pagerduty user with email %s", c.cfg.DefaultEmail)
+	}
+	c.defaultUser = defaultUser
+	return defaultUser, nil
 }
 
 // GetUserByEmail returns the pagerduty user for the given email or an error.
-func (c *PagerdutyClient) GetUserByEmail(email string) (*pagerduty.User, error) {
-	userList, err := c.pagerdutyClient.ListUsers(pagerduty.ListUsersOptions{Query: email})
+func (c *PagerdutyClient) GetUserByEmail(ctx context.Context, email string) (*pagerduty.User, error) {
+	userList, err := c.pagerdutyClient.ListUsersWithContext(ctx, pagerduty.ListUsersOptions{Query: email})
 	if err != nil {
 		return nil, err
 	}
@@ -98,38 +137,67 @@ func (c *PagerdutyClient) GetUserByEmail(email string) (*pagerduty.User, error)
 	return nil, fmt.Errorf("user with email '%s' not found", email)
 }
 
-// ListIncidents returns a list of incidents matching the given filter or an error.
-func (c *PagerdutyClient) ListIncidents(f *Filter) ([]pagerduty.Incident, error) {
+// GetService returns the pagerduty service with the given ID or an error.
+func (c *PagerdutyClient) GetService(ctx context.Context, serviceID string) (*pagerduty.Service, error) {
+	return c.pagerdutyClient.GetServiceWithContext(ctx, serviceID, &pagerduty.GetServiceOptions{})
+}
+
+// ListIncidents returns up to Filter.GetLimit() open incidents, most recent first, matching the given filter or an error.
+// All pages are requested until the limit is reached. Without a filter all open incidents are returned.
+func (c *PagerdutyClient) ListIncidents(ctx context.Context, f *Filter) ([]pagerduty.Incident, error) {
 	o := pagerduty.ListIncidentsOptions{
-		Statuses: []string{IncidentStatusTriggered, IncidentStatusAcknowledged},
-		Since:    time.Now().AddDate(0, 0, -1).Format(time.RFC3339),
-		SortBy:   "created_at:desc",
-        ServiceIDs: c.cfg.FilterServices,
+		Limit:      incidentsPageLimit,
+		Statuses:   f.GetStatuses(),
+		SortBy:     "created_at:desc",
+		ServiceIDs: c.cfg.FilterServices,
 	}
 
 	if f != nil {
-		level.Debug(c.logger).Log("msg", "listing pagerduty incident", "filter", f.ToString())
+		o.Urgencies = f.Urgencies
 	}
 
-    // TODD replace deprecated function usage
-	incidentList, err := c.pagerdutyClient.ListIncidents(o)
-	if err != nil {
-		return nil, err
+	var limit uint
+	if f != nil {
+		level.Debug(c.logger).Log("msg", "listing pagerduty incident", "filter", f.ToString())
+		limit = f.GetLimit()
 	}
 
-	// Break here if we don't need to filter
-	if f == nil {
-		return incidentList.Incidents, nil
+	if since, until, ok := f.TimeRange(); ok {
+		o.Since = util.TimestampToString(since)
+		o.Until = util.TimestampToString(until)
+	} else {
+		o.DateRange = dateRangeAll
 	}
 
-	return f.FilterIncidents(incidentList.Incidents), nil
+	res := make([]pagerduty.Incident, 0)
+	for {
+		incidentList, err := c.pagerdutyClient.ListIncidentsWithContext(ctx, o)
+		if err != nil {
+			return nil, err
+		}
+
+		incidents := incidentList.Incidents
+		if f != nil {
+			incidents = f.FilterIncidents(incidents)
+		}
+		res = append(res, incidents...)
+
+		if limit > 0 && uint(len(res)) >= limit {
+			return res[:limit], nil
+		}
+
+		if !incidentList.More {
+			return res, nil
+		}
+		o.Offset += o.Limit
+	}
 }
 
 // GetIncident returns the latest incident matching the filter or an error.
-func (c *PagerdutyClient) GetIncident(f *Filter) (*pagerduty.Incident, error) {
+func (c *PagerdutyClient) GetIncident(ctx context.Context, f *Filter) (*pagerduty.Incident, error) {
 	// Return the most recent incident.
 	f.SetLimit(1)
-	incidentList, err := c.ListIncidents(f)
+	incidentList, err := c.ListIncidents(ctx, f)
 	if err != nil {
 		return nil, errors.Wrap(err, "error listing pagerduty incidents")
 	}
@@ -142,9 +210,13 @@ func (c *PagerdutyClient) GetIncident(f *Filter) (*pagerduty.Incident, error) {
 }
 
 // AcknowledgeIncident sets a incident to status acknowledged and assigns the given user to it.
-func (c *PagerdutyClient) AcknowledgeIncident(incidentID string, user *pagerduty.User) (*pagerduty.ListIncidentsResponse, error) {
+func (c *PagerdutyClient) AcknowledgeIncident(ctx context.Context, incidentID string, user *pagerduty.User) (*pagerduty.ListIncidentsResponse, error) {
 	if user == nil {
-		user = c.defaultUser
+		defaultUser, err := c.GetDefaultUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		user = defaultUser
 	}
 
 	incident := pagerduty.ManageIncidentsOptions{
@@ -154,30 +226,69 @@ func (c *PagerdutyClient) AcknowledgeIncident(incidentID string, user *pagerduty
 	}
 
 	level.Debug(c.logger).Log("msg", "acknowledging incident", "incidentID", incident.ID, "userEmail", user.Email)
-	return c.pagerdutyClient.ManageIncidents(user.Email, []pagerduty.ManageIncidentsOptions{incident})
+	return c.pagerdutyClient.ManageIncidentsWithContext(ctx, user.Email, []pagerduty.ManageIncidentsOptions{incident})
 }
 
 // AddActualAcknowledgerAsNoteToIncident adds a note containing the actual acknowledger to the given incident.
-func (c *PagerdutyClient) AddActualAcknowledgerAsNoteToIncident(incidentID, actualAcknowledger string) (*pagerduty.IncidentNote, error) {
+func (c *PagerdutyClient) AddActualAcknowledgerAsNoteToIncident(ctx context.Context, incidentID, actualAcknowledger string) (*pagerduty.IncidentNote, error) {
+	return c.AddNoteToIncident(ctx, incidentID, fmt.Sprintf("Incident was acknowledged on behalf of %s. time: %s\n%s", actualAcknowledger, time.Now().UTC().String(), PulsarNoteMarker))
+}
+
+// AddNoteToIncident adds a note with the given content on behalf of the default user to the given incident.
+func (c *PagerdutyClient) AddNoteToIncident(ctx context.Context, incidentID, content string) (*pagerduty.IncidentNote, error) {
+	defaultUser, err := c.GetDefaultUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now().UTC()
 	note := pagerduty.IncidentNote{
 		ID: incidentID,
 		User: pagerduty.APIObject{
-			ID:      c.defaultUser.ID,
+			ID:      defaultUser.ID,
 			Type:    typeUserReference,
-			Summary: c.defaultUser.Email, //as we use api key which is not bound to a user, we need to give the email and not c.defaultUser.Summary,
-			Self:    c.defaultUser.Self,
-			HTMLURL: c.defaultUser.HTMLURL,
+			Summary: defaultUser.Email, //as we use api key which is not bound to a user, we need to give the email and not defaultUser.Summary,
+			Self:    defaultUser.Self,
+			HTMLURL: defaultUser.HTMLURL,
 		},
-		Content:   fmt.Sprintf("Incident was acknowledged on behalf of %s. time: %s", actualAcknowledger, now.String()),
+		Content:   content,
 		CreatedAt: now.String(),
 	}
 
-	return c.pagerdutyClient.CreateIncidentNoteWithResponse(incidentID, note)
+	return c.pagerdutyClient.CreateIncidentNoteWithContext(ctx, incidentID, note)
+}
+
+// ListIncidentNotes returns the notes of the given incident or an error.
+func (c *PagerdutyClient) ListIncidentNotes(ctx context.Context, incidentID string) ([]pagerduty.IncidentNote, error) {
+	return c.pagerdutyClient.ListIncidentNotesWithContext(ctx, incidentID)
+}
+
+// ListAnnotatedIncidentIDs returns the ids of the incidents notes were added to since the given time or an error.
+// Unlike ListIncidentNotes it needs a single request for all incidents.
+func (c *PagerdutyClient) ListAnnotatedIncidentIDs(ctx context.Context, since time.Time) (map[string]bool, error) {
+	o := pagerduty.ListLogEntriesOptions{Limit: 100, Since: util.TimestampToString(since)}
+
+	res := make(map[string]bool)
+	for {
+		entries, err := c.pagerdutyClient.ListLogEntriesWithContext(ctx, o)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries.LogEntries {
+			if entry.Type == logEntryTypeAnnotate {
+				res[entry.Incident.ID] = true
+			}
+		}
+
+		if !entries.More {
+			return res, nil
+		}
+		o.Offset += o.Limit
+	}
 }
 
 // ListTodaysOnCalls returns the OnCall users for today.
-func (c *PagerdutyClient) ListTodaysOnCallUsers(scheduleID *string) ([]*pagerduty.User, error) {
+func (c *PagerdutyClient) ListTodaysOnCallUsers(ctx context.Context, scheduleID *string) ([]*pagerduty.User, error) {
 	listOpts := pagerduty.ListOnCallOptions{}
 	listOpts.Limit = 100
 	listOpts.Earliest = true
@@ -189,7 +300,7 @@ func (c *PagerdutyClient) ListTodaysOnCallUsers(scheduleID *string) ([]*pagerdut
 		listOpts.ScheduleIDs = []string{*scheduleID}
 	}
 
-	onCallList, err := c.pagerdutyClient.ListOnCalls(listOpts)
+	onCallList, err := c.pagerdutyClient.ListOnCallsWithContext(ctx, listOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -198,7 +309,7 @@ func (c *PagerdutyClient) ListTodaysOnCallUsers(scheduleID *string) ([]*pagerdut
 	res := make([]*pagerduty.User, 0)
 	for _, onCall := range onCallList.OnCalls {
 		if !containsUser(res, onCall.User) {
-			u, err := c.pagerdutyClient.GetUser(onCall.User.ID, pagerduty.GetUserOptions{})
+			u, err := c.GetUser(ctx, onCall.User.ID)
 			if err != nil {
 				level.Error(c.logger).Log("msg", "error getting user", "id", onCall.User.ID, "err", err.Error())
 				continue
@@ -212,12 +323,12 @@ func (c *PagerdutyClient) ListTodaysOnCallUsers(scheduleID *string) ([]*pagerdut
 }
 
 // GetSchedule returns a pagerduty schedule for the given name or an error.
-func (c *PagerdutyClient) GetSchedule(scheduleName string) (*pagerduty.Schedule, error) {
+func (c *PagerdutyClient) GetSchedule(ctx context.Context, scheduleName string) (*pagerduty.Schedule, error) {
 	listOpts := pagerduty.ListSchedulesOptions{}
 	listOpts.Limit = 100
 	listOpts.Query = scheduleName
 
-	scheduleList, err := c.pagerdutyClient.ListSchedules(listOpts)
+	scheduleList, err := c.pagerdutyClient.ListSchedulesWithContext(ctx, listOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -228,5 +339,135 @@ func (c *PagerdutyClient) GetSchedule(scheduleName string) (*pagerduty.Schedule,
 		}
 	}
 
-	return nil, fmt.Errorf("schedule not found")
+	return nil, fmt.Errorf("schedule %w", ErrNotFound)
+}
+
+// GetEscalationPolicy returns a pagerduty escalation policy for the given name or an error.
+func (c *PagerdutyClient) GetEscalationPolicy(ctx context.Context, name string) (*pagerduty.EscalationPolicy, error) {
+	listOpts := pagerduty.ListEscalationPoliciesOptions{}
+	listOpts.Limit = 100
+	listOpts.Query = name
+
+	policyList, err := c.pagerdutyClient.ListEscalationPoliciesWithContext(ctx, listOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, policy := range policyList.EscalationPolicies {
+		if util.NormalizeString(policy.Name) == util.NormalizeString(name) {
+			return &policy, nil
+		}
+	}
+
+	return nil, fmt.Errorf("escalation policy %w", ErrNotFound)
+}
+
+// ListEscalationPolicyIDsForTeam returns the ids of the escalation policies of the team with the given name or an error.
+func (c *PagerdutyClient) ListEscalationPolicyIDsForTeam(ctx context.Context, teamName string) ([]string, error) {
+	teamList, err := c.pagerdutyClient.ListTeamsWithContext(ctx, pagerduty.ListTeamOptions{Limit: 100, Query: teamName})
+	if err != nil {
+		return nil, err
+	}
+
+	var teamID string
+	for _, team := range teamList.Teams {
+		if util.NormalizeString(team.Name) == util.NormalizeString(teamName) {
+			teamID = team.ID
+			break
+		}
+	}
+	if teamID == "" {
+		return nil, fmt.Errorf("team %w", ErrNotFound)
+	}
+
+	policyList, err := c.pagerdutyClient.ListEscalationPoliciesWithContext(ctx, pagerduty.ListEscalationPoliciesOptions{Limit: 100, TeamIDs: []string{teamID}})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0)
+	for _, policy := range policyList.EscalationPolicies {
+		res = append(res, policy.ID)
+	}
+	return res, nil
+}
+
+// ListCurrentOnCalls returns the current on-call entries, including the users, of all escalation levels
+// for the given schedules and escalation policies or an error.
+func (c *PagerdutyClient) ListCurrentOnCalls(ctx context.Context, scheduleIDs, escalationPolicyIDs []string) ([]pagerduty.OnCall, error) {
+	return c.listOnCalls(ctx, pagerduty.ListOnCallOptions{
+		ScheduleIDs:         scheduleIDs,
+		EscalationPolicyIDs: escalationPolicyIDs,
+	})
+}
+
+// ListOnCallShifts returns the on-call entries, including the users, of the given schedules and users
+// overlapping the time range between since and until or an error.
+func (c *PagerdutyClient) ListOnCallShifts(ctx context.Context, scheduleIDs, userIDs []string, since, until time.Time) ([]pagerduty.OnCall, error) {
+	return c.listOnCalls(ctx, pagerduty.ListOnCallOptions{
+		ScheduleIDs: scheduleIDs,
+		UserIDs:     userIDs,
+		Since:       util.TimestampToString(since),
+		Until:       util.TimestampToString(until),
+	})
+}
+
+func (c *PagerdutyClient) listOnCalls(ctx context.Context, listOpts pagerduty.ListOnCallOptions) ([]pagerduty.OnCall, error) {
+	listOpts.Limit = 100
+	listOpts.Includes = []string{"users"}
+
+	res := make([]pagerduty.OnCall, 0)
+	for {
+		onCallList, err := c.pagerdutyClient.ListOnCallsWithContext(ctx, listOpts)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, onCallList.OnCalls...)
+
+		if !onCallList.More {
+			break
+		}
+		listOpts.Offset += listOpts.Limit
+	}
+
+	return res, nil
+}
+
+// GetUser returns the pagerduty user with the given id or an error.
+func (c *PagerdutyClient) GetUser(ctx context.Context, userID string) (*pagerduty.User, error) {
+	return c.pagerdutyClient.GetUserWithContext(ctx, userID, pagerduty.GetUserOptions{})
+}
+
+// CreateScheduleOverride puts the given user on-call for the schedule between start and end.
+func (c *PagerdutyClient) CreateScheduleOverride(ctx context.Context, scheduleID string, user *pagerduty.User, start, end time.Time) (*pagerduty.Override, error) {
+	override := pagerduty.Override{
+		Start: util.TimestampToString(start),
+		End:   util.TimestampToString(end),
+		User: pagerduty.APIObject{
+			ID:   user.ID,
+			Type: typeUserReference,
+		},
+	}
+
+	level.Debug(c.logger).Log("msg", "creating schedule override", "scheduleID", scheduleID, "userEmail", user.Email, "start", override.Start, "end", override.End)
+	return c.pagerdutyClient.CreateOverrideWithContext(ctx, scheduleID, override)
+}
+
+// DeleteScheduleOverride removes the override with the given id from the schedule.
+func (c *PagerdutyClient) DeleteScheduleOverride(ctx context.Context, scheduleID, overrideID string) error {
+	level.Debug(c.logger).Log("msg", "deleting schedule override", "scheduleID", scheduleID, "overrideID", overrideID)
+	return c.pagerdutyClient.DeleteOverrideWithContext(ctx, scheduleID, overrideID)
+}
+
+// ListFinalScheduleEntries returns the entries of the final schedule, including overrides, between since and until.
+func (c *PagerdutyClient) ListFinalScheduleEntries(ctx context.Context, scheduleID string, since, until time.Time) ([]pagerduty.RenderedScheduleEntry, error) {
+	schedule, err := c.pagerdutyClient.GetScheduleWithContext(ctx, scheduleID, pagerduty.GetScheduleOptions{
+		Since: util.TimestampToString(since),
+		Until: util.TimestampToString(until),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule.FinalSchedule.RenderedScheduleEntries, nil
 }
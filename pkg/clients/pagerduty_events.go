@@ -0,0 +1,171 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package clients
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-kit/kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	IncidentStatusResolved = "resolved"
+
+	eventActionTrigger = "trigger"
+	eventClient        = "Pulsar"
+
+	// incidentWatchInterval and incidentWatchTimeout are the polling interval and the maximal duration of WatchIncident.
+	incidentWatchInterval = 30 * time.Second
+	incidentWatchTimeout  = 24 * time.Hour
+)
+
+// eventSeverities maps urgencies and severities to the severity of an Events API v2 event.
+var eventSeverities = map[string]string{
+	"high":     "critical",
+	"low":      "warning",
+	"critical": "critical",
+	"error":    "error",
+	"warning":  "warning",
+	"info":     "info",
+}
+
+// EventSeverity returns the Events API v2 severity for the given urgency or severity or an error.
+func EventSeverity(urgency string) (string, error) {
+	if s, ok := eventSeverities[urgency]; ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown urgency '%s'. use high, low, critical, error, warning or info", urgency)
+}
+
+// EventSeverities returns the urgencies and severities which can be used to trigger an event.
+func EventSeverities() []string {
+	res := make([]string, 0, len(eventSeverities))
+	for s := range eventSeverities {
+		res = append(res, s)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// TriggerEvent triggers an incident via the Events API v2 for the given routing key and returns its dedup key or an error.
+func (c *PagerdutyClient) TriggerEvent(ctx context.Context, routingKey, severity, summary, source string) (string, error) {
+	event := &pagerduty.V2Event{
+		RoutingKey: routingKey,
+		Action:     eventActionTrigger,
+		Client:     eventClient,
+		Payload: &pagerduty.V2Payload{
+			Summary:   summary,
+			Source:    source,
+			Severity:  severity,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	level.Debug(c.logger).Log("msg", "triggering event", "summary", summary, "severity", severity)
+	res, err := c.pagerdutyClient.ManageEventWithContext(ctx, event)
+	if err != nil {
+		return "", err
+	}
+
+	return res.DedupKey, nil
+}
+
+// GetIncidentByKey returns the incident with the given incident key, which equals the dedup key of the triggering event, or an error.
+func (c *PagerdutyClient) GetIncidentByKey(ctx context.Context, incidentKey string) (*pagerduty.Incident, error) {
+	incidentList, err := c.pagerdutyClient.ListIncidentsWithContext(ctx, pagerduty.ListIncidentsOptions{
+		IncidentKey: incidentKey,
+		Statuses:    []string{IncidentStatusTriggered, IncidentStatusAcknowledged, IncidentStatusResolved},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(incidentList.Incidents) == 0 {
+		return nil, fmt.Errorf("no incident with key '%s' found", incidentKey)
+	}
+	return &incidentList.Incidents[0], nil
+}
+
+// WatchIncident polls the incident with the given key and calls onChange whenever it was created or its status changed.
+// Returns once the incident is resolved, the context is done or after the timeout.
+func (c *PagerdutyClient) WatchIncident(ctx context.Context, incidentKey string, onChange func(incident *pagerduty.Incident)) error {
+	ctx, cancel := context.WithTimeout(ctx, incidentWatchTimeout)
+	defer cancel()
+
+	interval := c.watchInterval
+	if interval == 0 {
+		interval = incidentWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastStatus string
+	for {
+		incident, err := c.GetIncidentByKey(ctx, incidentKey)
+		if err != nil {
+			// The incident might not have been created yet.
+			level.Debug(c.logger).Log("msg", "failed to get incident", "key", incidentKey, "err", err.Error())
+		} else {
+			if incident.Status != lastStatus {
+				lastStatus = incident.Status
+				onChange(incident)
+			}
+
+			if incident.Status == IncidentStatusResolved {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("stopped watching incident with key '%s' after %s", incidentKey, incidentWatchTimeout.String())
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// PostIncidentUpdates returns a function for WatchIncident posting the incident link and status changes to the given thread.
+func PostIncidentUpdates(slackClient *SlackClient, channelID, threadTimestamp string) func(incident *pagerduty.Incident) {
+	isFirst := true
+	return func(incident *pagerduty.Incident) {
+		text := fmt.Sprintf("Incident is %s", incident.Status)
+		if isFirst {
+			isFirst = false
+			text = fmt.Sprintf("PD Incident (%d): %s\n%s", incident.IncidentNumber, incident.HTMLURL, text)
+		}
+
+		if incident.Status == IncidentStatusAcknowledged && len(incident.Acknowledgements) > 0 {
+			text += fmt.Sprintf(" by %s", incident.Acknowledgements[0].Acknowledger.Summary)
+		}
+
+		if _, _, err := slackClient.PostMessage(channelID, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTimestamp)); err != nil {
+			level.Error(slackClient.logger).Log("msg", "failed to post incident update", "incidentID", incident.ID, "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEventsClient(handler http.HandlerFunc) (*PagerdutyClient, func()) {
+	srv := httptest.NewServer(handler)
+	return &PagerdutyClient{
+		logger: util.NewLogger(),
+		cfg:    &config.PagerdutyConfig{},
+		pagerdutyClient: pagerduty.NewClient("token",
+			pagerduty.WithAPIEndpoint(srv.URL),
+			pagerduty.WithV2EventsAPIEndpoint(srv.URL),
+		),
+		watchInterval: 10 * time.Millisecond,
+	}, srv.Close
+}
+
+func TestTriggerEvent(t *testing.T) {
+	var event pagerduty.V2Event
+	c, closeServer := newTestEventsClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/enqueue", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event), "the event should be valid JSON")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(pagerduty.V2EventResponse{Status: "success", DedupKey: "dedup-1"})
+	})
+	defer closeServer()
+
+	dedupKey, err := c.TriggerEvent(context.Background(), "routing-key", "critical", "nova api is down", "slack")
+	require.NoError(t, err, "there should be no error triggering the event")
+	assert.Equal(t, "dedup-1", dedupKey, "the dedup key of the response should be returned")
+	assert.Equal(t, "routing-key", event.RoutingKey)
+	assert.Equal(t, eventActionTrigger, event.Action)
+	if assert.NotNil(t, event.Payload, "the event should have a payload") {
+		assert.Equal(t, "nova api is down", event.Payload.Summary)
+		assert.Equal(t, "critical", event.Payload.Severity)
+		assert.Equal(t, "slack", event.Payload.Source)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.TriggerEvent(ctx, "routing-key", "critical", "nova api is down", "slack")
+	assert.Error(t, err, "cancelled events should not be sent")
+}
+
+func TestWatchIncident(t *testing.T) {
+	// The incident does not exist at first, is triggered, stays triggered for a while, is acknowledged and resolved.
+	statuses := []string{"", IncidentStatusTriggered, IncidentStatusTriggered, IncidentStatusAcknowledged, IncidentStatusResolved}
+	var (
+		polls int
+		mtx   sync.Mutex
+	)
+	c, closeServer := newTestEventsClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "dedup-1", r.URL.Query().Get("incident_key"), "the incident should be looked up by its key")
+		mtx.Lock()
+		status := statuses[polls]
+		if polls < len(statuses)-1 {
+			polls++
+		}
+		mtx.Unlock()
+
+		incidents := make([]pagerduty.Incident, 0)
+		if status != "" {
+			incidents = append(incidents, pagerduty.Incident{IncidentKey: "dedup-1", Status: status})
+		}
+		json.NewEncoder(w).Encode(pagerduty.ListIncidentsResponse{Incidents: incidents})
+	})
+	defer closeServer()
+
+	changes := make([]string, 0)
+	err := c.WatchIncident(context.Background(), "dedup-1", func(incident *pagerduty.Incident) {
+		changes = append(changes, incident.Status)
+	})
+	assert.NoError(t, err, "the watcher should stop once the incident is resolved")
+	assert.Equal(t, []string{IncidentStatusTriggered, IncidentStatusAcknowledged, IncidentStatusResolved}, changes,
+		"only changes of the status should be reported")
+}
+
+func TestWatchIncidentCancel(t *testing.T) {
+	c, closeServer := newTestEventsClient(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(pagerduty.ListIncidentsResponse{Incidents: []pagerduty.Incident{{Status: IncidentStatusTriggered}}})
+	})
+	defer closeServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.WatchIncident(ctx, "dedup-1", func(incident *pagerduty.Incident) {})
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err, "the watcher should stop once the context is cancelled")
+	case <-time.After(time.Second):
+		assert.Fail(t, "the watcher should stop once the context is cancelled")
+	}
+}
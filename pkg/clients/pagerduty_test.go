@@ -0,0 +1,84 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListIncidentsPagination(t *testing.T) {
+	// 3 pages with 2 incidents each. Only one incident per page matches the filter.
+	pages := [][]pagerduty.Incident{
+		{{APIObject: pagerduty.APIObject{Summary: summaryTextMultiple}}, {APIObject: pagerduty.APIObject{Summary: summaryText}}},
+		{{APIObject: pagerduty.APIObject{Summary: summaryTextWithLink}}, {APIObject: pagerduty.APIObject{Summary: summaryTextMultiple}}},
+		{{APIObject: pagerduty.APIObject{Summary: summaryTextMultiple}}, {APIObject: pagerduty.APIObject{Summary: summaryText}}},
+	}
+
+	var requestedPages int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, dateRangeAll, r.URL.Query().Get("date_range"), "incidents should not be limited to a time range")
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		page := offset / incidentsPageLimit
+		requestedPages++
+
+		json.NewEncoder(w).Encode(pagerduty.ListIncidentsResponse{
+			APIListObject: pagerduty.APIListObject{More: page < len(pages)-1},
+			Incidents:     pages[page],
+		})
+	}))
+	defer srv.Close()
+
+	c := &PagerdutyClient{
+		logger:          util.NewLogger(),
+		cfg:             &config.PagerdutyConfig{},
+		pagerdutyClient: pagerduty.NewClient("token", pagerduty.WithAPIEndpoint(srv.URL)),
+	}
+
+	f := &Filter{Clusters: []string{"eu-de-2"}}
+	incidents, err := c.ListIncidents(context.Background(), f)
+	assert.NoError(t, err, "there should be no error listing incidents")
+	assert.Len(t, incidents, 3, "all pages should be requested")
+	assert.Equal(t, 3, requestedPages, "all pages should be requested")
+
+	requestedPages = 0
+	f.SetLimit(2)
+	incidents, err = c.ListIncidents(context.Background(), f)
+	assert.NoError(t, err, "there should be no error listing incidents")
+	assert.Len(t, incidents, 2, "the limit should be honoured")
+	assert.Equal(t, 2, requestedPages, "no further pages should be requested once the limit is reached")
+}
+
+func TestGetDefaultUser(t *testing.T) {
+	var (
+		users     []pagerduty.User
+		requested int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested++
+		json.NewEncoder(w).Encode(pagerduty.ListUsersResponse{Users: users})
+	}))
+	defer srv.Close()
+
+	c, err := NewPagerdutyClient(&config.PagerdutyConfig{APIURL: srv.URL, DefaultEmail: "pulsar@example.com"}, util.NewLogger())
+	assert.NoError(t, err, "there should be no error creating the client")
+	assert.Equal(t, 0, requested, "creating the client should not look up the default user")
+
+	_, err = c.GetDefaultUser(context.Background())
+	assert.Error(t, err, "there should be an error if the default user does not exist")
+
+	users = []pagerduty.User{{APIObject: pagerduty.APIObject{ID: "P1"}, Email: "pulsar@example.com"}}
+	for i := 0; i < 2; i++ {
+		user, err := c.GetDefaultUser(context.Background())
+		assert.NoError(t, err, "there should be no error getting the default user")
+		assert.Equal(t, "P1", user.ID, "the default user should be returned")
+	}
+	assert.Equal(t, 2, requested, "the default user should be looked up again after an error but cached once found")
+}
@@ -0,0 +1,231 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+const (
+	resultTypeVector = "vector"
+	resultTypeMatrix = "matrix"
+	resultTypeScalar = "scalar"
+
+	// maxRangePoints limits the points per series of range queries like the Prometheus UI does.
+	maxRangePoints = 250
+)
+
+// PrometheusClient runs PromQL queries against the Prometheus API v1 of a region.
+type PrometheusClient struct {
+	cfg        *config.PrometheusConfig
+	httpClient httpDoer
+	logger     log.Logger
+}
+
+// Sample is the value of a series at a point in time.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series is a labeled list of samples. Instant queries return one sample per series.
+type Series struct {
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Name returns the labels of the series in the PromQL notation, e.g. `up{job="nova"}`.
+func (s *Series) Name() string {
+	pairs := make([]string, 0, len(s.Labels))
+	for name, value := range s.Labels {
+		if name != "__name__" {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+		}
+	}
+	sort.Strings(pairs)
+
+	name := s.Labels["__name__"]
+	if len(pairs) > 0 || name == "" {
+		name += "{" + strings.Join(pairs, ", ") + "}"
+	}
+	return name
+}
+
+// NewPrometheusClient returns a new PrometheusClient.
+func NewPrometheusClient(cfg *config.PrometheusConfig, logger log.Logger) *PrometheusClient {
+	return &PrometheusClient{
+		cfg:        cfg,
+		httpClient: newRetryClient("prometheus", logger),
+		logger:     log.With(logger, "component", "prometheus"),
+	}
+}
+
+// NewPrometheusClientFromEnv get's the configuration from the environment and returns a new PrometheusClient or an error.
+func NewPrometheusClientFromEnv() (*PrometheusClient, error) {
+	cfg, err := config.NewPrometheusConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPrometheusClient(cfg, util.NewLogger()), nil
+}
+
+// Query evaluates the query at the given time in the Prometheus of the region and returns one sample per series.
+func (c *PrometheusClient) Query(ctx context.Context, region, query string, at time.Time) ([]Series, error) {
+	params := url.Values{"query": {query}, "time": {formatTime(at)}}
+	return c.do(ctx, region, "/api/v1/query", params)
+}
+
+// QueryRange evaluates the query over the range ending at the given time in the Prometheus of the region.
+// The step is chosen so each series has at most maxRangePoints samples.
+func (c *PrometheusClient) QueryRange(ctx context.Context, region, query string, end time.Time, queryRange time.Duration) ([]Series, error) {
+	step := queryRange / maxRangePoints
+	if step < time.Second {
+		step = time.Second
+	}
+
+	params := url.Values{
+		"query": {query},
+		"start": {formatTime(end.Add(-queryRange))},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	return c.do(ctx, region, "/api/v1/query_range", params)
+}
+
+// do runs the query against the Prometheus of the region and returns the series of the result or an error.
+func (c *PrometheusClient) do(ctx context.Context, region, path string, params url.Values) ([]Series, error) {
+	baseURL, err := c.cfg.URLForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	level.Debug(c.logger).Log("msg", "querying prometheus", "region", region, "path", path, "query", params.Get("query"))
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, errors.Wrapf(err, "prometheus in region %s responded with %d", region, res.StatusCode)
+	}
+	if body.Status != "success" {
+		return nil, fmt.Errorf("query failed: %s", body.Error)
+	}
+	return parseResult(body.Data.ResultType, body.Data.Result)
+}
+
+// parseResult parses the result of a query depending on its type.
+func parseResult(resultType string, result json.RawMessage) ([]Series, error) {
+	type series struct {
+		Metric map[string]string `json:"metric"`
+		Value  [2]interface{}    `json:"value"`
+		Values [][2]interface{}  `json:"values"`
+	}
+
+	var raw []series
+	switch resultType {
+	case resultTypeVector, resultTypeMatrix:
+		if err := json.Unmarshal(result, &raw); err != nil {
+			return nil, err
+		}
+	case resultTypeScalar:
+		var value [2]interface{}
+		if err := json.Unmarshal(result, &value); err != nil {
+			return nil, err
+		}
+		raw = []series{{Metric: map[string]string{}, Value: value}}
+	default:
+		return nil, fmt.Errorf("unsupported result type '%s'", resultType)
+	}
+
+	res := make([]Series, 0, len(raw))
+	for _, r := range raw {
+		values := r.Values
+		if resultType != resultTypeMatrix {
+			values = [][2]interface{}{r.Value}
+		}
+
+		s := Series{Labels: r.Metric, Samples: make([]Sample, 0, len(values))}
+		for _, v := range values {
+			sample, err := parseSample(v)
+			if err != nil {
+				return nil, err
+			}
+			s.Samples = append(s.Samples, sample)
+		}
+		res = append(res, s)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name() < res[j].Name() })
+	return res, nil
+}
+
+// parseSample parses a sample of the form [<unix time>, "<value>"].
+func parseSample(v [2]interface{}) (Sample, error) {
+	ts, ok := v[0].(float64)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid sample time '%v'", v[0])
+	}
+	str, ok := v[1].(string)
+	if !ok {
+		return Sample{}, fmt.Errorf("invalid sample value '%v'", v[1])
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	sec, frac := math.Modf(ts)
+	return Sample{Time: time.Unix(int64(sec), int64(frac*1e9)).UTC(), Value: value}, nil
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
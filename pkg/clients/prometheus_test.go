@@ -0,0 +1,75 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusQuery(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/eu-de-1/api/v1/query":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"__name__":"up","job":"nova-api"},"value":[1570000000.5,"0"]},
+				{"metric":{"__name__":"up","job":"cinder-api"},"value":[1570000000.5,"1"]}]}}`))
+		case "/eu-de-1/api/v1/query_range":
+			assert.Equal(t, "1", r.URL.Query().Get("step"), "the step should be at least 1s")
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"job":"nova-api"},"values":[[1570000000,"1"],[1570000001,"NaN"]]}]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewPrometheusClient(&config.PrometheusConfig{APIURL: server.URL + "/{region}"}, log.NewNopLogger())
+
+	series, err := client.Query(context.Background(), "eu-de-1", `up`, time.Now())
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	assert.Equal(t, `up{job="cinder-api"}`, series[0].Name(), "the series should be sorted by name")
+	assert.Equal(t, []Sample{{Time: time.Unix(1570000000, 5e8).UTC(), Value: 1}}, series[0].Samples)
+
+	series, err = client.QueryRange(context.Background(), "eu-de-1", `up`, time.Now(), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.Equal(t, `{job="nova-api"}`, series[0].Name())
+	assert.Len(t, series[0].Samples, 2)
+
+	_, err = client.Query(context.Background(), "eu-nl-1", `up{`, time.Now())
+	assert.EqualError(t, err, "query failed: parse error")
+
+	_, err = client.Query(context.Background(), "", `up`, time.Now())
+	assert.Error(t, err, "queries without region should be rejected")
+	assert.Equal(t, []string{"/eu-de-1/api/v1/query", "/eu-de-1/api/v1/query_range", "/eu-nl-1/api/v1/query"}, paths)
+}
@@ -0,0 +1,123 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package clients
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	maxRetries     = 5
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+var (
+	// throttledRequests counts the requests rejected by an API due to rate limits per service.
+	throttledRequests = expvar.NewMap("pulsar_throttled_requests_total")
+	// retriedRequests counts the retries of requests per service.
+	retriedRequests = expvar.NewMap("pulsar_retried_requests_total")
+)
+
+// httpDoer is the interface of the HTTP clients used by the Slack and PagerDuty libraries.
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// retryClient retries requests rejected due to rate limits (429) or temporarily unavailable APIs (503).
+// It waits as long as the Retry-After header asks for or backs off exponentially.
+type retryClient struct {
+	client  httpDoer
+	service string
+	logger  log.Logger
+}
+
+func newRetryClient(service string, logger log.Logger) *retryClient {
+	return &retryClient{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		service: service,
+		logger:  logger,
+	}
+}
+
+// Do sends the request and retries it if necessary.
+func (r *retryClient) Do(req *http.Request) (*http.Response, error) {
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		res, err := r.client.Do(req)
+		if err != nil || !isRetryable(res.StatusCode) {
+			return res, err
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests {
+			throttledRequests.Add(r.service, 1)
+		}
+
+		// Requests with a body can only be retried if the body can be read again.
+		if attempt >= maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return res, nil
+		}
+
+		wait := retryAfter(res, backoff)
+		res.Body.Close()
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		level.Info(r.logger).Log("msg", "request throttled. retrying", "service", r.service, "status", res.StatusCode, "retryAfter", wait.String(), "attempt", attempt+1)
+		retriedRequests.Add(r.service, 1)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// retryAfter returns the duration given in seconds by the Retry-After header or the backoff.
+func retryAfter(res *http.Response, backoff time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		if d := time.Duration(seconds) * time.Second; d < maxBackoff {
+			return d
+		}
+		return maxBackoff
+	}
+	return backoff
+}
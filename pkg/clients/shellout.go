@@ -21,6 +21,7 @@ package clients
 
 import (
 	"bytes"
+	"context"
 	"os/exec"
 	"strings"
 
@@ -55,7 +56,12 @@ func (c *Command) verify() error {
 
 // Run starts the command, waits until execution finished and returns stdOut or the error.
 func (c *Command) Run(args ...string) (string, error) {
-	cmd := exec.Command(c.cmd, append(c.defaultArgs, args...)...)
+	return c.RunWithContext(context.Background(), args...)
+}
+
+// RunWithContext is like Run but kills the command if the context is done before it finished.
+func (c *Command) RunWithContext(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, c.cmd, append(c.defaultArgs, args...)...)
 
 	var stdErr, stdOut bytes.Buffer
 	cmd.Stderr = &stdErr
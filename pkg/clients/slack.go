@@ -20,6 +20,10 @@
 package clients
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/go-kit/kit/log"
@@ -33,45 +37,38 @@ const errAlreadyReacted = "already_reacted"
 
 // SlackClient ...
 type SlackClient struct {
-	logger log.Logger
-	cfg    *config.SlackConfig
-	client *slack.Client
-
+	logger     log.Logger
+	cfg        *config.SlackConfig
+	client     *slack.Client
+	httpClient httpDoer
+	token      string
 }
 
 // NewSlackClient returns a new SlackClient with Bot Token or an error.
 func NewSlackBotClient(cfg *config.SlackConfig, logger log.Logger) (*SlackClient, error) {
-    cfg, err := config.NewSlackConfigFromEnv()
-	if err != nil {
-		return nil, err
-	}
-
-    slackClient := slack.New(cfg.BotToken)
-	if slackClient == nil {
-		return nil, errors.New("failed to initialize slack client with bot token")
-	}
-
-	return &SlackClient{
-		cfg:    cfg,
-		logger: log.With(logger, "component", "slack"),
-		client: slackClient,
-	}, nil
+	c, err := newSlackClient(cfg, cfg.BotToken, logger)
+	return c, errors.Wrap(err, "failed to initialize slack client with bot token")
 }
+
 // NewSlackClient returns a new SlackClient with Access token or an error.
 func NewSlackClient(cfg *config.SlackConfig, logger log.Logger) (*SlackClient, error) {
-    cfg, err := config.NewSlackConfigFromEnv()
-	if err != nil {
-		return nil, err
-	}
-    slackClient := slack.New(cfg.AccessToken)
+	c, err := newSlackClient(cfg, cfg.AccessToken, logger)
+	return c, errors.Wrap(err, "failed to initialize slack client with access token")
+}
+
+func newSlackClient(cfg *config.SlackConfig, token string, logger log.Logger) (*SlackClient, error) {
+	httpClient := newRetryClient("slack", logger)
+	slackClient := slack.New(token, slack.OptionHTTPClient(httpClient), slack.OptionAPIURL(cfg.APIEndpoint()))
 	if slackClient == nil {
-		return nil, errors.New("failed to initialize slack client with access token")
+		return nil, errors.New("slack client is nil")
 	}
 
 	return &SlackClient{
-		cfg:    cfg,
-		logger: log.With(logger, "component", "slack"),
-		client: slackClient,
+		cfg:        cfg,
+		logger:     log.With(logger, "component", "slack"),
+		client:     slackClient,
+		httpClient: httpClient,
+		token:      token,
 	}, nil
 }
 
@@ -100,6 +97,38 @@ func (s *SlackClient) PostMessage(channelID string, options ...slack.MsgOption)
 	return s.client.PostMessage(channelID, append(opts, options...)...)
 }
 
+// UpdateMessage updates an existing message in the specified channel.
+func (s *SlackClient) UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	return s.client.UpdateMessage(channelID, timestamp, options...)
+}
+
+// PostEphemeral posts a message only visible to the given user in the specified channel.
+func (s *SlackClient) PostEphemeral(channelID, userID string, options ...slack.MsgOption) (string, error) {
+	return s.client.PostEphemeral(channelID, userID, options...)
+}
+
+// OpenDialog opens the dialog in response to the interaction with the given trigger ID.
+func (s *SlackClient) OpenDialog(triggerID string, dialog slack.Dialog) error {
+	return s.client.OpenDialog(triggerID, dialog)
+}
+
+// OpenDirectMessage opens a direct message channel with the user and returns its id or an error.
+func (s *SlackClient) OpenDirectMessage(userID string) (string, error) {
+	_, _, channelID, err := s.client.OpenIMChannel(userID)
+	return channelID, err
+}
+
+// DeleteMessage deletes a message in the specified channel.
+func (s *SlackClient) DeleteMessage(channelID, timestamp string) error {
+	_, _, err := s.client.DeleteMessage(channelID, timestamp)
+	return err
+}
+
+// UploadFile uploads a file to the channels given in the parameters.
+func (s *SlackClient) UploadFile(params slack.FileUploadParameters) (*slack.File, error) {
+	return s.client.UploadFile(params)
+}
+
 // GetUserByEmail returns the user or an error.
 func (s *SlackClient) GetUserByEmail(email string) (*slack.User, error) {
 	return s.client.GetUserByEmail(email)
@@ -109,6 +138,14 @@ func (s *SlackClient) GetUserByID(userID string) (*slack.User, error) {
 	return s.client.GetUserInfo(userID)
 }
 
+// UserMentionByEmail returns the mention of the user with the given email or the fallback if the user cannot be found.
+func (s *SlackClient) UserMentionByEmail(email, fallback string) string {
+	if usr, err := s.client.GetUserByEmail(email); err == nil {
+		return fmt.Sprintf("<@%s>", usr.ID)
+	}
+	return fallback
+}
+
 // AddReactionToMessage adds a reaction emoji to an existing message.
 func (s *SlackClient) AddReactionToMessage(channel, timestamp, reaction string) error {
 	msgRef := slack.NewRefToMessage(channel, timestamp)
@@ -129,6 +166,67 @@ func (s *SlackClient) GetConversationHistory(channel string) (*slack.GetConversa
 	return history, nil
 }
 
+// GetConversationReplies returns all messages of the thread including the parent message.
+func (s *SlackClient) GetConversationReplies(channel, threadTimestamp string) ([]slack.Message, error) {
+	params := &slack.GetConversationRepliesParameters{ChannelID: channel, Timestamp: threadTimestamp}
+
+	res := make([]slack.Message, 0)
+	for {
+		msgs, hasMore, nextCursor, err := s.client.GetConversationReplies(params)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, msgs...)
+
+		if !hasMore || nextCursor == "" {
+			return res, nil
+		}
+		params.Cursor = nextCursor
+	}
+}
+
+// Scopes returns the OAuth scopes granted to the token of the client or an error if the token is invalid.
+// The Slack library does not expose the X-OAuth-Scopes header, so auth.test is called directly.
+func (s *SlackClient) Scopes(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.APIEndpoint()+"auth.test", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var authTest slack.SlackResponse
+	if err := json.NewDecoder(res.Body).Decode(&authTest); err != nil {
+		return nil, errors.Wrap(err, "failed to decode auth.test response")
+	}
+	if !authTest.Ok {
+		return nil, errors.New(authTest.Error)
+	}
+
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(res.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// GetChannel returns the channel, group or direct message with the given ID or an error.
+func (s *SlackClient) GetChannel(channelID string) (*slack.Channel, error) {
+	return s.client.GetConversationInfo(channelID, false)
+}
+
+// ListUserGroups returns all user groups of the workspace or an error.
+func (s *SlackClient) ListUserGroups() ([]slack.UserGroup, error) {
+	return s.client.GetUserGroups()
+}
+
 func isErrAlreadyReacted(err error) bool {
 	if err == nil {
 		return false
@@ -23,19 +23,30 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/PagerDuty/go-pagerduty"
+	"github.com/sapcc/pulsar/pkg/config"
 	"github.com/sapcc/pulsar/pkg/util"
 )
 
-// regionAlertnameRegex is used to find the region and alertname from an incident text
-const regionAlertnameRegex = `.*[\s\*]+\[(?P<region>[\w-]*\w{2}-\w{2}-\d|admin|staging)\][\s\*]+(?P<alertname>.+?)\s\-.*`
+// regionAlertnameRegex is used to find the region and alertname from an incident text.
+// The region group is filled with the pattern of the region catalog.
+const regionAlertnameRegex = `.*[\s\*]+\[(?P<region>%s)\][\s\*]+(?P<alertname>.+?)\s\-.*`
+
+// regionAlertname caches the regionAlertnameRegex compiled for the current pattern of the region catalog.
+var regionAlertname = struct {
+	sync.Mutex
+	regionPattern string
+	regex         *regexp.Regexp
+}{}
 
 // parseRegionAndAlertnameFromText does what it says.
 // It's meant as a workaround until Fingerprints for Prometheus alerts are supported.
-// Returns an error if neither alertname nor region can be found.
+// Returns an error if neither alertname nor region can be found or the region is not in the region catalog.
 func ParseRegionAndAlertnameFromText(summary string) (string, string, error) {
-	regionAlertnameRegex := regexp.MustCompile(regionAlertnameRegex)
+	regions := config.Regions()
+	regionAlertnameRegex := regionAlertnameRegexFor(regions.Pattern())
 	matchMap := make(map[string]string)
 
 	match := regionAlertnameRegex.FindStringSubmatch(summary)
@@ -58,9 +69,26 @@ func ParseRegionAndAlertnameFromText(summary string) (string, string, error) {
 		return "", "", fmt.Errorf("pagerduty incident summary doesn not contain alertname and/or region: '%s'", summary)
 	}
 
+	region, err := regions.Resolve(region)
+	if err != nil {
+		return "", "", err
+	}
+
 	return util.NormalizeString(region), util.NormalizeString(alertname), nil
 }
 
+// regionAlertnameRegexFor returns the compiled regionAlertnameRegex for the pattern of the region catalog.
+// It is only compiled again if the catalog was reloaded.
+func regionAlertnameRegexFor(regionPattern string) *regexp.Regexp {
+	regionAlertname.Lock()
+	defer regionAlertname.Unlock()
+	if regionAlertname.regex == nil || regionAlertname.regionPattern != regionPattern {
+		regionAlertname.regionPattern = regionPattern
+		regionAlertname.regex = regexp.MustCompile(fmt.Sprintf(regionAlertnameRegex, regionPattern))
+	}
+	return regionAlertname.regex
+}
+
 func containsUser(userList []*pagerduty.User, user pagerduty.User) bool {
 	for _, u := range userList {
 		if u.ID == user.ID {
@@ -69,3 +97,11 @@ func containsUser(userList []*pagerduty.User, user pagerduty.User) bool {
 	}
 	return false
 }
+
+// UserName returns the name of the pagerduty user falling back to the summary.
+func UserName(user pagerduty.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	return user.Summary
+}
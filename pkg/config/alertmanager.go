@@ -0,0 +1,131 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	webhookToken     = "ALERTMANAGER_WEBHOOK_TOKEN"
+	receiverChannels = "ALERTMANAGER_RECEIVER_CHANNELS"
+	alertmanagerURL  = "ALERTMANAGER_API_URL"
+	silenceAdminRole = "ALERTMANAGER_SILENCE_ADMIN_ROLE"
+)
+
+// AlertmanagerConfig configures the webhook receiving alert notifications from the Alertmanager.
+type AlertmanagerConfig struct {
+	// WebhookToken is the bearer token the Alertmanager has to send with notifications.
+	// Required if receiver channels are configured.
+	WebhookToken string `yaml:"webhookToken"`
+
+	// ReceiverChannels maps names of Alertmanager receivers to the Slack channel IDs their alerts are posted in.
+	// Reloaded at runtime.
+	ReceiverChannels map[string]string `yaml:"receiverChannels"`
+
+	// APIURL is the base URL of the Alertmanager API used to silence alerts. {region} is replaced by the region
+	// of the alerts, e.g. https://alertmanager.{region}.example.com. Optional.
+	APIURL string `yaml:"apiURL"`
+
+	// SilenceAdminRole is the role of the users who may expire silences created by others. Optional.
+	// Without it only the creator of a silence may expire it.
+	SilenceAdminRole string `yaml:"silenceAdminRole"`
+
+	// regions is the region catalog, whose Alertmanager URLs take precedence over APIURL.
+	regions *RegionCatalog
+}
+
+// NewAlertmanagerConfigFromEnv returns the validated Alertmanager configuration read from the configuration file and the environment or an error.
+func NewAlertmanagerConfigFromEnv() (*AlertmanagerConfig, error) {
+	cfg, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	return &cfg.Alertmanager, cfg.Alertmanager.validate()
+}
+
+// ChannelForReceiver returns the ID of the channel the alerts of the receiver are posted in and whether one is configured.
+func (c *AlertmanagerConfig) ChannelForReceiver(receiver string) (string, bool) {
+	current.RLock()
+	defer current.RUnlock()
+	channelID, ok := c.ReceiverChannels[receiver]
+	return channelID, ok
+}
+
+// URLForRegion returns the base URL of the Alertmanager API of the region or an error if none is configured
+// or the region is unknown.
+func (c *AlertmanagerConfig) URLForRegion(region string) (string, error) {
+	return c.regions.urlForRegion(alertmanagerURL, c.APIURL, region, func(r *Region) string { return r.AlertmanagerURL })
+}
+
+func (c *AlertmanagerConfig) applyEnv() error {
+	return applyEnvOverrides(
+		envString(webhookToken, &c.WebhookToken),
+		envFunc(receiverChannels, func(v string) error {
+			c.ReceiverChannels = parseReceiverChannels(v)
+			return nil
+		}),
+		envString(alertmanagerURL, &c.APIURL),
+		envString(silenceAdminRole, &c.SilenceAdminRole),
+	)
+}
+
+// reload applies the settings of the new configuration which are safe to change at runtime.
+// The caller must hold the lock.
+func (c *AlertmanagerConfig) reload(n *AlertmanagerConfig) {
+	c.ReceiverChannels = n.ReceiverChannels
+}
+
+func (c *AlertmanagerConfig) validate() error {
+	if err := validateReceiverChannels(c.ReceiverChannels); err != nil {
+		return err
+	}
+	if len(c.ReceiverChannels) > 0 && c.WebhookToken == "" {
+		return fmt.Errorf("missing %s. it is required to receive notifications for the %s", webhookToken, receiverChannels)
+	}
+
+	return validateURLTemplate(alertmanagerURL, c.APIURL)
+}
+
+// parseReceiverChannels parses a string of the form `receiver1=channelID1,receiver2=channelID2`.
+// Receiver names are case-sensitive like in the Alertmanager configuration. Malformed entries are kept with empty
+// receivers or channel IDs, so they are reported by validateReceiverChannels.
+func parseReceiverChannels(theString string) map[string]string {
+	res := make(map[string]string)
+	for _, entry := range splitList(theString, ",") {
+		receiver, channelID, _ := strings.Cut(entry, "=")
+		res[strings.TrimSpace(receiver)] = strings.TrimSpace(channelID)
+	}
+	return res
+}
+
+// validateReceiverChannels returns an error unless every receiver is mapped to a channel ID.
+func validateReceiverChannels(channels map[string]string) error {
+	for receiver, channelID := range channels {
+		if receiver == "" || channelID == "" {
+			return fmt.Errorf("%s must map receivers to channel IDs: '%s=%s'", receiverChannels, receiver, channelID)
+		}
+	}
+	return nil
+}
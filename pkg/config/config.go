@@ -0,0 +1,397 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFile = "PULSAR_CONFIG_FILE"
+
+	// fileSuffix is appended to the name of an environment variable to read its value from a file instead.
+	fileSuffix = "_FILE"
+
+	// watchInterval is the interval in which the configuration file is checked for changes.
+	watchInterval = 10 * time.Second
+
+	// regionPlaceholder is replaced by the region in the URLs of per-region APIs.
+	regionPlaceholder = "{region}"
+)
+
+// Config is the configuration of pulsar.
+// It is read from the YAML configuration file and overridden by environment variables.
+type Config struct {
+	Slack        SlackConfig        `yaml:"slack"`
+	Pagerduty    PagerdutyConfig    `yaml:"pagerduty"`
+	Kubernetes   K8sConfig          `yaml:"kubernetes"`
+	Alertmanager AlertmanagerConfig `yaml:"alertmanager"`
+	Prometheus   PrometheusConfig   `yaml:"prometheus"`
+	Runbooks     RunbookCatalog     `yaml:"runbooks"`
+	Regions      RegionCatalog      `yaml:"regions"`
+}
+
+var current = struct {
+	// RWMutex guards the settings which are reloaded at runtime.
+	sync.RWMutex
+	path     string
+	cfg      *Config
+	modTime  time.Time
+	onReload []func()
+}{
+	path: os.Getenv(configFile),
+}
+
+// SetFile sets the path of the configuration file. Must be called before the configuration is used.
+func SetFile(path string) {
+	current.Lock()
+	defer current.Unlock()
+	current.path = path
+	current.cfg = nil
+}
+
+// File returns the path of the configuration file or an empty string if none is used.
+func File() string {
+	current.RLock()
+	defer current.RUnlock()
+	return current.path
+}
+
+// Get returns the configuration shared by all components or an error.
+// The configuration is loaded on first use. Sections are not validated.
+func Get() (*Config, error) {
+	current.Lock()
+	defer current.Unlock()
+
+	if current.cfg != nil {
+		return current.cfg, nil
+	}
+
+	cfg, err := Load(current.path)
+	if err != nil {
+		return nil, err
+	}
+	current.cfg = cfg
+	current.modTime = modTime(current.path)
+	return cfg, nil
+}
+
+// Load reads the configuration from the given file, which is optional, and applies the environment overrides.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	cfg.Slack.setDefaults()
+	cfg.Pagerduty.setDefaults()
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read configuration file")
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse configuration file %s", path)
+		}
+	}
+
+	if err := cfg.Slack.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Pagerduty.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Kubernetes.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Alertmanager.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Prometheus.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Runbooks.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Regions.applyEnv(); err != nil {
+		return nil, err
+	}
+	cfg.Pagerduty.normalize()
+
+	// The URLs of the regions take precedence over the URL templates.
+	cfg.Alertmanager.regions = &cfg.Regions
+	cfg.Prometheus.regions = &cfg.Regions
+	return cfg, nil
+}
+
+// Validate validates all sections of the configuration.
+func (c *Config) Validate() error {
+	if err := c.Slack.validate(); err != nil {
+		return errors.Wrap(err, "invalid slack configuration")
+	}
+	if err := c.Pagerduty.validate(); err != nil {
+		return errors.Wrap(err, "invalid pagerduty configuration")
+	}
+	if err := c.Kubernetes.validate(); err != nil {
+		return errors.Wrap(err, "invalid kubernetes configuration")
+	}
+	if err := c.Alertmanager.validate(); err != nil {
+		return errors.Wrap(err, "invalid alertmanager configuration")
+	}
+	if err := c.Prometheus.validate(); err != nil {
+		return errors.Wrap(err, "invalid prometheus configuration")
+	}
+	if err := c.Runbooks.validate(); err != nil {
+		return errors.Wrap(err, "invalid runbooks configuration")
+	}
+	if err := c.Regions.validate(); err != nil {
+		return errors.Wrap(err, "invalid regions configuration")
+	}
+	return nil
+}
+
+// OnReload registers a function called after the configuration was reloaded.
+func OnReload(fn func()) {
+	current.Lock()
+	defer current.Unlock()
+	current.onReload = append(current.onReload, fn)
+}
+
+// Reload reads the configuration file again and applies the settings which are safe to change at runtime.
+// Tokens, the API address and the command workers require a restart.
+func Reload() error {
+	current.RLock()
+	path, cfg := current.path, current.cfg
+	current.RUnlock()
+	if cfg == nil {
+		return errors.New("configuration not loaded yet")
+	}
+
+	newCfg, err := Load(path)
+	if err != nil {
+		return err
+	}
+	if err := newCfg.Validate(); err != nil {
+		return err
+	}
+
+	current.Lock()
+	cfg.Slack.reload(&newCfg.Slack)
+	cfg.Pagerduty.reload(&newCfg.Pagerduty)
+	cfg.Alertmanager.reload(&newCfg.Alertmanager)
+	cfg.Runbooks.reload(&newCfg.Runbooks)
+	cfg.Regions.reload(&newCfg.Regions)
+	current.modTime = modTime(path)
+	onReload := current.onReload
+	current.Unlock()
+
+	for _, fn := range onReload {
+		fn()
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever the configuration file changed until stopped.
+func Watch(stop <-chan struct{}, logger log.Logger) {
+	path := File()
+	if path == "" {
+		level.Info(logger).Log("msg", "no configuration file given. not watching for changes")
+		return
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			current.RLock()
+			lastModTime := current.modTime
+			current.RUnlock()
+			if t := modTime(path); t.IsZero() || t.Equal(lastModTime) {
+				continue
+			}
+
+			if err := Reload(); err != nil {
+				level.Error(logger).Log("msg", "failed to reload configuration. keeping the previous one", "file", path, "err", err.Error())
+				// Don't retry until the file changes again.
+				current.Lock()
+				current.modTime = modTime(path)
+				current.Unlock()
+				continue
+			}
+			level.Info(logger).Log("msg", "reloaded configuration", "file", path)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// lookupEnv returns the value of the environment variable.
+// If the variable is not set but `<name>_FILE` is, the value is read from that file, e.g. a mounted secret.
+func lookupEnv(name string) (string, bool, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true, nil
+	}
+
+	path, ok := os.LookupEnv(name + fileSuffix)
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to read %s%s", name, fileSuffix)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// envOverride applies an environment variable to a setting if it is set.
+type envOverride func() error
+
+func applyEnvOverrides(overrides ...envOverride) error {
+	for _, o := range overrides {
+		if err := o(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envFunc applies the value of the environment variable using the given function unless it is empty.
+func envFunc(name string, apply func(value string) error) envOverride {
+	return func() error {
+		v, ok, err := lookupEnv(name)
+		if err != nil || !ok || strings.TrimSpace(v) == "" {
+			return err
+		}
+		return errors.Wrapf(apply(strings.TrimSpace(v)), "invalid %s", name)
+	}
+}
+
+// envOptionalString applies the value of the environment variable even if it is empty, so it can disable a setting with a default.
+func envOptionalString(name string, target *string) envOverride {
+	return func() error {
+		v, ok, err := lookupEnv(name)
+		if err != nil || !ok {
+			return err
+		}
+		*target = strings.TrimSpace(v)
+		return nil
+	}
+}
+
+func envString(name string, target *string) envOverride {
+	return envFunc(name, func(v string) error {
+		*target = v
+		return nil
+	})
+}
+
+func envList(name string, target *[]string) envOverride {
+	return envFunc(name, func(v string) error {
+		*target = splitList(v, ",")
+		return nil
+	})
+}
+
+func envInt(name string, target *int) envOverride {
+	return envFunc(name, func(v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*target = i
+		return nil
+	})
+}
+
+func envDuration(name string, target *time.Duration) envOverride {
+	return envFunc(name, func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*target = d
+		return nil
+	})
+}
+
+// validateList returns an error if the list contains empty items.
+func validateList(name string, list []string) error {
+	for _, itm := range list {
+		if strings.TrimSpace(itm) == "" {
+			return fmt.Errorf("%s must not contain empty items", name)
+		}
+	}
+	return nil
+}
+
+// validateURL returns an error unless the value is an absolute http(s) URL.
+func validateURL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an absolute http(s) URL", name)
+	}
+	return nil
+}
+
+// validateURLTemplate returns an error unless the value is empty or an absolute http(s) URL once the region is filled in.
+func validateURLTemplate(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	return validateURL(name, strings.ReplaceAll(value, regionPlaceholder, "region"))
+}
+
+// urlForRegion fills the region into the URL template of the per-region API configured by the given variable.
+func urlForRegion(name, template, region string) (string, error) {
+	if template == "" {
+		return "", fmt.Errorf("missing %s", name)
+	}
+	if region == "" && strings.Contains(template, regionPlaceholder) {
+		return "", errors.New("the region is unknown")
+	}
+	return strings.TrimSuffix(strings.ReplaceAll(template, regionPlaceholder, region), "/"), nil
+}
+
+// copyList returns a copy of the list so it can be used outside of the lock.
+func copyList(list []string) []string {
+	return append([]string(nil), list...)
+}
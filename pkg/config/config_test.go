@@ -0,0 +1,350 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+slack:
+  botToken: fileBotToken
+  botID: pulsar
+  accessToken: fileAccessToken
+  verificationToken: fileVerificationToken
+  authorizedUserGroupNames: [group1]
+  syncChannels: [C1]
+  commandTimeout: 1m
+pagerduty:
+  authToken: fileAuthToken
+  defaultEmail: pulsar@example.com
+  channelSchedules:
+    C1: [schedule1, schedule2]
+  routingKeys:
+    Compute: key1
+  defaultPageTarget: compute
+alertmanager:
+  apiURL: https://alertmanager.{region}.example.com/
+runbooks:
+- alertname: OpenstackLbaas.*
+  url: https://runbooks.example.com/lbaas
+  checklist: [check the octavia workers]
+- labels:
+    service: nova
+  checklist: [check the nova-api pods]
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeFile(t, "pulsar.yaml", testConfig)
+	t.Setenv(botToken, "envBotToken")
+	t.Setenv(accessToken+fileSuffix, writeFile(t, "accessToken", "secretAccessToken\n"))
+	t.Setenv(userRateLimit, "5")
+
+	cfg, err := Load(path)
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.NoError(t, cfg.Validate(), "the configuration should be valid")
+
+	assert.Equal(t, "envBotToken", cfg.Slack.BotToken, "the environment should override the file")
+	assert.Equal(t, "secretAccessToken", cfg.Slack.AccessToken, "the secret should be read from the file")
+	assert.Equal(t, "fileVerificationToken", cfg.Slack.VerificationToken)
+	assert.Equal(t, time.Minute, cfg.Slack.CommandTimeout)
+	assert.Equal(t, 5, cfg.Slack.UserRateLimit)
+	assert.Equal(t, 30, cfg.Slack.CommandRateLimit, "unset settings should use the default")
+
+	assert.Equal(t, []string{"schedule1", "schedule2"}, cfg.Pagerduty.SchedulesForChannel("C1"))
+	assert.Equal(t, []string{defaultScheduleName}, cfg.Pagerduty.SchedulesForChannel("C2"))
+	key, ok := cfg.Pagerduty.RoutingKey("compute")
+	assert.True(t, ok, "routing key names should be normalized")
+	assert.Equal(t, "key1", key)
+
+	amURL, err := cfg.Alertmanager.URLForRegion("eu-de-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://alertmanager.eu-de-1.example.com", amURL, "the region should be filled in")
+	_, err = cfg.Alertmanager.URLForRegion("")
+	assert.Error(t, err, "the region is required")
+}
+
+func TestSplitList(t *testing.T) {
+	stimuli := map[string][]string{
+		"":                       {},
+		" , ,":                   {},
+		"schedule1":              {"schedule1"},
+		" schedule1 ,  sched 2 ": {"schedule1", "sched 2"},
+		"schedule1,,schedule2,":  {"schedule1", "schedule2"},
+	}
+
+	for input, expected := range stimuli {
+		assert.Equal(t, expected, splitList(input, ","), "unexpected result for '%s'", input)
+	}
+}
+
+func TestParseChannelSchedules(t *testing.T) {
+	stimuli := []struct {
+		input    string
+		expected map[string][]string
+		valid    bool
+	}{
+		{input: "C1=schedule1", expected: map[string][]string{"C1": {"schedule1"}}, valid: true},
+		{input: " C1 = schedule1 | schedule2 , C2=schedule3 ", expected: map[string][]string{"C1": {"schedule1", "schedule2"}, "C2": {"schedule3"}}, valid: true},
+		{input: "C1=schedule1,C1=schedule2|schedule1", expected: map[string][]string{"C1": {"schedule1", "schedule2"}}, valid: true},
+		{input: "C1=schedule1||", expected: map[string][]string{"C1": {"schedule1"}}, valid: true},
+		{input: "", expected: map[string][]string{}, valid: true},
+		{input: "C1=", expected: map[string][]string{"C1": nil}},
+		{input: "C1=|", expected: map[string][]string{"C1": nil}},
+		{input: "C1", expected: map[string][]string{"C1": nil}},
+		{input: "=schedule1", expected: map[string][]string{"": {"schedule1"}}},
+		{input: "C1=schedule1,C2", expected: map[string][]string{"C1": {"schedule1"}, "C2": nil}},
+	}
+
+	for _, s := range stimuli {
+		got := parseChannelSchedules(s.input)
+		assert.Equal(t, s.expected, got, "unexpected result for '%s'", s.input)
+		if s.valid {
+			assert.NoError(t, validateChannelSchedules(channelSchedules, got), "'%s' should be valid", s.input)
+		} else {
+			assert.Error(t, validateChannelSchedules(channelSchedules, got), "'%s' should be invalid", s.input)
+		}
+	}
+}
+
+func TestParseRoutingKeys(t *testing.T) {
+	stimuli := []struct {
+		input    string
+		expected map[string]string
+		valid    bool
+	}{
+		{input: "Compute=key1", expected: map[string]string{"compute": "key1"}, valid: true},
+		{input: " compute = key1 , storage=key2 ", expected: map[string]string{"compute": "key1", "storage": "key2"}, valid: true},
+		{input: "", expected: map[string]string{}, valid: true},
+		{input: "compute", expected: map[string]string{"compute": ""}},
+		{input: "compute=", expected: map[string]string{"compute": ""}},
+		{input: "=key1", expected: map[string]string{"": "key1"}},
+		{input: "compute=key1,storage", expected: map[string]string{"compute": "key1", "storage": ""}},
+	}
+
+	for _, s := range stimuli {
+		got := parseRoutingKeys(s.input)
+		assert.Equal(t, s.expected, got, "unexpected result for '%s'", s.input)
+		if s.valid {
+			assert.NoError(t, validateRoutingKeys(got), "'%s' should be valid", s.input)
+		} else {
+			assert.Error(t, validateRoutingKeys(got), "'%s' should be invalid", s.input)
+		}
+	}
+}
+
+func TestParseReceiverChannels(t *testing.T) {
+	stimuli := []struct {
+		input    string
+		expected map[string]string
+		valid    bool
+	}{
+		{input: "Slack-Alerts=C1", expected: map[string]string{"Slack-Alerts": "C1"}, valid: true},
+		{input: " slack-alerts = C1 , slack-storage=C2 ", expected: map[string]string{"slack-alerts": "C1", "slack-storage": "C2"}, valid: true},
+		{input: "", expected: map[string]string{}, valid: true},
+		{input: "slack-alerts", expected: map[string]string{"slack-alerts": ""}},
+		{input: "=C1", expected: map[string]string{"": "C1"}},
+		{input: "slack-alerts=C1,slack-storage", expected: map[string]string{"slack-alerts": "C1", "slack-storage": ""}},
+	}
+
+	for _, s := range stimuli {
+		got := parseReceiverChannels(s.input)
+		assert.Equal(t, s.expected, got, "unexpected result for '%s'", s.input)
+		if s.valid {
+			assert.NoError(t, validateReceiverChannels(got), "'%s' should be valid", s.input)
+		} else {
+			assert.Error(t, validateReceiverChannels(got), "'%s' should be invalid", s.input)
+		}
+	}
+}
+
+func TestDebugAddressFromEnv(t *testing.T) {
+	cfg, err := Load(writeFile(t, "pulsar.yaml", testConfig))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.Equal(t, "127.0.0.1:8081", cfg.Slack.DebugAddress, "the debug address should default to localhost")
+
+	t.Setenv(debugAddress, "")
+	cfg, err = Load(writeFile(t, "pulsar.yaml", testConfig))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.Empty(t, cfg.Slack.DebugAddress, "an empty debug address should disable the debug listener")
+}
+
+func TestChannelSchedulesFromEnv(t *testing.T) {
+	t.Setenv(channelSchedules, "C1=schedule1,C2")
+	cfg, err := Load(writeFile(t, "pulsar.yaml", testConfig))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.EqualError(t, cfg.Validate(), "invalid pagerduty configuration: PAGERDUTY_CHANNEL_SCHEDULES must map channel IDs to at least one schedule")
+
+	_, err = Load(writeFile(t, "pulsar.yaml", strings.Replace(testConfig, "C1: [schedule1, schedule2]", "C1: [schedule1]\n    C1: [schedule2]", 1)))
+	assert.Error(t, err, "channels given twice in the configuration file should be reported")
+
+	cfg, err = Load(writeFile(t, "pulsar.yaml", strings.Replace(testConfig, "C1: [schedule1, schedule2]", "C1: []", 1)))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.Error(t, cfg.Validate(), "channels without schedules should be reported")
+}
+
+func TestRunbookCatalog(t *testing.T) {
+	cfg, err := Load(writeFile(t, "pulsar.yaml", testConfig))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+
+	runbook, ok := cfg.Runbooks.Find(map[string]string{"alertname": "openstacklbaasapiflapping", "region": "eu-de-1"}, "https://other.example.com")
+	assert.True(t, ok, "the alertname should match case-insensitively")
+	assert.Equal(t, "https://runbooks.example.com/lbaas", runbook.URL, "the catalog should take precedence over the annotation")
+
+	runbook, ok = cfg.Runbooks.Find(map[string]string{"alertname": "NovaApiDown", "service": "nova"}, "https://runbooks.example.com/nova")
+	assert.True(t, ok, "the labels should match")
+	assert.Equal(t, "https://runbooks.example.com/nova", runbook.URL, "the annotation should be used if the runbook has no URL")
+	assert.Equal(t, []string{"check the nova-api pods"}, runbook.Checklist)
+
+	runbook, ok = cfg.Runbooks.Find(map[string]string{"alertname": "OpenstackLbaas", "service": "neutron"}, "")
+	assert.True(t, ok)
+	_, ok = cfg.Runbooks.Find(map[string]string{"alertname": "NeutronDown"}, "")
+	assert.False(t, ok, "there should be no runbook without match or annotation")
+
+	t.Setenv(runbookURLs, "NeutronDown=https://runbooks.example.com/neutron")
+	cfg, err = Load("")
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	runbook, ok = cfg.Runbooks.Find(map[string]string{"alertname": "NeutronDown"}, "")
+	assert.True(t, ok, "the runbooks should be read from the environment")
+	assert.Equal(t, "https://runbooks.example.com/neutron", runbook.URL)
+
+	invalid := RunbookCatalog{{Alertname: "Foo(", URL: "https://runbooks.example.com"}}
+	assert.Error(t, invalid.validate(), "invalid patterns should be reported")
+	invalid = RunbookCatalog{{Alertname: "Foo"}}
+	assert.Error(t, invalid.validate(), "runbooks without URL and checklist should be reported")
+}
+
+func TestRegionCatalogParse(t *testing.T) {
+	stimuli := map[string][]string{
+		"[CRITICAL - 2] [LA-BR-1] ManyPodsNotReadyOnNode - Less then 75% of pods ready on node":                         {"la-br-1"},
+		"[RESOLVED] [LA-BR-1] OpenstackNovaDatapathDown - Datapath nova metadata is down":                               {"la-br-1"},
+		"[CRITICAL] [S-LA-BR-1] InfrastructurePrometheusFederationFailed - Infrastructure Prometheus s-la-br-1 is down": {"s-la-br-1"},
+	}
+
+	empty := RegionCatalog{}
+	for inputString, expected := range stimuli {
+		got, err := empty.Parse(inputString)
+		assert.NoError(t, err, "there should be no error parsing region names from the string")
+		assert.EqualValues(t, expected, got, "result and expected should have equal values")
+	}
+	_, err := empty.Parse("list incidents")
+	assert.Equal(t, ErrNoRegion, err)
+}
+
+func TestRegionCatalog(t *testing.T) {
+	cfg, err := Load(writeFile(t, "pulsar.yaml", testConfig+`regions:
+- name: eu-de-1
+  aliases: [frankfurt, de1]
+  kubeContext: k-eu-de-1
+  prometheusURL: https://prometheus-infra.eu-de-1.example.com/
+- name: staging
+`))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.NoError(t, cfg.Validate(), "the configuration should be valid")
+
+	regions, err := cfg.Regions.Parse("restart deployment kube-system/coredns in Frankfurt and STAGING")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eu-de-1", "staging"}, regions, "aliases should be resolved")
+	_, err = cfg.Regions.Parse("list incidents eu-de-1 eu-nl-1")
+	assert.EqualError(t, err, "unknown region(s) eu-nl-1. known regions are eu-de-1, staging", "unknown regions should be reported")
+
+	region, err := cfg.Regions.Resolve("de1")
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-de-1", region)
+	_, err = cfg.Regions.Resolve("admin")
+	assert.Error(t, err, "regions missing in the catalog should be unknown")
+
+	assert.Equal(t, "k-eu-de-1", cfg.Regions.KubeContext("eu-de-1"))
+	assert.Equal(t, "staging", cfg.Regions.KubeContext("staging"), "the kube context should default to the name")
+
+	promURL, err := cfg.Prometheus.URLForRegion("eu-de-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prometheus-infra.eu-de-1.example.com", promURL, "the URL of the region should be used")
+	amURL, err := cfg.Alertmanager.URLForRegion("frankfurt")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://alertmanager.eu-de-1.example.com", amURL, "the template should be filled with the name of the region")
+	_, err = cfg.Alertmanager.URLForRegion("eu-nl-1")
+	assert.EqualError(t, err, "unknown region 'eu-nl-1'")
+
+	invalid := NewRegionCatalog(Region{Name: "eu-de-1", Aliases: []string{"frankfurt"}}, Region{Name: "Frankfurt"})
+	assert.Error(t, invalid.validate(), "names used twice should be reported")
+}
+
+func TestLoadInvalid(t *testing.T) {
+	t.Setenv(commandTimeout, "soon")
+	_, err := Load("")
+	assert.Error(t, err, "an invalid environment variable should be reported")
+
+	_, err = Load(writeFile(t, "pulsar.yaml", "slack: [not, a, map]"))
+	assert.Error(t, err, "an invalid configuration file should be reported")
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Load(writeFile(t, "pulsar.yaml", strings.Replace(testConfig, "syncChannels: [C1]", `syncChannels: [C1, ""]`, 1)))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.EqualError(t, cfg.Validate(), "invalid slack configuration: SLACK_CHANNELS_ID_LIST must not contain empty items")
+
+	cfg, err = Load(writeFile(t, "pulsar.yaml", strings.Replace(testConfig, "alertmanager:\n", "alertmanager:\n  receiverChannels:\n    receiver1: C1\n", 1)))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.EqualError(t, cfg.Validate(), "invalid alertmanager configuration: missing ALERTMANAGER_WEBHOOK_TOKEN. it is required to receive notifications for the ALERTMANAGER_RECEIVER_CHANNELS")
+
+	cfg, err = Load(writeFile(t, "pulsar.yaml", testConfig+"kubernetes:\n  kubeconfig: /does/not/exist\n"))
+	assert.NoError(t, err, "there should be no error loading the configuration")
+	assert.Error(t, cfg.Validate(), "a missing kubeconfig should be reported")
+}
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "pulsar.yaml", testConfig)
+	SetFile(path)
+	defer SetFile("")
+
+	reloaded := false
+	OnReload(func() { reloaded = true })
+
+	pdCfg, err := NewPagerdutyConfigFromEnv()
+	assert.NoError(t, err, "there should be no error getting the pagerduty configuration")
+	_, err = Regions().Parse("frankfurt")
+	assert.Equal(t, ErrNoRegion, err, "unknown aliases should not match")
+
+	changed := strings.NewReplacer("Compute: key1", "Storage: key2", "defaultPageTarget: compute", "defaultPageTarget: storage", "fileAuthToken", "otherAuthToken").Replace(testConfig)
+	changed += "regions:\n- name: eu-de-1\n  aliases: [frankfurt]\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(changed), 0600))
+	assert.NoError(t, Reload(), "there should be no error reloading the configuration")
+
+	assert.True(t, reloaded, "the reload hooks should be called")
+	assert.Equal(t, []string{"storage"}, pdCfg.RoutingKeyNames(), "routing keys should be reloaded")
+	assert.Equal(t, "storage", pdCfg.PageTarget())
+	assert.Equal(t, "fileAuthToken", pdCfg.AuthToken, "tokens should require a restart")
+	regions, err := Regions().Parse("frankfurt")
+	assert.NoError(t, err, "the pattern of the regions should be compiled again")
+	assert.Equal(t, []string{"eu-de-1"}, regions)
+}
@@ -19,22 +19,42 @@
 
 package config
 
-import "os"
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const kubeConfig = "KUBECONFIG"
 
 // K8sConfig ...
 type K8sConfig struct {
 	// Path to kubeconfig.
-	KubeConfig string
+	KubeConfig string `yaml:"kubeconfig"`
 }
 
-// NewK8sConfigFromEnv returns a new K8sConfig or an error.
+// NewK8sConfigFromEnv returns the validated Kubernetes configuration read from the configuration file and the environment or an error.
 func NewK8sConfigFromEnv() (*K8sConfig, error) {
-	k := &K8sConfig{
-		KubeConfig: os.Getenv("KUBECONFIG"),
+	cfg, err := Get()
+	if err != nil {
+		return nil, err
 	}
-	return k, k.validate()
+	return &cfg.Kubernetes, cfg.Kubernetes.validate()
+}
+
+func (k *K8sConfig) applyEnv() error {
+	return envString(kubeConfig, &k.KubeConfig)()
 }
 
 func (k *K8sConfig) validate() error {
+	if k.KubeConfig == "" {
+		return nil
+	}
+	// KUBECONFIG may be a list of files.
+	for _, path := range splitList(k.KubeConfig, string(os.PathListSeparator)) {
+		if _, err := os.Stat(path); err != nil {
+			return errors.Wrapf(err, "invalid %s", kubeConfig)
+		}
+	}
 	return nil
 }
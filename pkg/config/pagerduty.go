@@ -21,7 +21,7 @@ package config
 
 import (
 	"fmt"
-	"os"
+	"sort"
 	"strings"
 )
 
@@ -29,24 +29,163 @@ const (
 	authToken    = "PAGERDUTY_AUTH_TOKEN"
 	defaultEmail = "PAGERDUTY_DEFAULT_EMAIL"
     filter_services = "PAGERDUTY_SERVICES_ID_LIST"
+	defaultSchedules = "PAGERDUTY_DEFAULT_SCHEDULES"
+	channelSchedules = "PAGERDUTY_CHANNEL_SCHEDULES"
+	handoverChannels = "PAGERDUTY_HANDOVER_CHANNELS"
+	routingKeys      = "PAGERDUTY_ROUTING_KEYS"
+	defaultPageTarget = "PAGERDUTY_DEFAULT_PAGE_TARGET"
+	pagerdutyAPIURL   = "PAGERDUTY_API_URL"
+	eventsAPIURL      = "PAGERDUTY_EVENTS_API_URL"
+
+	// defaultAPIURL and defaultEventsAPIURL are the base URLs of the public PagerDuty REST and Events API.
+	defaultAPIURL       = "https://api.pagerduty.com"
+	defaultEventsAPIURL = "https://events.pagerduty.com"
+
+	// defaultScheduleName is used if no default schedules are configured.
+	defaultScheduleName = "Managed Service for CCloud API (Two Day Shifts)"
 )
 
 // PagerdutyConfig ...
 type PagerdutyConfig struct {
-	AuthToken string
-	DefaultEmail string
-    FilterServices []string
+	AuthToken      string   `yaml:"authToken"`
+	DefaultEmail   string   `yaml:"defaultEmail"`
+	FilterServices []string `yaml:"services"`
+
+	// APIURL is the base URL of the PagerDuty REST API, e.g. of a fake server.
+	APIURL string `yaml:"apiURL"`
+
+	// EventsAPIURL is the base URL of the PagerDuty Events API v2.
+	EventsAPIURL string `yaml:"eventsAPIURL"`
+
+	// DefaultSchedules is the list of schedule names used to look up the on-call if no schedule was given.
+	// Reloaded at runtime.
+	DefaultSchedules []string `yaml:"defaultSchedules"`
+
+	// ChannelSchedules maps Slack channel IDs to the schedule names used to look up the on-call in this channel.
+	// Overrides the DefaultSchedules for the channel. Reloaded at runtime.
+	ChannelSchedules map[string][]string `yaml:"channelSchedules"`
+
+	// HandoverChannels maps Slack channel IDs to the schedule names whose shift handovers are announced in this channel.
+	// Reloaded at runtime.
+	HandoverChannels map[string][]string `yaml:"handoverChannels"`
+
+	// RoutingKeys maps friendly names of services or escalation policies to the Events API v2 routing keys used to page them.
+	// Reloaded at runtime.
+	RoutingKeys map[string]string `yaml:"routingKeys"`
+
+	// DefaultPageTarget is the name of the routing key used by the page button of incidents.
+	// Reloaded at runtime.
+	DefaultPageTarget string `yaml:"defaultPageTarget"`
 }
 
-// NewPagerdutyConfigFromEnv returns a new PagerdutyConfig or an error.
+// NewPagerdutyConfigFromEnv returns the validated PagerDuty configuration read from the configuration file and the environment or an error.
 func NewPagerdutyConfigFromEnv() (*PagerdutyConfig, error) {
-	c := &PagerdutyConfig{
-		AuthToken:    os.Getenv(authToken),
-		DefaultEmail: os.Getenv(defaultEmail),
-        FilterServices: strings.Split(os.Getenv(filter_services), ","),
+	cfg, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	return &cfg.Pagerduty, cfg.Pagerduty.validate()
+}
+
+// SchedulesForChannel returns the names of the schedules configured for the given channel or the default schedules.
+func (c *PagerdutyConfig) SchedulesForChannel(channelID string) []string {
+	current.RLock()
+	defer current.RUnlock()
+	if s, ok := c.ChannelSchedules[channelID]; ok && len(s) > 0 {
+		return copyList(s)
+	}
+	return copyList(c.DefaultSchedules)
+}
+
+// Handovers returns a copy of the schedule names by channel ID whose shift handovers are announced.
+func (c *PagerdutyConfig) Handovers() map[string][]string {
+	current.RLock()
+	defer current.RUnlock()
+	res := make(map[string][]string, len(c.HandoverChannels))
+	for channelID, scheduleNames := range c.HandoverChannels {
+		res[channelID] = copyList(scheduleNames)
+	}
+	return res
+}
+
+// RoutingKey returns the routing key for the given name and whether it is known.
+func (c *PagerdutyConfig) RoutingKey(name string) (string, bool) {
+	current.RLock()
+	defer current.RUnlock()
+	key, ok := c.RoutingKeys[strings.ToLower(name)]
+	return key, ok
+}
+
+// RoutingKeyNames returns the sorted names of the routing keys.
+func (c *PagerdutyConfig) RoutingKeyNames() []string {
+	current.RLock()
+	defer current.RUnlock()
+	res := make([]string, 0, len(c.RoutingKeys))
+	for name := range c.RoutingKeys {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// PageTarget returns the name of the routing key used by the page button of incidents.
+func (c *PagerdutyConfig) PageTarget() string {
+	current.RLock()
+	defer current.RUnlock()
+	return c.DefaultPageTarget
+}
+
+func (c *PagerdutyConfig) setDefaults() {
+	c.DefaultSchedules = []string{defaultScheduleName}
+	c.APIURL = defaultAPIURL
+	c.EventsAPIURL = defaultEventsAPIURL
+}
+
+func (c *PagerdutyConfig) applyEnv() error {
+	return applyEnvOverrides(
+		envString(authToken, &c.AuthToken),
+		envString(defaultEmail, &c.DefaultEmail),
+		envList(filter_services, &c.FilterServices),
+		envList(defaultSchedules, &c.DefaultSchedules),
+		envFunc(channelSchedules, func(v string) error {
+			c.ChannelSchedules = parseChannelSchedules(v)
+			return nil
+		}),
+		envFunc(handoverChannels, func(v string) error {
+			c.HandoverChannels = parseChannelSchedules(v)
+			return nil
+		}),
+		envFunc(routingKeys, func(v string) error {
+			c.RoutingKeys = parseRoutingKeys(v)
+			return nil
+		}),
+		envString(defaultPageTarget, &c.DefaultPageTarget),
+		envString(pagerdutyAPIURL, &c.APIURL),
+		envString(eventsAPIURL, &c.EventsAPIURL),
+	)
+}
+
+// normalize lower cases the names of the routing keys and the default page target.
+func (c *PagerdutyConfig) normalize() {
+	routingKeys := make(map[string]string, len(c.RoutingKeys))
+	for name, key := range c.RoutingKeys {
+		routingKeys[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(key)
 	}
+	c.RoutingKeys = routingKeys
+	c.DefaultPageTarget = strings.ToLower(strings.TrimSpace(c.DefaultPageTarget))
+}
 
-	return c, c.validate()
+// reload applies the settings of the new configuration which are safe to change at runtime.
+// The caller must hold the lock.
+func (c *PagerdutyConfig) reload(n *PagerdutyConfig) {
+	c.DefaultSchedules = n.DefaultSchedules
+	c.ChannelSchedules = n.ChannelSchedules
+	c.HandoverChannels = n.HandoverChannels
+	c.RoutingKeys = n.RoutingKeys
+	c.DefaultPageTarget = n.DefaultPageTarget
 }
 
 func (c *PagerdutyConfig) validate() error {
@@ -58,5 +197,97 @@ func (c *PagerdutyConfig) validate() error {
 		return fmt.Errorf("missing %s", defaultEmail)
 	}
 
+	if err := validateURL(pagerdutyAPIURL, c.APIURL); err != nil {
+		return err
+	}
+	if err := validateURL(eventsAPIURL, c.EventsAPIURL); err != nil {
+		return err
+	}
+	if err := validateList(filter_services, c.FilterServices); err != nil {
+		return err
+	}
+	if err := validateList(defaultSchedules, c.DefaultSchedules); err != nil {
+		return err
+	}
+	if err := validateChannelSchedules(channelSchedules, c.ChannelSchedules); err != nil {
+		return err
+	}
+	if err := validateChannelSchedules(handoverChannels, c.HandoverChannels); err != nil {
+		return err
+	}
+	if err := validateRoutingKeys(c.RoutingKeys); err != nil {
+		return err
+	}
+
+	if c.DefaultPageTarget != "" {
+		if _, ok := c.RoutingKeys[c.DefaultPageTarget]; !ok {
+			return fmt.Errorf("%s '%s' is not one of the %s", defaultPageTarget, c.DefaultPageTarget, routingKeys)
+		}
+	}
+
 	return nil
 }
+
+// validateChannelSchedules returns an error unless every channel is mapped to at least one schedule name.
+func validateChannelSchedules(name string, channels map[string][]string) error {
+	for channelID, scheduleNames := range channels {
+		if channelID == "" || len(scheduleNames) == 0 {
+			return fmt.Errorf("%s must map channel IDs to at least one schedule", name)
+		}
+		if err := validateList(name, scheduleNames); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRoutingKeys returns an error unless every name is mapped to a routing key.
+func validateRoutingKeys(keys map[string]string) error {
+	for name, key := range keys {
+		if name == "" || key == "" {
+			return fmt.Errorf("%s must map names to routing keys. invalid entry for '%s'", routingKeys, name)
+		}
+	}
+	return nil
+}
+
+// parseRoutingKeys parses a string of the form `name1=routingKey1,name2=routingKey2`.
+// Names are normalized. Malformed entries are kept with empty names or keys, so they are reported by validateRoutingKeys.
+func parseRoutingKeys(theString string) map[string]string {
+	res := make(map[string]string)
+	for _, entry := range splitList(theString, ",") {
+		name, key, _ := strings.Cut(entry, "=")
+		res[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(key)
+	}
+	return res
+}
+
+// parseChannelSchedules parses a string of the form `channelID1=schedule1|schedule2,channelID2=schedule3`.
+// The schedules of channels given more than once are merged. Entries without schedules are kept, so they are
+// reported by validateChannelSchedules.
+func parseChannelSchedules(theString string) map[string][]string {
+	res := make(map[string][]string)
+	for _, entry := range splitList(theString, ",") {
+		channelAndSchedules := strings.SplitN(entry, "=", 2)
+		channelID := strings.TrimSpace(channelAndSchedules[0])
+		scheduleNames := res[channelID]
+		if len(channelAndSchedules) == 2 {
+			for _, name := range splitList(channelAndSchedules[1], "|") {
+				scheduleNames = appendUnique(scheduleNames, name)
+			}
+		}
+		res[channelID] = scheduleNames
+	}
+	return res
+}
+
+// splitList splits the string by the separator and omits empty items.
+func splitList(theString, sep string) []string {
+	res := make([]string, 0)
+	for _, itm := range strings.Split(theString, sep) {
+		if itm = strings.TrimSpace(itm); itm != "" {
+			res = append(res, itm)
+		}
+	}
+	return res
+}
@@ -0,0 +1,57 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package config
+
+const prometheusURL = "PROMETHEUS_API_URL"
+
+// PrometheusConfig configures the Prometheus queried by the query command.
+type PrometheusConfig struct {
+	// APIURL is the base URL of the Prometheus API. {region} is replaced by the region,
+	// e.g. https://prometheus.{region}.example.com. Optional.
+	APIURL string `yaml:"apiURL"`
+
+	// regions is the region catalog, whose Prometheus URLs take precedence over APIURL.
+	regions *RegionCatalog
+}
+
+// NewPrometheusConfigFromEnv returns the validated Prometheus configuration read from the configuration file and the environment or an error.
+func NewPrometheusConfigFromEnv() (*PrometheusConfig, error) {
+	cfg, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return &cfg.Prometheus, cfg.Prometheus.validate()
+}
+
+// URLForRegion returns the base URL of the Prometheus API of the region or an error if none is configured
+// or the region is unknown.
+func (c *PrometheusConfig) URLForRegion(region string) (string, error) {
+	return c.regions.urlForRegion(prometheusURL, c.APIURL, region, func(r *Region) string { return r.PrometheusURL })
+}
+
+func (c *PrometheusConfig) applyEnv() error {
+	return applyEnvOverrides(
+		envString(prometheusURL, &c.APIURL),
+	)
+}
+
+func (c *PrometheusConfig) validate() error {
+	return validateURLTemplate(prometheusURL, c.APIURL)
+}
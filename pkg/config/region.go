@@ -0,0 +1,351 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	regionList = "REGIONS"
+
+	// defaultRegionPattern matches names of the form xx-yy-N, admin and staging.
+	// Without a catalog these are the known regions. With a catalog they are reported as unknown unless listed.
+	defaultRegionPattern = `[\w-]*\w{2}-\w{2}-\d|admin|staging`
+)
+
+// ErrNoRegion is returned by RegionCatalog.Parse if the text does not mention any region.
+var ErrNoRegion = errors.New("no region found in input")
+
+var (
+	// defaultRegionRegex matches the names of regions if the catalog is empty.
+	defaultRegionRegex = regexp.MustCompile(`^(?:` + defaultRegionPattern + `)$`)
+
+	// emptyCatalogRegex is the pattern of the empty catalog.
+	emptyCatalogRegex = regexp.MustCompile(regionPattern(nil))
+)
+
+// Region is an entry of the region catalog.
+type Region struct {
+	// Name is the name of the region, e.g. eu-de-1.
+	Name string `yaml:"name"`
+
+	// Aliases are other names of the region accepted in commands and alerts. Optional.
+	Aliases []string `yaml:"aliases"`
+
+	// KubeContext is the context of the cluster of the region in the kubeconfig. Defaults to the name.
+	KubeContext string `yaml:"kubeContext"`
+
+	// AlertmanagerURL and PrometheusURL are the base URLs of the APIs of the region.
+	// Optional, the URL templates of the alertmanager and prometheus sections are used otherwise.
+	AlertmanagerURL string `yaml:"alertmanagerURL"`
+	PrometheusURL   string `yaml:"prometheusURL"`
+
+	// PagerdutyServices are the IDs of the Pagerduty services of the region. Their incidents belong to the region
+	// even if their summary does not name it. Optional.
+	PagerdutyServices []string `yaml:"pagerdutyServices"`
+}
+
+// RegionCatalog is the list of known regions used to parse, filter and resolve regions.
+// If it is empty, every name matching defaultRegionPattern is accepted. Reloaded at runtime.
+type RegionCatalog struct {
+	regions []Region
+
+	// pattern is the compiled Pattern of the regions. It is updated whenever the regions are loaded or reloaded.
+	pattern *regexp.Regexp
+}
+
+// NewRegionCatalog returns the catalog of the given regions.
+func NewRegionCatalog(regions ...Region) *RegionCatalog {
+	c := &RegionCatalog{}
+	c.setRegions(regions)
+	return c
+}
+
+// NewRegionCatalogFromEnv returns the validated region catalog read from the configuration file and the environment or an error.
+func NewRegionCatalogFromEnv() (*RegionCatalog, error) {
+	cfg, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	return &cfg.Regions, cfg.Regions.validate()
+}
+
+// Regions returns the region catalog of the configuration for parsing regions from text.
+// It is empty if the configuration cannot be loaded, which is reported by the components reading it.
+func Regions() *RegionCatalog {
+	cfg, err := Get()
+	if err != nil {
+		return &RegionCatalog{}
+	}
+	return &cfg.Regions
+}
+
+// Names returns the names of the regions of the catalog.
+func (c *RegionCatalog) Names() []string {
+	if c == nil {
+		return nil
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	names := make([]string, 0, len(c.regions))
+	for _, r := range c.regions {
+		names = append(names, strings.ToLower(r.Name))
+	}
+	return names
+}
+
+// Lookup returns the region with the given name or alias, ignoring the case, and whether it is in the catalog.
+func (c *RegionCatalog) Lookup(name string) (Region, bool) {
+	if c == nil {
+		return Region{}, false
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	name = strings.TrimSpace(name)
+	for _, r := range c.regions {
+		if strings.EqualFold(r.Name, name) {
+			return r, true
+		}
+		for _, alias := range r.Aliases {
+			if strings.EqualFold(alias, name) {
+				return r, true
+			}
+		}
+	}
+	return Region{}, false
+}
+
+// Resolve returns the lower case name of the region with the given name or alias or an error if it is unknown.
+func (c *RegionCatalog) Resolve(name string) (string, error) {
+	if r, ok := c.Lookup(name); ok {
+		return strings.ToLower(r.Name), nil
+	}
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(c.Names()) == 0 && defaultRegionRegex.MatchString(name) {
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown region '%s'", name)
+}
+
+// Pattern returns a regular expression matching the names and aliases of the regions as well as other names looking
+// like regions, so unknown ones can be reported. Matching is case-insensitive.
+func (c *RegionCatalog) Pattern() string {
+	return c.regex().String()
+}
+
+// regex returns the compiled Pattern of the catalog.
+func (c *RegionCatalog) regex() *regexp.Regexp {
+	if c == nil {
+		return emptyCatalogRegex
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	if c.pattern == nil {
+		return emptyCatalogRegex
+	}
+	return c.pattern
+}
+
+// Parse returns the names of the regions mentioned in the text, resolving aliases.
+// Returns an error if no region is found or if any of them is unknown.
+func (c *RegionCatalog) Parse(text string) ([]string, error) {
+	res, unknown := make([]string, 0), make([]string, 0)
+	for _, match := range c.regex().FindAllString(text, -1) {
+		name, err := c.Resolve(match)
+		if err != nil {
+			unknown = appendUnique(unknown, strings.ToLower(match))
+			continue
+		}
+		res = appendUnique(res, name)
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown region(s) %s. known regions are %s", strings.Join(unknown, ", "), strings.Join(c.Names(), ", "))
+	}
+	if len(res) == 0 {
+		return nil, ErrNoRegion
+	}
+	return res, nil
+}
+
+// KubeContext returns the context of the cluster of the region in the kubeconfig.
+func (c *RegionCatalog) KubeContext(region string) string {
+	if r, ok := c.Lookup(region); ok && r.KubeContext != "" {
+		return r.KubeContext
+	}
+	return region
+}
+
+// HasPagerdutyService returns whether the Pagerduty service belongs to one of the regions.
+func (c *RegionCatalog) HasPagerdutyService(regions []string, serviceID string) bool {
+	for _, region := range regions {
+		r, ok := c.Lookup(region)
+		if !ok {
+			continue
+		}
+		for _, id := range r.PagerdutyServices {
+			if id == serviceID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// urlForRegion returns the URL of the per-region API given by the region, falling back to the template configured
+// by the given variable. Regions which are not in the catalog are rejected unless the catalog is empty.
+func (c *RegionCatalog) urlForRegion(name, template, region string, regionURL func(r *Region) string) (string, error) {
+	if r, ok := c.Lookup(region); ok {
+		if u := regionURL(&r); u != "" {
+			return strings.TrimSuffix(u, "/"), nil
+		}
+		region = strings.ToLower(r.Name)
+	} else if region != "" && len(c.Names()) > 0 {
+		return "", fmt.Errorf("unknown region '%s'", region)
+	}
+	return urlForRegion(name, template, region)
+}
+
+// List returns a copy of the regions of the catalog.
+func (c *RegionCatalog) List() []Region {
+	if c == nil {
+		return nil
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	return append([]Region(nil), c.regions...)
+}
+
+// UnmarshalYAML reads the list of regions from the configuration file.
+func (c *RegionCatalog) UnmarshalYAML(value *yaml.Node) error {
+	var regions []Region
+	if err := value.Decode(&regions); err != nil {
+		return err
+	}
+	c.setRegions(regions)
+	return nil
+}
+
+// setRegions sets the regions and compiles their pattern.
+func (c *RegionCatalog) setRegions(regions []Region) {
+	c.regions = regions
+	c.pattern = regexp.MustCompile(regionPattern(regions))
+}
+
+func (c *RegionCatalog) applyEnv() error {
+	return applyEnvOverrides(
+		envFunc(regionList, func(v string) error {
+			c.setRegions(parseRegions(v))
+			return nil
+		}),
+	)
+}
+
+// reload applies the regions of the new configuration including their compiled pattern.
+// The caller must hold the lock.
+func (c *RegionCatalog) reload(n *RegionCatalog) {
+	*c = *n
+}
+
+func (c *RegionCatalog) validate() error {
+	seen := make(map[string]string)
+	for idx, r := range c.regions {
+		if strings.TrimSpace(r.Name) == "" {
+			return fmt.Errorf("region %d must have a name", idx)
+		}
+		for _, name := range append([]string{r.Name}, r.Aliases...) {
+			key := strings.ToLower(strings.TrimSpace(name))
+			if key == "" {
+				return fmt.Errorf("region %s must not have empty aliases", r.Name)
+			}
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("%s is used by regions %s and %s", name, other, r.Name)
+			}
+			seen[key] = r.Name
+		}
+
+		for name, value := range map[string]string{"alertmanagerURL": r.AlertmanagerURL, "prometheusURL": r.PrometheusURL} {
+			if value == "" {
+				continue
+			}
+			if err := validateURL(fmt.Sprintf("%s of region %s", name, r.Name), value); err != nil {
+				return err
+			}
+		}
+		if err := validateList(fmt.Sprintf("pagerdutyServices of region %s", r.Name), r.PagerdutyServices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// regionPattern returns the pattern matching the names and aliases of the regions and names looking like regions.
+func regionPattern(regions []Region) string {
+	names := make([]string, 0)
+	for _, r := range regions {
+		names = append(names, r.Name)
+		names = append(names, r.Aliases...)
+	}
+
+	// The first matching alternative is used, so longer names go first.
+	sort.SliceStable(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for idx, name := range names {
+		names[idx] = regexp.QuoteMeta(name)
+	}
+	return `(?i)\b(?:` + strings.Join(append(names, defaultRegionPattern), "|") + `)\b`
+}
+
+// parseRegions parses a string of the form `region1,region2=alias1|alias2`.
+func parseRegions(theString string) []Region {
+	res := make([]Region, 0)
+	for _, entry := range splitList(theString, ",") {
+		nameAndAliases := strings.SplitN(entry, "=", 2)
+		r := Region{Name: strings.TrimSpace(nameAndAliases[0])}
+		if len(nameAndAliases) == 2 {
+			r.Aliases = splitList(nameAndAliases[1], "|")
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, i := range list {
+		if i == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
@@ -0,0 +1,159 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const runbookURLs = "RUNBOOK_URLS"
+
+// Runbook links the playbook of alerts and a short checklist of first steps.
+type Runbook struct {
+	// Alertname is a regular expression matching the whole alertname case-insensitively. Optional if labels are given.
+	Alertname string `yaml:"alertname"`
+
+	// Labels maps label names to regular expressions matching the whole value case-insensitively. Optional.
+	Labels map[string]string `yaml:"labels"`
+
+	// URL is the link to the playbook. Optional if a checklist is given.
+	URL string `yaml:"url"`
+
+	// Checklist are the first steps to take.
+	Checklist []string `yaml:"checklist"`
+}
+
+// RunbookCatalog is the list of runbooks. The first runbook matching the labels of alerts is used.
+// Reloaded at runtime.
+type RunbookCatalog []Runbook
+
+// NewRunbookCatalogFromEnv returns the validated runbook catalog read from the configuration file and the environment or an error.
+func NewRunbookCatalogFromEnv() (*RunbookCatalog, error) {
+	cfg, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	return &cfg.Runbooks, cfg.Runbooks.validate()
+}
+
+// Find returns the runbook of alerts with the given labels and whether there is one.
+// runbookURL is the runbook_url annotation of the alerts. It is used if no runbook matches or the matching one has no URL.
+func (c *RunbookCatalog) Find(labels map[string]string, runbookURL string) (Runbook, bool) {
+	current.RLock()
+	defer current.RUnlock()
+
+	for _, r := range *c {
+		if r.matches(labels) {
+			if r.URL == "" {
+				r.URL = runbookURL
+			}
+			return r, true
+		}
+	}
+
+	if runbookURL != "" {
+		return Runbook{URL: runbookURL}, true
+	}
+	return Runbook{}, false
+}
+
+// matches returns whether the alertname and all label patterns of the runbook match the labels.
+func (r *Runbook) matches(labels map[string]string) bool {
+	if r.Alertname != "" && !matchesPattern(r.Alertname, labels["alertname"]) {
+		return false
+	}
+	for name, pattern := range r.Labels {
+		if !matchesPattern(pattern, labels[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *RunbookCatalog) applyEnv() error {
+	return applyEnvOverrides(
+		envFunc(runbookURLs, func(v string) error {
+			*c = parseRunbookURLs(v)
+			return nil
+		}),
+	)
+}
+
+// reload applies the runbooks of the new configuration.
+// The caller must hold the lock.
+func (c *RunbookCatalog) reload(n *RunbookCatalog) {
+	*c = *n
+}
+
+func (c *RunbookCatalog) validate() error {
+	for idx, r := range *c {
+		if r.Alertname == "" && len(r.Labels) == 0 {
+			return fmt.Errorf("runbook %d must have an alertname or labels", idx)
+		}
+		if r.URL == "" && len(r.Checklist) == 0 {
+			return fmt.Errorf("runbook %d must have a URL or a checklist", idx)
+		}
+		if r.URL != "" {
+			if u, err := url.Parse(r.URL); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("runbook %d has an invalid URL '%s'", idx, r.URL)
+			}
+		}
+
+		patterns := []string{r.Alertname}
+		for _, pattern := range r.Labels {
+			patterns = append(patterns, pattern)
+		}
+		for _, pattern := range patterns {
+			if _, err := compilePattern(pattern); err != nil {
+				return fmt.Errorf("runbook %d has an invalid pattern '%s': %s", idx, pattern, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// parseRunbookURLs parses a string of the form `alertname1=url1,alertname2=url2`.
+func parseRunbookURLs(theString string) RunbookCatalog {
+	res := make(RunbookCatalog, 0)
+	for _, entry := range splitList(theString, ",") {
+		alertnameAndURL := strings.SplitN(entry, "=", 2)
+		if len(alertnameAndURL) != 2 {
+			continue
+		}
+		res = append(res, Runbook{Alertname: strings.TrimSpace(alertnameAndURL[0]), URL: strings.TrimSpace(alertnameAndURL[1])})
+	}
+	return res
+}
+
+// compilePattern compiles the pattern matching whole values case-insensitively.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)^(?:" + pattern + ")$")
+}
+
+func matchesPattern(pattern, value string) bool {
+	re, err := compilePattern(pattern)
+	return err == nil && re.MatchString(value)
+}
@@ -21,9 +21,11 @@ package config
 
 import (
 	"fmt"
-	"os"
-	"strconv"
+	"net"
 	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
 )
 
 const (
@@ -36,76 +38,148 @@ const (
 	verificationToken         = "SLACK_VERIFICATION_TOKEN"
     channelIdsListForPdSync   = "SLACK_CHANNELS_ID_LIST"
     channelMessageHistoryScanCount = "SLACK_CHANNELS_MESSAGE_HISTORY_SCAN_COUNT"
+	commandWorkers            = "SLACK_COMMAND_WORKERS"
+	commandTimeout            = "SLACK_COMMAND_TIMEOUT"
+	userRateLimit             = "SLACK_USER_RATE_LIMIT"
+	commandRateLimit          = "SLACK_COMMAND_RATE_LIMIT"
+	slackAPIURL               = "SLACK_API_URL"
 	apiPort                   = "API_PORT"
 	apiHost                   = "API_HOST"
+	debugAddress              = "DEBUG_ADDRESS"
 )
 
 // SlackConfig ...
 type SlackConfig struct {
 	// BotToken is the Slack token with bot permissions.
-	BotToken string
+	BotToken string `yaml:"botToken"`
 
 	// BotID is the id of the bot.
-	BotID string
+	BotID string `yaml:"botID"`
 
 	// AccessToken is the Slack token with permissions to list user groups and their members.
-	AccessToken string
+	AccessToken string `yaml:"accessToken"`
 
 	// VerificationToken used to verify messages from the Slack API.
-	VerificationToken string
+	VerificationToken string `yaml:"verificationToken"`
+
+	// APIURL is the base URL of the Slack Web API, e.g. of a fake server. Defaults to the public API.
+	APIURL string `yaml:"apiURL"`
 
 	// AuthorizedUserGroupNames is the list of user group names whose members are authorized to interact with the bot.
-	AuthorizedUserGroupNames []string
+	// Reloaded at runtime.
+	AuthorizedUserGroupNames []string `yaml:"authorizedUserGroupNames"`
 
 	// KubernetesUserGroupNames is the list of user group names whose members are authorized to perform read operations for kubernetes clusters via the bot.
-	KubernetesUserGroupNames []string
+	// Reloaded at runtime.
+	KubernetesUserGroupNames []string `yaml:"kubernetesUserGroupNames"`
 
 	// KubernetesAdminGroupNames is the list of user group names whose members are authorized to perform all operations for kubernetes clusters via the bot.
-	KubernetesAdminGroupNames []string
+	// Reloaded at runtime.
+	KubernetesAdminGroupNames []string `yaml:"kubernetesAdminGroupNames"`
 
 	// APIPort is the port on which the API is exposed.
-	APIPort int
+	APIPort int `yaml:"apiPort"`
 
 	// APIHost is the host on which the API is exposed.
-	APIHost string
+	APIHost string `yaml:"apiHost"`
+
+	// DebugAddress is the host:port on which /debug/vars is served. It should not be reachable publicly.
+	// Defaults to localhost. Empty disables it.
+	DebugAddress string `yaml:"debugAddress"`
+
+	// ChannelIdsListForPdSync is the list of Slack channel IDs whose alerts are synced with PagerDuty incidents.
+	// Reloaded at runtime.
+	ChannelIdsListForPdSync []string `yaml:"syncChannels"`
+
+	// ChannelMessageHistoryScanCount is the number of messages of a channel scanned for alerts.
+	ChannelMessageHistoryScanCount int `yaml:"messageHistoryScanCount"`
 
-    // Slack Channel Ids for PD incident sync
-    ChannelIdsListForPdSync []string
+	// CommandWorkers is the number of commands run concurrently.
+	CommandWorkers int `yaml:"commandWorkers"`
 
-    // Slack Channel History Message Count which will be scanned 
-    ChannelMessageHistoryScanCount int
+	// CommandTimeout is the time after which a command is cancelled.
+	CommandTimeout time.Duration `yaml:"commandTimeout"`
+
+	// UserRateLimit is the number of commands a user may run per minute.
+	UserRateLimit int `yaml:"userRateLimit"`
+
+	// CommandRateLimit is the number of times a command may run per minute unless the command sets its own limit.
+	CommandRateLimit int `yaml:"commandRateLimit"`
 }
 
+// NewSlackConfigFromEnv returns the validated Slack configuration read from the configuration file and the environment or an error.
 func NewSlackConfigFromEnv() (*SlackConfig, error) {
-	port := 8080
-	if p, err := strconv.Atoi(os.Getenv(apiPort)); err == nil {
-		port = p
-	}
-
-	host := "0.0.0.0"
-	if h := os.Getenv(apiHost); h != "" {
-		host = h
-	}
-
-    defaultChannelMessageHistoryScanCount := 20
-    if msc, err := strconv.Atoi(os.Getenv(channelMessageHistoryScanCount)); err == nil {
-        defaultChannelMessageHistoryScanCount = msc
-    }
-
-	c := &SlackConfig{
-		BotToken:                  os.Getenv(botToken),
-		BotID:                     os.Getenv(botID),
-		AccessToken:               os.Getenv(accessToken),
-		VerificationToken:         os.Getenv(verificationToken),
-        ChannelIdsListForPdSync:   strings.Split(os.Getenv(channelIdsListForPdSync), ","),
-        ChannelMessageHistoryScanCount: defaultChannelMessageHistoryScanCount,
-		AuthorizedUserGroupNames:  strings.Split(os.Getenv(authorizedUserGroupNames), ","),
-		KubernetesUserGroupNames:  strings.Split(os.Getenv(kubernetesUserGroupNames), ","),
-		KubernetesAdminGroupNames: strings.Split(os.Getenv(kubernetesAdminGroupNames), ","),
-		APIHost:                   host,
-		APIPort:                   port,
-	}
-	return c, c.validate()
+	cfg, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	current.RLock()
+	defer current.RUnlock()
+	return &cfg.Slack, cfg.Slack.validate()
+}
+
+// UserGroupNames returns the names of the user groups whose members are authorized to use the bot,
+// to perform read operations and to perform all operations for kubernetes clusters.
+func (c *SlackConfig) UserGroupNames() (authorized, kubernetesUsers, kubernetesAdmins []string) {
+	current.RLock()
+	defer current.RUnlock()
+	return copyList(c.AuthorizedUserGroupNames), copyList(c.KubernetesUserGroupNames), copyList(c.KubernetesAdminGroupNames)
+}
+
+// SyncChannels returns the IDs of the channels whose alerts are synced with PagerDuty incidents.
+func (c *SlackConfig) SyncChannels() []string {
+	current.RLock()
+	defer current.RUnlock()
+	return copyList(c.ChannelIdsListForPdSync)
+}
+
+// APIEndpoint returns the base URL of the Slack Web API with the trailing slash expected by the Slack library.
+func (c *SlackConfig) APIEndpoint() string {
+	return strings.TrimSuffix(c.APIURL, "/") + "/"
+}
+
+func (c *SlackConfig) setDefaults() {
+	c.APIURL = slack.APIURL
+	c.APIPort = 8080
+	c.APIHost = "0.0.0.0"
+	c.DebugAddress = "127.0.0.1:8081"
+	c.ChannelMessageHistoryScanCount = 20
+	c.CommandWorkers = 10
+	c.CommandTimeout = 2 * time.Minute
+	c.UserRateLimit = 10
+	c.CommandRateLimit = 30
+}
+
+func (c *SlackConfig) applyEnv() error {
+	return applyEnvOverrides(
+		envString(botToken, &c.BotToken),
+		envString(botID, &c.BotID),
+		envString(accessToken, &c.AccessToken),
+		envString(verificationToken, &c.VerificationToken),
+		envString(slackAPIURL, &c.APIURL),
+		envList(channelIdsListForPdSync, &c.ChannelIdsListForPdSync),
+		envInt(channelMessageHistoryScanCount, &c.ChannelMessageHistoryScanCount),
+		envList(authorizedUserGroupNames, &c.AuthorizedUserGroupNames),
+		envList(kubernetesUserGroupNames, &c.KubernetesUserGroupNames),
+		envList(kubernetesAdminGroupNames, &c.KubernetesAdminGroupNames),
+		envString(apiHost, &c.APIHost),
+		envInt(apiPort, &c.APIPort),
+		envOptionalString(debugAddress, &c.DebugAddress),
+		envInt(commandWorkers, &c.CommandWorkers),
+		envDuration(commandTimeout, &c.CommandTimeout),
+		envInt(userRateLimit, &c.UserRateLimit),
+		envInt(commandRateLimit, &c.CommandRateLimit),
+	)
+}
+
+// reload applies the settings of the new configuration which are safe to change at runtime.
+// The caller must hold the lock.
+func (c *SlackConfig) reload(n *SlackConfig) {
+	c.AuthorizedUserGroupNames = n.AuthorizedUserGroupNames
+	c.KubernetesUserGroupNames = n.KubernetesUserGroupNames
+	c.KubernetesAdminGroupNames = n.KubernetesAdminGroupNames
+	c.ChannelIdsListForPdSync = n.ChannelIdsListForPdSync
 }
 
 func (c *SlackConfig) validate() error {
@@ -124,9 +198,47 @@ func (c *SlackConfig) validate() error {
 	if c.VerificationToken == "" {
 		return fmt.Errorf("missing %s", verificationToken)
 	}
-    if len(c.ChannelIdsListForPdSync) == 0 {
-        return fmt.Errorf("missing or empty %s", verificationToken)
-    }
+	if len(c.ChannelIdsListForPdSync) == 0 {
+		return fmt.Errorf("missing or empty %s", channelIdsListForPdSync)
+	}
+	if err := validateList(authorizedUserGroupNames, c.AuthorizedUserGroupNames); err != nil {
+		return err
+	}
+	if err := validateList(kubernetesUserGroupNames, c.KubernetesUserGroupNames); err != nil {
+		return err
+	}
+	if err := validateList(kubernetesAdminGroupNames, c.KubernetesAdminGroupNames); err != nil {
+		return err
+	}
+	if err := validateList(channelIdsListForPdSync, c.ChannelIdsListForPdSync); err != nil {
+		return err
+	}
+	if err := validateURL(slackAPIURL, c.APIURL); err != nil {
+		return err
+	}
+	if c.APIPort <= 0 || c.APIPort > 65535 {
+		return fmt.Errorf("%s must be a valid port", apiPort)
+	}
+	if c.DebugAddress != "" {
+		if _, _, err := net.SplitHostPort(c.DebugAddress); err != nil {
+			return fmt.Errorf("%s must be of the form host:port", debugAddress)
+		}
+	}
+	if c.ChannelMessageHistoryScanCount <= 0 {
+		return fmt.Errorf("%s must be positive", channelMessageHistoryScanCount)
+	}
+	if c.CommandWorkers <= 0 {
+		return fmt.Errorf("%s must be positive", commandWorkers)
+	}
+	if c.CommandTimeout <= 0 {
+		return fmt.Errorf("%s must be positive", commandTimeout)
+	}
+	if c.UserRateLimit <= 0 {
+		return fmt.Errorf("%s must be positive", userRateLimit)
+	}
+	if c.CommandRateLimit <= 0 {
+		return fmt.Errorf("%s must be positive", commandRateLimit)
+	}
 
 	return nil
 }
@@ -0,0 +1,293 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+// scopeClassicBot is granted to classic bot tokens, which implicitly have all scopes required by the bot.
+const scopeClassicBot = "bot"
+
+var (
+	// botTokenScopes are the OAuth scopes required by the bot token.
+	botTokenScopes = []string{"channels:history", "chat:write", "files:write", "im:write", "reactions:write", "users:read", "users:read.email"}
+
+	// accessTokenScopes are the OAuth scopes required by the access token.
+	accessTokenScopes = []string{"usergroups:read"}
+)
+
+// Result is the result of a single check.
+type Result struct {
+	// Name of the check.
+	Name string
+
+	// Detail describes what was found if the check passed.
+	Detail string
+
+	// Err is the reason the check failed.
+	Err error
+}
+
+// Passed returns whether the check passed.
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Doctor verifies the configuration against the Slack and PagerDuty APIs and the kubeconfig.
+type Doctor struct {
+	cfg     *config.Config
+	logger  log.Logger
+	results []Result
+}
+
+// New returns a new Doctor for the given configuration.
+func New(cfg *config.Config, logger log.Logger) *Doctor {
+	return &Doctor{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Run runs all checks and returns their results.
+// Checks depending on a client which cannot be created are reported as failed.
+func (d *Doctor) Run(ctx context.Context) []Result {
+	d.results = make([]Result, 0)
+	d.checkSlack(ctx)
+	d.checkPagerduty(ctx)
+	d.checkKubernetes(ctx)
+	return d.results
+}
+
+func (d *Doctor) add(name, detail string, err error) {
+	d.results = append(d.results, Result{Name: name, Detail: detail, Err: err})
+}
+
+func (d *Doctor) checkSlack(ctx context.Context) {
+	cfg := &d.cfg.Slack
+
+	botClient, err := clients.NewSlackBotClient(cfg, d.logger)
+	if err != nil {
+		d.add("slack bot token", "", err)
+		return
+	}
+	scopes, err := checkScopes(ctx, botClient, botTokenScopes)
+	d.add("slack bot token", scopes, err)
+
+	accessClient, err := clients.NewSlackClient(cfg, d.logger)
+	if err != nil {
+		d.add("slack access token", "", err)
+		return
+	}
+	scopes, err = checkScopes(ctx, accessClient, accessTokenScopes)
+	d.add("slack access token", scopes, err)
+
+	authorized, kubernetesUsers, kubernetesAdmins := cfg.UserGroupNames()
+	groupNames := util.RemoveDuplicates(append(append(authorized, kubernetesUsers...), kubernetesAdmins...))
+	userGroups, err := accessClient.ListUserGroups()
+	if err != nil {
+		d.add("slack user groups", "", errors.Wrap(err, "failed to list user groups"))
+	} else {
+		members := make(map[string]int, len(userGroups))
+		for _, ug := range userGroups {
+			members[ug.Name] = len(ug.Users)
+		}
+		for _, name := range groupNames {
+			count, ok := members[name]
+			if !ok {
+				d.add(fmt.Sprintf("slack user group %s", name), "", errors.New("user group not found"))
+				continue
+			}
+			d.add(fmt.Sprintf("slack user group %s", name), fmt.Sprintf("%d members", count), nil)
+		}
+	}
+
+	for _, channelID := range d.channelIDs() {
+		channel, err := botClient.GetChannel(channelID)
+		if err != nil {
+			d.add(fmt.Sprintf("slack channel %s", channelID), "", err)
+			continue
+		}
+		d.add(fmt.Sprintf("slack channel %s", channelID), "#"+channel.Name, nil)
+	}
+}
+
+// channelIDs returns the sorted IDs of all channels referenced by the configuration.
+func (d *Doctor) channelIDs() []string {
+	ids := d.cfg.Slack.SyncChannels()
+	for channelID := range d.cfg.Pagerduty.ChannelSchedules {
+		ids = append(ids, channelID)
+	}
+	for channelID := range d.cfg.Pagerduty.Handovers() {
+		ids = append(ids, channelID)
+	}
+	ids = util.RemoveDuplicates(ids)
+	sort.Strings(ids)
+	return ids
+}
+
+func (d *Doctor) checkPagerduty(ctx context.Context) {
+	cfg := &d.cfg.Pagerduty
+
+	client, err := clients.NewPagerdutyClient(cfg, d.logger)
+	if err != nil {
+		d.add("pagerduty token and default user", "", err)
+		return
+	}
+
+	// Looking up the default user also verifies the token.
+	defaultUser, err := client.GetDefaultUser(ctx)
+	if err != nil {
+		d.add("pagerduty token and default user", "", err)
+		return
+	}
+	d.add("pagerduty token and default user", defaultUser.Name, nil)
+
+	for _, serviceID := range d.serviceIDs() {
+		service, err := client.GetService(ctx, serviceID)
+		if err != nil {
+			d.add(fmt.Sprintf("pagerduty service %s", serviceID), "", err)
+			continue
+		}
+		d.add(fmt.Sprintf("pagerduty service %s", serviceID), service.Name, nil)
+	}
+
+	for _, scheduleName := range d.scheduleNames() {
+		schedule, err := client.GetSchedule(ctx, scheduleName)
+		if err != nil {
+			d.add(fmt.Sprintf("pagerduty schedule %s", scheduleName), "", err)
+			continue
+		}
+		d.add(fmt.Sprintf("pagerduty schedule %s", scheduleName), schedule.ID, nil)
+	}
+}
+
+// serviceIDs returns the IDs of the synced services and the services of the regions in the order of the configuration.
+func (d *Doctor) serviceIDs() []string {
+	ids := append([]string(nil), d.cfg.Pagerduty.FilterServices...)
+	for _, region := range d.cfg.Regions.List() {
+		ids = append(ids, region.PagerdutyServices...)
+	}
+	return util.RemoveDuplicates(ids)
+}
+
+// scheduleNames returns the sorted names of all schedules referenced by the configuration.
+func (d *Doctor) scheduleNames() []string {
+	names := append([]string(nil), d.cfg.Pagerduty.DefaultSchedules...)
+	for _, scheduleNames := range d.cfg.Pagerduty.ChannelSchedules {
+		names = append(names, scheduleNames...)
+	}
+	for _, scheduleNames := range d.cfg.Pagerduty.Handovers() {
+		names = append(names, scheduleNames...)
+	}
+	names = util.RemoveDuplicates(names)
+	sort.Strings(names)
+	return names
+}
+
+func (d *Doctor) checkKubernetes(ctx context.Context) {
+	client, err := clients.NewK8sClient(&d.cfg.Kubernetes, d.logger)
+	if err != nil {
+		d.add("kubectl", "", err)
+		return
+	}
+
+	kubeContexts, err := client.ListContexts(ctx)
+	if err != nil {
+		d.add("kubeconfig", "", errors.Wrap(err, "failed to list contexts"))
+		return
+	}
+	if len(kubeContexts) == 0 {
+		d.add("kubeconfig", "", errors.New("no contexts found"))
+		return
+	}
+	d.add("kubeconfig", fmt.Sprintf("%d contexts", len(kubeContexts)), nil)
+
+	for _, kubeContext := range kubeContexts {
+		version, err := client.ServerVersion(ctx, kubeContext)
+		d.add(fmt.Sprintf("kubernetes context %s", kubeContext), version, err)
+	}
+
+	// Every region of the catalog needs the context of its cluster.
+	for _, region := range d.cfg.Regions.Names() {
+		kubeContext := d.cfg.Regions.KubeContext(region)
+		if !util.Contains(kubeContexts, kubeContext) {
+			d.add(fmt.Sprintf("region %s", region), "", fmt.Errorf("kubernetes context %s not found in kubeconfig", kubeContext))
+		}
+	}
+}
+
+// checkScopes verifies the token of the client and returns the granted scopes or an error listing the missing ones.
+func checkScopes(ctx context.Context, client *clients.SlackClient, required []string) (string, error) {
+	granted, err := client.Scopes(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid token")
+	}
+	if missing := missingScopes(granted, required); len(missing) > 0 {
+		return "", fmt.Errorf("missing scopes %s", strings.Join(missing, ", "))
+	}
+	return strings.Join(granted, ", "), nil
+}
+
+// missingScopes returns the required scopes which were not granted.
+func missingScopes(granted, required []string) []string {
+	missing := make([]string, 0)
+	if util.Contains(granted, scopeClassicBot) {
+		return missing
+	}
+	for _, scope := range required {
+		if !util.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// Report writes the results as a table and returns the number of failed checks.
+func Report(w io.Writer, results []Result) (int, error) {
+	table := uitable.New()
+	table.MaxColWidth = 100
+	table.Wrap = true
+	table.AddRow("STATUS", "CHECK", "DETAIL")
+
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			table.AddRow("PASS", r.Name, r.Detail)
+			continue
+		}
+		failed++
+		table.AddRow("FAIL", r.Name, r.Err.Error())
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n\n%d of %d checks passed\n", table.String(), len(results)-failed, len(results))
+	return failed, err
+}
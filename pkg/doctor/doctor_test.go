@@ -0,0 +1,48 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package doctor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingScopes(t *testing.T) {
+	assert.Equal(t, []string{"im:write"}, missingScopes([]string{"chat:write", "users:read"}, []string{"chat:write", "im:write"}))
+	assert.Empty(t, missingScopes([]string{scopeClassicBot}, botTokenScopes), "classic bot tokens should have all scopes")
+	assert.Empty(t, missingScopes([]string{"usergroups:read", "identify"}, accessTokenScopes))
+}
+
+func TestReport(t *testing.T) {
+	var buf bytes.Buffer
+	failed, err := Report(&buf, []Result{
+		{Name: "slack channel C1", Detail: "#alerts"},
+		{Name: "pagerduty service P1", Err: errors.New("not found")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failed, "one check should have failed")
+	assert.Contains(t, buf.String(), "PASS")
+	assert.Contains(t, buf.String(), "FAIL")
+	assert.Contains(t, buf.String(), "not found")
+	assert.Contains(t, buf.String(), "1 of 2 checks passed")
+}
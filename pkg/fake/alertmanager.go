@@ -0,0 +1,141 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	silenceStateActive  = "active"
+	silenceStateExpired = "expired"
+)
+
+// Alertmanager is a fake of the silences of the Alertmanager API v2 of several regions keeping them in memory.
+// The region is the first segment of the path, so the URL template is URL() + "/{region}".
+type Alertmanager struct {
+	server *httptest.Server
+
+	mtx      sync.Mutex
+	silences []Silence
+}
+
+// Silence is a silence created in the fake Alertmanager.
+type Silence struct {
+	ID       string `json:"id"`
+	Region   string `json:"-"`
+	Matchers []struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+		IsEqual bool   `json:"isEqual"`
+	} `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+	Status    struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+// NewAlertmanager starts a new fake Alertmanager. It must be closed after use.
+func NewAlertmanager() *Alertmanager {
+	a := &Alertmanager{}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/{region}/api/v2/silences", a.handleListSilences).Methods(http.MethodGet)
+	r.HandleFunc("/{region}/api/v2/silences", a.handleCreateSilence).Methods(http.MethodPost)
+	r.HandleFunc("/{region}/api/v2/silence/{id}", a.handleExpireSilence).Methods(http.MethodDelete)
+
+	a.server = httptest.NewServer(r)
+	return a
+}
+
+// URL returns the base URL of the server. ALERTMANAGER_API_URL is URL() + "/{region}".
+func (a *Alertmanager) URL() string {
+	return a.server.URL
+}
+
+// Close stops the server.
+func (a *Alertmanager) Close() {
+	a.server.Close()
+}
+
+// Silences returns all silences including expired ones.
+func (a *Alertmanager) Silences() []Silence {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return append([]Silence(nil), a.silences...)
+}
+
+func (a *Alertmanager) handleListSilences(w http.ResponseWriter, r *http.Request) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	res := make([]Silence, 0)
+	for _, s := range a.silences {
+		if s.Region == mux.Vars(r)["region"] {
+			res = append(res, s)
+		}
+	}
+	writeJSON(w, res)
+}
+
+func (a *Alertmanager) handleCreateSilence(w http.ResponseWriter, r *http.Request) {
+	var s Silence
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(s.Matchers) == 0 || s.CreatedBy == "" || s.Comment == "" || !s.EndsAt.After(s.StartsAt) {
+		http.Error(w, "invalid silence", http.StatusBadRequest)
+		return
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	s.ID = fmt.Sprintf("silence-%d", len(a.silences)+1)
+	s.Region = mux.Vars(r)["region"]
+	s.Status.State = silenceStateActive
+	a.silences = append(a.silences, s)
+	writeJSON(w, map[string]string{"silenceID": s.ID})
+}
+
+func (a *Alertmanager) handleExpireSilence(w http.ResponseWriter, r *http.Request) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	for idx := range a.silences {
+		s := &a.silences[idx]
+		if s.ID == mux.Vars(r)["id"] && s.Region == mux.Vars(r)["region"] {
+			s.Status.State = silenceStateExpired
+			s.EndsAt = time.Now().UTC()
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	http.Error(w, "silence not found", http.StatusNotFound)
+}
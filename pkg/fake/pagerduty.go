@@ -0,0 +1,658 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/gorilla/mux"
+)
+
+// PagerdutyToken is the API token accepted by the fake PagerDuty.
+const PagerdutyToken = "fake-pagerduty-token"
+
+const (
+	statusTriggered    = "triggered"
+	statusAcknowledged = "acknowledged"
+)
+
+// Pagerduty is a fake of the PagerDuty REST and Events API v2 keeping users, services, schedules, incidents and their
+// notes in memory. Scenarios trigger incidents via its methods and inspect what the bot did.
+type Pagerduty struct {
+	server *httptest.Server
+
+	mtx         sync.Mutex
+	users       []pagerduty.User
+	services    map[string]pagerduty.Service
+	routingKeys map[string]string
+	schedules   []pagerduty.Schedule
+	policies    []pagerduty.EscalationPolicy
+	overrides   map[string][]pagerduty.Override
+	incidents   []*pagerduty.Incident
+	notes       map[string][]pagerduty.IncidentNote
+
+	// requests are the method and path of the API requests received.
+	requests []string
+
+	// overrideLimit is the number of overrides per schedule after which creating overrides fails. 0 means no limit.
+	overrideLimit int
+	lastOverride  int
+}
+
+// NewPagerduty starts a new fake PagerDuty. It must be closed after use.
+func NewPagerduty() *Pagerduty {
+	p := &Pagerduty{
+		services:    make(map[string]pagerduty.Service),
+		routingKeys: make(map[string]string),
+		overrides:   make(map[string][]pagerduty.Override),
+		notes:       make(map[string][]pagerduty.IncidentNote),
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v2/enqueue", p.handleEnqueue).Methods(http.MethodPost)
+
+	api := r.NewRoute().Subrouter()
+	api.Use(p.authenticate)
+	api.HandleFunc("/users", p.handleListUsers).Methods(http.MethodGet)
+	api.HandleFunc("/users/{id}", p.handleGetUser).Methods(http.MethodGet)
+	api.HandleFunc("/services/{id}", p.handleGetService).Methods(http.MethodGet)
+	api.HandleFunc("/incidents", p.handleListIncidents).Methods(http.MethodGet)
+	api.HandleFunc("/incidents", p.handleManageIncidents).Methods(http.MethodPut)
+	api.HandleFunc("/incidents/{id}/notes", p.handleListNotes).Methods(http.MethodGet)
+	api.HandleFunc("/incidents/{id}/notes", p.handleCreateNote).Methods(http.MethodPost)
+	api.HandleFunc("/log_entries", p.handleListLogEntries).Methods(http.MethodGet)
+	api.HandleFunc("/schedules", p.handleListSchedules).Methods(http.MethodGet)
+	api.HandleFunc("/schedules/{id}", p.handleGetSchedule).Methods(http.MethodGet)
+	api.HandleFunc("/schedules/{id}/overrides", p.handleCreateOverride).Methods(http.MethodPost)
+	api.HandleFunc("/schedules/{id}/overrides/{overrideID}", p.handleDeleteOverride).Methods(http.MethodDelete)
+	api.HandleFunc("/oncalls", p.handleListOnCalls).Methods(http.MethodGet)
+	api.HandleFunc("/escalation_policies", p.handleEmptyList("escalation_policies")).Methods(http.MethodGet)
+	api.HandleFunc("/teams", p.handleEmptyList("teams")).Methods(http.MethodGet)
+
+	p.server = httptest.NewServer(r)
+	return p
+}
+
+// URL returns the base URL to be used as PAGERDUTY_API_URL and PAGERDUTY_EVENTS_API_URL.
+func (p *Pagerduty) URL() string {
+	return p.server.URL
+}
+
+// Close stops the server.
+func (p *Pagerduty) Close() {
+	p.server.Close()
+}
+
+// AddUser adds a user with the given name and email and returns it.
+func (p *Pagerduty) AddUser(name, email string) pagerduty.User {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	usr := pagerduty.User{
+		APIObject: pagerduty.APIObject{ID: fmt.Sprintf("PU%d", len(p.users)+1), Type: "user", Summary: name},
+		Name:      name,
+		Email:     email,
+		Timezone:  "UTC",
+	}
+	p.users = append(p.users, usr)
+	return usr
+}
+
+// AddService adds a service with the given ID and name. Events sent with the routing key trigger incidents of it.
+func (p *Pagerduty) AddService(serviceID, name, routingKey string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.services[serviceID] = pagerduty.Service{
+		APIObject: pagerduty.APIObject{ID: serviceID, Type: "service", Summary: name},
+		Name:      name,
+		Status:    "active",
+	}
+	if routingKey != "" {
+		p.routingKeys[routingKey] = serviceID
+	}
+}
+
+// AddSchedule adds a schedule with the given name on which the given users are on call and returns its ID.
+func (p *Pagerduty) AddSchedule(name string, users ...pagerduty.User) string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	schedule := pagerduty.Schedule{
+		APIObject: pagerduty.APIObject{ID: fmt.Sprintf("PS%d", len(p.schedules)+1), Type: "schedule", Summary: name},
+		Name:      name,
+		TimeZone:  "UTC",
+	}
+	for _, usr := range users {
+		schedule.Users = append(schedule.Users, usr.APIObject)
+	}
+	p.schedules = append(p.schedules, schedule)
+	return schedule.ID
+}
+
+// SetOnCall replaces the users on call on the schedule with the given ones, e.g. to hand over a shift.
+func (p *Pagerduty) SetOnCall(scheduleID string, users ...pagerduty.User) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for idx := range p.schedules {
+		if p.schedules[idx].ID != scheduleID {
+			continue
+		}
+		p.schedules[idx].Users = nil
+		for _, usr := range users {
+			p.schedules[idx].Users = append(p.schedules[idx].Users, usr.APIObject)
+		}
+	}
+}
+
+// AddEscalationPolicy adds an escalation policy with the given name escalating to the schedule, which is used by the
+// given services, and returns its ID. Incidents of the services and on-calls of the schedule refer to it.
+func (p *Pagerduty) AddEscalationPolicy(name, scheduleID string, serviceIDs ...string) string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	policy := pagerduty.EscalationPolicy{
+		APIObject: pagerduty.APIObject{ID: fmt.Sprintf("PP%d", len(p.policies)+1), Type: "escalation_policy", Summary: name},
+		Name:      name,
+	}
+	p.policies = append(p.policies, policy)
+
+	for idx := range p.schedules {
+		if p.schedules[idx].ID == scheduleID {
+			p.schedules[idx].EscalationPolicies = append(p.schedules[idx].EscalationPolicies, policy.APIObject)
+		}
+	}
+	for _, serviceID := range serviceIDs {
+		service := p.services[serviceID]
+		service.EscalationPolicy = policy
+		p.services[serviceID] = service
+	}
+	return policy.ID
+}
+
+// SetOverrideLimit makes creating overrides fail once the schedule has the given number of overrides.
+func (p *Pagerduty) SetOverrideLimit(limit int) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.overrideLimit = limit
+}
+
+// TriggerIncident creates a triggered incident of the service with the given summary and returns it.
+func (p *Pagerduty) TriggerIncident(serviceID, summary string) pagerduty.Incident {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return *p.triggerIncident(serviceID, summary, "", "high")
+}
+
+// TriggerIncidentWithKey creates a triggered incident of the service with the given summary and incident key,
+// e.g. the hash of an Alertmanager group key, and returns it.
+func (p *Pagerduty) TriggerIncidentWithKey(serviceID, summary, incidentKey string) pagerduty.Incident {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return *p.triggerIncident(serviceID, summary, incidentKey, "high")
+}
+
+// Incident returns the incident with the given ID.
+func (p *Pagerduty) Incident(incidentID string) (pagerduty.Incident, bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if inc := p.findIncident(incidentID); inc != nil {
+		return *inc, true
+	}
+	return pagerduty.Incident{}, false
+}
+
+// Incidents returns all incidents, oldest first.
+func (p *Pagerduty) Incidents() []pagerduty.Incident {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	res := make([]pagerduty.Incident, 0, len(p.incidents))
+	for _, inc := range p.incidents {
+		res = append(res, *inc)
+	}
+	return res
+}
+
+// Notes returns the notes of the incident, oldest first.
+func (p *Pagerduty) Notes(incidentID string) []pagerduty.IncidentNote {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return append([]pagerduty.IncidentNote(nil), p.notes[incidentID]...)
+}
+
+// Overrides returns the overrides created for the schedule.
+func (p *Pagerduty) Overrides(scheduleID string) []pagerduty.Override {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return append([]pagerduty.Override(nil), p.overrides[scheduleID]...)
+}
+
+// Requests returns the number of API requests received with the given method and path, e.g. `GET /incidents`.
+func (p *Pagerduty) Requests(method, path string) int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	n := 0
+	for _, r := range p.requests {
+		if r == method+" "+path {
+			n++
+		}
+	}
+	return n
+}
+
+// triggerIncident creates an incident. The caller must hold the lock.
+func (p *Pagerduty) triggerIncident(serviceID, summary, incidentKey, urgency string) *pagerduty.Incident {
+	number := len(p.incidents) + 1
+	id := fmt.Sprintf("PI%d", number)
+	if incidentKey == "" {
+		incidentKey = id
+	}
+
+	inc := &pagerduty.Incident{
+		APIObject: pagerduty.APIObject{
+			ID:      id,
+			Type:    "incident",
+			Summary: summary,
+			HTMLURL: fmt.Sprintf("%s/incidents/%s", p.server.URL, id),
+		},
+		IncidentNumber:   uint(number),
+		Title:            summary,
+		CreatedAt:        time.Now().UTC().Format(time.RFC3339),
+		IncidentKey:      incidentKey,
+		Service:          p.services[serviceID].APIObject,
+		EscalationPolicy: p.services[serviceID].EscalationPolicy.APIObject,
+		Urgency:          urgency,
+		Status:           statusTriggered,
+	}
+	p.incidents = append(p.incidents, inc)
+	return inc
+}
+
+// findIncident returns the incident with the given ID or nil. The caller must hold the lock.
+func (p *Pagerduty) findIncident(incidentID string) *pagerduty.Incident {
+	for _, inc := range p.incidents {
+		if inc.ID == incidentID {
+			return inc
+		}
+	}
+	return nil
+}
+
+// findUserByEmail returns the user with the given email or nil. The caller must hold the lock.
+func (p *Pagerduty) findUserByEmail(email string) *pagerduty.User {
+	for i := range p.users {
+		if p.users[i].Email == email {
+			return &p.users[i]
+		}
+	}
+	return nil
+}
+
+func (p *Pagerduty) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token token="+PagerdutyToken {
+			writeError(w, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		p.mtx.Lock()
+		defer p.mtx.Unlock()
+		p.requests = append(p.requests, r.Method+" "+r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Pagerduty) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("query"))
+	users := make([]pagerduty.User, 0)
+	for _, usr := range p.users {
+		if strings.Contains(strings.ToLower(usr.Name), query) || strings.Contains(strings.ToLower(usr.Email), query) {
+			users = append(users, usr)
+		}
+	}
+	writeJSON(w, map[string]interface{}{"users": users, "more": false})
+}
+
+func (p *Pagerduty) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	for _, usr := range p.users {
+		if usr.ID == mux.Vars(r)["id"] {
+			writeJSON(w, map[string]interface{}{"user": usr})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (p *Pagerduty) handleGetService(w http.ResponseWriter, r *http.Request) {
+	if service, ok := p.services[mux.Vars(r)["id"]]; ok {
+		writeJSON(w, map[string]interface{}{"service": service})
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// handleListIncidents filters by incident key, statuses, urgencies and services and returns the incidents most recent
+// first, paginated by limit and offset.
+func (p *Pagerduty) handleListIncidents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	incidents := make([]pagerduty.Incident, 0)
+	for i := len(p.incidents) - 1; i >= 0; i-- {
+		inc := p.incidents[i]
+		if key := q.Get("incident_key"); key != "" && inc.IncidentKey != key {
+			continue
+		}
+		if !matches(q["statuses[]"], inc.Status) || !matches(q["urgencies[]"], inc.Urgency) || !matches(q["service_ids[]"], inc.Service.ID) {
+			continue
+		}
+		incidents = append(incidents, *inc)
+	}
+
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit == 0 {
+		limit = 25
+	}
+	if offset > len(incidents) {
+		offset = len(incidents)
+	}
+	end := offset + limit
+	if end > len(incidents) {
+		end = len(incidents)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"incidents": incidents[offset:end],
+		"offset":    offset,
+		"limit":     limit,
+		"more":      end < len(incidents),
+	})
+}
+
+// handleManageIncidents updates the status of the incidents on behalf of the user given by the From header.
+func (p *Pagerduty) handleManageIncidents(w http.ResponseWriter, r *http.Request) {
+	from := p.findUserByEmail(r.Header.Get("From"))
+	if from == nil {
+		writeError(w, http.StatusBadRequest, "Requester User Not Found")
+		return
+	}
+
+	var body struct {
+		Incidents []pagerduty.ManageIncidentsOptions `json:"incidents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	incidents := make([]pagerduty.Incident, 0, len(body.Incidents))
+	for _, o := range body.Incidents {
+		inc := p.findIncident(o.ID)
+		if inc == nil {
+			writeError(w, http.StatusNotFound, "Incident Not Found")
+			return
+		}
+		if o.Status != "" && o.Status != inc.Status {
+			inc.Status = o.Status
+			inc.LastStatusChangeAt = now
+			inc.LastStatusChangeBy = from.APIObject
+			if o.Status == statusAcknowledged {
+				inc.Acknowledgements = append(inc.Acknowledgements, pagerduty.Acknowledgement{At: now, Acknowledger: from.APIObject})
+			}
+		}
+		incidents = append(incidents, *inc)
+	}
+	writeJSON(w, map[string]interface{}{"incidents": incidents})
+}
+
+func (p *Pagerduty) handleListNotes(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if p.findIncident(id) == nil {
+		writeError(w, http.StatusNotFound, "Incident Not Found")
+		return
+	}
+	notes := append([]pagerduty.IncidentNote{}, p.notes[id]...)
+	writeJSON(w, map[string]interface{}{"notes": notes})
+}
+
+func (p *Pagerduty) handleCreateNote(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if p.findIncident(id) == nil {
+		writeError(w, http.StatusNotFound, "Incident Not Found")
+		return
+	}
+
+	var body struct {
+		Note pagerduty.IncidentNote `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	note := body.Note
+	note.ID = fmt.Sprintf("PN%d", len(p.notes[id])+1)
+	note.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	p.notes[id] = append(p.notes[id], note)
+	writeJSON(w, map[string]interface{}{"note": note})
+}
+
+// handleListLogEntries returns an annotate log entry for every note created since the requested time.
+func (p *Pagerduty) handleListLogEntries(w http.ResponseWriter, r *http.Request) {
+	since, _ := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	entries := make([]pagerduty.LogEntry, 0)
+	for _, inc := range p.incidents {
+		for _, note := range p.notes[inc.ID] {
+			if created, err := time.Parse(time.RFC3339, note.CreatedAt); err == nil && !created.Before(since) {
+				entry := pagerduty.LogEntry{Incident: pagerduty.Incident{APIObject: inc.APIObject}}
+				entry.Type, entry.CreatedAt = "annotate_log_entry", note.CreatedAt
+				entries = append(entries, entry)
+			}
+		}
+	}
+	writeJSON(w, map[string]interface{}{"log_entries": entries, "more": false})
+}
+
+func (p *Pagerduty) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("query"))
+	schedules := make([]pagerduty.Schedule, 0)
+	for _, s := range p.schedules {
+		if strings.Contains(strings.ToLower(s.Name), query) {
+			schedules = append(schedules, s)
+		}
+	}
+	writeJSON(w, map[string]interface{}{"schedules": schedules, "more": false})
+}
+
+// handleGetSchedule returns the schedule whose final schedule has the first user on call for the requested time
+// range, followed by the overrides.
+func (p *Pagerduty) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	for _, s := range p.schedules {
+		if s.ID != mux.Vars(r)["id"] {
+			continue
+		}
+
+		if len(s.Users) > 0 {
+			s.FinalSchedule.RenderedScheduleEntries = []pagerduty.RenderedScheduleEntry{{
+				Start: r.URL.Query().Get("since"),
+				End:   r.URL.Query().Get("until"),
+				User:  s.Users[0],
+			}}
+		}
+		for _, o := range p.overrides[s.ID] {
+			s.FinalSchedule.RenderedScheduleEntries = append(s.FinalSchedule.RenderedScheduleEntries, pagerduty.RenderedScheduleEntry{Start: o.Start, End: o.End, User: o.User})
+		}
+		writeJSON(w, map[string]interface{}{"schedule": s})
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (p *Pagerduty) handleCreateOverride(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var body struct {
+		Override pagerduty.Override `json:"override"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if p.overrideLimit > 0 && len(p.overrides[id]) >= p.overrideLimit {
+		writeError(w, http.StatusBadRequest, "Override limit reached")
+		return
+	}
+
+	o := body.Override
+	p.lastOverride++
+	o.ID = fmt.Sprintf("PO%d", p.lastOverride)
+	p.overrides[id] = append(p.overrides[id], o)
+	writeJSON(w, map[string]interface{}{"override": o})
+}
+
+func (p *Pagerduty) handleDeleteOverride(w http.ResponseWriter, r *http.Request) {
+	id, overrideID := mux.Vars(r)["id"], mux.Vars(r)["overrideID"]
+	for idx, o := range p.overrides[id] {
+		if o.ID == overrideID {
+			p.overrides[id] = append(p.overrides[id][:idx], p.overrides[id][idx+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// handleListOnCalls returns every user of the requested schedules as on call for whole days. Without a time range
+// only today's shift is returned, otherwise one shift for every day overlapping the range.
+func (p *Pagerduty) handleListOnCalls(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	days := 1
+	if until, err := time.Parse(time.RFC3339, q.Get("until")); err == nil {
+		days = int(until.Sub(today).Hours()/24) + 1
+	}
+
+	onCalls := make([]pagerduty.OnCall, 0)
+	for _, s := range p.schedules {
+		if !matches(q["schedule_ids[]"], s.ID) {
+			continue
+		}
+		var policy pagerduty.EscalationPolicy
+		if len(s.EscalationPolicies) > 0 {
+			policy.APIObject = s.EscalationPolicies[0]
+		}
+		for _, ref := range s.Users {
+			if !matches(q["user_ids[]"], ref.ID) {
+				continue
+			}
+			for _, usr := range p.users {
+				if usr.ID != ref.ID {
+					continue
+				}
+				for day := 0; day < days; day++ {
+					start := today.AddDate(0, 0, day)
+					onCalls = append(onCalls, pagerduty.OnCall{
+						User:             usr,
+						Schedule:         pagerduty.Schedule{APIObject: s.APIObject, Name: s.Name},
+						EscalationPolicy: policy,
+						EscalationLevel:  1,
+						Start:            start.Format(time.RFC3339),
+						End:              start.AddDate(0, 0, 1).Format(time.RFC3339),
+					})
+				}
+			}
+		}
+	}
+	sort.SliceStable(onCalls, func(i, j int) bool { return onCalls[i].User.Name < onCalls[j].User.Name })
+	writeJSON(w, map[string]interface{}{"oncalls": onCalls, "more": false})
+}
+
+func (p *Pagerduty) handleEmptyList(key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{key: []interface{}{}, "more": false})
+	}
+}
+
+// handleEnqueue triggers an incident of the service of the routing key, deduplicated by the dedup key.
+func (p *Pagerduty) handleEnqueue(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var event pagerduty.V2Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.Payload == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, pagerduty.V2EventResponse{Status: "invalid event", Message: "Event object is invalid"})
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	serviceID, ok := p.routingKeys[event.RoutingKey]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, pagerduty.V2EventResponse{Status: "invalid event", Message: "Event object is invalid", Errors: []string{"Invalid routing key"}})
+		return
+	}
+
+	if event.DedupKey == "" {
+		event.DedupKey = fmt.Sprintf("%s-%d", event.RoutingKey, len(p.incidents)+1)
+	}
+
+	urgency := "high"
+	if event.Payload.Severity == "warning" || event.Payload.Severity == "info" {
+		urgency = "low"
+	}
+
+	exists := false
+	for _, inc := range p.incidents {
+		if inc.IncidentKey == event.DedupKey && inc.Status != "resolved" {
+			exists = true
+		}
+	}
+	if !exists && event.Action == "trigger" {
+		p.triggerIncident(serviceID, event.Payload.Summary, event.DedupKey, urgency)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, pagerduty.V2EventResponse{Status: "success", Message: "Event processed", DedupKey: event.DedupKey})
+}
+
+// matches returns true if the value is one of the wanted values or no values are wanted.
+func matches(wanted []string, value string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if w == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": status, "message": message}})
+}
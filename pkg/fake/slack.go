@@ -0,0 +1,631 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+)
+
+const (
+	// SlackBotToken and SlackAccessToken are the tokens accepted by the fake Slack.
+	SlackBotToken    = "xoxb-fake"
+	SlackAccessToken = "xoxp-fake"
+
+	// SlackVerificationToken is sent with interactions.
+	SlackVerificationToken = "fake-verification-token"
+
+	// SlackBotUserID and SlackBotID identify the bot using the bot token.
+	SlackBotUserID = "UPULSAR"
+	SlackBotID     = "BPULSAR"
+
+	// AlertmanagerBotID identifies messages posted via PostAlert.
+	AlertmanagerBotID = "BALERTMANAGER"
+
+	subTypeBotMessage = "bot_message"
+
+	maxUploadSize = 10 << 20
+)
+
+// Slack is a fake of the Slack Web and RTM API keeping channels, messages, reactions, users and user groups in memory.
+// Scenarios post messages and click buttons via its methods and inspect what the bot did.
+type Slack struct {
+	server *httptest.Server
+
+	// Scopes are returned by auth.test for each token.
+	Scopes map[string][]string
+
+	mtx        sync.Mutex
+	users      map[string]slack.User
+	userGroups []slack.UserGroup
+	channels   map[string]*slackChannel
+	ims        map[string]string
+	files      []slack.File
+	dialogs    []slack.Dialog
+	rtmConns   []*websocket.Conn
+	lastTS     time.Time
+	counter    int
+}
+
+type slackChannel struct {
+	info      slack.Channel
+	messages  []slack.Message
+	ephemeral []slack.Message
+}
+
+// NewSlack starts a new fake Slack. It must be closed after use.
+func NewSlack() *Slack {
+	s := &Slack{
+		Scopes: map[string][]string{
+			SlackBotToken:    {"bot"},
+			SlackAccessToken: {"usergroups:read"},
+		},
+		users:    make(map[string]slack.User),
+		channels: make(map[string]*slackChannel),
+		ims:      make(map[string]string),
+	}
+	s.AddUser(slack.User{ID: SlackBotUserID, Name: "pulsar", IsBot: true})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", s.handleMethod)
+	mux.HandleFunc("/rtm", s.handleRTM)
+	s.server = httptest.NewServer(mux)
+	return s
+}
+
+// URL returns the base URL of the Web API to be used as SLACK_API_URL.
+func (s *Slack) URL() string {
+	return s.server.URL + "/api/"
+}
+
+// Close stops the server and closes all RTM connections.
+func (s *Slack) Close() {
+	s.mtx.Lock()
+	for _, conn := range s.rtmConns {
+		conn.Close()
+	}
+	s.mtx.Unlock()
+	s.server.Close()
+}
+
+// AddUser adds a user to the workspace.
+func (s *Slack) AddUser(user slack.User) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.users[user.ID] = user
+}
+
+// AddUserGroup adds a user group with the given members.
+func (s *Slack) AddUserGroup(name string, userIDs ...string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.userGroups = append(s.userGroups, slack.UserGroup{
+		ID:        fmt.Sprintf("S%d", len(s.userGroups)+1),
+		Name:      name,
+		Handle:    name,
+		Users:     userIDs,
+		UserCount: len(userIDs),
+	})
+}
+
+// AddChannel adds a channel.
+func (s *Slack) AddChannel(channelID, name string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.channel(channelID).info.Name = name
+}
+
+// PostAlert posts a message with the given attachments like Alertmanager does and returns its timestamp.
+func (s *Slack) PostAlert(channelID string, attachments ...slack.Attachment) string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.addMessage(channelID, slack.Message{Msg: slack.Msg{
+		Type:        "message",
+		SubType:     subTypeBotMessage,
+		BotID:       AlertmanagerBotID,
+		Attachments: attachments,
+	}})
+}
+
+// SendMessage posts a message of the user, e.g. a command, in the channel or, if threadTimestamp is set, in the thread
+// and sends it to the bot via RTM. Returns the timestamp of the message.
+func (s *Slack) SendMessage(channelID, threadTimestamp, userID, text string) string {
+	s.mtx.Lock()
+	msg := slack.Message{Msg: slack.Msg{
+		Type:            "message",
+		Channel:         channelID,
+		User:            userID,
+		Text:            text,
+		ThreadTimestamp: threadTimestamp,
+	}}
+	msg.Timestamp = s.addMessage(channelID, msg)
+	conns := append([]*websocket.Conn(nil), s.rtmConns...)
+	s.mtx.Unlock()
+
+	for _, conn := range conns {
+		conn.WriteJSON(msg.Msg)
+	}
+	return msg.Timestamp
+}
+
+// Messages returns the top-level messages of the channel, oldest first.
+func (s *Slack) Messages(channelID string) []slack.Message {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	res := make([]slack.Message, 0)
+	for _, msg := range s.channel(channelID).messages {
+		if msg.ThreadTimestamp == "" || msg.ThreadTimestamp == msg.Timestamp {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+// Message returns the message with the given timestamp.
+func (s *Slack) Message(channelID, timestamp string) (slack.Message, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if msg := s.findMessage(channelID, timestamp); msg != nil {
+		return *msg, true
+	}
+	return slack.Message{}, false
+}
+
+// Replies returns the replies in the thread of the message with the given timestamp, oldest first.
+func (s *Slack) Replies(channelID, threadTimestamp string) []slack.Message {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.replies(channelID, threadTimestamp)
+}
+
+// EphemeralMessages returns the ephemeral messages posted in the channel.
+func (s *Slack) EphemeralMessages(channelID string) []slack.Message {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]slack.Message(nil), s.channel(channelID).ephemeral...)
+}
+
+// Reactions returns the names of the reactions added to the message.
+func (s *Slack) Reactions(channelID, timestamp string) []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	res := make([]string, 0)
+	if msg := s.findMessage(channelID, timestamp); msg != nil {
+		for _, r := range msg.Reactions {
+			res = append(res, r.Name)
+		}
+	}
+	return res
+}
+
+// Interact sends the interaction callback to the interaction endpoint of the API like Slack does after a user clicked a button.
+func (s *Slack) Interact(interactionURL string, callback slack.InteractionCallback) error {
+	_, err := s.interact(interactionURL, callback)
+	return err
+}
+
+// interact sends the interaction callback and returns the body of the response.
+func (s *Slack) interact(interactionURL string, callback slack.InteractionCallback) ([]byte, error) {
+	callback.Token = SlackVerificationToken
+	payload, err := json.Marshal(callback)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.PostForm(interactionURL, url.Values{"payload": {string(payload)}})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("interaction failed with status %d", res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// ClickAttachmentButton sends the interaction of the user clicking the attachment button with the given name and value
+// of the message to the interaction endpoint.
+func (s *Slack) ClickAttachmentButton(interactionURL, channelID, timestamp, userID, name, value string) error {
+	msg, ok := s.Message(channelID, timestamp)
+	if !ok {
+		return fmt.Errorf("message %s not found in channel %s", timestamp, channelID)
+	}
+
+	callback := slack.InteractionCallback{
+		Type:            slack.InteractionTypeInteractionMessage,
+		User:            slack.User{ID: userID},
+		Channel:         slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: channelID}}},
+		OriginalMessage: msg,
+		MessageTs:       timestamp,
+	}
+	callback.ActionCallback.AttachmentActions = []*slack.AttachmentAction{{Name: name, Type: "button", Value: value}}
+	return s.Interact(interactionURL, callback)
+}
+
+// ClickBlockButton sends the interaction of the user clicking the Block Kit button with the given action ID and value
+// of the message to the interaction endpoint.
+func (s *Slack) ClickBlockButton(interactionURL, channelID, timestamp, userID, actionID, value string) error {
+	msg, ok := s.Message(channelID, timestamp)
+	if !ok {
+		return fmt.Errorf("message %s not found in channel %s", timestamp, channelID)
+	}
+
+	callback := slack.InteractionCallback{
+		Type:      slack.InteractionTypeBlockActions,
+		TriggerID: "trigger-" + timestamp,
+		User:      slack.User{ID: userID},
+		Channel:   slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: channelID}}},
+		Message:   msg,
+		MessageTs: timestamp,
+	}
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: actionID, Value: value}}
+	return s.Interact(interactionURL, callback)
+}
+
+// Dialogs returns the dialogs opened by the bot, oldest first.
+func (s *Slack) Dialogs() []slack.Dialog {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]slack.Dialog(nil), s.dialogs...)
+}
+
+// SubmitDialog sends the submission of the dialog by the user to the interaction endpoint.
+// Returns an error if the bot rejected the submission, e.g. because of invalid input.
+func (s *Slack) SubmitDialog(interactionURL, channelID, userID string, dialog slack.Dialog, submission map[string]string) error {
+	s.mtx.Lock()
+	usr := s.users[userID]
+	s.mtx.Unlock()
+
+	callback := slack.InteractionCallback{
+		Type:       slack.InteractionTypeDialogSubmission,
+		CallbackID: dialog.CallbackID,
+		User:       slack.User{ID: userID, Name: usr.Name},
+		Channel:    slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: channelID}}},
+	}
+	callback.State = dialog.State
+	callback.Submission = submission
+
+	body, err := s.interact(interactionURL, callback)
+	if err != nil || len(body) == 0 {
+		return err
+	}
+
+	var validationErrors slack.DialogInputValidationErrors
+	if err := json.Unmarshal(body, &validationErrors); err != nil {
+		return err
+	}
+	if len(validationErrors.Errors) > 0 {
+		return fmt.Errorf("invalid %s: %s", validationErrors.Errors[0].Name, validationErrors.Errors[0].Error)
+	}
+	return nil
+}
+
+// handleRTM upgrades the connection to a websocket, greets the client and answers pings.
+func (s *Slack) handleRTM(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mtx.Lock()
+	s.rtmConns = append(s.rtmConns, conn)
+	s.mtx.Unlock()
+
+	conn.WriteJSON(map[string]string{"type": "hello"})
+	for {
+		var event struct {
+			ID   int    `json:"id"`
+			Type string `json:"type"`
+		}
+		if err := conn.ReadJSON(&event); err != nil {
+			return
+		}
+		if event.Type == "ping" {
+			conn.WriteJSON(map[string]interface{}{"type": "pong", "reply_to": event.ID})
+		}
+	}
+}
+
+// handleMethod handles the Web API methods used by pulsar.
+func (s *Slack) handleMethod(w http.ResponseWriter, r *http.Request) {
+	// Files are uploaded as multipart form.
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil && err != http.ErrNotMultipart {
+		writeJSON(w, slackError("invalid_form_data"))
+		return
+	}
+
+	token := r.Form.Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	scopes, ok := s.Scopes[token]
+	if !ok {
+		writeJSON(w, slackError("invalid_auth"))
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	if method == "auth.test" {
+		w.Header().Set("X-OAuth-Scopes", strings.Join(scopes, ","))
+	}
+
+	// dialog.open is called with a JSON body.
+	if method == "dialog.open" {
+		writeJSON(w, s.openDialog(r))
+		return
+	}
+
+	s.mtx.Lock()
+	res := s.call(method, token, r.Form)
+	s.mtx.Unlock()
+	writeJSON(w, res)
+}
+
+// call returns the response of the Web API method. The caller must hold the lock.
+func (s *Slack) call(method, token string, form url.Values) interface{} {
+	switch method {
+	case "auth.test":
+		return ok(map[string]interface{}{"user_id": SlackBotUserID, "user": "pulsar", "team": "fake", "team_id": "TFAKE"})
+
+	case "rtm.start", "rtm.connect":
+		return ok(map[string]interface{}{
+			"url":  strings.Replace(s.server.URL, "http", "ws", 1) + "/rtm",
+			"self": slack.UserDetails{ID: SlackBotUserID, Name: "pulsar"},
+			"team": slack.Team{ID: "TFAKE", Name: "fake"},
+		})
+
+	case "chat.postMessage":
+		msg, err := messageFromForm(form)
+		if err != nil {
+			return slackError("invalid_arguments")
+		}
+		if token == SlackBotToken {
+			msg.User, msg.BotID = SlackBotUserID, SlackBotID
+		}
+		ts := s.addMessage(form.Get("channel"), msg)
+		return ok(map[string]interface{}{"channel": form.Get("channel"), "ts": ts})
+
+	case "chat.postEphemeral":
+		msg, err := messageFromForm(form)
+		if err != nil {
+			return slackError("invalid_arguments")
+		}
+		msg.Timestamp = s.nextTimestamp()
+		c := s.channel(form.Get("channel"))
+		c.ephemeral = append(c.ephemeral, msg)
+		return ok(map[string]interface{}{"message_ts": msg.Timestamp})
+
+	case "chat.update":
+		existing := s.findMessage(form.Get("channel"), form.Get("ts"))
+		if existing == nil {
+			return slackError("message_not_found")
+		}
+		msg, err := messageFromForm(form)
+		if err != nil {
+			return slackError("invalid_arguments")
+		}
+		existing.Text, existing.Blocks, existing.Attachments = msg.Text, msg.Blocks, msg.Attachments
+		return ok(map[string]interface{}{"channel": form.Get("channel"), "ts": form.Get("ts"), "text": msg.Text})
+
+	case "chat.delete":
+		c := s.channel(form.Get("channel"))
+		for i, msg := range c.messages {
+			if msg.Timestamp == form.Get("ts") {
+				c.messages = append(c.messages[:i], c.messages[i+1:]...)
+				return ok(map[string]interface{}{"channel": form.Get("channel"), "ts": form.Get("ts")})
+			}
+		}
+		return slackError("message_not_found")
+
+	case "reactions.add":
+		msg := s.findMessage(form.Get("channel"), form.Get("timestamp"))
+		if msg == nil {
+			return slackError("message_not_found")
+		}
+		for _, r := range msg.Reactions {
+			if r.Name == form.Get("name") {
+				return slackError("already_reacted")
+			}
+		}
+		msg.Reactions = append(msg.Reactions, slack.ItemReaction{Name: form.Get("name"), Count: 1, Users: []string{SlackBotUserID}})
+		return ok(nil)
+
+	case "users.info":
+		if usr, found := s.users[form.Get("user")]; found {
+			return ok(map[string]interface{}{"user": usr})
+		}
+		return slackError("user_not_found")
+
+	case "users.lookupByEmail":
+		for _, usr := range s.users {
+			if usr.Profile.Email != "" && usr.Profile.Email == form.Get("email") {
+				return ok(map[string]interface{}{"user": usr})
+			}
+		}
+		return slackError("users_not_found")
+
+	case "usergroups.list":
+		return ok(map[string]interface{}{"usergroups": s.userGroups})
+
+	case "conversations.info":
+		if c, found := s.channels[form.Get("channel")]; found {
+			return ok(map[string]interface{}{"channel": c.info})
+		}
+		return slackError("channel_not_found")
+
+	case "conversations.history":
+		msgs := make([]slack.Message, 0)
+		for _, msg := range s.channel(form.Get("channel")).messages {
+			if msg.ThreadTimestamp == "" || msg.ThreadTimestamp == msg.Timestamp {
+				msg.ReplyCount = len(s.replies(form.Get("channel"), msg.Timestamp))
+				msgs = append(msgs, msg)
+			}
+		}
+		// Newest first like Slack.
+		sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Timestamp > msgs[j].Timestamp })
+		return ok(map[string]interface{}{"messages": msgs, "has_more": false})
+
+	case "conversations.replies":
+		parent := s.findMessage(form.Get("channel"), form.Get("ts"))
+		if parent == nil {
+			return slackError("thread_not_found")
+		}
+		msgs := append([]slack.Message{*parent}, s.replies(form.Get("channel"), form.Get("ts"))...)
+		return ok(map[string]interface{}{"messages": msgs, "has_more": false})
+
+	case "im.open", "conversations.open":
+		userID := form.Get("user")
+		if userID == "" {
+			userID = form.Get("users")
+		}
+		channelID, found := s.ims[userID]
+		if !found {
+			channelID = "D" + userID
+			s.ims[userID] = channelID
+			s.channel(channelID).info.IsIM = true
+		}
+		return ok(map[string]interface{}{"channel": map[string]string{"id": channelID}})
+
+	case "files.upload":
+		file := slack.File{ID: fmt.Sprintf("F%d", len(s.files)+1), Name: form.Get("filename"), Title: form.Get("title"), Preview: form.Get("content")}
+		s.files = append(s.files, file)
+		return ok(map[string]interface{}{"file": file})
+	}
+
+	return slackError("unknown_method")
+}
+
+// openDialog records the dialog of the dialog.open request.
+func (s *Slack) openDialog(r *http.Request) interface{} {
+	var trigger slack.DialogTrigger
+	if err := json.NewDecoder(r.Body).Decode(&trigger); err != nil {
+		return slackError("invalid_json")
+	}
+	if trigger.TriggerID == "" {
+		return slackError("invalid_trigger")
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	trigger.Dialog.TriggerID = trigger.TriggerID
+	s.dialogs = append(s.dialogs, trigger.Dialog)
+	return ok(nil)
+}
+
+// channel returns the channel with the given ID and creates it if it doesn't exist. The caller must hold the lock.
+func (s *Slack) channel(channelID string) *slackChannel {
+	c, found := s.channels[channelID]
+	if !found {
+		c = &slackChannel{info: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: channelID}, Name: channelID}}}
+		s.channels[channelID] = c
+	}
+	return c
+}
+
+// addMessage adds the message to the channel and returns its timestamp. The caller must hold the lock.
+func (s *Slack) addMessage(channelID string, msg slack.Message) string {
+	msg.Timestamp = s.nextTimestamp()
+	msg.Channel = channelID
+	c := s.channel(channelID)
+	c.messages = append(c.messages, msg)
+	return msg.Timestamp
+}
+
+// findMessage returns the message with the given timestamp or nil. The caller must hold the lock.
+func (s *Slack) findMessage(channelID, timestamp string) *slack.Message {
+	c := s.channel(channelID)
+	for i := range c.messages {
+		if c.messages[i].Timestamp == timestamp {
+			return &c.messages[i]
+		}
+	}
+	return nil
+}
+
+// replies returns the replies in the thread. The caller must hold the lock.
+func (s *Slack) replies(channelID, threadTimestamp string) []slack.Message {
+	res := make([]slack.Message, 0)
+	for _, msg := range s.channel(channelID).messages {
+		if msg.ThreadTimestamp == threadTimestamp && msg.Timestamp != threadTimestamp {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+// nextTimestamp returns a unique timestamp of the current time in the format used by Slack. The caller must hold the lock.
+func (s *Slack) nextTimestamp() string {
+	now := time.Now().Truncate(time.Second)
+	if !now.Equal(s.lastTS) {
+		s.lastTS, s.counter = now, 0
+	}
+	s.counter++
+	return fmt.Sprintf("%d.%06d", now.Unix(), s.counter)
+}
+
+// messageFromForm returns the message given by the parameters of chat.postMessage, chat.update or chat.postEphemeral.
+func messageFromForm(form url.Values) (slack.Message, error) {
+	msg := slack.Message{Msg: slack.Msg{
+		Type:            "message",
+		Channel:         form.Get("channel"),
+		Text:            form.Get("text"),
+		ThreadTimestamp: form.Get("thread_ts"),
+	}}
+
+	if blocks := form.Get("blocks"); blocks != "" {
+		if err := json.Unmarshal([]byte(blocks), &msg.Blocks); err != nil {
+			return msg, err
+		}
+	}
+	if attachments := form.Get("attachments"); attachments != "" {
+		if err := json.Unmarshal([]byte(attachments), &msg.Attachments); err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
+
+func ok(fields map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{"ok": true}
+	for k, v := range fields {
+		res[k] = v
+	}
+	return res
+}
+
+func slackError(err string) map[string]interface{} {
+	return map[string]interface{}{"ok": false, "error": err}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -20,6 +20,7 @@
 package slack
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
@@ -59,7 +60,7 @@ func (c *catCommand) Keywords() []string {
 	return []string{"cat", "kitty"}
 }
 
-func (c *catCommand) Run(msg *slack.Msg) (*slack.Msg, error) {
+func (c *catCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
 	resp, err := http.Get("https://api.thecatapi.com/api/images/get?format=xml&size=med&results_per_page=1")
 	if err != nil {
 		return nil, err
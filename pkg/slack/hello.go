@@ -20,6 +20,7 @@
 package slack
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 
@@ -64,7 +65,8 @@ func (h *helloCommand) Keywords() []string {
 }
 
 // Run takes the slack message triggering the command and returns a slack message containing the response.
-func (h *helloCommand) Run(msg *slack.Msg) (*slack.Msg, error) {
+// The context is cancelled when the command times out.
+func (h *helloCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
 
 	greetings := []string{
 		fmt.Sprintf("What's up <@%s>?", msg.User),
@@ -0,0 +1,376 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+const (
+	rolloutPollInterval = 10 * time.Second
+	rolloutTimeout      = 10 * time.Minute
+
+	restartWorkloadUsage = "`restart deployment|statefulset|daemonset $namespace/$name in $clusterName`"
+	scaleWorkloadUsage   = "`scale deployment|statefulset $namespace/$name --replicas $n in $clusterName`"
+	rolloutStatusUsage   = "`rollout status deployment|statefulset|daemonset $namespace/$name in $clusterName`"
+)
+
+func init() {
+	bot.RegisterCommand(func() bot.Command {
+		return &restartWorkloadCommand{}
+	})
+	bot.RegisterCommand(func() bot.Command {
+		return &scaleWorkloadCommand{}
+	})
+	bot.RegisterCommand(func() bot.Command {
+		return &rolloutStatusCommand{}
+	})
+}
+
+// workloadClient runs kubectl commands on workloads. It is implemented by *clients.K8sClient.
+type workloadClient interface {
+	RolloutRestart(ctx context.Context, kubeContext, kind, namespace, name string) (string, error)
+	Scale(ctx context.Context, kubeContext, kind, namespace, name string, replicas int) (string, error)
+	RolloutStatus(ctx context.Context, kubeContext, kind, namespace, name string) (string, bool, error)
+}
+
+// workloadCommand holds the clients shared by the commands operating on Kubernetes workloads.
+type workloadCommand struct {
+	k8sClient   workloadClient
+	slackClient *clients.SlackClient
+	logger      log.Logger
+
+	// pollInterval and timeout of tracking rollouts. Default to rolloutPollInterval and rolloutTimeout.
+	pollInterval,
+	timeout time.Duration
+
+	// trackers are the rollouts tracked by cluster and workload. Tracking stops once a newer rollout of the workload is tracked.
+	trackers    map[string]rolloutTracker
+	trackersMtx sync.Mutex
+}
+
+type rolloutTracker struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (w *workloadCommand) Init() error {
+	k8sClient, err := clients.NewK8sClientFromEnv()
+	if err != nil {
+		return err
+	}
+	w.k8sClient = k8sClient
+
+	slackClient, err := clients.NewSlackBotClientFromEnv()
+	if err != nil {
+		return err
+	}
+	w.slackClient = slackClient
+
+	w.logger = log.With(util.NewLogger(), "component", "audit")
+	return nil
+}
+
+func (w *workloadCommand) IsDisabled() bool {
+	return false
+}
+
+func (w *workloadCommand) RequiredUserRole() auth.UserRole {
+	return auth.UserRoles.KubernetesAdmin
+}
+
+// trackRollout posts the rollout status of the workload in the thread of the message
+// and updates it in the background until the rollout completed, timed out or a newer rollout of the workload is tracked.
+func (w *workloadCommand) trackRollout(msg *slack.Msg, cluster string, workload *util.Workload) error {
+	channelID := msg.Channel
+	_, timestamp, err := w.slackClient.PostMessage(
+		channelID,
+		slack.MsgOptionText(fmt.Sprintf("Waiting for rollout of %s in %s :hourglass:", workload.String(), cluster), false),
+		slack.MsgOptionTS(bot.ThreadTimestamp(msg)),
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, done := w.startTracking(cluster, workload)
+	go func() {
+		defer done()
+		w.watchRollout(ctx, channelID, timestamp, cluster, workload)
+	}()
+	return nil
+}
+
+// startTracking returns the context of tracking the rollout of the workload, which is cancelled once a newer rollout
+// of it is tracked or the timeout passed, and the function to call once tracking stopped.
+func (w *workloadCommand) startTracking(cluster string, workload *util.Workload) (context.Context, func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.trackingTimeout())
+
+	w.trackersMtx.Lock()
+	defer w.trackersMtx.Unlock()
+	if w.trackers == nil {
+		w.trackers = make(map[string]rolloutTracker)
+	}
+
+	key := fmt.Sprintf("%s/%s", cluster, workload.String())
+	if previous, ok := w.trackers[key]; ok {
+		previous.cancel()
+	}
+	w.trackers[key] = rolloutTracker{ctx: ctx, cancel: cancel}
+
+	return ctx, func() {
+		cancel()
+		w.trackersMtx.Lock()
+		defer w.trackersMtx.Unlock()
+		// A newer rollout of the workload might be tracked already.
+		if w.trackers[key].ctx == ctx {
+			delete(w.trackers, key)
+		}
+	}
+}
+
+// watchRollout polls the rollout status of the workload and updates the message until the rollout completed or the
+// context is done.
+func (w *workloadCommand) watchRollout(ctx context.Context, channelID, timestamp, cluster string, workload *util.Workload) {
+	pollInterval := w.pollInterval
+	if pollInterval <= 0 {
+		pollInterval = rolloutPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			text := fmt.Sprintf("Stopped tracking the rollout of %s in %s in favor of a newer one :arrow_down:", workload.String(), cluster)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				text = fmt.Sprintf("Rollout of %s in %s did not complete within %s :x:", workload.String(), cluster, w.trackingTimeout().String())
+			}
+			w.updateRolloutMessage(channelID, timestamp, text)
+			return
+		case <-ticker.C:
+			status, done, err := w.k8sClient.RolloutStatus(ctx, config.Regions().KubeContext(cluster), workload.Kind, workload.Namespace, workload.Name)
+			if ctx.Err() != nil {
+				continue
+			}
+			if err != nil {
+				w.updateRolloutMessage(channelID, timestamp, fmt.Sprintf("Failed to get rollout status of %s in %s :x:\n```\n%s\n```", workload.String(), cluster, err.Error()))
+				return
+			}
+
+			if done {
+				w.updateRolloutMessage(channelID, timestamp, fmt.Sprintf("Rollout of %s in %s completed :white_check_mark:\n```\n%s\n```", workload.String(), cluster, status))
+				return
+			}
+			w.updateRolloutMessage(channelID, timestamp, fmt.Sprintf("Waiting for rollout of %s in %s :hourglass:\n```\n%s\n```", workload.String(), cluster, status))
+		}
+	}
+}
+
+func (w *workloadCommand) trackingTimeout() time.Duration {
+	if w.timeout <= 0 {
+		return rolloutTimeout
+	}
+	return w.timeout
+}
+
+func (w *workloadCommand) updateRolloutMessage(channelID, timestamp, text string) {
+	if _, _, _, err := w.slackClient.UpdateMessage(channelID, timestamp, slack.MsgOptionText(text, false)); err != nil {
+		level.Error(w.logger).Log("msg", "failed to update rollout status message", "err", err.Error())
+	}
+}
+
+type restartWorkloadCommand struct {
+	workloadCommand
+}
+
+func (r *restartWorkloadCommand) Describe() string {
+	return "Restart a workload: restart deployment $namespace/$name in $clusterName."
+}
+
+func (r *restartWorkloadCommand) Keywords() []string {
+	return []string{"restart deployment", "restart statefulset", "restart daemonset"}
+}
+
+func (r *restartWorkloadCommand) Examples() []string {
+	return []string{"restart deployment kube-system/coredns in eu-de-1"}
+}
+
+func (r *restartWorkloadCommand) DescribeAction(msg *slack.Msg) (string, error) {
+	workload, cluster, err := parseWorkloadAndCluster(msg.Text, restartWorkloadUsage)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("restart %s in %s", workload.String(), cluster), nil
+}
+
+// ApproverRole returns no role as restarts only need the confirmation of the requester.
+func (r *restartWorkloadCommand) ApproverRole() auth.UserRole {
+	return ""
+}
+
+func (r *restartWorkloadCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	workload, cluster, err := parseWorkloadAndCluster(msg.Text, restartWorkloadUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.k8sClient.RolloutRestart(ctx, config.Regions().KubeContext(cluster), workload.Kind, workload.Namespace, workload.Name)
+	if err != nil {
+		return nil, err
+	}
+	level.Info(r.logger).Log("msg", "executed", "userID", msg.User, "action", fmt.Sprintf("restart %s in %s", workload.String(), cluster))
+
+	if err := r.trackRollout(msg, cluster, workload); err != nil {
+		return nil, err
+	}
+
+	return &slack.Msg{Text: fmt.Sprintf("```\n%s\n```", strings.TrimSpace(res))}, nil
+}
+
+type scaleWorkloadCommand struct {
+	workloadCommand
+}
+
+func (s *scaleWorkloadCommand) Describe() string {
+	return "Scale a workload: scale $kind $namespace/$name --replicas $n in $clusterName."
+}
+
+func (s *scaleWorkloadCommand) Keywords() []string {
+	return []string{"scale"}
+}
+
+func (s *scaleWorkloadCommand) Examples() []string {
+	return []string{"scale deployment kube-system/coredns --replicas 3 in eu-de-1"}
+}
+
+func (s *scaleWorkloadCommand) DescribeAction(msg *slack.Msg) (string, error) {
+	workload, cluster, replicas, err := parseScale(msg.Text)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("scale %s in %s to %d replicas", workload.String(), cluster, replicas), nil
+}
+
+// ApproverRole requires a second admin to approve scaling since scaling down may cause an outage.
+func (s *scaleWorkloadCommand) ApproverRole() auth.UserRole {
+	return auth.UserRoles.KubernetesAdmin
+}
+
+func (s *scaleWorkloadCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	workload, cluster, replicas, err := parseScale(msg.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.k8sClient.Scale(ctx, config.Regions().KubeContext(cluster), workload.Kind, workload.Namespace, workload.Name, replicas)
+	if err != nil {
+		return nil, err
+	}
+	level.Info(s.logger).Log("msg", "executed", "userID", msg.User, "action", fmt.Sprintf("scale %s in %s to %d replicas", workload.String(), cluster, replicas))
+
+	if err := s.trackRollout(msg, cluster, workload); err != nil {
+		return nil, err
+	}
+
+	return &slack.Msg{Text: fmt.Sprintf("```\n%s\n```", strings.TrimSpace(res))}, nil
+}
+
+func parseScale(text string) (*util.Workload, string, int, error) {
+	workload, cluster, err := parseWorkloadAndCluster(text, scaleWorkloadUsage)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	// Daemonsets run one pod per node and cannot be scaled.
+	if workload.Kind == "daemonset" {
+		return nil, "", 0, &bot.UsageError{Err: errors.New("daemonsets cannot be scaled"), Usage: scaleWorkloadUsage}
+	}
+
+	replicas, err := util.ParseReplicasFromString(text)
+	if err != nil {
+		return nil, "", 0, &bot.UsageError{Err: err, Usage: scaleWorkloadUsage}
+	}
+	return workload, cluster, replicas, nil
+}
+
+type rolloutStatusCommand struct {
+	workloadCommand
+}
+
+func (r *rolloutStatusCommand) Describe() string {
+	return "Track a rollout: rollout status $kind $namespace/$name in $clusterName."
+}
+
+func (r *rolloutStatusCommand) Keywords() []string {
+	return []string{"rollout status"}
+}
+
+func (r *rolloutStatusCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	workload, cluster, err := parseWorkloadAndCluster(msg.Text, rolloutStatusUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The status message is posted and updated by the tracker.
+	return nil, r.trackRollout(msg, cluster, workload)
+}
+
+// parseWorkloadAndCluster parses text of the form `... <kind> <namespace>/<name> ... in <cluster>`.
+// A *bot.UsageError with the given usage is returned if the text is invalid.
+func parseWorkloadAndCluster(text, usage string) (*util.Workload, string, error) {
+	idx := strings.LastIndex(text, " in ")
+	if idx < 0 {
+		return nil, "", &bot.UsageError{Err: errors.New("missing cluster"), Usage: usage}
+	}
+
+	workload, err := util.ParseWorkloadFromString(text[:idx])
+	if err != nil {
+		return nil, "", &bot.UsageError{Err: err, Usage: usage}
+	}
+
+	regions := config.Regions()
+	clusters, err := regions.Parse(text[idx:])
+	if err == config.ErrNoRegion {
+		err = errors.New("missing cluster")
+		if known := regions.Names(); len(known) > 0 {
+			err = fmt.Errorf("unknown cluster '%s'. known regions are %s", strings.TrimSpace(text[idx+len(" in "):]), strings.Join(known, ", "))
+		}
+	}
+	if err != nil {
+		return nil, "", &bot.UsageError{Err: err, Usage: usage}
+	}
+
+	// Just the first cluster.
+	return workload, clusters[0], nil
+}
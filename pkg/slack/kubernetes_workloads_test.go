@@ -0,0 +1,182 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const workloadChannelID = "CK8S"
+
+// fakeWorkloadClient records the kubectl commands and returns the given rollout statuses in order.
+// The last status is repeated. A status containing "rolled out" completes the rollout.
+type fakeWorkloadClient struct {
+	mtx      sync.Mutex
+	calls    []string
+	statuses []string
+}
+
+func (f *fakeWorkloadClient) RolloutRestart(ctx context.Context, kubeContext, kind, namespace, name string) (string, error) {
+	f.record("--context %s --namespace %s rollout restart %s/%s", kubeContext, namespace, kind, name)
+	return fmt.Sprintf("%s.apps/%s restarted\n", kind, name), nil
+}
+
+func (f *fakeWorkloadClient) Scale(ctx context.Context, kubeContext, kind, namespace, name string, replicas int) (string, error) {
+	f.record("--context %s --namespace %s scale %s/%s --replicas=%d", kubeContext, namespace, kind, name, replicas)
+	return fmt.Sprintf("%s.apps/%s scaled\n", kind, name), nil
+}
+
+func (f *fakeWorkloadClient) RolloutStatus(ctx context.Context, kubeContext, kind, namespace, name string) (string, bool, error) {
+	f.record("--context %s --namespace %s rollout status %s/%s", kubeContext, namespace, kind, name)
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	status := f.statuses[0]
+	if len(f.statuses) > 1 {
+		f.statuses = f.statuses[1:]
+	}
+	return status, strings.Contains(status, "rolled out"), nil
+}
+
+func (f *fakeWorkloadClient) record(format string, args ...interface{}) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeWorkloadClient) Calls() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// newTestWorkloadCommand sets up the workloadCommand to use the fake client and track rollouts every few milliseconds.
+func newTestWorkloadCommand(t *testing.T, w *workloadCommand, statuses ...string) (*fake.Slack, *fakeWorkloadClient) {
+	useRegions(t, "regions:\n- name: eu-de-1\n  kubeContext: k8s-eu-de-1\n")
+	fakeSlack, slackClient := newTestSlackClient(t)
+	fakeSlack.AddChannel(workloadChannelID, "k8s")
+
+	k8sClient := &fakeWorkloadClient{statuses: statuses}
+	w.k8sClient = k8sClient
+	w.slackClient = slackClient
+	w.logger = log.NewNopLogger()
+	w.pollInterval = 5 * time.Millisecond
+	w.timeout = time.Second
+	return fakeSlack, k8sClient
+}
+
+// sendCommand posts the command in the channel like a user and returns the message passed to the command.
+func sendCommand(fakeSlack *fake.Slack, text string) *slack.Msg {
+	ts := fakeSlack.SendMessage(workloadChannelID, "", "UALICE", text)
+	return &slack.Msg{Channel: workloadChannelID, Timestamp: ts, User: "UALICE", Text: text}
+}
+
+// hasRolloutReply returns whether the only reply in the thread of the message contains the text.
+func hasRolloutReply(fakeSlack *fake.Slack, msg *slack.Msg, text string) bool {
+	replies := fakeSlack.Replies(workloadChannelID, msg.Timestamp)
+	return len(replies) == 1 && strings.Contains(replies[0].Text, text)
+}
+
+func TestRestartWorkload(t *testing.T) {
+	r := &restartWorkloadCommand{}
+	fakeSlack, k8sClient := newTestWorkloadCommand(t, &r.workloadCommand, "Waiting for deployment \"coredns\" rollout to finish: 1 of 2 updated replicas are available...", "deployment \"coredns\" successfully rolled out")
+
+	msg := sendCommand(fakeSlack, "restart deployment kube-system/coredns in eu-de-1")
+	res, err := r.Run(context.Background(), msg)
+	require.NoError(t, err, "there should be no error restarting the workload")
+	assert.Equal(t, "```\ndeployment.apps/coredns restarted\n```", res.Text)
+
+	assert.Eventually(t, func() bool {
+		return hasRolloutReply(fakeSlack, msg, "Rollout of deployment kube-system/coredns in eu-de-1 completed :white_check_mark:")
+	}, time.Second, 10*time.Millisecond, "the completed rollout should be posted in the thread")
+	assert.Equal(t, []string{
+		"--context k8s-eu-de-1 --namespace kube-system rollout restart deployment/coredns",
+		"--context k8s-eu-de-1 --namespace kube-system rollout status deployment/coredns",
+		"--context k8s-eu-de-1 --namespace kube-system rollout status deployment/coredns",
+	}, k8sClient.Calls(), "the status should be polled until the rollout completed")
+}
+
+func TestScaleWorkload(t *testing.T) {
+	s := &scaleWorkloadCommand{}
+	fakeSlack, k8sClient := newTestWorkloadCommand(t, &s.workloadCommand, "statefulset rolling update complete 3 pods at revision 1... successfully rolled out")
+
+	msg := sendCommand(fakeSlack, "scale sts monitoring/prometheus --replicas 3 in eu-de-1")
+	res, err := s.Run(context.Background(), msg)
+	require.NoError(t, err, "there should be no error scaling the workload")
+	assert.Equal(t, "```\nstatefulset.apps/prometheus scaled\n```", res.Text)
+	assert.Eventually(t, func() bool {
+		return hasRolloutReply(fakeSlack, msg, "completed :white_check_mark:")
+	}, time.Second, 10*time.Millisecond, "the completed rollout should be posted in the thread")
+	assert.Equal(t, "--context k8s-eu-de-1 --namespace monitoring scale statefulset/prometheus --replicas=3", k8sClient.Calls()[0])
+
+	_, err = s.Run(context.Background(), sendCommand(fakeSlack, "scale daemonset kube-system/kube-proxy --replicas 3 in eu-de-1"))
+	var usageErr *bot.UsageError
+	if assert.ErrorAs(t, err, &usageErr, "scaling a daemonset should be a usage error") {
+		assert.EqualError(t, usageErr.Err, "daemonsets cannot be scaled")
+	}
+	for _, call := range k8sClient.Calls() {
+		assert.NotContains(t, call, "kube-proxy", "daemonsets should not be scaled")
+	}
+}
+
+func TestRolloutStatus(t *testing.T) {
+	r := &rolloutStatusCommand{}
+	fakeSlack, k8sClient := newTestWorkloadCommand(t, &r.workloadCommand, "Waiting for daemon set \"kube-proxy\" rollout to finish: 1 of 3 updated pods are available...")
+	r.timeout = 100 * time.Millisecond
+
+	msg := sendCommand(fakeSlack, "rollout status daemonset kube-system/kube-proxy in eu-de-1")
+	res, err := r.Run(context.Background(), msg)
+	require.NoError(t, err, "there should be no error tracking the rollout")
+	assert.Nil(t, res, "the status should be posted by the tracker only")
+	assert.Eventually(t, func() bool {
+		return hasRolloutReply(fakeSlack, msg, "1 of 3 updated pods are available")
+	}, time.Second, 5*time.Millisecond, "the status should be posted in the thread")
+
+	// Tracking the workload again stops tracking it in the previous message.
+	again := sendCommand(fakeSlack, "rollout status ds kube-system/kube-proxy in eu-de-1")
+	_, err = r.Run(context.Background(), again)
+	require.NoError(t, err, "there should be no error tracking the rollout again")
+	assert.Eventually(t, func() bool {
+		return hasRolloutReply(fakeSlack, msg, "Stopped tracking the rollout of daemonset kube-system/kube-proxy in eu-de-1")
+	}, time.Second, 10*time.Millisecond, "the previous tracker should be stopped")
+
+	assert.Eventually(t, func() bool {
+		return hasRolloutReply(fakeSlack, again, "Rollout of daemonset kube-system/kube-proxy in eu-de-1 did not complete within 100ms :x:")
+	}, time.Second, 10*time.Millisecond, "tracking should stop after the timeout")
+
+	// No tracker polls once all stopped.
+	calls := len(k8sClient.Calls())
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, k8sClient.Calls(), calls, "the status should not be polled after tracking stopped")
+	r.trackersMtx.Lock()
+	defer r.trackersMtx.Unlock()
+	assert.Empty(t, r.trackers, "stopped trackers should be forgotten")
+}
@@ -20,12 +20,14 @@
 package slack
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/nlopes/slack"
 	"github.com/sapcc/pulsar/pkg/auth"
 	"github.com/sapcc/pulsar/pkg/bot"
 	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
 	"github.com/sapcc/pulsar/pkg/util"
 )
 
@@ -36,7 +38,8 @@ func init() {
 }
 
 type listNodesCommand struct {
-	k8sClient *clients.K8sClient
+	k8sClient   *clients.K8sClient
+	slackClient *clients.SlackClient
 }
 
 func (l *listNodesCommand) Init() error {
@@ -45,6 +48,12 @@ func (l *listNodesCommand) Init() error {
 		return err
 	}
 	l.k8sClient = k8sClient
+
+	slackClient, err := clients.NewSlackBotClientFromEnv()
+	if err != nil {
+		return err
+	}
+	l.slackClient = slackClient
 	return nil
 }
 
@@ -60,30 +69,41 @@ func (l *listNodesCommand) Keywords() []string {
 	return []string{"list nodes", "show nodes"}
 }
 
-func (l *listNodesCommand) RequiredUserRole() auth.UserRole {
-	return auth.UserRoles.KubernetesUser
+// RateLimit limits the kubectl calls.
+func (l *listNodesCommand) RateLimit() int {
+	return 10
 }
 
-func (l *listNodesCommand) Run(msg *slack.Msg) (*slack.Msg, error) {
-	clusters, err := util.ParseClusterFromString(msg.Text)
-	if err != nil {
-		return nil, err
+func (l *listNodesCommand) Arguments() []bot.Argument {
+	return []bot.Argument{
+		{Name: "cluster", Type: bot.ArgCluster, Positional: true, Required: true},
 	}
+}
+
+func (l *listNodesCommand) Examples() []string {
+	return []string{"list nodes eu-de-1"}
+}
 
-	// Just the first cluster.
-	clusterName := clusters[0]
+func (l *listNodesCommand) RequiredUserRole() auth.UserRole {
+	return auth.UserRoles.KubernetesUser
+}
 
-	if err := l.k8sClient.SetContext(clusterName); err != nil {
+func (l *listNodesCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	args, err := bot.ParseArguments(l, msg.Text)
+	if err != nil {
 		return nil, err
 	}
+	clusterName := args.String("cluster")
 
-	res, err := l.k8sClient.ListNodes()
+	res, err := l.k8sClient.ListNodes(ctx, config.Regions().KubeContext(clusterName))
 	if err != nil {
 		return nil, err
 	}
 
-	return &slack.Msg{
-		Type: slack.MarkdownType,
-		Text: fmt.Sprintf("I found the following nodes in %s:\n```\n%s\n```", clusterName, res),
-	}, nil
+	header, rows := util.ParseColumnsFromString(res)
+	table := util.NewTable(fmt.Sprintf("I found the following nodes in %s:", clusterName), header...)
+	for _, row := range rows {
+		table.AddRow(row...)
+	}
+	return table.Respond(l.slackClient, msg.Channel, bot.ThreadTimestamp(msg))
 }
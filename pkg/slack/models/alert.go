@@ -0,0 +1,243 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package models
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	// ActionIDAlertAcknowledge is the action id of the button acknowledging the incident of an alert group.
+	ActionIDAlertAcknowledge = "alertAcknowledgeID"
+
+	// actionIDAlertRunbook is the action id of the button linking the runbook. Slack opens the link itself.
+	actionIDAlertRunbook = "alertRunbookID"
+
+	// AlertStatusFiring and AlertStatusResolved are the states of alerts and alert groups.
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+
+	// alertGroupBlockIDPrefix prefixes the key of the alert group in the ID of the first block of its message.
+	alertGroupBlockIDPrefix = "alertGroup|"
+	alertFingerprintBlockID = "alertFingerprints"
+
+	alertListSize = 10
+
+	emojiFire = ":fire:"
+
+	statusResolved = "RESOLVED"
+)
+
+// AlertGroup is a notification of the Alertmanager webhook for a group of alerts.
+// Every notification contains all alerts of the group, so the message can be rendered from the latest one.
+type AlertGroup struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// Alert is a single alert of an AlertGroup.
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Key returns the hash of the group key. The Alertmanager uses it as dedup key of PagerDuty incidents,
+// so it equals the incident key of the incident of the group.
+func (g *AlertGroup) Key() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(g.GroupKey)))
+}
+
+// IsResolved returns whether all alerts of the group are resolved.
+func (g *AlertGroup) IsResolved() bool {
+	return g.Status == AlertStatusResolved
+}
+
+// Alertname returns the name of the alerts of the group.
+func (g *AlertGroup) Alertname() string {
+	if name := g.GroupLabels["alertname"]; name != "" {
+		return name
+	}
+	if name := g.CommonLabels["alertname"]; name != "" {
+		return name
+	}
+	return "Alerts"
+}
+
+// Region returns the region of the alerts of the group or an empty string if they are from several regions.
+func (g *AlertGroup) Region() string {
+	return regionOf(g.CommonLabels)
+}
+
+// Fingerprints returns the sorted fingerprints of the alerts of the group.
+func (g *AlertGroup) Fingerprints() []string {
+	res := make([]string, 0, len(g.Alerts))
+	for _, a := range g.Alerts {
+		res = append(res, a.Fingerprint)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Summary returns the summary of the alert, falling back to its description and name.
+func (a *Alert) Summary() string {
+	for _, key := range []string{"summary", "description"} {
+		if s := a.Annotations[key]; s != "" {
+			return s
+		}
+	}
+	return a.Labels["alertname"]
+}
+
+// ToSlackMessage renders the group as message listing the firing and resolved alerts.
+// The first block carries the key of the group so the message can be found again. Buttons are only shown while alerts are firing.
+func (g *AlertGroup) ToSlackMessage() *slack.Msg {
+	firing, resolved := make([]Alert, 0), make([]Alert, 0)
+	for _, a := range g.Alerts {
+		if a.Status == AlertStatusResolved {
+			resolved = append(resolved, a)
+		} else {
+			firing = append(firing, a)
+		}
+	}
+
+	emoji, status := emojiFire, fmt.Sprintf("FIRING:%d", len(firing))
+	if g.IsResolved() {
+		emoji, status = emojiGreenCheckmark, statusResolved
+	}
+
+	title := fmt.Sprintf("*[%s] %s*", status, g.Alertname())
+	if region := g.Region(); region != "" {
+		title += fmt.Sprintf(" `%s`", region)
+	}
+	if s := g.CommonAnnotations["summary"]; s != "" {
+		title += "\n" + s
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("%s %s", emoji, title), false, false),
+			nil, nil,
+			slack.SectionBlockOptionBlockID(alertGroupBlockIDPrefix+g.Key()),
+		),
+	}
+	if len(firing) > 0 {
+		blocks = appendTextSectionBlock(blocks, "*Firing*\n"+alertLines(firing, g.TruncatedAlerts))
+	}
+	if len(resolved) > 0 {
+		blocks = appendTextSectionBlock(blocks, "*Resolved*\n"+alertLines(resolved, 0))
+	}
+
+	blocks = append(blocks, slack.NewContextBlock(alertFingerprintBlockID,
+		slack.NewTextBlockObject(slack.MarkdownType, "Fingerprints: "+strings.Join(g.Fingerprints(), ", "), false, false),
+	))
+
+	if !g.IsResolved() {
+		actionBlock := slack.NewActionBlock("")
+		actionBlock.Elements.ElementSet = append(actionBlock.Elements.ElementSet,
+			slack.NewButtonBlockElement(ActionIDAlertAcknowledge, g.Key(), slack.NewTextBlockObject(slack.PlainTextType, "Acknowledge", true, false)),
+			NewSilenceButton(g.silenceMatchers()),
+		)
+		if url := g.CommonAnnotations["runbook_url"]; url != "" {
+			runbook := slack.NewButtonBlockElement(actionIDAlertRunbook, "", slack.NewTextBlockObject(slack.PlainTextType, "Runbook", true, false))
+			runbook.URL = url
+			actionBlock.Elements.ElementSet = append(actionBlock.Elements.ElementSet, runbook)
+		}
+		blocks = append(blocks, actionBlock)
+	}
+
+	blockMsg := slack.NewBlockMessage(blocks...)
+	blockMsg.Msg.Text = g.fallbackText(status)
+	return &blockMsg.Msg
+}
+
+// fallbackText returns the text shown in notifications in the format `[STATUS] [REGION] alertname - summary`.
+func (g *AlertGroup) fallbackText(status string) string {
+	text := fmt.Sprintf("[%s]", status)
+	if region := g.Region(); region != "" {
+		text += fmt.Sprintf(" [%s]", strings.ToUpper(region))
+	}
+	text += " " + g.Alertname()
+	if s := g.CommonAnnotations["summary"]; s != "" {
+		text += " - " + s
+	}
+	return text
+}
+
+// AlertGroupKey returns the key of the alert group whose notification is the message and whether it is one.
+func AlertGroupKey(message *slack.Message) (string, bool) {
+	for _, block := range message.Blocks.BlockSet {
+		if section, ok := block.(*slack.SectionBlock); ok && strings.HasPrefix(section.BlockID, alertGroupBlockIDPrefix) {
+			return strings.TrimPrefix(section.BlockID, alertGroupBlockIDPrefix), true
+		}
+	}
+	return "", false
+}
+
+// IsResolvedAlertGroup returns whether the message is the notification of a resolved alert group.
+func IsResolvedAlertGroup(message *slack.Message) bool {
+	return strings.HasPrefix(message.Text, fmt.Sprintf("[%s]", statusResolved))
+}
+
+// alertLines lists up to alertListSize alerts with their region and summary.
+func alertLines(alerts []Alert, truncated int) string {
+	lines := make([]string, 0, alertListSize+1)
+	for i, a := range alerts {
+		if i == alertListSize {
+			break
+		}
+		line := "• "
+		if region := regionOf(a.Labels); region != "" {
+			line += fmt.Sprintf("`%s` ", region)
+		}
+		lines = append(lines, line+a.Summary())
+	}
+
+	if more := len(alerts) + truncated - len(lines); more > 0 {
+		lines = append(lines, fmt.Sprintf("… and %d more", more))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// regionOf returns the region or, if there is none, the cluster label.
+func regionOf(labels map[string]string) string {
+	if region := labels["region"]; region != "" {
+		return region
+	}
+	return labels["cluster"]
+}
@@ -36,6 +36,9 @@ const (
 
 	statusOpen   = "open"
 	statusClosed = "closed"
+
+	// ActionIDPage is the action id of the button paging the on-call for the incident.
+	ActionIDPage = "pageID"
 )
 
 type Incident struct {
@@ -110,9 +113,10 @@ func (i *Incident) ToSlackMessage() *slack.Msg {
 	blocks = appendActionSectionBlock(blocks,
 		newIncidentAction("closeID", "Close", "close"),
 		newIncidentAction("editID", "Edit", "edit"),
-		newIncidentAction("pageID", "Page on-call", "page"),
+		newIncidentAction(ActionIDPage, "Page on-call", "page"),
 	)
 
 	blockMsg := slack.NewBlockMessage(blocks...)
+	blockMsg.Msg.Text = i.title
 	return &blockMsg.Msg
 }
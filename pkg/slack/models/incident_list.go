@@ -0,0 +1,161 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+const (
+	// GroupByRegion groups incidents by the region parsed from their summary.
+	GroupByRegion = "region"
+	// GroupByService groups incidents by their PagerDuty service.
+	GroupByService = "service"
+
+	incidentListPageSize = 10
+	groupUnknown         = "unknown"
+
+	emojiTriggered    = ":red_circle:"
+	emojiAcknowledged = ":large_orange_circle:"
+	emojiResolved     = ":large_green_circle:"
+)
+
+// NewIncidentTable returns the table listing the PagerDuty incidents in pages.
+// Grouped incidents are sorted by their group, which is shown in the first column, keeping their order within a group.
+func NewIncidentTable(incidents []pagerduty.Incident, groupBy string) *util.Table {
+	title := fmt.Sprintf("%d incident(s)", len(incidents))
+	if groupBy == "" {
+		t := util.NewTable(title, "Incident", "Details")
+		t.PageSize = incidentListPageSize
+		for _, inc := range incidents {
+			t.AddRow(incidentLink(inc), incidentDetails(inc))
+		}
+		return t
+	}
+
+	sorted := append([]pagerduty.Incident(nil), incidents...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return incidentGroup(sorted[i], groupBy) < incidentGroup(sorted[j], groupBy)
+	})
+
+	groupHeader := "Region"
+	if groupBy == GroupByService {
+		groupHeader = "Service"
+	}
+
+	t := util.NewTable(title, groupHeader, "Incident")
+	t.PageSize = incidentListPageSize
+	for _, inc := range sorted {
+		t.AddRow(incidentGroup(inc, groupBy), incidentToString(inc))
+	}
+	return t
+}
+
+// ParseIncidentListQuery parses the filter and grouping from a text like `list incidents acknowledged urgency=high group=service`.
+func ParseIncidentListQuery(theString string) (*clients.Filter, string, error) {
+	var (
+		groupBy string
+		rest    = make([]string, 0)
+	)
+
+	for _, field := range strings.Fields(theString) {
+		key, value, isPair := strings.Cut(field, "=")
+		if !isPair || strings.ToLower(key) != "group" {
+			rest = append(rest, field)
+			continue
+		}
+
+		groupBy = strings.ToLower(value)
+		if groupBy != GroupByRegion && groupBy != GroupByService {
+			return nil, "", fmt.Errorf("cannot group by '%s'. use group=%s or group=%s", value, GroupByRegion, GroupByService)
+		}
+	}
+
+	f, err := clients.NewFilterFromText(strings.Join(rest, " "))
+	if err != nil {
+		return nil, "", err
+	}
+	return f, groupBy, nil
+}
+
+func incidentGroup(inc pagerduty.Incident, groupBy string) string {
+	var group string
+	switch groupBy {
+	case GroupByRegion:
+		group, _, _ = clients.ParseRegionAndAlertnameFromText(inc.Summary)
+	case GroupByService:
+		group = inc.Service.Summary
+	}
+
+	if group == "" {
+		return groupUnknown
+	}
+	return group
+}
+
+func incidentToString(inc pagerduty.Incident) string {
+	return incidentLink(inc) + "\n" + incidentDetails(inc)
+}
+
+func incidentLink(inc pagerduty.Incident) string {
+	return fmt.Sprintf("<%s|#%d %s>", inc.HTMLURL, inc.IncidentNumber, inc.Title)
+}
+
+// incidentDetails returns the status, urgency, priority, assignees, service and creation time of the incident.
+func incidentDetails(inc pagerduty.Incident) string {
+	details := []string{statusEmoji(inc.Status) + " " + inc.Status, inc.Urgency}
+
+	if inc.Priority != nil && inc.Priority.Name != "" {
+		details = append(details, inc.Priority.Name)
+	}
+
+	assignees := make([]string, 0)
+	for _, a := range inc.Assignments {
+		assignees = append(assignees, a.Assignee.Summary)
+	}
+	if len(assignees) > 0 {
+		details = append(details, strings.Join(assignees, ", "))
+	}
+
+	if inc.Service.Summary != "" {
+		details = append(details, inc.Service.Summary)
+	}
+
+	details = append(details, util.HumanizeTimestamp(util.StringToTimestamp(inc.CreatedAt)))
+	return strings.Join(details, " | ")
+}
+
+func statusEmoji(status string) string {
+	switch status {
+	case clients.IncidentStatusTriggered:
+		return emojiTriggered
+	case clients.IncidentStatusAcknowledged:
+		return emojiAcknowledged
+	case clients.IncidentStatusResolved:
+		return emojiResolved
+	}
+	return ""
+}
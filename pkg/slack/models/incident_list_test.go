@@ -0,0 +1,88 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIncident(number uint, title, service string) pagerduty.Incident {
+	inc := pagerduty.Incident{
+		IncidentNumber: number,
+		Title:          title,
+		Status:         "triggered",
+		Urgency:        "high",
+		Service:        pagerduty.APIObject{Summary: service},
+	}
+	inc.Summary = fmt.Sprintf("[#%d] %s", number, title)
+	return inc
+}
+
+func TestIncidentTable(t *testing.T) {
+	incidents := []pagerduty.Incident{
+		newIncident(1, "[AP-JP-1] CinderApiDown", "storage"),
+		newIncident(2, "[EU-DE-1] CinderApiDown", "storage"),
+		newIncident(3, "[EU-DE-1] NovaApiDown", "compute"),
+	}
+
+	table := NewIncidentTable(incidents, "")
+	assert.Equal(t, "3 incident(s)", table.Title)
+	assert.Equal(t, []string{"Incident", "Details"}, table.Header)
+	assert.Len(t, table.Rows, 3)
+	assert.Equal(t, "<|#1 [AP-JP-1] CinderApiDown>", table.Rows[0][0])
+	assert.Contains(t, table.Rows[0][1], ":red_circle: triggered | high | storage")
+
+	table = NewIncidentTable(incidents, GroupByService)
+	assert.Equal(t, []string{"Service", "Incident"}, table.Header)
+	groups := make([]string, 0)
+	for _, row := range table.Rows {
+		groups = append(groups, row[0])
+	}
+	assert.Equal(t, []string{"compute", "storage", "storage"}, groups, "incidents should be sorted by group")
+	assert.Contains(t, table.Rows[0][1], "#3 [EU-DE-1] NovaApiDown")
+	assert.Contains(t, table.Rows[1][1], "#1 [AP-JP-1] CinderApiDown", "the order within a group should be kept")
+	assert.Equal(t, uint(1), incidents[0].IncidentNumber, "the given incidents should not be reordered")
+}
+
+func TestIncidentTablePagination(t *testing.T) {
+	incidents := make([]pagerduty.Incident, 0)
+	for i := uint(1); i <= 25; i++ {
+		incidents = append(incidents, newIncident(i, "[EU-DE-1] NovaApiDown", "compute"))
+	}
+
+	table := NewIncidentTable(incidents, "")
+	assert.Equal(t, 3, table.Pages())
+
+	msg, err := table.Respond(nil, "C1", "1.0")
+	assert.NoError(t, err)
+	actions := msg.Blocks.BlockSet[len(msg.Blocks.BlockSet)-1].(*slack.ActionBlock)
+	next := actions.Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	assert.Equal(t, util.ActionIDTablePage, next.ActionID)
+
+	page, err := util.TablePageFromValue(next.Value)
+	assert.NoError(t, err)
+	assert.Contains(t, page.Blocks.BlockSet[0].(*slack.SectionBlock).Text.Text, "(page 2/3)")
+}
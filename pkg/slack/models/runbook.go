@@ -0,0 +1,76 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+)
+
+// NewRunbookMessage returns the message linking the runbook of the alert and listing its checklist.
+// The alertname is optional.
+func NewRunbookMessage(alertname string, runbook config.Runbook) *slack.Msg {
+	text := ":book: Runbook"
+	if alertname != "" {
+		text += fmt.Sprintf(" for *%s*", alertname)
+	}
+	if runbook.URL != "" {
+		text += ": " + runbook.URL
+	}
+	for _, step := range runbook.Checklist {
+		text += "\n• " + step
+	}
+	return &slack.Msg{Text: text}
+}
+
+// AlertGroupRunbook returns the labels of the alert group whose notification is the message and the URL of its
+// runbook button. The labels are taken from the silence button, so resolved groups have none.
+func AlertGroupRunbook(message *slack.Message) (labels map[string]string, runbookURL string) {
+	labels = make(map[string]string)
+	for _, block := range message.Blocks.BlockSet {
+		actionBlock, ok := block.(*slack.ActionBlock)
+		if !ok {
+			continue
+		}
+		for _, element := range actionBlock.Elements.ElementSet {
+			button, ok := element.(*slack.ButtonBlockElement)
+			if !ok {
+				continue
+			}
+			switch button.ActionID {
+			case ActionIDAlertSilence:
+				matchers, err := clients.ParseMatchers(button.Value)
+				if err != nil {
+					continue
+				}
+				for _, m := range matchers {
+					labels[m.Name] = m.Value
+				}
+			case actionIDAlertRunbook:
+				runbookURL = strings.TrimSpace(button.URL)
+			}
+		}
+	}
+	return labels, runbookURL
+}
@@ -0,0 +1,141 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/clients"
+)
+
+const (
+	// ActionIDAlertSilence is the action id of the button opening the silence dialog. Its value are the matchers.
+	ActionIDAlertSilence = "alertSilenceID"
+
+	// ActionIDSilenceExpire is the action id of the button expiring a silence.
+	ActionIDSilenceExpire = "silenceExpireID"
+
+	// CallbackIDSilence is the callback id of the silence dialog.
+	CallbackIDSilence = "silenceDialog"
+
+	// SilenceMatchers, SilenceDuration and SilenceComment are the names of the elements of the silence dialog.
+	SilenceMatchers = "matchers"
+	SilenceDuration = "duration"
+	SilenceComment  = "comment"
+
+	defaultSilenceDuration = "2h"
+
+	// maxButtonValueLength is the maximum length of the value of a button accepted by Slack.
+	maxButtonValueLength = 2000
+
+	silenceValueSeparator = "|"
+)
+
+// NewSilenceButton returns the button opening the silence dialog prefilled with the matchers.
+func NewSilenceButton(matchers []clients.Matcher) *slack.ButtonBlockElement {
+	return slack.NewButtonBlockElement(ActionIDAlertSilence, clients.FormatMatchers(matchers), slack.NewTextBlockObject(slack.PlainTextType, "Silence", true, false))
+}
+
+// NewSilencePrompt returns the message with the button opening the silence dialog.
+// Dialogs can only be opened in response to an interaction, so commands post this prompt instead.
+func NewSilencePrompt(matchers []clients.Matcher) *slack.Msg {
+	text := fmt.Sprintf("Silence alerts matching:\n```\n%s\n```", clients.FormatMatchers(matchers))
+	blockMsg := slack.NewBlockMessage(
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		slack.NewActionBlock("", NewSilenceButton(matchers)),
+	)
+	blockMsg.Msg.Text = text
+	return &blockMsg.Msg
+}
+
+// NewSilenceDialog returns the dialog creating a silence prefilled with the matchers.
+// The state is passed back with the submission.
+func NewSilenceDialog(matchers, state string) slack.Dialog {
+	matchersInput := slack.NewTextAreaInput(SilenceMatchers, "Matchers", matchers)
+	matchersInput.Hint = "One name=value per line. The region label selects the Alertmanager."
+
+	durationInput := slack.NewTextInput(SilenceDuration, "Duration", defaultSilenceDuration)
+	durationInput.Hint = "For example 30m, 2h or 24h."
+
+	commentInput := slack.NewTextAreaInput(SilenceComment, "Comment", "")
+	commentInput.Placeholder = "Why are the alerts silenced?"
+
+	return slack.Dialog{
+		CallbackID:  CallbackIDSilence,
+		State:       state,
+		Title:       "Silence alerts",
+		SubmitLabel: "Silence",
+		Elements:    []slack.DialogElement{matchersInput, durationInput, commentInput},
+	}
+}
+
+// NewSilenceMessage returns the message announcing the silence with a button to expire it.
+// The button identifies the user who created the silence, so the expiry can be restricted to them.
+func NewSilenceMessage(userID, region, silenceID string, endsAt time.Time) *slack.Msg {
+	text := fmt.Sprintf(":mute: <@%s> silenced the alerts in %s until %s (silence `%s`)", userID, region, endsAt.UTC().Format(time.RFC1123), silenceID)
+	expire := slack.NewButtonBlockElement(ActionIDSilenceExpire, strings.Join([]string{region, silenceID, userID}, silenceValueSeparator), slack.NewTextBlockObject(slack.PlainTextType, "Expire silence", true, false))
+	expire.Style = slack.StyleDanger
+
+	blockMsg := slack.NewBlockMessage(
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		slack.NewActionBlock("", expire),
+	)
+	blockMsg.Msg.Text = text
+	return &blockMsg.Msg
+}
+
+// NewSilenceExpiredMessage returns the message replacing the silence message after it was expired.
+func NewSilenceExpiredMessage(userID, region, silenceID string) *slack.Msg {
+	return &slack.Msg{Text: fmt.Sprintf(":loud_sound: <@%s> expired the silence `%s` in %s", userID, silenceID, region)}
+}
+
+// ParseSilenceExpireValue returns the region, the ID and the ID of the slack user who created the silence of the expire button.
+// The user is empty for buttons posted before it was added.
+func ParseSilenceExpireValue(value string) (region, silenceID, userID string, err error) {
+	parts := strings.SplitN(value, silenceValueSeparator, 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return "", "", "", errors.Errorf("invalid silence '%s'", value)
+	}
+	if len(parts) == 3 {
+		userID = parts[2]
+	}
+	return parts[0], parts[1], userID, nil
+}
+
+// silenceMatchers returns the matchers of the common labels or, if they exceed the value of a button, of the group labels and the region.
+func (g *AlertGroup) silenceMatchers() []clients.Matcher {
+	matchers := clients.MatchersFromLabels(g.CommonLabels)
+	if len(clients.FormatMatchers(matchers)) <= maxButtonValueLength {
+		return matchers
+	}
+
+	labels := make(map[string]string, len(g.GroupLabels)+1)
+	for name, value := range g.GroupLabels {
+		labels[name] = value
+	}
+	if region := g.Region(); region != "" {
+		labels["region"] = region
+	}
+	return clients.MatchersFromLabels(labels)
+}
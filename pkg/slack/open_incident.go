@@ -20,6 +20,7 @@
 package slack
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/nlopes/slack"
@@ -66,7 +67,7 @@ func (o *openIncidentCommand) RequiredUserRole() auth.UserRole {
 	return auth.UserRoles.Base
 }
 
-func (o *openIncidentCommand) Run(msg *slack.Msg) (*slack.Msg, error) {
+func (o *openIncidentCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
 	incident := models.NewIncident(
 		util.TrimAnyPrefix(o.Keywords(), msg.Text),
 		models.NewUser(models.Reporter, fmt.Sprintf("<@%s>", msg.User)),
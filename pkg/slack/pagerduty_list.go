@@ -20,6 +20,7 @@
 package slack
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -27,7 +28,7 @@ import (
 	"github.com/sapcc/pulsar/pkg/auth"
 	"github.com/sapcc/pulsar/pkg/bot"
 	"github.com/sapcc/pulsar/pkg/clients"
-	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/sapcc/pulsar/pkg/slack/models"
 )
 
 func init() {
@@ -36,8 +37,11 @@ func init() {
 	})
 }
 
+const listIncidentsUsage = "`list incidents [triggered|acknowledged|resolved] [urgency=high|low] [service=$name] [alertname=$name] [since=$duration] [until=$duration] [$clusterName] [group=region|service]`"
+
 type pagerdutyList struct {
 	pagerdutyClient *clients.PagerdutyClient
+	slackClient     *clients.SlackClient
 }
 
 func (l *pagerdutyList) Init() error {
@@ -46,6 +50,12 @@ func (l *pagerdutyList) Init() error {
 		return err
 	}
 	l.pagerdutyClient = c
+
+	sCli, err := clients.NewSlackBotClientFromEnv()
+	if err != nil {
+		return err
+	}
+	l.slackClient = sCli
 	return nil
 }
 
@@ -54,23 +64,28 @@ func (l *pagerdutyList) IsDisabled() bool {
 }
 
 func (l *pagerdutyList) Describe() string {
-	return "List currently open PagerDuty incidents."
+	return "List currently open PagerDuty incidents: list incidents [triggered|acknowledged|resolved] [urgency=high|low] [service=$name] [alertname=$name] [since=$duration] [until=$duration] [$clusterName] [group=region|service]."
 }
 
 func (l *pagerdutyList) Keywords() []string {
 	return []string{"list incidents", "incident list"}
 }
 
+func (l *pagerdutyList) Examples() []string {
+	return []string{"list incidents", "list incidents acknowledged urgency=high service=compute group=region", "list incidents eu-de-1 since=2d", "list incidents since=7d until=1d"}
+}
+
 func (l *pagerdutyList) RequiredUserRole() auth.UserRole {
 	return auth.UserRoles.Base
 }
 
-func (l *pagerdutyList) Run(msg *slack.Msg) (*slack.Msg, error) {
-	f := &clients.Filter{}
-	// If the message contains a cluster name filter incidents accordingly.
-	f.ClusterFilterFromText(msg.Text)
+func (l *pagerdutyList) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	f, groupBy, err := models.ParseIncidentListQuery(msg.Text)
+	if err != nil {
+		return nil, &bot.UsageError{Err: err, Usage: listIncidentsUsage}
+	}
 
-	incidentList, err := l.pagerdutyClient.ListIncidents(f)
+	incidentList, err := l.pagerdutyClient.ListIncidents(ctx, f)
 	if err != nil {
 		return nil, err
 	}
@@ -85,10 +100,5 @@ func (l *pagerdutyList) Run(msg *slack.Msg) (*slack.Msg, error) {
 		return &slack.Msg{Text: response}, nil
 	}
 
-	data := [][]string{{"Summary", "Started"}}
-	for _, inc := range incidentList {
-		data = append(data, []string{inc.APIObject.Summary, util.HumanizeTimestamp(util.StringToTimestamp(inc.CreatedAt))})
-	}
-
-	return util.ToSlackTable(data), nil
+	return models.NewIncidentTable(incidentList, groupBy).Respond(l.slackClient, msg.Channel, bot.ThreadTimestamp(msg))
 }
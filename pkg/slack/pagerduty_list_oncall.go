@@ -20,16 +20,22 @@
 package slack
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/PagerDuty/go-pagerduty"
 	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
 	"github.com/sapcc/pulsar/pkg/auth"
 	"github.com/sapcc/pulsar/pkg/bot"
 	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
 )
 
-const scheduleName = "Managed Service for CCloud API (Two Day Shifts)"
+const listOnCallUsage = "`who's on call [for $schedule|$team|$escalationPolicy]`"
 
 func init() {
 	bot.RegisterCommand(func() bot.Command {
@@ -38,11 +44,18 @@ func init() {
 }
 
 type pagerdutyListOnCall struct {
+	cfg             *config.PagerdutyConfig
 	pagerdutyClient *clients.PagerdutyClient
 	slackClient     *clients.SlackClient
 }
 
 func (l *pagerdutyListOnCall) Init() error {
+	cfg, err := config.NewPagerdutyConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	l.cfg = cfg
+
 	pdCli, err := clients.NewPagerdutyClientFromEnv()
 	if err != nil {
 		return err
@@ -63,38 +76,145 @@ func (l *pagerdutyListOnCall) IsDisabled() bool {
 }
 
 func (l *pagerdutyListOnCall) Describe() string {
-	return "List on-call persons."
+	return "List on-call persons [for $schedule|$team|$escalationPolicy]."
 }
 
 func (l *pagerdutyListOnCall) Keywords() []string {
-	return []string{"list oncall", "list on-call", "list on call", "who's on call", "who's on-call"}
+	return []string{"list oncall", "list on-call", "list on call", "who's on call", "who's on-call", "who’s on call", "who’s on-call", "who is on call"}
 }
 
 func (l *pagerdutyListOnCall) RequiredUserRole() auth.UserRole {
 	return auth.UserRoles.Base
 }
 
-func (l *pagerdutyListOnCall) Run(msg *slack.Msg) (*slack.Msg, error) {
-	schedule, err := l.pagerdutyClient.GetSchedule(scheduleName)
+func (l *pagerdutyListOnCall) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	var (
+		escalationPolicyIDs []string
+		err                 error
+	)
+
+	if target := parseOnCallTarget(msg.Text); target != "" {
+		escalationPolicyIDs, err = l.resolveEscalationPolicyIDs(ctx, target)
+	} else if scheduleNames := l.cfg.SchedulesForChannel(msg.Channel); len(scheduleNames) > 0 {
+		escalationPolicyIDs, err = l.escalationPolicyIDsForSchedules(ctx, scheduleNames...)
+	} else {
+		err = &bot.UsageError{Err: errors.New("no on-call schedules configured for this channel"), Usage: listOnCallUsage}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	onCallUserList, err := l.pagerdutyClient.ListTodaysOnCallUsers(&schedule.ID)
+	onCalls, err := l.pagerdutyClient.ListCurrentOnCalls(ctx, nil, escalationPolicyIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(onCallUserList) == 0 {
+	if len(onCalls) == 0 {
 		return &slack.Msg{Text: "There's no one on-call right now."}, nil
 	}
 
-	users := make([]string, 0)
-	for _, u := range onCallUserList {
-		if usr, err := l.slackClient.GetUserByEmail(u.Email); err == nil {
-			users = append(users, fmt.Sprintf("<@%s>", usr.ID))
+	return l.onCallTable(onCalls).Respond(l.slackClient, msg.Channel, bot.ThreadTimestamp(msg))
+}
+
+// resolveEscalationPolicyIDs returns the ids of the escalation policies for the given schedule, escalation policy or team name.
+func (l *pagerdutyListOnCall) resolveEscalationPolicyIDs(ctx context.Context, name string) ([]string, error) {
+	if ids, err := l.escalationPolicyIDsForSchedules(ctx, name); err == nil {
+		return ids, nil
+	}
+
+	if policy, err := l.pagerdutyClient.GetEscalationPolicy(ctx, name); err == nil {
+		return []string{policy.ID}, nil
+	}
+
+	if ids, err := l.pagerdutyClient.ListEscalationPolicyIDsForTeam(ctx, name); err == nil {
+		return ids, nil
+	}
+
+	return nil, &bot.UsageError{Err: fmt.Errorf("no schedule, escalation policy or team named '%s' found", name), Usage: listOnCallUsage}
+}
+
+// escalationPolicyIDsForSchedules returns the ids of the escalation policies the given schedules are part of.
+func (l *pagerdutyListOnCall) escalationPolicyIDsForSchedules(ctx context.Context, scheduleNames ...string) ([]string, error) {
+	if len(scheduleNames) == 0 {
+		return nil, errors.New("no on-call schedules configured")
+	}
+
+	scheduleIDs := make([]string, 0)
+	for _, name := range scheduleNames {
+		schedule, err := l.pagerdutyClient.GetSchedule(ctx, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get schedule '%s'", name)
+		}
+		scheduleIDs = append(scheduleIDs, schedule.ID)
+	}
+
+	onCalls, err := l.pagerdutyClient.ListCurrentOnCalls(ctx, scheduleIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0)
+	for _, onCall := range onCalls {
+		if !util.Contains(res, onCall.EscalationPolicy.ID) {
+			res = append(res, onCall.EscalationPolicy.ID)
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("schedule(s) '%s' are not part of any escalation policy", strings.Join(scheduleNames, "', '"))
+	}
+	return res, nil
+}
+
+// onCallTable lists the on-call users grouped by escalation policy and level.
+// Users which cannot be found in Slack are listed by their PagerDuty name.
+func (l *pagerdutyListOnCall) onCallTable(onCalls []pagerduty.OnCall) *util.Table {
+	sort.SliceStable(onCalls, func(i, j int) bool {
+		if onCalls[i].EscalationPolicy.Summary != onCalls[j].EscalationPolicy.Summary {
+			return onCalls[i].EscalationPolicy.Summary < onCalls[j].EscalationPolicy.Summary
+		}
+		return onCalls[i].EscalationLevel < onCalls[j].EscalationLevel
+	})
+
+	var (
+		table        = util.NewTable("Currently on call:", "Escalation level", "On call")
+		policy       string
+		level        uint
+		usersInLevel []string
+	)
+
+	flushLevel := func() {
+		if len(usersInLevel) > 0 {
+			table.AddRow(fmt.Sprintf("%s: level %d", policy, level), strings.Join(usersInLevel, ", "))
+		}
+		usersInLevel = nil
+	}
+
+	for _, onCall := range onCalls {
+		if onCall.EscalationPolicy.Summary != policy || onCall.EscalationLevel != level {
+			flushLevel()
+		}
+		policy = onCall.EscalationPolicy.Summary
+		level = onCall.EscalationLevel
+
+		if user := l.slackUserOrName(onCall.User); !util.Contains(usersInLevel, user) {
+			usersInLevel = append(usersInLevel, user)
 		}
 	}
+	flushLevel()
 
-	return &slack.Msg{Text: "Currently on call: " + strings.Join(users, ", ")}, nil
+	return table
+}
+
+func (l *pagerdutyListOnCall) slackUserOrName(user pagerduty.User) string {
+	return l.slackClient.UserMentionByEmail(user.Email, clients.UserName(user))
+}
+
+// parseOnCallTarget returns the schedule, team or escalation policy name following `for` or an empty string.
+func parseOnCallTarget(text string) string {
+	idx := strings.Index(text, " for ")
+	if idx < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[idx+len(" for "):])
 }
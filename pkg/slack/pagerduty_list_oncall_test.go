@@ -0,0 +1,110 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"testing"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-kit/kit/log"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSlackClient(t *testing.T) (*fake.Slack, *clients.SlackClient) {
+	fakeSlack := fake.NewSlack()
+	t.Cleanup(fakeSlack.Close)
+
+	slackClient, err := clients.NewSlackBotClient(&config.SlackConfig{APIURL: fakeSlack.URL(), BotToken: fake.SlackBotToken}, log.NewNopLogger())
+	require.NoError(t, err, "there should be no error creating the slack client")
+	return fakeSlack, slackClient
+}
+
+func newOnCall(policy string, level uint, name, email string) pagerduty.OnCall {
+	return pagerduty.OnCall{
+		EscalationPolicy: pagerduty.EscalationPolicy{APIObject: pagerduty.APIObject{Summary: policy}},
+		EscalationLevel:  level,
+		User:             pagerduty.User{Name: name, Email: email},
+	}
+}
+
+func TestOnCallTable(t *testing.T) {
+	fakeSlack, slackClient := newTestSlackClient(t)
+	fakeSlack.AddUser(slack.User{ID: "UALICE", Name: "alice", Profile: slack.UserProfile{Email: "alice@example.com"}})
+	l := &pagerdutyListOnCall{slackClient: slackClient}
+
+	stimuli := []struct {
+		name     string
+		onCalls  []pagerduty.OnCall
+		expected [][]string
+	}{
+		{
+			name:     "no one on call",
+			onCalls:  []pagerduty.OnCall{},
+			expected: [][]string{},
+		},
+		{
+			name: "levels and policies are sorted",
+			onCalls: []pagerduty.OnCall{
+				newOnCall("Storage", 2, "Bob", "bob@example.com"),
+				newOnCall("Compute", 1, "Alice", "alice@example.com"),
+				newOnCall("Storage", 1, "Carol", "carol@example.com"),
+			},
+			expected: [][]string{
+				{"Compute: level 1", "<@UALICE>"},
+				{"Storage: level 1", "Carol"},
+				{"Storage: level 2", "Bob"},
+			},
+		},
+		{
+			name: "users of a level are joined once",
+			onCalls: []pagerduty.OnCall{
+				newOnCall("Compute", 1, "Alice", "alice@example.com"),
+				newOnCall("Compute", 1, "Bob", "bob@example.com"),
+				newOnCall("Compute", 1, "Alice", "alice@example.com"),
+			},
+			expected: [][]string{
+				{"Compute: level 1", "<@UALICE>, Bob"},
+			},
+		},
+	}
+
+	for _, s := range stimuli {
+		table := l.onCallTable(s.onCalls)
+		assert.Equal(t, []string{"Escalation level", "On call"}, table.Header, s.name)
+		assert.Equal(t, s.expected, table.Rows, s.name)
+	}
+}
+
+func TestParseOnCallTarget(t *testing.T) {
+	stimuli := map[string]string{
+		"list oncall":                    "",
+		"list oncall for Compute Team ":  "Compute Team",
+		"who is on call for storage ops": "storage ops",
+	}
+
+	for input, expected := range stimuli {
+		assert.Equal(t, expected, parseOnCallTarget(input), "unexpected target for '%s'", input)
+	}
+}
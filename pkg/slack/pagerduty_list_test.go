@@ -0,0 +1,65 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useRegions configures the region catalog used to parse regions from commands.
+func useRegions(t *testing.T, yaml string) {
+	path := filepath.Join(t.TempDir(), "pulsar.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(yaml), 0600), "there should be no error writing the configuration")
+	config.SetFile(path)
+	t.Cleanup(func() { config.SetFile("") })
+}
+
+func TestUnknownRegions(t *testing.T) {
+	useRegions(t, "regions:\n- name: eu-de-1\n  aliases: [frankfurt]\n- name: staging\n")
+
+	tests := []struct {
+		cmd      bot.Command
+		text     string
+		expected string
+	}{
+		{&pagerdutyList{}, "list incidents eu-nl-1", "unknown region(s) eu-nl-1. known regions are eu-de-1, staging"},
+		{&rolloutStatusCommand{}, "rollout status deployment kube-system/coredns in eu-nl-1", "unknown region(s) eu-nl-1. known regions are eu-de-1, staging"},
+		{&rolloutStatusCommand{}, "rollout status deployment kube-system/coredns in amsterdam", "unknown cluster 'amsterdam'. known regions are eu-de-1, staging"},
+		{&restartWorkloadCommand{}, "restart deployment kube-system/coredns in eu-nl-1", "unknown region(s) eu-nl-1. known regions are eu-de-1, staging"},
+		{&scaleWorkloadCommand{}, "scale deployment kube-system/coredns --replicas 3 in eu-nl-1", "unknown region(s) eu-nl-1. known regions are eu-de-1, staging"},
+	}
+
+	for _, tc := range tests {
+		_, err := tc.cmd.Run(context.Background(), &slack.Msg{Text: tc.text})
+		var usageErr *bot.UsageError
+		if assert.ErrorAs(t, err, &usageErr, "'%s' should be a usage error", tc.text) {
+			assert.EqualError(t, usageErr.Err, tc.expected, "the unknown region and the known ones should be named")
+		}
+	}
+}
@@ -0,0 +1,364 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+const takeOnCallUsage = "`take on-call $schedule from $time to $time`"
+
+func init() {
+	bot.RegisterCommand(func() bot.Command {
+		return &takeOnCallCommand{}
+	})
+	bot.RegisterCommand(func() bot.Command {
+		return &coverOnCallCommand{}
+	})
+}
+
+type takeOnCallCommand struct {
+	shiftCommand
+}
+
+func (t *takeOnCallCommand) Describe() string {
+	return "Take the on-call: take on-call $schedule from $time to $time."
+}
+
+func (t *takeOnCallCommand) Keywords() []string {
+	return []string{"take on-call", "take on call", "take oncall"}
+}
+
+func (t *takeOnCallCommand) DescribeAction(msg *slack.Msg) (string, error) {
+	scheduleName, start, end, err := t.parseTimeRange(msg.Text)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("put <@%s> on-call for *%s* from %s until %s", msg.User, scheduleName, util.HumanizeTimestamp(start), util.HumanizeTimestamp(end)), nil
+}
+
+// ApproverRole returns no role as the override only affects the requesting user.
+func (t *takeOnCallCommand) ApproverRole() auth.UserRole {
+	return ""
+}
+
+func (t *takeOnCallCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	scheduleName, start, end, err := t.parseTimeRange(msg.Text)
+	if err != nil {
+		return nil, err
+	}
+	return t.createOverride(ctx, scheduleName, msg.User, start, end)
+}
+
+// parseTimeRange returns the schedule name and the time range of 'take on-call $schedule from $time to $time'.
+func (t *takeOnCallCommand) parseTimeRange(msgText string) (scheduleName string, start, end time.Time, err error) {
+	text := strings.TrimSpace(util.TrimAnyPrefix(t.Keywords(), msgText))
+
+	fromIdx := strings.LastIndex(text, " from ")
+	if fromIdx < 0 {
+		return "", start, end, &bot.UsageError{Err: errors.New("missing time range"), Usage: takeOnCallUsage}
+	}
+	toIdx := strings.LastIndex(text[fromIdx:], " to ")
+	if toIdx < 0 {
+		return "", start, end, &bot.UsageError{Err: errors.New("missing end time"), Usage: takeOnCallUsage}
+	}
+	toIdx += fromIdx
+
+	now := time.Now().UTC()
+	start, err = util.ParseTime(text[fromIdx+len(" from "):toIdx], now)
+	if err != nil {
+		return "", start, end, &bot.UsageError{Err: err, Usage: takeOnCallUsage}
+	}
+
+	end, err = util.ParseTime(text[toIdx+len(" to "):], now)
+	if err != nil {
+		return "", start, end, &bot.UsageError{Err: err, Usage: takeOnCallUsage}
+	}
+
+	scheduleName = strings.TrimSpace(text[:fromIdx])
+	if scheduleName == "" {
+		return "", start, end, &bot.UsageError{Err: errors.New("missing schedule"), Usage: takeOnCallUsage}
+	}
+	return scheduleName, start, end, nil
+}
+
+type coverOnCallCommand struct {
+	shiftCommand
+}
+
+func (c *coverOnCallCommand) Describe() string {
+	return "Cover the on-call shifts of someone for the given duration: cover @user $schedule $duration."
+}
+
+func (c *coverOnCallCommand) Keywords() []string {
+	return []string{"cover"}
+}
+
+func (c *coverOnCallCommand) Arguments() []bot.Argument {
+	return []bot.Argument{
+		{Name: "user", Type: bot.ArgUser, Positional: true, Required: true, Description: "user to cover for"},
+		{Name: "schedule", Type: bot.ArgString, Positional: true, Required: true, Description: "name of the PagerDuty schedule"},
+		{Name: "duration", Type: bot.ArgDuration, Positional: true, Required: true, Description: "how long to cover starting now"},
+	}
+}
+
+func (c *coverOnCallCommand) Examples() []string {
+	return []string{"cover @jane compute on-call 8h"}
+}
+
+func (c *coverOnCallCommand) DescribeAction(msg *slack.Msg) (string, error) {
+	args, err := c.parseArguments(msg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("put <@%s> on-call for the shifts of <@%s> on *%s* within the next %s",
+		msg.User, args.String("user"), args.String("schedule"), args.Duration("duration").String()), nil
+}
+
+// ApproverRole returns no role as the override only puts the requesting user on-call.
+func (c *coverOnCallCommand) ApproverRole() auth.UserRole {
+	return ""
+}
+
+func (c *coverOnCallCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	args, err := c.parseArguments(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now().UTC()
+	return c.coverShifts(ctx, args.String("schedule"), msg.User, args.String("user"), start, start.Add(args.Duration("duration")))
+}
+
+func (c *coverOnCallCommand) parseArguments(msg *slack.Msg) (*bot.Args, error) {
+	args, err := bot.ParseArguments(c, msg.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.String("user") == msg.User {
+		return nil, &bot.UsageError{Err: errors.New("you cannot cover for yourself"), Usage: bot.Usage(c)}
+	}
+	return args, nil
+}
+
+// createOverride puts the slack user on-call for the schedule between start and end
+// and responds with the resulting on-call timeline.
+func (s *shiftCommand) createOverride(ctx context.Context, scheduleName, slackUserID string, start, end time.Time) (*slack.Msg, error) {
+	if !end.After(start) {
+		return nil, errors.New("the end of the override must be after its start")
+	}
+
+	schedule, err := s.pagerdutyClient.GetSchedule(ctx, strings.TrimSpace(scheduleName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get schedule '%s'", strings.TrimSpace(scheduleName))
+	}
+
+	user, err := s.pagerdutyUser(ctx, slackUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := s.pagerdutyClient.CreateScheduleOverride(ctx, schedule.ID, user, start, end); err != nil {
+		return nil, errors.Wrap(err, "failed to create schedule override")
+	}
+
+	timeline, err := s.scheduleTimeline(ctx, schedule.ID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &slack.Msg{Text: fmt.Sprintf(
+		"<@%s> is on-call for *%s* from %s until %s :white_check_mark:\nResulting on-call timeline:\n%s",
+		slackUserID, schedule.Name, util.HumanizeTimestamp(start), util.HumanizeTimestamp(end), timeline,
+	)}, nil
+}
+
+// coverShifts puts the slack user on-call for the shifts of the covered slack user on the schedule between start and end
+// and responds with the resulting on-call timeline.
+func (s *shiftCommand) coverShifts(ctx context.Context, scheduleName, slackUserID, coveredSlackUserID string, start, end time.Time) (*slack.Msg, error) {
+	if !end.After(start) {
+		return nil, errors.New("the end of the override must be after its start")
+	}
+
+	schedule, err := s.pagerdutyClient.GetSchedule(ctx, strings.TrimSpace(scheduleName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get schedule '%s'", strings.TrimSpace(scheduleName))
+	}
+
+	user, err := s.pagerdutyUser(ctx, slackUserID)
+	if err != nil {
+		return nil, err
+	}
+	coveredUser, err := s.pagerdutyUser(ctx, coveredSlackUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.pagerdutyClient.ListFinalScheduleEntries(ctx, schedule.ID, start, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list schedule entries")
+	}
+
+	shifts := shiftsOfUser(entries, coveredUser.ID, start, end)
+	if len(shifts) == 0 {
+		return nil, fmt.Errorf("<@%s> is not on-call for *%s* until %s", coveredSlackUserID, schedule.Name, util.HumanizeTimestamp(end))
+	}
+
+	// The shifts are covered completely or not at all. Overrides created before one fails are removed again.
+	overrides := make([]*pagerduty.Override, 0, len(shifts))
+	for _, shift := range shifts {
+		err := ctx.Err()
+		if err == nil {
+			var override *pagerduty.Override
+			if override, err = s.pagerdutyClient.CreateScheduleOverride(ctx, schedule.ID, user, shift.start, shift.end); err == nil {
+				overrides = append(overrides, override)
+				continue
+			}
+			err = errors.Wrap(err, "failed to create schedule override")
+		}
+
+		remaining := s.removeOverrides(schedule.ID, overrides)
+		if len(remaining) == 0 {
+			return nil, err
+		}
+		return &slack.Msg{Text: fmt.Sprintf(
+			":x: Failed to cover for <@%s> on *%s*. <@%s> still covers %s. Please remove the overrides in PagerDuty.",
+			coveredSlackUserID, schedule.Name, slackUserID, strings.Join(remaining, ", "),
+		)}, nil
+	}
+
+	timeline, err := s.scheduleTimeline(ctx, schedule.ID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &slack.Msg{Text: fmt.Sprintf(
+		"<@%s> covers for <@%s> on *%s* from %s until %s :white_check_mark:\nResulting on-call timeline:\n%s",
+		slackUserID, coveredSlackUserID, schedule.Name, util.HumanizeTimestamp(shifts[0].start), util.HumanizeTimestamp(shifts[len(shifts)-1].end), timeline,
+	)}, nil
+}
+
+// pagerdutyUser returns the pagerduty user of the slack user or an error.
+func (s *shiftCommand) pagerdutyUser(ctx context.Context, slackUserID string) (*pagerduty.User, error) {
+	slackUser, err := s.slackClient.GetUserByID(slackUserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find slack user")
+	}
+
+	user, err := s.pagerdutyClient.GetUserByEmail(ctx, slackUser.Profile.Email)
+	if err != nil {
+		return nil, fmt.Errorf("<@%s> has no pagerduty user: %s", slackUserID, err.Error())
+	}
+	return user, nil
+}
+
+type shift struct {
+	start, end time.Time
+}
+
+// removeOverrides deletes the given overrides of the schedule and returns the time ranges of the ones which could not be deleted.
+func (s *shiftCommand) removeOverrides(scheduleID string, overrides []*pagerduty.Override) []string {
+	remaining := make([]string, 0)
+	for _, o := range overrides {
+		// The context of the command might be cancelled already.
+		if err := s.pagerdutyClient.DeleteScheduleOverride(context.Background(), scheduleID, o.ID); err != nil {
+			remaining = append(remaining, fmt.Sprintf("from %s until %s",
+				util.HumanizeTimestamp(util.StringToTimestamp(o.Start)), util.HumanizeTimestamp(util.StringToTimestamp(o.End)),
+			))
+		}
+	}
+	return remaining
+}
+
+// shiftsOfUser returns the shifts of the user in the schedule entries, limited to the range between since and until.
+// Adjacent shifts are merged.
+func shiftsOfUser(entries []pagerduty.RenderedScheduleEntry, userID string, since, until time.Time) []shift {
+	res := make([]shift, 0)
+	for _, entry := range entries {
+		if entry.User.ID != userID {
+			continue
+		}
+
+		start, end := util.StringToTimestamp(entry.Start), util.StringToTimestamp(entry.End)
+		if start.Before(since) {
+			start = since
+		}
+		if end.After(until) {
+			end = until
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		if n := len(res); n > 0 && !start.After(res[n-1].end) {
+			if end.After(res[n-1].end) {
+				res[n-1].end = end
+			}
+			continue
+		}
+		res = append(res, shift{start: start, end: end})
+	}
+	return res
+}
+
+// scheduleTimeline lists the final schedule entries of the schedule overlapping the range between since and until.
+func (s *shiftCommand) scheduleTimeline(ctx context.Context, scheduleID string, since, until time.Time) (string, error) {
+	entries, err := s.pagerdutyClient.ListFinalScheduleEntries(ctx, scheduleID, since, until)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list schedule entries")
+	}
+
+	users := make(map[string]string)
+	lines := make([]string, 0)
+	for _, entry := range entries {
+		if _, ok := users[entry.User.ID]; !ok {
+			users[entry.User.ID] = s.userMention(ctx, entry.User)
+		}
+		lines = append(lines, fmt.Sprintf("• %s %s", users[entry.User.ID], formatShiftTime(&pagerduty.OnCall{Start: entry.Start, End: entry.End})))
+	}
+
+	if len(lines) == 0 {
+		return "nobody", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// userMention returns the slack mention of the pagerduty user or its name if the user cannot be found in slack.
+func (s *shiftCommand) userMention(ctx context.Context, userRef pagerduty.APIObject) string {
+	user, err := s.pagerdutyClient.GetUser(ctx, userRef.ID)
+	if err != nil {
+		return userRef.Summary
+	}
+	return s.slackClient.UserMentionByEmail(user.Email, user.Name)
+}
@@ -0,0 +1,163 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/go-kit/kit/log"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/fake"
+	"github.com/sapcc/pulsar/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPagerdutyClient(t *testing.T) (*fake.Pagerduty, *clients.PagerdutyClient) {
+	fakePagerduty := fake.NewPagerduty()
+	t.Cleanup(fakePagerduty.Close)
+	fakePagerduty.AddUser("Pulsar", "pulsar@example.com")
+
+	pagerdutyClient, err := clients.NewPagerdutyClient(&config.PagerdutyConfig{
+		AuthToken:    fake.PagerdutyToken,
+		DefaultEmail: "pulsar@example.com",
+		APIURL:       fakePagerduty.URL(),
+		EventsAPIURL: fakePagerduty.URL(),
+	}, log.NewNopLogger())
+	require.NoError(t, err, "there should be no error creating the pagerduty client")
+	return fakePagerduty, pagerdutyClient
+}
+
+func TestCoverOnCall(t *testing.T) {
+	fakeSlack, slackClient := newTestSlackClient(t)
+	fakeSlack.AddUser(slack.User{ID: "UALICE", Name: "alice", Profile: slack.UserProfile{Email: "alice@example.com"}})
+	fakeSlack.AddUser(slack.User{ID: "UBOB", Name: "bob", Profile: slack.UserProfile{Email: "bob@example.com"}})
+
+	fakePagerduty, pagerdutyClient := newTestPagerdutyClient(t)
+	alice := fakePagerduty.AddUser("Alice", "alice@example.com")
+	bob := fakePagerduty.AddUser("Bob", "bob@example.com")
+	scheduleID := fakePagerduty.AddSchedule("compute", alice)
+	otherScheduleID := fakePagerduty.AddSchedule("storage", bob)
+
+	c := &coverOnCallCommand{shiftCommand{pagerdutyClient: pagerdutyClient, slackClient: slackClient}}
+
+	before := time.Now().UTC().Truncate(time.Second)
+	res, err := c.Run(context.Background(), &slack.Msg{User: "UBOB", Text: "cover <@UALICE> compute 8h"})
+	require.NoError(t, err, "there should be no error covering the on-call")
+	assert.Contains(t, res.Text, "<@UBOB> covers for <@UALICE> on *compute*")
+
+	overrides := fakePagerduty.Overrides(scheduleID)
+	require.Len(t, overrides, 1, "there should be one override")
+	assert.Equal(t, bob.ID, overrides[0].User.ID, "the caller should be put on call")
+	start, end := util.StringToTimestamp(overrides[0].Start), util.StringToTimestamp(overrides[0].End)
+	assert.False(t, start.Before(before), "the override should start now")
+	assert.Equal(t, 8*time.Hour, end.Sub(start), "the override should cover the shift of the covered user")
+
+	_, err = c.Run(context.Background(), &slack.Msg{User: "UALICE", Text: "cover <@UALICE> compute 8h"})
+	var usageErr *bot.UsageError
+	if assert.ErrorAs(t, err, &usageErr, "covering for yourself should be a usage error") {
+		assert.EqualError(t, usageErr.Err, "you cannot cover for yourself")
+	}
+
+	_, err = c.Run(context.Background(), &slack.Msg{User: "UBOB", Text: "cover <@UALICE> storage 8h"})
+	assert.Error(t, err, "users who are not on call should not be covered")
+	assert.Empty(t, fakePagerduty.Overrides(otherScheduleID), "no override should be created")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Run(ctx, &slack.Msg{User: "UBOB", Text: "cover <@UALICE> compute 8h"})
+	if assert.Error(t, err, "cancelled commands should fail") {
+		assert.Contains(t, err.Error(), context.Canceled.Error())
+	}
+	assert.Len(t, fakePagerduty.Overrides(scheduleID), 1, "cancelled commands should not create overrides")
+}
+
+func TestCoverOnCallRollback(t *testing.T) {
+	fakeSlack, slackClient := newTestSlackClient(t)
+	fakeSlack.AddUser(slack.User{ID: "UALICE", Name: "alice", Profile: slack.UserProfile{Email: "alice@example.com"}})
+	fakeSlack.AddUser(slack.User{ID: "UBOB", Name: "bob", Profile: slack.UserProfile{Email: "bob@example.com"}})
+
+	fakePagerduty, pagerdutyClient := newTestPagerdutyClient(t)
+	alice := fakePagerduty.AddUser("Alice", "alice@example.com")
+	fakePagerduty.AddUser("Bob", "bob@example.com")
+	scheduleID := fakePagerduty.AddSchedule("compute", fakePagerduty.AddUser("Carol", "carol@example.com"))
+
+	// Alice has two separate shifts within the next 8 hours.
+	now := time.Now().UTC()
+	for _, start := range []time.Time{now.Add(time.Hour), now.Add(4 * time.Hour)} {
+		_, err := pagerdutyClient.CreateScheduleOverride(context.Background(), scheduleID, &alice, start, start.Add(time.Hour))
+		require.NoError(t, err, "there should be no error creating the shifts of alice")
+	}
+	// Only the override of the first shift can be created.
+	fakePagerduty.SetOverrideLimit(3)
+
+	c := &coverOnCallCommand{shiftCommand{pagerdutyClient: pagerdutyClient, slackClient: slackClient}}
+	_, err := c.Run(context.Background(), &slack.Msg{User: "UBOB", Text: "cover <@UALICE> compute 8h"})
+	assert.Error(t, err, "covering should fail if an override cannot be created")
+
+	overrides := fakePagerduty.Overrides(scheduleID)
+	if assert.Len(t, overrides, 2, "the override of the first shift should be removed") {
+		for _, o := range overrides {
+			assert.Equal(t, alice.ID, o.User.ID, "the shifts of alice should be kept")
+		}
+	}
+}
+
+func TestTakeOnCallUsage(t *testing.T) {
+	c := &takeOnCallCommand{}
+
+	for _, text := range []string{
+		"take on-call compute",
+		"take on-call compute from tomorrow",
+		"take on-call compute from someday to tomorrow",
+		"take on-call from 10:00 to 12:00",
+	} {
+		_, err := c.Run(context.Background(), &slack.Msg{User: "UBOB", Text: text})
+		var usageErr *bot.UsageError
+		assert.ErrorAs(t, err, &usageErr, "'%s' should be a usage error", text)
+	}
+}
+
+func TestShiftsOfUser(t *testing.T) {
+	since := time.Date(2019, 5, 1, 8, 0, 0, 0, time.UTC)
+	until := since.Add(12 * time.Hour)
+	entry := func(userID string, start, end time.Time) pagerduty.RenderedScheduleEntry {
+		return pagerduty.RenderedScheduleEntry{User: pagerduty.APIObject{ID: userID}, Start: util.TimestampToString(start), End: util.TimestampToString(end)}
+	}
+
+	entries := []pagerduty.RenderedScheduleEntry{
+		entry("PU1", since.Add(-2*time.Hour), since.Add(2*time.Hour)),
+		entry("PU1", since.Add(2*time.Hour), since.Add(4*time.Hour)),
+		entry("PU2", since.Add(4*time.Hour), since.Add(10*time.Hour)),
+		entry("PU1", since.Add(10*time.Hour), since.Add(16*time.Hour)),
+	}
+
+	assert.Equal(t, []shift{
+		{start: since, end: since.Add(4 * time.Hour)},
+		{start: since.Add(10 * time.Hour), end: until},
+	}, shiftsOfUser(entries, "PU1", since, until), "shifts should be limited to the range and adjacent ones merged")
+	assert.Empty(t, shiftsOfUser(entries, "PU3", since, until))
+}
@@ -0,0 +1,153 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+func init() {
+	bot.RegisterCommand(func() bot.Command {
+		return &pagerdutyPage{}
+	})
+}
+
+type pagerdutyPage struct {
+	cfg             *config.PagerdutyConfig
+	pagerdutyClient *clients.PagerdutyClient
+	slackClient     *clients.SlackClient
+	logger          log.Logger
+}
+
+func (p *pagerdutyPage) Init() error {
+	cfg, err := config.NewPagerdutyConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	p.cfg = cfg
+
+	pdCli, err := clients.NewPagerdutyClientFromEnv()
+	if err != nil {
+		return err
+	}
+	p.pagerdutyClient = pdCli
+
+	sCli, err := clients.NewSlackBotClientFromEnv()
+	if err != nil {
+		return err
+	}
+	p.slackClient = sCli
+
+	p.logger = util.NewLogger()
+	return nil
+}
+
+func (p *pagerdutyPage) IsDisabled() bool {
+	return false
+}
+
+func (p *pagerdutyPage) Describe() string {
+	return "Page a service or escalation policy: page $target $urgency $message."
+}
+
+func (p *pagerdutyPage) Keywords() []string {
+	return []string{"page"}
+}
+
+func (p *pagerdutyPage) RequiredUserRole() auth.UserRole {
+	return auth.UserRoles.Base
+}
+
+func (p *pagerdutyPage) Arguments() []bot.Argument {
+	return []bot.Argument{
+		{Name: "target", Type: bot.ArgString, Positional: true, Required: true, Description: "name of the service or escalation policy to page"},
+		{Name: "urgency", Type: bot.ArgEnum, Positional: true, Required: true, Values: clients.EventSeverities()},
+		{Name: "message", Type: bot.ArgString, Positional: true, Required: true, Description: "summary of the incident"},
+	}
+}
+
+func (p *pagerdutyPage) Examples() []string {
+	return []string{"page compute high nova api is down in eu-de-1"}
+}
+
+func (p *pagerdutyPage) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	args, err := bot.ParseArguments(p, msg.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	target := args.String("target")
+	routingKey, ok := p.cfg.RoutingKey(target)
+	if !ok {
+		return nil, fmt.Errorf("unknown target '%s'. known targets: %s", target, strings.Join(p.cfg.RoutingKeyNames(), ", "))
+	}
+
+	severity, err := clients.EventSeverity(args.String("urgency"))
+	if err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("%s (paged by %s via Slack)", args.String("message"), p.userName(msg.User))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dedupKey, err := p.pagerdutyClient.TriggerEvent(ctx, routingKey, severity, summary, "slack")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to page")
+	}
+	level.Info(p.logger).Log("msg", "paged", "target", target, "userID", msg.User, "dedupKey", dedupKey)
+
+	threadTimestamp := bot.ThreadTimestamp(msg)
+	if _, _, err := p.slackClient.PostMessage(
+		msg.Channel,
+		slack.MsgOptionText(fmt.Sprintf("Paging *%s* (%s) :rotating_light:", target, severity), false),
+		slack.MsgOptionTS(threadTimestamp),
+	); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := p.pagerdutyClient.WatchIncident(context.Background(), dedupKey, clients.PostIncidentUpdates(p.slackClient, msg.Channel, threadTimestamp)); err != nil {
+			level.Info(p.logger).Log("msg", "stopped watching paged incident", "err", err.Error())
+		}
+	}()
+
+	// The status is posted by the incident watcher.
+	return nil, nil
+}
+
+func (p *pagerdutyPage) userName(userID string) string {
+	if usr, err := p.slackClient.GetUserByID(userID); err == nil {
+		return usr.Name
+	}
+	return userID
+}
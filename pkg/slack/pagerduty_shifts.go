@@ -0,0 +1,261 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+const (
+	// nextOnCallLookahead is the time range in which the next shift is searched.
+	nextOnCallLookahead = 14 * 24 * time.Hour
+
+	nextOnCallUsage = "`next on call [$schedule]`"
+)
+
+func init() {
+	bot.RegisterCommand(func() bot.Command {
+		return &nextOnCallCommand{}
+	})
+	bot.RegisterCommand(func() bot.Command {
+		return &myShiftsCommand{}
+	})
+}
+
+// shiftCommand holds the configuration and clients shared by the commands listing on-call shifts.
+type shiftCommand struct {
+	cfg             *config.PagerdutyConfig
+	pagerdutyClient *clients.PagerdutyClient
+	slackClient     *clients.SlackClient
+}
+
+func (s *shiftCommand) Init() error {
+	cfg, err := config.NewPagerdutyConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	s.cfg = cfg
+
+	pdCli, err := clients.NewPagerdutyClientFromEnv()
+	if err != nil {
+		return err
+	}
+	s.pagerdutyClient = pdCli
+
+	sCli, err := clients.NewSlackBotClientFromEnv()
+	if err != nil {
+		return err
+	}
+	s.slackClient = sCli
+
+	return nil
+}
+
+func (s *shiftCommand) IsDisabled() bool {
+	return false
+}
+
+func (s *shiftCommand) RequiredUserRole() auth.UserRole {
+	return auth.UserRoles.Base
+}
+
+type nextOnCallCommand struct {
+	shiftCommand
+}
+
+func (n *nextOnCallCommand) Describe() string {
+	return "Show the next on-call shift [of $schedule]."
+}
+
+func (n *nextOnCallCommand) Keywords() []string {
+	return []string{"next on call", "next on-call", "next oncall"}
+}
+
+func (n *nextOnCallCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	scheduleNames := n.cfg.SchedulesForChannel(msg.Channel)
+	if s := strings.TrimSpace(util.TrimAnyPrefix(n.Keywords(), msg.Text)); s != "" {
+		scheduleNames = []string{s}
+	}
+
+	if len(scheduleNames) == 0 {
+		return nil, &bot.UsageError{Err: errors.New("no on-call schedules configured for this channel"), Usage: nextOnCallUsage}
+	}
+
+	now := time.Now().UTC()
+	table := util.NewTable("Next on call:", "Schedule", "On call")
+	for _, scheduleName := range scheduleNames {
+		schedule, err := n.pagerdutyClient.GetSchedule(ctx, scheduleName)
+		if errors.Is(err, clients.ErrNotFound) {
+			return nil, &bot.UsageError{Err: fmt.Errorf("no schedule named '%s' found", scheduleName), Usage: nextOnCallUsage}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get schedule '%s'", scheduleName)
+		}
+
+		onCalls, err := n.pagerdutyClient.ListOnCallShifts(ctx, []string{schedule.ID}, nil, now, now.Add(nextOnCallLookahead))
+		if err != nil {
+			return nil, err
+		}
+
+		next := nextShift(onCalls, schedule.ID, now)
+		if next == nil {
+			table.AddRow(schedule.Name, fmt.Sprintf("no shift within the next %d days", int(nextOnCallLookahead.Hours()/24)))
+			continue
+		}
+
+		table.AddRow(schedule.Name, fmt.Sprintf("%s %s",
+			n.slackClient.UserMentionByEmail(next.User.Email, clients.UserName(next.User)),
+			formatShiftTime(next),
+		))
+	}
+
+	return table.Respond(n.slackClient, msg.Channel, bot.ThreadTimestamp(msg))
+}
+
+type myShiftsCommand struct {
+	shiftCommand
+}
+
+func (m *myShiftsCommand) Describe() string {
+	return "List your upcoming on-call shifts [week|month]."
+}
+
+func (m *myShiftsCommand) Keywords() []string {
+	return []string{"my shifts", "my on-call shifts", "my oncall shifts"}
+}
+
+func (m *myShiftsCommand) ReplyMode() bot.ReplyMode {
+	return bot.ReplyEphemeral
+}
+
+func (m *myShiftsCommand) Arguments() []bot.Argument {
+	return []bot.Argument{
+		{Name: "period", Type: bot.ArgEnum, Positional: true, Values: []string{"week", "month"}, Default: "week", Description: "how far to look ahead"},
+	}
+}
+
+func (m *myShiftsCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	args, err := bot.ParseArguments(m, msg.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	period, until := args.String("period"), time.Now().UTC().AddDate(0, 0, 7)
+	if period == "month" {
+		until = time.Now().UTC().AddDate(0, 1, 0)
+	}
+
+	slackUser, err := m.slackClient.GetUserByID(msg.User)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find slack user")
+	}
+
+	user, err := m.pagerdutyClient.GetUserByEmail(ctx, slackUser.Profile.Email)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find pagerduty user")
+	}
+
+	onCalls, err := m.pagerdutyClient.ListOnCallShifts(ctx, nil, []string{user.ID}, time.Now().UTC(), until)
+	if err != nil {
+		return nil, err
+	}
+
+	shifts := uniqueShifts(onCalls)
+	if len(shifts) == 0 {
+		return &slack.Msg{Text: fmt.Sprintf("You have no on-call shifts within the next %s :palm_tree:", period)}, nil
+	}
+
+	// Ephemeral replies can neither be paginated nor uploaded as file, so only the first page of shifts is shown.
+	table := util.NewTable(fmt.Sprintf("Your on-call shifts within the next %s:", period), "Schedule", "Shift")
+	if len(shifts) > table.PageSize {
+		table.Title = fmt.Sprintf("Your next %d of %d on-call shifts within the next %s:", table.PageSize, len(shifts), period)
+		shifts = shifts[:table.PageSize]
+	}
+	for _, s := range shifts {
+		name := s.Schedule.Summary
+		if name == "" {
+			name = fmt.Sprintf("%s (level %d)", s.EscalationPolicy.Summary, s.EscalationLevel)
+		}
+		table.AddRow(name, formatShiftTime(&s))
+	}
+
+	return table.ToSlackMessage(0), nil
+}
+
+// nextShift returns the first shift of the schedule starting after the given time or nil.
+func nextShift(onCalls []pagerduty.OnCall, scheduleID string, after time.Time) *pagerduty.OnCall {
+	var res *pagerduty.OnCall
+	for idx, onCall := range onCalls {
+		start := util.StringToTimestamp(onCall.Start)
+		if onCall.Schedule.ID != scheduleID || !start.After(after) {
+			continue
+		}
+		if res == nil || start.Before(util.StringToTimestamp(res.Start)) {
+			res = &onCalls[idx]
+		}
+	}
+	return res
+}
+
+// uniqueShifts removes on-call entries for the same schedule and time range, which are returned once per escalation level,
+// and sorts them by start time.
+func uniqueShifts(onCalls []pagerduty.OnCall) []pagerduty.OnCall {
+	seen := make(map[string]bool)
+	res := make([]pagerduty.OnCall, 0)
+	for _, onCall := range onCalls {
+		key := strings.Join([]string{onCall.Schedule.ID, onCall.EscalationPolicy.ID, onCall.Start, onCall.End}, "/")
+		if onCall.Schedule.ID != "" {
+			key = strings.Join([]string{onCall.Schedule.ID, onCall.Start, onCall.End}, "/")
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		res = append(res, onCall)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return util.StringToTimestamp(res[i].Start).Before(util.StringToTimestamp(res[j].Start))
+	})
+	return res
+}
+
+func formatShiftTime(onCall *pagerduty.OnCall) string {
+	if onCall.Start == "" {
+		return "(permanently on-call)"
+	}
+	return fmt.Sprintf("from %s until %s",
+		util.HumanizeTimestamp(util.StringToTimestamp(onCall.Start).UTC()),
+		util.HumanizeTimestamp(util.StringToTimestamp(onCall.End).UTC()),
+	)
+}
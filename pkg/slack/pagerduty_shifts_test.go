@@ -0,0 +1,114 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tableFields returns the texts of the section fields of a table rendered as Slack message.
+func tableFields(msg *slack.Msg) []string {
+	res := make([]string, 0)
+	for _, block := range msg.Blocks.BlockSet {
+		if section, ok := block.(*slack.SectionBlock); ok {
+			for _, field := range section.Fields {
+				res = append(res, field.Text)
+			}
+		}
+	}
+	return res
+}
+
+func TestNextOnCall(t *testing.T) {
+	fakeSlack, slackClient := newTestSlackClient(t)
+	fakeSlack.AddUser(slack.User{ID: "UALICE", Name: "alice", Profile: slack.UserProfile{Email: "alice@example.com"}})
+
+	fakePagerduty, pagerdutyClient := newTestPagerdutyClient(t)
+	alice := fakePagerduty.AddUser("Alice", "alice@example.com")
+	fakePagerduty.AddSchedule("compute", alice)
+	fakePagerduty.AddSchedule("storage")
+
+	n := &nextOnCallCommand{shiftCommand{
+		cfg:             &config.PagerdutyConfig{ChannelSchedules: map[string][]string{"CCOMPUTE": {"compute", "storage"}}},
+		pagerdutyClient: pagerdutyClient,
+		slackClient:     slackClient,
+	}}
+
+	res, err := n.Run(context.Background(), &slack.Msg{Channel: "CCOMPUTE", Text: "next on call"})
+	require.NoError(t, err, "there should be no error listing the next shifts of the channel's schedules")
+	fields := tableFields(res)
+	if assert.Len(t, fields, 6, "there should be a row per schedule") {
+		assert.Equal(t, "compute", fields[2])
+		assert.Contains(t, fields[3], "<@UALICE> from ", "the next shift of the schedule should be shown")
+		assert.Equal(t, "storage", fields[4])
+		assert.Equal(t, "no shift within the next 14 days", fields[5])
+	}
+
+	res, err = n.Run(context.Background(), &slack.Msg{Channel: "COTHER", Text: "next on call compute"})
+	require.NoError(t, err, "there should be no error listing the next shift of the given schedule")
+	assert.Len(t, tableFields(res), 4, "only the given schedule should be listed")
+
+	var usageErr *bot.UsageError
+	_, err = n.Run(context.Background(), &slack.Msg{Channel: "COTHER", Text: "next on call"})
+	assert.ErrorAs(t, err, &usageErr, "a channel without schedules should be a usage error")
+	_, err = n.Run(context.Background(), &slack.Msg{Channel: "COTHER", Text: "next on call network"})
+	assert.ErrorAs(t, err, &usageErr, "an unknown schedule should be a usage error")
+}
+
+func TestMyShifts(t *testing.T) {
+	fakeSlack, slackClient := newTestSlackClient(t)
+	fakeSlack.AddUser(slack.User{ID: "UALICE", Name: "alice", Profile: slack.UserProfile{Email: "alice@example.com"}})
+	fakeSlack.AddUser(slack.User{ID: "UBOB", Name: "bob", Profile: slack.UserProfile{Email: "bob@example.com"}})
+
+	fakePagerduty, pagerdutyClient := newTestPagerdutyClient(t)
+	alice := fakePagerduty.AddUser("Alice", "alice@example.com")
+	fakePagerduty.AddUser("Bob", "bob@example.com")
+	fakePagerduty.AddSchedule("compute", alice)
+
+	m := &myShiftsCommand{shiftCommand{pagerdutyClient: pagerdutyClient, slackClient: slackClient}}
+
+	// The fake puts Alice on call for every day of the requested range.
+	res, err := m.Run(context.Background(), &slack.Msg{Channel: "CCOMPUTE", User: "UALICE", Text: "my shifts"})
+	require.NoError(t, err, "there should be no error listing the shifts of the week")
+	assert.Equal(t, "Your on-call shifts within the next week:", res.Text)
+	fields := tableFields(res)
+	require.Greater(t, len(fields), 2, "the shifts should be listed")
+	assert.Equal(t, "compute", fields[2])
+
+	// A month exceeds a page, which cannot be paginated in an ephemeral reply, so only the first page is shown.
+	res, err = m.Run(context.Background(), &slack.Msg{Channel: "CCOMPUTE", User: "UALICE", Text: "my shifts month"})
+	require.NoError(t, err, "there should be no error listing the shifts of the month")
+	assert.Contains(t, res.Text, "Your next 20 of ", "the title should tell that not all shifts are shown")
+	assert.Len(t, tableFields(res), 2*21, "only one page of shifts should be shown")
+	for _, block := range res.Blocks.BlockSet {
+		assert.NotEqual(t, slack.MBTAction, block.BlockType(), "there should be no pagination buttons")
+	}
+
+	res, err = m.Run(context.Background(), &slack.Msg{Channel: "CCOMPUTE", User: "UBOB", Text: "my shifts"})
+	require.NoError(t, err, "there should be no error listing no shifts")
+	assert.Equal(t, "You have no on-call shifts within the next week :palm_tree:", res.Text)
+}
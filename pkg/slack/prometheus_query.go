@@ -0,0 +1,185 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/util"
+)
+
+const (
+	queryRateLimit = 10
+	queryMaxRange  = 7 * 24 * time.Hour
+	chartFilename  = "query.png"
+)
+
+func init() {
+	bot.RegisterCommand(func() bot.Command {
+		return &prometheusQueryCommand{}
+	})
+}
+
+type prometheusQueryCommand struct {
+	prometheusClient *clients.PrometheusClient
+	slackClient      *clients.SlackClient
+}
+
+func (p *prometheusQueryCommand) Init() error {
+	promCli, err := clients.NewPrometheusClientFromEnv()
+	if err != nil {
+		return err
+	}
+	p.prometheusClient = promCli
+
+	sCli, err := clients.NewSlackBotClientFromEnv()
+	if err != nil {
+		return err
+	}
+	p.slackClient = sCli
+	return nil
+}
+
+func (p *prometheusQueryCommand) IsDisabled() bool {
+	return false
+}
+
+func (p *prometheusQueryCommand) Describe() string {
+	return "Run a PromQL query in a region: query $promql in $region [range=1h]."
+}
+
+func (p *prometheusQueryCommand) Keywords() []string {
+	return []string{"query"}
+}
+
+func (p *prometheusQueryCommand) RequiredUserRole() auth.UserRole {
+	return auth.UserRoles.Base
+}
+
+// IsCaseSensitive returns true as metric names and label values are case sensitive.
+func (p *prometheusQueryCommand) IsCaseSensitive() bool {
+	return true
+}
+
+// RateLimit returns the number of queries per minute to protect Prometheus from expensive queries.
+func (p *prometheusQueryCommand) RateLimit() int {
+	return queryRateLimit
+}
+
+func (p *prometheusQueryCommand) Arguments() []bot.Argument {
+	return []bot.Argument{
+		{Name: "promql", Type: bot.ArgString, Positional: true, Required: true, Description: "the PromQL expression"},
+		{Name: "region", Type: bot.ArgCluster, Prefix: "in", Required: true, Description: "the region of the Prometheus"},
+		{Name: "range", Type: bot.ArgDuration, Description: "renders a graph of the given range ending now instead of the current values"},
+	}
+}
+
+func (p *prometheusQueryCommand) Examples() []string {
+	return []string{
+		`query up{job="nova-api"} in eu-de-1`,
+		`query sum(rate(http_requests_total{status=~"5.."}[5m])) by (service) in eu-de-1 range=6h`,
+	}
+}
+
+// Run responds with a table of the current values or uploads a graph of the range to the thread.
+func (p *prometheusQueryCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	args, err := bot.ParseArguments(p, msg.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	query, region := args.String("promql"), args.String("region")
+	if !args.IsSet("range") {
+		return p.queryInstant(ctx, msg, query, region)
+	}
+
+	queryRange := args.Duration("range")
+	if queryRange <= 0 || queryRange > queryMaxRange {
+		return nil, fmt.Errorf("range must be between 1s and %s", formatRange(queryMaxRange))
+	}
+	return p.queryRange(ctx, msg, query, region, queryRange)
+}
+
+func (p *prometheusQueryCommand) queryInstant(ctx context.Context, msg *slack.Msg, query, region string) (*slack.Msg, error) {
+	series, err := p.prometheusClient.Query(ctx, region, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if len(series) == 0 {
+		return &slack.Msg{Text: fmt.Sprintf("No data for `%s` in %s", query, region)}, nil
+	}
+
+	table := util.NewTable(fmt.Sprintf("`%s` in %s", query, region), "Series", "Value")
+	for _, s := range series {
+		table.AddRow(s.Name(), strconv.FormatFloat(s.Samples[0].Value, 'g', -1, 64))
+	}
+	return table.Respond(p.slackClient, msg.Channel, bot.ThreadTimestamp(msg))
+}
+
+func (p *prometheusQueryCommand) queryRange(ctx context.Context, msg *slack.Msg, query, region string, queryRange time.Duration) (*slack.Msg, error) {
+	series, err := p.prometheusClient.QueryRange(ctx, region, query, time.Now(), queryRange)
+	if err != nil {
+		return nil, err
+	}
+
+	title := fmt.Sprintf("%s in %s (last %s)", query, region, formatRange(queryRange))
+	chart := &util.LineChart{Title: title, Series: make([]util.ChartSeries, 0, len(series))}
+	for _, s := range series {
+		cs := util.ChartSeries{Name: s.Name(), Points: make([]util.ChartPoint, 0, len(s.Samples))}
+		for _, sample := range s.Samples {
+			cs.Points = append(cs.Points, util.ChartPoint{Time: sample.Time, Value: sample.Value})
+		}
+		chart.Series = append(chart.Series, cs)
+	}
+
+	img, err := chart.RenderPNG()
+	if err != nil {
+		if len(series) == 0 {
+			return &slack.Msg{Text: fmt.Sprintf("No data for `%s` in %s", query, region)}, nil
+		}
+		return nil, errors.Wrap(err, "failed to render graph")
+	}
+
+	// The graph is uploaded to the thread, so there is no response.
+	_, err = p.slackClient.UploadFile(slack.FileUploadParameters{
+		Title:           title,
+		Filename:        chartFilename,
+		Filetype:        "png",
+		Reader:          bytes.NewReader(img),
+		Channels:        []string{msg.Channel},
+		ThreadTimestamp: bot.ThreadTimestamp(msg),
+	})
+	return nil, err
+}
+
+// formatRange formats the range without trailing zero units, e.g. 6h instead of 6h0m0s.
+func formatRange(d time.Duration) string {
+	return strings.TrimSuffix(strings.TrimSuffix(d.String(), "0s"), "0m")
+}
@@ -0,0 +1,55 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusQueryWithComparison(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.FormValue("query"))
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"up","job":"nova-api"},"value":[1570000000,"1"]}]}}`))
+	}))
+	defer server.Close()
+
+	_, slackClient := newTestSlackClient(t)
+	p := &prometheusQueryCommand{
+		prometheusClient: clients.NewPrometheusClient(&config.PrometheusConfig{APIURL: server.URL + "/{region}"}, log.NewNopLogger()),
+		slackClient:      slackClient,
+	}
+
+	res, err := p.Run(context.Background(), &slack.Msg{Text: `query up{job="nova-api"} > 0 in eu-de-1`})
+	require.NoError(t, err, "there should be no error running the query")
+	assert.Equal(t, "`up{job=\"nova-api\"} > 0` in eu-de-1", res.Text)
+	assert.Equal(t, []string{`up{job="nova-api"} > 0`}, queries, "the comparison should be passed to Prometheus")
+}
@@ -0,0 +1,96 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/config"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+)
+
+func init() {
+	bot.RegisterCommand(func() bot.Command {
+		return &runbookCommand{}
+	})
+}
+
+type runbookCommand struct {
+	runbooks *config.RunbookCatalog
+}
+
+func (r *runbookCommand) Init() error {
+	runbooks, err := config.NewRunbookCatalogFromEnv()
+	if err != nil {
+		return err
+	}
+	r.runbooks = runbooks
+	return nil
+}
+
+func (r *runbookCommand) IsDisabled() bool {
+	return false
+}
+
+func (r *runbookCommand) Describe() string {
+	return "Show the runbook of an alert: runbook $alertname."
+}
+
+func (r *runbookCommand) Keywords() []string {
+	return []string{"runbook"}
+}
+
+func (r *runbookCommand) RequiredUserRole() auth.UserRole {
+	return auth.UserRoles.Base
+}
+
+// IsCaseSensitive returns true to respond with the alertname as given.
+func (r *runbookCommand) IsCaseSensitive() bool {
+	return true
+}
+
+func (r *runbookCommand) Arguments() []bot.Argument {
+	return []bot.Argument{
+		{Name: "alertname", Type: bot.ArgString, Positional: true, Required: true, Description: "the name of the alert"},
+	}
+}
+
+func (r *runbookCommand) Examples() []string {
+	return []string{"runbook OpenstackLbaasApiFlapping"}
+}
+
+// Run responds with the runbook of the alertname from the runbook catalog.
+func (r *runbookCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	args, err := bot.ParseArguments(r, msg.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	alertname := args.String("alertname")
+	runbook, ok := r.runbooks.Find(map[string]string{"alertname": alertname}, "")
+	if !ok {
+		return &slack.Msg{Text: fmt.Sprintf("No runbook found for %s", alertname)}, nil
+	}
+	return models.NewRunbookMessage(alertname, runbook), nil
+}
@@ -0,0 +1,89 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package slack
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/sapcc/pulsar/pkg/auth"
+	"github.com/sapcc/pulsar/pkg/bot"
+	"github.com/sapcc/pulsar/pkg/clients"
+	"github.com/sapcc/pulsar/pkg/slack/models"
+)
+
+func init() {
+	bot.RegisterCommand(func() bot.Command {
+		return &silenceCommand{}
+	})
+}
+
+type silenceCommand struct{}
+
+func (s *silenceCommand) Init() error {
+	return nil
+}
+
+func (s *silenceCommand) IsDisabled() bool {
+	return false
+}
+
+func (s *silenceCommand) Describe() string {
+	return "Silence alerts in the Alertmanager of their region: silence $matchers."
+}
+
+func (s *silenceCommand) Keywords() []string {
+	return []string{"silence"}
+}
+
+func (s *silenceCommand) RequiredUserRole() auth.UserRole {
+	return auth.UserRoles.Base
+}
+
+// IsCaseSensitive returns true as label values are case sensitive.
+func (s *silenceCommand) IsCaseSensitive() bool {
+	return true
+}
+
+func (s *silenceCommand) Arguments() []bot.Argument {
+	return []bot.Argument{
+		{Name: "matchers", Type: bot.ArgString, Positional: true, Required: true, Description: "label matchers like alertname=Foo region=eu-de-1. the region selects the alertmanager"},
+	}
+}
+
+func (s *silenceCommand) Examples() []string {
+	return []string{"silence alertname=OpenstackLbaasApiFlapping region=eu-de-1"}
+}
+
+// Run responds with a button opening the silence dialog, as Slack only opens dialogs in response to interactions.
+func (s *silenceCommand) Run(ctx context.Context, msg *slack.Msg) (*slack.Msg, error) {
+	args, err := bot.ParseArguments(s, msg.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	matchers, err := clients.ParseMatchers(strings.Join(strings.Fields(args.String("matchers")), "\n"))
+	if err != nil {
+		return nil, &bot.UsageError{Err: err, Usage: bot.Usage(s)}
+	}
+
+	return models.NewSilencePrompt(matchers), nil
+}
@@ -0,0 +1,281 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	chartWidth        = 1000
+	chartHeight       = 420
+	chartMarginLeft   = 80
+	chartMarginRight  = 20
+	chartMarginTop    = 30
+	chartMarginBottom = 30
+	chartTicks        = 5
+	chartLegendLine   = 16
+	chartLegendSize   = 10
+	chartMaxLabel     = 130
+)
+
+var (
+	chartBackground = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	chartGrid       = color.RGBA{R: 225, G: 225, B: 225, A: 255}
+	chartText       = color.RGBA{R: 50, G: 50, B: 50, A: 255}
+
+	// chartPalette is used for the series in order.
+	chartPalette = []color.RGBA{
+		{R: 31, G: 119, B: 180, A: 255},
+		{R: 255, G: 127, B: 14, A: 255},
+		{R: 44, G: 160, B: 44, A: 255},
+		{R: 214, G: 39, B: 40, A: 255},
+		{R: 148, G: 103, B: 189, A: 255},
+		{R: 140, G: 86, B: 75, A: 255},
+		{R: 227, G: 119, B: 194, A: 255},
+		{R: 127, G: 127, B: 127, A: 255},
+		{R: 188, G: 189, B: 34, A: 255},
+		{R: 23, G: 190, B: 207, A: 255},
+	}
+)
+
+// ChartPoint is a value at a point in time.
+type ChartPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// ChartSeries is a named line of a LineChart.
+type ChartSeries struct {
+	Name   string
+	Points []ChartPoint
+}
+
+// LineChart renders time series as PNG. Series beyond the size of the palette are drawn but only the first ones are listed in the legend.
+type LineChart struct {
+	Title  string
+	Series []ChartSeries
+}
+
+// RenderPNG renders the chart as PNG or returns an error if there is nothing to draw.
+func (c *LineChart) RenderPNG() ([]byte, error) {
+	minTime, maxTime, minValue, maxValue, ok := c.bounds()
+	if !ok {
+		return nil, fmt.Errorf("no data points to draw")
+	}
+	if maxValue == minValue {
+		minValue, maxValue = minValue-1, maxValue+1
+	}
+	if !maxTime.After(minTime) {
+		maxTime = minTime.Add(time.Minute)
+	}
+
+	legendLines := len(c.Series)
+	if legendLines > chartLegendSize {
+		legendLines = chartLegendSize + 1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight+legendLines*chartLegendLine))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: chartBackground}, image.Point{}, draw.Src)
+
+	plot := image.Rect(chartMarginLeft, chartMarginTop, chartWidth-chartMarginRight, chartHeight-chartMarginBottom)
+	toX := func(t time.Time) int {
+		return plot.Min.X + int(float64(plot.Dx())*float64(t.Sub(minTime))/float64(maxTime.Sub(minTime)))
+	}
+	toY := func(v float64) int {
+		return plot.Max.Y - int(float64(plot.Dy())*(v-minValue)/(maxValue-minValue))
+	}
+
+	drawText(img, c.Title, chartMarginLeft, chartMarginTop-10, chartText)
+
+	// Grid and axis labels.
+	timeFormat := "15:04"
+	if maxTime.Sub(minTime) > 24*time.Hour {
+		timeFormat = "01-02 15:04"
+	}
+	for i := 0; i <= chartTicks; i++ {
+		v := minValue + (maxValue-minValue)*float64(i)/chartTicks
+		y := toY(v)
+		drawLine(img, plot.Min.X, y, plot.Max.X, y, chartGrid)
+		label := formatChartValue(v)
+		drawText(img, label, plot.Min.X-8-textWidth(label), y+4, chartText)
+
+		t := minTime.Add(time.Duration(float64(maxTime.Sub(minTime)) * float64(i) / chartTicks))
+		x := toX(t)
+		drawLine(img, x, plot.Min.Y, x, plot.Max.Y, chartGrid)
+		label = t.UTC().Format(timeFormat)
+		drawText(img, label, x-textWidth(label)/2, plot.Max.Y+18, chartText)
+	}
+
+	// Lines are interrupted where samples are missing.
+	step := c.minStep()
+	for idx, s := range c.Series {
+		clr := chartPalette[idx%len(chartPalette)]
+		var prev *ChartPoint
+		for i := range s.Points {
+			p := &s.Points[i]
+			if !isFinite(p.Value) {
+				prev = nil
+				continue
+			}
+			if prev != nil && p.Time.Sub(prev.Time) <= 2*step {
+				drawThickLine(img, toX(prev.Time), toY(prev.Value), toX(p.Time), toY(p.Value), clr)
+			} else {
+				drawThickLine(img, toX(p.Time), toY(p.Value), toX(p.Time), toY(p.Value), clr)
+			}
+			prev = p
+		}
+	}
+
+	// Legend.
+	for idx, s := range c.Series {
+		y := chartHeight + idx*chartLegendLine + 4
+		if idx == chartLegendSize {
+			drawText(img, fmt.Sprintf("... and %d more", len(c.Series)-chartLegendSize), chartMarginLeft, y+10, chartText)
+			break
+		}
+		draw.Draw(img, image.Rect(chartMarginLeft, y, chartMarginLeft+10, y+10), &image.Uniform{C: chartPalette[idx%len(chartPalette)]}, image.Point{}, draw.Src)
+		drawText(img, truncateLabel(s.Name), chartMarginLeft+16, y+10, chartText)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// bounds returns the range of the times and finite values of all series and whether there is any point.
+func (c *LineChart) bounds() (minTime, maxTime time.Time, minValue, maxValue float64, ok bool) {
+	minValue, maxValue = math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			if !isFinite(p.Value) {
+				continue
+			}
+			if !ok || p.Time.Before(minTime) {
+				minTime = p.Time
+			}
+			if !ok || p.Time.After(maxTime) {
+				maxTime = p.Time
+			}
+			minValue, maxValue = math.Min(minValue, p.Value), math.Max(maxValue, p.Value)
+			ok = true
+		}
+	}
+	return
+}
+
+// minStep returns the smallest distance between two points of a series.
+func (c *LineChart) minStep() time.Duration {
+	step := time.Duration(math.MaxInt64)
+	for _, s := range c.Series {
+		for i := 1; i < len(s.Points); i++ {
+			if d := s.Points[i].Time.Sub(s.Points[i-1].Time); d > 0 && d < step {
+				step = d
+			}
+		}
+	}
+	return step
+}
+
+// formatChartValue formats the value with up to 4 significant digits.
+func formatChartValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// truncateLabel shortens the label to chartMaxLabel characters.
+func truncateLabel(label string) string {
+	if r := []rune(label); len(r) > chartMaxLabel {
+		return string(r[:chartMaxLabel-3]) + "..."
+	}
+	return label
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func textWidth(text string) int {
+	return font.MeasureString(basicfont.Face7x13, text).Ceil()
+}
+
+func drawText(img draw.Image, text string, x, y int, clr color.Color) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(clr),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// drawThickLine draws a line which is 2 pixels wide.
+func drawThickLine(img *image.RGBA, x0, y0, x1, y1 int, clr color.Color) {
+	drawLine(img, x0, y0, x1, y1, clr)
+	drawLine(img, x0, y0+1, x1, y1+1, clr)
+}
+
+// drawLine draws a line using Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, clr color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	e := dx + dy
+	for {
+		img.Set(x0, y0, clr)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
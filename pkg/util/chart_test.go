@@ -0,0 +1,57 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package util
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineChartRenderPNG(t *testing.T) {
+	start := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	chart := &LineChart{Title: "up in eu-de-1"}
+	for i := 0; i < 3; i++ {
+		s := ChartSeries{Name: "series"}
+		for j := 0; j < 60; j++ {
+			v := float64(i * j)
+			if j == 30 {
+				v = math.NaN()
+			}
+			s.Points = append(s.Points, ChartPoint{Time: start.Add(time.Duration(j) * time.Minute), Value: v})
+		}
+		chart.Series = append(chart.Series, s)
+	}
+
+	data, err := chart.RenderPNG()
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err, "the chart should be a valid PNG")
+	assert.Equal(t, chartWidth, img.Bounds().Dx())
+	assert.Equal(t, chartHeight+3*chartLegendLine, img.Bounds().Dy(), "the legend should list every series")
+
+	_, err = (&LineChart{Series: []ChartSeries{{Name: "empty", Points: []ChartPoint{{Time: start, Value: math.NaN()}}}}}).RenderPNG()
+	assert.Error(t, err, "charts without data should be rejected")
+}
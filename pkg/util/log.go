@@ -20,15 +20,24 @@
 package util
 
 import (
+	"io"
 	"os"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 )
 
+// logOutput is the writer of all loggers created afterwards.
+var logOutput io.Writer = os.Stdout
+
+// SetLogOutput sets the writer of all loggers created afterwards, e.g. to keep stdout free for the output of a command.
+func SetLogOutput(w io.Writer) {
+	logOutput = w
+}
+
 // NewLogger returns a new Logger with log level configured.
 func NewLogger() log.Logger {
-	logger := log.NewLogfmtLogger(os.Stdout)
+	logger := log.NewLogfmtLogger(logOutput)
 	logger = log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
 
 	logLevel := level.AllowInfo()
@@ -21,25 +21,116 @@ package util
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
-const clusterRegex = `[\w-]*\w{2}-\w{2}-\d|admin|staging`
+const (
+	workloadRegex    = `(?P<kind>deployments?|deploy|statefulsets?|sts|daemonsets?|ds)\s+(?P<namespace>[a-z0-9-]+)/(?P<name>[a-z0-9.-]+)`
+	userMentionRegex = `<@(?P<userID>[a-zA-Z0-9]+)(\|[^>]*)?>`
+	replicasRegex    = `(?:--|—)replicas[\s=]+(?P<replicas>\d+)`
+)
+
+// workloadKinds maps the supported kubectl resource names and aliases to the workload kind.
+var workloadKinds = map[string]string{
+	"deployment":   "deployment",
+	"deployments":  "deployment",
+	"deploy":       "deployment",
+	"statefulset":  "statefulset",
+	"statefulsets": "statefulset",
+	"sts":          "statefulset",
+	"daemonset":    "daemonset",
+	"daemonsets":   "daemonset",
+	"ds":           "daemonset",
+}
+
+// Workload identifies a Kubernetes workload.
+type Workload struct {
+	Kind,
+	Namespace,
+	Name string
+}
+
+// String returns the workload in the form kind namespace/name.
+func (w *Workload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+// ParseWorkloadFromString returns the first workload of the form `<kind> <namespace>/<name>` found in the given string or an error.
+func ParseWorkloadFromString(theString string) (*Workload, error) {
+	r := regexp.MustCompile(workloadRegex)
+	match := r.FindStringSubmatch(NormalizeString(theString))
+	if match == nil {
+		return nil, errors.New("no workload of the form '<kind> <namespace>/<name>' found in input")
+	}
+
+	return &Workload{
+		Kind:      workloadKinds[match[r.SubexpIndex("kind")]],
+		Namespace: match[r.SubexpIndex("namespace")],
+		Name:      match[r.SubexpIndex("name")],
+	}, nil
+}
+
+// ParseReplicasFromString returns the number of replicas given via `--replicas N` in the string or an error.
+func ParseReplicasFromString(theString string) (int, error) {
+	r := regexp.MustCompile(replicasRegex)
+	match := r.FindStringSubmatch(theString)
+	if match == nil {
+		return 0, errors.New("no replicas of the form '--replicas N' found in input")
+	}
+
+	return strconv.Atoi(match[r.SubexpIndex("replicas")])
+}
 
-// ParseClusterFromString returns the cluster names found in the given string or an error.
-func ParseClusterFromString(theString string) ([]string, error) {
-	r, err := regexp.Compile(clusterRegex)
-	if err != nil {
-		return nil, err
+// ParseUserMentionsFromString returns the IDs of the Slack users mentioned in the given string.
+func ParseUserMentionsFromString(theString string) []string {
+	r := regexp.MustCompile(userMentionRegex)
+	userIDs := make([]string, 0)
+	for _, match := range r.FindAllStringSubmatch(theString, -1) {
+		// User IDs are upper case but the text of messages is normalized to lower case.
+		userIDs = append(userIDs, strings.ToUpper(match[r.SubexpIndex("userID")]))
 	}
+	return RemoveDuplicates(userIDs)
+}
 
-	clusters := r.FindAllString(theString, -1)
-	clusters = NormalizeStringSlice(clusters)
-	clusters = RemoveDuplicates(clusters)
+// ParseColumnsFromString parses column aligned text, like the output of kubectl, into header and rows.
+// The columns are determined by the start of the header names, so values may contain spaces.
+func ParseColumnsFromString(theString string) ([]string, [][]string) {
+	lines := strings.Split(strings.TrimRight(theString, "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, nil
+	}
 
-	if len(clusters) == 0 {
-		return nil, errors.New("no cluster found in input")
+	starts := make([]int, 0)
+	for idx, r := range lines[0] {
+		if r != ' ' && (idx == 0 || lines[0][idx-1] == ' ') {
+			starts = append(starts, idx)
+		}
 	}
 
-	return clusters, nil
+	split := func(line string) []string {
+		values := make([]string, 0, len(starts))
+		for idx, start := range starts {
+			if start >= len(line) {
+				values = append(values, "")
+				continue
+			}
+			end := len(line)
+			if idx+1 < len(starts) && starts[idx+1] < end {
+				end = starts[idx+1]
+			}
+			values = append(values, strings.TrimSpace(line[start:end]))
+		}
+		return values
+	}
+
+	rows := make([][]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) != "" {
+			rows = append(rows, split(line))
+		}
+	}
+	return split(lines[0]), rows
 }
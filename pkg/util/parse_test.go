@@ -24,16 +24,58 @@ import (
 	"testing"
 )
 
-func TestParseClusterFromString(t *testing.T) {
+func TestParseWorkloadFromString(t *testing.T) {
+	stimuli := map[string]Workload{
+		"restart deployment kube-system/coredns in eu-de-1":             {Kind: "deployment", Namespace: "kube-system", Name: "coredns"},
+		"scale sts monsoon3/nova-api --replicas 3 in staging":           {Kind: "statefulset", Namespace: "monsoon3", Name: "nova-api"},
+		"rollout status DaemonSet kube-system/kube-proxy.v2 in ap-sa-1": {Kind: "daemonset", Namespace: "kube-system", Name: "kube-proxy.v2"},
+	}
+
+	for inputString, expected := range stimuli {
+		got, err := ParseWorkloadFromString(inputString)
+		assert.NoError(t, err, "there should be no error parsing the workload from the string")
+		assert.Equal(t, expected, *got, "result and expected should be equal")
+	}
+
+	_, err := ParseWorkloadFromString("restart pod kube-system/coredns in eu-de-1")
+	assert.Error(t, err, "there should be an error parsing an unsupported kind")
+}
+
+func TestParseReplicasFromString(t *testing.T) {
+	stimuli := map[string]int{
+		"scale deployment kube-system/coredns --replicas 3 in eu-de-1": 3,
+		"scale deployment kube-system/coredns --replicas=0 in eu-de-1": 0,
+	}
+
+	for inputString, expected := range stimuli {
+		got, err := ParseReplicasFromString(inputString)
+		assert.NoError(t, err, "there should be no error parsing the replicas from the string")
+		assert.Equal(t, expected, got, "result and expected should be equal")
+	}
+}
+
+func TestParseUserMentionsFromString(t *testing.T) {
 	stimuli := map[string][]string{
-		"[CRITICAL - 2] [LA-BR-1] ManyPodsNotReadyOnNode - Less then 75% of pods ready on node":                         {"la-br-1"},
-		"[RESOLVED] [LA-BR-1] OpenstackNovaDatapathDown - Datapath nova metadata is down":                               {"la-br-1"},
-		"[CRITICAL] [S-LA-BR-1] InfrastructurePrometheusFederationFailed - Infrastructure Prometheus s-la-br-1 is down": {"s-la-br-1"},
+		"cover <@u012ab3cd> my schedule 8h":               {"U012AB3CD"},
+		"<@U012AB3CD|jane> and <@w0123> and <@u012ab3cd>": {"U012AB3CD", "W0123"},
+		"no mention": {},
 	}
 
 	for inputString, expected := range stimuli {
-		got, err := ParseClusterFromString(inputString)
-		assert.NoError(t, err, "there should be no error parsing cluster names from the string")
-		assert.EqualValues(t, expected, got, "result and expected should have equal values")
+		assert.EqualValues(t, expected, ParseUserMentionsFromString(inputString), "result and expected should have equal values")
 	}
 }
+
+func TestParseColumnsFromString(t *testing.T) {
+	output := `NAME      STATUS   ROLES    OS-IMAGE
+node001   Ready    <none>   Ubuntu 20.04 LTS
+node002   NotReady <none>
+`
+
+	header, rows := ParseColumnsFromString(output)
+	assert.Equal(t, []string{"NAME", "STATUS", "ROLES", "OS-IMAGE"}, header, "header should be parsed")
+	assert.Equal(t, [][]string{
+		{"node001", "Ready", "<none>", "Ubuntu 20.04 LTS"},
+		{"node002", "NotReady", "<none>", ""},
+	}, rows, "rows should be parsed")
+}
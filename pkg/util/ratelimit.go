@@ -0,0 +1,94 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket rate limiter with a bucket per key.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	mtx       sync.Mutex
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing up to n events per interval and key.
+// Up to n events may happen at once.
+func NewRateLimiter(n int, interval time.Duration) *RateLimiter {
+	return &RateLimiter{
+		rate:    float64(n) / interval.Seconds(),
+		burst:   float64(n),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token for the key and returns false if there is none left.
+func (r *RateLimiter) Allow(key string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := r.now()
+	r.prune(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{tokens: r.burst, last: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * r.rate
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune removes the buckets which are full again, as they are equal to new ones.
+// It runs at most once per time needed to refill a bucket. The caller must hold the lock.
+func (r *RateLimiter) prune(now time.Time) {
+	if now.Sub(r.lastPrune).Seconds()*r.rate < r.burst {
+		return
+	}
+	r.lastPrune = now
+
+	for key, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*r.rate >= r.burst {
+			delete(r.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimiter(2, time.Minute)
+	r.now = func() time.Time { return now }
+
+	assert.True(t, r.Allow("U1"), "the first event should be allowed")
+	assert.True(t, r.Allow("U1"), "the burst should be allowed")
+	assert.False(t, r.Allow("U1"), "events exceeding the burst should be rejected")
+	assert.True(t, r.Allow("U2"), "keys should have separate buckets")
+
+	now = now.Add(30 * time.Second)
+	assert.True(t, r.Allow("U1"), "a token should be refilled after 30s")
+	assert.False(t, r.Allow("U1"), "only one token should be refilled after 30s")
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimiter(2, time.Minute)
+	r.now = func() time.Time { return now }
+
+	assert.True(t, r.Allow("U1"))
+	assert.True(t, r.Allow("U2"))
+	assert.True(t, r.Allow("U2"))
+
+	now = now.Add(45 * time.Second)
+	assert.True(t, r.Allow("U3"))
+	assert.Len(t, r.buckets, 3, "buckets should not be pruned before they could be full again")
+
+	now = now.Add(16 * time.Second)
+	assert.True(t, r.Allow("U4"))
+	assert.Len(t, r.buckets, 2, "full buckets should be removed")
+	assert.NotContains(t, r.buckets, "U1", "idle buckets should be removed")
+	assert.NotContains(t, r.buckets, "U2", "buckets refilled completely should be removed")
+	assert.Contains(t, r.buckets, "U3", "buckets which are not full yet should be kept")
+	assert.True(t, r.Allow("U3"))
+	assert.False(t, r.Allow("U3"), "the tokens of kept buckets should not be reset")
+}
@@ -19,23 +19,345 @@
 
 package util
 
-import "github.com/nlopes/slack"
-
-// ToSlackTable create a 2 column slack table using the TextBlockObjects.
-// The input shall look like:
-// [][]string{
-//   {"headerColumn1", "headerColumn2"},
-//	 {"valueLine1", "valueLine2"},
-// }
-func ToSlackTable(values [][]string) *slack.Msg {
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ActionIDTablePage is the action id of the buttons paginating a table.
+	ActionIDTablePage = "tablePageID"
+
+	tableDefaultPageSize = 20
+	tableExpiry          = 24 * time.Hour
+	tableValueSeparator  = "|"
+	tableFilename        = "table.txt"
+
+	// Limits of Slack's Block Kit.
+	maxSectionFields     = 10
+	maxFieldTextLength   = 2000
+	maxSectionTextLength = 3000
+	// fieldColumns is the number of columns section fields are rendered in.
+	fieldColumns = 2
+)
+
+var (
+	tables    = make(map[string]*Table)
+	tablesMtx sync.Mutex
+)
+
+// FileUploader uploads files to Slack.
+type FileUploader interface {
+	UploadFile(params slack.FileUploadParameters) (*slack.File, error)
+}
+
+// Table is rendered as a Slack message. Tables with two columns are rendered using section fields, wider ones as monospace text.
+// Tables exceeding Slack's limits are uploaded as file and tables with more rows than the page size are paginated.
+type Table struct {
+	// Title is shown above the table.
+	Title string
+	// Header contains the names of the columns.
+	Header []string
+	// Rows contains the values. Each row should have as many values as the header.
+	Rows [][]string
+	// PageSize is the number of rows per page.
+	PageSize int
+
+	id      string
+	expires time.Time
+}
+
+// NewTable returns a new Table with the given title and column names.
+func NewTable(title string, header ...string) *Table {
+	return &Table{
+		Title:    title,
+		Header:   header,
+		Rows:     make([][]string, 0),
+		PageSize: tableDefaultPageSize,
+	}
+}
+
+// AddRow adds a row with the given values.
+func (t *Table) AddRow(values ...string) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Pages returns the number of pages.
+func (t *Table) Pages() int {
+	pageSize := t.pageSize()
+	pages := (len(t.Rows) + pageSize - 1) / pageSize
+	if pages == 0 {
+		return 1
+	}
+	return pages
+}
+
+// Respond returns the first page of the table as message.
+// If the table exceeds Slack's limits it is uploaded as file to the channel and thread instead and no message is returned.
+func (t *Table) Respond(uploader FileUploader, channelID, threadTimestamp string) (*slack.Msg, error) {
+	if t.isOversized() {
+		_, err := uploader.UploadFile(slack.FileUploadParameters{
+			Title:           t.Title,
+			Filename:        tableFilename,
+			Filetype:        "text",
+			Content:         t.ToText(),
+			Channels:        []string{channelID},
+			ThreadTimestamp: threadTimestamp,
+		})
+		return nil, err
+	}
+
+	// Remember the table to serve further pages.
+	if t.Pages() > 1 {
+		registerTable(t)
+	}
+	return t.ToSlackMessage(0), nil
+}
+
+// ToSlackMessage renders the given page starting from 0.
+func (t *Table) ToSlackMessage(page int) *slack.Msg {
+	if page < 0 {
+		page = 0
+	}
+	if page >= t.Pages() {
+		page = t.Pages() - 1
+	}
+
+	rows := t.pageRows(page)
+
+	title := t.Title
+	if t.Pages() > 1 {
+		title += fmt.Sprintf(" (page %d/%d)", page+1, t.Pages())
+	}
+
+	blocks := make([]slack.Block, 0)
+	if title != "" {
+		blocks = append(blocks, newMarkdownSection(title))
+	}
+
+	if t.columns() == fieldColumns {
+		blocks = append(blocks, t.toFieldSections(rows)...)
+	} else {
+		blocks = append(blocks, newMarkdownSection(fmt.Sprintf("```\n%s\n```", t.toMonospace(rows))))
+	}
+
+	if actions := t.pageActions(page); actions != nil {
+		blocks = append(blocks, actions)
+	}
+
+	blockMsg := slack.NewBlockMessage(blocks...)
+	blockMsg.Msg.Text = t.Title
+	return &blockMsg.Msg
+}
+
+// ToText renders all rows as monospace text.
+func (t *Table) ToText() string {
+	text := t.toMonospace(t.Rows)
+	if t.Title != "" {
+		text = t.Title + "\n\n" + text
+	}
+	return text
+}
+
+// TablePageFromValue returns the page of a previously sent table referenced by the value of a pagination button.
+func TablePageFromValue(value string) (*slack.Msg, error) {
+	id, pageString, ok := strings.Cut(value, tableValueSeparator)
+	if !ok {
+		return nil, errors.New("invalid table page")
+	}
+
+	page, err := strconv.Atoi(pageString)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid table page")
+	}
+
+	tablesMtx.Lock()
+	defer tablesMtx.Unlock()
+	removeExpiredTables()
+
+	t, ok := tables[id]
+	if !ok {
+		return nil, errors.New("the table expired. please run the command again")
+	}
+	return t.ToSlackMessage(page), nil
+}
+
+func (t *Table) columns() int {
+	columns := len(t.Header)
+	for _, row := range t.Rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	return columns
+}
+
+func (t *Table) pageSize() int {
+	if t.PageSize <= 0 {
+		return tableDefaultPageSize
+	}
+	return t.PageSize
+}
+
+func (t *Table) pageRows(page int) [][]string {
+	start := page * t.pageSize()
+	end := start + t.pageSize()
+	if end > len(t.Rows) {
+		end = len(t.Rows)
+	}
+	if start > end {
+		start = end
+	}
+	return t.Rows[start:end]
+}
+
+// isOversized returns true if any page exceeds the limits of a section.
+func (t *Table) isOversized() bool {
+	for page := 0; page < t.Pages(); page++ {
+		rows := t.pageRows(page)
+		if t.columns() != fieldColumns {
+			if len(t.toMonospace(rows))+len("```\n\n```") > maxSectionTextLength {
+				return true
+			}
+			continue
+		}
+
+		for _, row := range append([][]string{t.Header}, rows...) {
+			for _, value := range row {
+				if len(value) > maxFieldTextLength {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// toFieldSections renders the header and rows as section fields. A section holds up to 10 fields.
+func (t *Table) toFieldSections(rows [][]string) []slack.Block {
 	fields := make([]*slack.TextBlockObject, 0)
-	for _, v := range values {
-		for _, itm := range v {
-			fields = append(fields, slack.NewTextBlockObject(slack.PlainTextType, itm, true, false))
+	if len(t.Header) > 0 {
+		for _, name := range padRow(t.Header, t.columns()) {
+			fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*", name), false, false))
+		}
+	}
+	for _, row := range rows {
+		for _, value := range padRow(row, t.columns()) {
+			// Empty fields are rejected by Slack.
+			if value == "" {
+				value = " "
+			}
+			fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, value, false, false))
+		}
+	}
+
+	blocks := make([]slack.Block, 0)
+	for start := 0; start < len(fields); start += maxSectionFields {
+		end := start + maxSectionFields
+		if end > len(fields) {
+			end = len(fields)
+		}
+		blocks = append(blocks, slack.NewSectionBlock(nil, fields[start:end], nil))
+	}
+	return blocks
+}
+
+// toMonospace renders the header and given rows as text with aligned columns.
+func (t *Table) toMonospace(rows [][]string) string {
+	columns := t.columns()
+	allRows := rows
+	if len(t.Header) > 0 {
+		allRows = append([][]string{t.Header}, rows...)
+	}
+
+	widths := make([]int, columns)
+	for _, row := range allRows {
+		for idx, value := range row {
+			if l := utf8.RuneCountInString(value); l > widths[idx] {
+				widths[idx] = l
+			}
 		}
 	}
 
-	blocks := slack.Blocks{}
-	blocks.BlockSet = append(blocks.BlockSet, slack.NewSectionBlock(nil, fields, nil))
-	return &slack.Msg{Blocks: blocks}
+	lines := make([]string, 0, len(allRows))
+	for _, row := range allRows {
+		values := make([]string, 0, columns)
+		for idx, value := range padRow(row, columns) {
+			values = append(values, value+strings.Repeat(" ", widths[idx]-utf8.RuneCountInString(value)))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(values, "  "), " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *Table) pageActions(page int) *slack.ActionBlock {
+	if t.id == "" || t.Pages() <= 1 {
+		return nil
+	}
+
+	actions := slack.NewActionBlock("")
+	if page > 0 {
+		actions.Elements.ElementSet = append(actions.Elements.ElementSet, t.newPageButton("Previous page", page-1))
+	}
+	if page < t.Pages()-1 {
+		actions.Elements.ElementSet = append(actions.Elements.ElementSet, t.newPageButton("Next page", page+1))
+	}
+	return actions
+}
+
+func (t *Table) newPageButton(text string, page int) *slack.ButtonBlockElement {
+	return slack.NewButtonBlockElement(
+		ActionIDTablePage,
+		fmt.Sprintf("%s%s%d", t.id, tableValueSeparator, page),
+		slack.NewTextBlockObject(slack.PlainTextType, text, true, false),
+	)
+}
+
+func registerTable(t *Table) {
+	tablesMtx.Lock()
+	defer tablesMtx.Unlock()
+	removeExpiredTables()
+
+	t.id = newTableID()
+	t.expires = time.Now().Add(tableExpiry)
+	tables[t.id] = t
+}
+
+// removeExpiredTables must be called with tablesMtx held.
+func removeExpiredTables() {
+	now := time.Now()
+	for id, t := range tables {
+		if now.After(t.expires) {
+			delete(tables, id)
+		}
+	}
+}
+
+func newTableID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+func newMarkdownSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// padRow returns the row with as many values as columns.
+func padRow(row []string, columns int) []string {
+	if len(row) >= columns {
+		return row
+	}
+	return append(append(make([]string, 0, columns), row...), make([]string, columns-len(row))...)
 }
@@ -0,0 +1,89 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUploader struct {
+	params []slack.FileUploadParameters
+}
+
+func (f *fakeUploader) UploadFile(params slack.FileUploadParameters) (*slack.File, error) {
+	f.params = append(f.params, params)
+	return &slack.File{}, nil
+}
+
+func TestTablePagination(t *testing.T) {
+	table := NewTable("Nodes", "Name", "Status", "Age")
+	table.PageSize = 2
+	for _, name := range []string{"node001", "node002", "node003"} {
+		table.AddRow(name, "Ready", "10d")
+	}
+
+	msg, err := table.Respond(&fakeUploader{}, "C123", "")
+	assert.NoError(t, err, "there should be no error responding with the table")
+	assert.Equal(t, 2, table.Pages(), "there should be 2 pages")
+	// Title, monospace text and actions.
+	assert.Len(t, msg.Blocks.BlockSet, 3, "the first page should have 3 blocks")
+
+	actions := msg.Blocks.BlockSet[2].(*slack.ActionBlock)
+	next := actions.Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	assert.Equal(t, ActionIDTablePage, next.ActionID)
+
+	page, err := TablePageFromValue(next.Value)
+	assert.NoError(t, err, "there should be no error getting the next page")
+	text := page.Blocks.BlockSet[1].(*slack.SectionBlock).Text.Text
+	assert.Contains(t, text, "node003", "the second page should contain the last row")
+	assert.NotContains(t, text, "node001", "the second page should not contain the first row")
+
+	_, err = TablePageFromValue("unknown|1")
+	assert.Error(t, err, "unknown tables should be rejected")
+}
+
+func TestTableFields(t *testing.T) {
+	table := NewTable("On call", "Level", "Users")
+	for i := 0; i < 6; i++ {
+		table.AddRow("Level 1", "<@U123>")
+	}
+
+	msg := table.ToSlackMessage(0)
+	// Title and 14 fields in 2 sections.
+	assert.Len(t, msg.Blocks.BlockSet, 3, "fields should be split into sections of 10")
+	assert.Len(t, msg.Blocks.BlockSet[1].(*slack.SectionBlock).Fields, 10)
+	assert.Len(t, msg.Blocks.BlockSet[2].(*slack.SectionBlock).Fields, 4)
+}
+
+func TestTableOversizedIsUploaded(t *testing.T) {
+	table := NewTable("Large", "A", "B", "C")
+	table.AddRow(strings.Repeat("x", maxSectionTextLength), "y", "z")
+
+	uploader := &fakeUploader{}
+	msg, err := table.Respond(uploader, "C123", "")
+	assert.NoError(t, err, "there should be no error uploading the table")
+	assert.Nil(t, msg, "no message should be returned for uploaded tables")
+	assert.Len(t, uploader.params, 1, "the table should be uploaded")
+	assert.Equal(t, []string{"C123"}, uploader.params[0].Channels)
+}
@@ -0,0 +1,40 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditDistance(t *testing.T) {
+	stimuli := map[[2]string]int{
+		{"list incidents", "list incidents"}: 0,
+		{"list incidnets", "list incidents"}: 2,
+		{"lsit nodes", "list nodes"}:         2,
+		{"", "help"}:                         4,
+		{"page", "pagerduty"}:                5,
+	}
+
+	for input, expected := range stimuli {
+		assert.Equal(t, expected, EditDistance(input[0], input[1]), "distance between '%s' and '%s'", input[0], input[1])
+	}
+}
@@ -21,6 +21,9 @@ package util
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -59,3 +62,69 @@ func TimeEndOfDay() time.Time {
 	now := time.Now().UTC()
 	return time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 00, 00, now.Location())
 }
+
+// timeLayouts are the layouts accepted by ParseTime in addition to the relative formats.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var durationRegex = regexp.MustCompile(`^(\d+)(w|d)$`)
+
+// ParseTime parses the given string as time in UTC relative to now.
+// Supported are `now`, `15:04`, `today 15:04`, `tomorrow 15:04` and the absolute timeLayouts.
+func ParseTime(theString string, now time.Time) (time.Time, error) {
+	theString = NormalizeString(theString)
+	now = now.UTC()
+
+	if theString == "now" {
+		return now, nil
+	}
+
+	day := now
+	switch {
+	case strings.HasPrefix(theString, "today "):
+		theString = strings.TrimPrefix(theString, "today ")
+	case strings.HasPrefix(theString, "tomorrow "):
+		theString = strings.TrimPrefix(theString, "tomorrow ")
+		day = now.AddDate(0, 0, 1)
+	}
+
+	if t, err := time.Parse("15:04", theString); err == nil {
+		return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, strings.ToUpper(theString)); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("cannot parse time '%s'. use 'now', '15:04', 'tomorrow 15:04' or '2006-01-02 15:04'", theString)
+}
+
+// ParseDuration parses the given string as duration.
+// In addition to the units supported by time.ParseDuration days (d) and weeks (w) are supported.
+func ParseDuration(theString string) (time.Duration, error) {
+	theString = NormalizeString(theString)
+	if match := durationRegex.FindStringSubmatch(theString); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, err
+		}
+
+		d := time.Duration(n) * 24 * time.Hour
+		if match[2] == "w" {
+			d *= 7
+		}
+		return d, nil
+	}
+
+	d, err := time.ParseDuration(theString)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse duration '%s'. use e.g. '30m', '8h' or '2d'", theString)
+	}
+	return d, nil
+}
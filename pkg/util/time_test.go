@@ -0,0 +1,66 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2023, 3, 14, 10, 30, 0, 0, time.UTC)
+
+	stimuli := map[string]time.Time{
+		"now":                       now,
+		"18:00":                     time.Date(2023, 3, 14, 18, 0, 0, 0, time.UTC),
+		"today 08:15":               time.Date(2023, 3, 14, 8, 15, 0, 0, time.UTC),
+		"tomorrow 08:00":            time.Date(2023, 3, 15, 8, 0, 0, 0, time.UTC),
+		"2023-03-20 09:00":          time.Date(2023, 3, 20, 9, 0, 0, 0, time.UTC),
+		"2023-03-20":                time.Date(2023, 3, 20, 0, 0, 0, 0, time.UTC),
+		"2023-03-20t09:00:00+01:00": time.Date(2023, 3, 20, 8, 0, 0, 0, time.UTC),
+	}
+
+	for inputString, expected := range stimuli {
+		got, err := ParseTime(inputString, now)
+		assert.NoError(t, err, "there should be no error parsing the time: %s", inputString)
+		assert.Equal(t, expected, got, "result and expected should be equal")
+	}
+
+	_, err := ParseTime("next friday", now)
+	assert.Error(t, err, "there should be an error parsing an unsupported time")
+}
+
+func TestParseDuration(t *testing.T) {
+	stimuli := map[string]time.Duration{
+		"30m":   30 * time.Minute,
+		"8h":    8 * time.Hour,
+		"2d":    48 * time.Hour,
+		"1w":    7 * 24 * time.Hour,
+		"1h30m": 90 * time.Minute,
+	}
+
+	for inputString, expected := range stimuli {
+		got, err := ParseDuration(inputString)
+		assert.NoError(t, err, "there should be no error parsing the duration: %s", inputString)
+		assert.Equal(t, expected, got, "result and expected should be equal")
+	}
+}